@@ -7,25 +7,24 @@ import (
 	"final-design/configServer/plugins"
 	"final-design/configServer/service"
 	"final-design/configServer/transport"
+	"final-design/pkg/bootstrap"
 	"final-design/pkg/discover"
+	"final-design/pkg/shutdown"
 	"flag"
-	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 )
 
 func main() {
 
 	// 获取命令行参数
 	var (
-		servicePort = flag.String("service.port", "10085", "service port")
-		serviceHost = flag.String("service.host", "127.0.0.1", "service host")
-		consulPort  = flag.String("consul.port", "8500", "consul port")
-		consulHost  = flag.String("consul.host", "127.0.0.1", "consul host")
-		serviceName = flag.String("service.name", "config-service", "service name")
-		configName  = "configService"
+		servicePort = flag.String("service.port", bootstrap.HttpConfig.Port, "service port")
+		serviceHost = flag.String("service.host", bootstrap.HttpConfig.Host, "service host")
+		consulPort  = flag.String("consul.port", bootstrap.DiscoverConfig.Port, "consul port")
+		consulHost  = flag.String("consul.host", bootstrap.DiscoverConfig.Host, "consul host")
+		serviceName = flag.String("service.name", bootstrap.DiscoverConfig.ServiceName, "service name")
+		configName  = bootstrap.DiscoverConfig.InstanceId
 	)
 	flag.Parse()
 
@@ -54,6 +53,7 @@ func main() {
 
 	instanceId := configName
 
+	server := &http.Server{Addr: ":" + *servicePort, Handler: r}
 	//http server
 	go func() {
 
@@ -64,18 +64,11 @@ func main() {
 			// 注册失败，服务启动失败
 			os.Exit(-1)
 		}
-		handler := r
-		errChan <- http.ListenAndServe(":"+*servicePort, handler)
+		errChan <- server.ListenAndServe()
 	}()
 
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errChan <- fmt.Errorf("%s", <-c)
-	}()
-
-	error := <-errChan
-	//服务退出取消注册
-	discoveryClient.DeRegister(instanceId, config.Logger)
-	config.Logger.Println(error)
+	//服务退出取消注册，再等待处理中的请求完成
+	shutdown.New(func() {
+		discoveryClient.DeRegister(instanceId, config.Logger)
+	}).HTTP(server).Wait(errChan)
 }
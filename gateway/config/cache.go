@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	conf "final-design/pkg/config"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// 缓存存储
+const (
+	CacheBackendMemory = "memory" // 进程内LRU，每个网关实例单独缓存
+	CacheBackendRedis  = "redis"  // redis，多个网关实例共享
+)
+
+// 当前生效的缓存配置
+var cacheConfig atomic.Value
+
+// 缓存规则，路径模式同policy.rules(匹配转发后的路径)，methods为空时只缓存GET、HEAD；
+// ttl为缓存秒数，服务返回的max-age更小时使用max-age；tags用于清除缓存；
+// varyHeaders中的请求头不同时分别缓存，默认所有用户共享缓存
+type CacheRule struct {
+	Path        string
+	Methods     []string
+	Ttl         int
+	Tags        []string
+	VaryHeaders []string
+
+	pattern *regexp.Regexp
+}
+
+// 网关响应缓存，backend为空时不缓存；backend和maxEntries修改后需要重启网关
+type CacheConf struct {
+	Backend      string
+	MaxEntries   int    // memory缓存的最大条数
+	KeyPrefix    string // redis key前缀
+	MaxBodyBytes int64  // 请求体和响应体超过该大小时不缓存
+	PurgeDelay   int    // 收到清除通知后，间隔purgeDelay毫秒再清除一次，避免缓存服务还没有更新的数据
+	Rules        []*CacheRule
+}
+
+// 从viper中解析缓存配置并替换当前配置，解析失败时保留原来的配置
+func LoadCacheConfig(v *viper.Viper) error {
+	cacheConf := &CacheConf{}
+	if err := conf.SubOf(v, "cache", cacheConf); err != nil {
+		return err
+	}
+	switch cacheConf.Backend {
+	case "", CacheBackendMemory, CacheBackendRedis:
+	default:
+		return errors.New("unknown cache backend: " + cacheConf.Backend)
+	}
+	if cacheConf.KeyPrefix == "" {
+		cacheConf.KeyPrefix = "gateway:cache:"
+	}
+	if cacheConf.MaxBodyBytes <= 0 {
+		cacheConf.MaxBodyBytes = 1 << 20
+	}
+	for _, rule := range cacheConf.Rules {
+		if rule.Ttl <= 0 {
+			return errors.New("cache ttl must be positive: " + rule.Path)
+		}
+		if len(rule.Methods) == 0 {
+			rule.Methods = []string{http.MethodGet, http.MethodHead}
+		}
+		pattern, err := compilePath(rule.Path)
+		if err != nil {
+			return err
+		}
+		rule.pattern = pattern
+	}
+	cacheConfig.Store(cacheConf)
+	return nil
+}
+
+// 当前生效的缓存配置，没有配置时不缓存
+func CurrentCacheConfig() *CacheConf {
+	if cacheConf, ok := cacheConfig.Load().(*CacheConf); ok {
+		return cacheConf
+	}
+	return &CacheConf{}
+}
+
+// 查找请求对应的缓存规则，没有匹配的规则时返回nil
+func (cacheConf *CacheConf) Match(method, path string) *CacheRule {
+	if cacheConf.Backend == "" {
+		return nil
+	}
+	for _, rule := range cacheConf.Rules {
+		if rule.pattern.MatchString(path) && matchMethod(rule.Methods, method) {
+			return rule
+		}
+	}
+	return nil
+}
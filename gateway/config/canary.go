@@ -0,0 +1,123 @@
+package config
+
+import (
+	"final-design/pkg/common"
+	conf "final-design/pkg/config"
+	"hash/crc32"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+const defaultCanaryHeader = "X-Canary"
+
+// 当前生效的灰度配置
+var canaryConfig atomic.Value
+
+// 一个服务的灰度规则：version为灰度实例的版本(consul中注册的meta.version)，其它实例都是稳定版本。
+// 请求头header为true/false时按请求头选择版本；users中的用户总是访问灰度版本；
+// 其余请求按用户id(没有令牌时按客户端IP)哈希，percent%的请求访问灰度版本，同一用户总是访问同一版本
+type CanaryRule struct {
+	Version string
+	Percent int
+	Users   []string
+}
+
+// 网关灰度配置，services按服务名配置规则，没有规则的服务不区分版本
+type CanaryConf struct {
+	Header   string
+	Services map[string]*CanaryRule
+}
+
+// 一次请求选择的版本，没有灰度规则时为nil
+type CanaryDecision struct {
+	Rule   *CanaryRule
+	Canary bool // 是否访问灰度版本
+}
+
+// 从viper中解析灰度配置并替换当前配置，解析失败时保留原来的配置
+func LoadCanaryConfig(v *viper.Viper) error {
+	canaryConf := &CanaryConf{}
+	if err := conf.SubOf(v, "canary", canaryConf); err != nil {
+		return err
+	}
+	if canaryConf.Header == "" {
+		canaryConf.Header = defaultCanaryHeader
+	}
+	for serviceName, rule := range canaryConf.Services {
+		if rule.Version == "" {
+			delete(canaryConf.Services, serviceName)
+			continue
+		}
+		if rule.Percent < 0 {
+			rule.Percent = 0
+		} else if rule.Percent > 100 {
+			rule.Percent = 100
+		}
+	}
+	canaryConfig.Store(canaryConf)
+	return nil
+}
+
+// 当前生效的灰度配置，没有配置时不区分版本
+func CurrentCanaryConfig() *CanaryConf {
+	if canaryConf, ok := canaryConfig.Load().(*CanaryConf); ok {
+		return canaryConf
+	}
+	return &CanaryConf{Header: defaultCanaryHeader}
+}
+
+// 选择请求访问的版本，key为用户id或客户端IP；选择结果写入header请求头转发给服务
+func (canaryConf *CanaryConf) Decide(serviceName string, r *http.Request, key string) *CanaryDecision {
+	rule, ok := canaryConf.Services[strings.ToLower(serviceName)]
+	if !ok {
+		return nil
+	}
+	decision := &CanaryDecision{Rule: rule}
+	if canary, err := strconv.ParseBool(r.Header.Get(canaryConf.Header)); err == nil {
+		decision.Canary = canary
+	} else if containsAny(rule.Users, []string{key}) {
+		decision.Canary = true
+	} else if rule.Percent > 0 && key != "" {
+		decision.Canary = int(crc32.ChecksumIEEE([]byte(serviceName+":"+key))%100) < rule.Percent
+	}
+	r.Header.Set(canaryConf.Header, strconv.FormatBool(decision.Canary))
+	return decision
+}
+
+// 负载均衡器和异常检测按版本分组，避免灰度和稳定版本的实例列表互相影响
+func (decision *CanaryDecision) Group() string {
+	if decision == nil {
+		return ""
+	}
+	if decision.Canary {
+		return decision.Rule.Version
+	}
+	return "stable"
+}
+
+// 过滤出选择的版本的实例；没有灰度实例时访问稳定版本，没有稳定版本实例时访问全部实例
+func (decision *CanaryDecision) Filter(services []*common.ServiceInstance) []*common.ServiceInstance {
+	if decision == nil {
+		return services
+	}
+	canary := make([]*common.ServiceInstance, 0, len(services))
+	stable := make([]*common.ServiceInstance, 0, len(services))
+	for _, service := range services {
+		if service.Version == decision.Rule.Version {
+			canary = append(canary, service)
+		} else {
+			stable = append(stable, service)
+		}
+	}
+	if decision.Canary && len(canary) > 0 {
+		return canary
+	}
+	if len(stable) > 0 {
+		return stable
+	}
+	return services
+}
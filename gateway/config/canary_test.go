@@ -0,0 +1,267 @@
+package config
+
+import (
+	"final-design/pkg/common"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadCanaryConfig(t *testing.T) {
+	canaryConfig = atomic.Value{}
+	loadTestConfig(t, `
+canary:
+  services:
+    sk-app: {version: v2, percent: 10, users: ["42"]}
+    sk-admin: {version: v3, percent: 150}
+    sk-core: {version: v4, percent: -5}
+    user: {percent: 50}
+`)
+	if err := LoadCanaryConfig(viper.GetViper()); err != nil {
+		t.Fatal(err)
+	}
+	canaryConf := CurrentCanaryConfig()
+	if canaryConf.Header != defaultCanaryHeader {
+		t.Errorf("Header = %q, want %q", canaryConf.Header, defaultCanaryHeader)
+	}
+
+	tests := []struct {
+		service     string
+		wantRule    bool
+		wantPercent int
+	}{
+		{"sk-app", true, 10},
+		{"sk-admin", true, 100},
+		{"sk-core", true, 0},
+		{"user", false, 0}, // 没有灰度版本的规则被忽略
+		{"oauth", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			rule, ok := canaryConf.Services[tt.service]
+			if ok != tt.wantRule {
+				t.Fatalf("rule of %s exists = %v, want %v", tt.service, ok, tt.wantRule)
+			}
+			if ok && rule.Percent != tt.wantPercent {
+				t.Errorf("Percent = %d, want %d", rule.Percent, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestCanaryDecide(t *testing.T) {
+	canaryConf := &CanaryConf{Header: defaultCanaryHeader, Services: map[string]*CanaryRule{
+		"sk-app":   {Version: "v2", Percent: 0, Users: []string{"42"}},
+		"sk-admin": {Version: "v3", Percent: 100},
+	}}
+	tests := []struct {
+		name       string
+		service    string
+		header     string
+		key        string
+		wantNil    bool
+		wantCanary bool
+	}{
+		{"没有灰度规则", "user", "", "1", true, false},
+		{"请求头指定灰度", "sk-app", "true", "1", false, true},
+		{"请求头指定稳定版本", "sk-admin", "false", "1", false, false},
+		{"请求头无法解析时忽略", "sk-admin", "yes please", "1", false, true},
+		{"指定用户", "sk-app", "", "42", false, true},
+		{"比例为0", "sk-app", "", "1", false, false},
+		{"比例为100", "sk-admin", "", "1", false, true},
+		{"没有key时不按比例", "sk-admin", "", "", false, false},
+		{"服务名不区分大小写", "SK-APP", "", "42", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/"+tt.service+"/info", nil)
+			if tt.header != "" {
+				r.Header.Set(defaultCanaryHeader, tt.header)
+			}
+			decision := canaryConf.Decide(tt.service, r, tt.key)
+			if (decision == nil) != tt.wantNil {
+				t.Fatalf("Decide() = %+v, want nil %v", decision, tt.wantNil)
+			}
+			if decision == nil {
+				if r.Header.Get(defaultCanaryHeader) != "" {
+					t.Error("canary header is set for a service without rule")
+				}
+				return
+			}
+			if decision.Canary != tt.wantCanary {
+				t.Errorf("Canary = %v, want %v", decision.Canary, tt.wantCanary)
+			}
+			// 选择结果转发给服务
+			if got := r.Header.Get(defaultCanaryHeader); got != fmt.Sprint(tt.wantCanary) {
+				t.Errorf("forwarded header = %q, want %v", got, tt.wantCanary)
+			}
+		})
+	}
+}
+
+func TestCanaryDecidePercent(t *testing.T) {
+	const users = 10000
+	canaryUsers := make(map[int]map[string]bool)
+	for _, percent := range []int{5, 20, 50} {
+		canaryConf := &CanaryConf{Header: defaultCanaryHeader, Services: map[string]*CanaryRule{
+			"sk-app": {Version: "v2", Percent: percent},
+		}}
+		canaryUsers[percent] = make(map[string]bool)
+		for i := 0; i < users; i++ {
+			key := fmt.Sprint(i)
+			decide := func() bool {
+				r := httptest.NewRequest(http.MethodGet, "/sk-app/sec/info", nil)
+				return canaryConf.Decide("sk-app", r, key).Canary
+			}
+			canary := decide()
+			if decide() != canary {
+				t.Fatalf("user %s switches version between requests", key)
+			}
+			if canary {
+				canaryUsers[percent][key] = true
+			}
+		}
+		if got := float64(len(canaryUsers[percent])) / users * 100; math.Abs(got-float64(percent)) > 2 {
+			t.Errorf("percent %d: %.1f%% users in canary", percent, got)
+		}
+	}
+	// 提高比例时已在灰度中的用户不会切回稳定版本
+	for key := range canaryUsers[5] {
+		if !canaryUsers[20][key] || !canaryUsers[50][key] {
+			t.Fatalf("user %s leaves canary when percent grows", key)
+		}
+	}
+}
+
+func TestCanaryDecisionFilter(t *testing.T) {
+	v1 := &common.ServiceInstance{Host: "10.0.0.1", Port: 1, Version: "v1"}
+	v1b := &common.ServiceInstance{Host: "10.0.0.2", Port: 1}
+	v2 := &common.ServiceInstance{Host: "10.0.0.3", Port: 1, Version: "v2"}
+	rule := &CanaryRule{Version: "v2"}
+
+	tests := []struct {
+		name      string
+		decision  *CanaryDecision
+		services  []*common.ServiceInstance
+		want      []*common.ServiceInstance
+		wantGroup string
+	}{
+		{"没有灰度规则", nil, []*common.ServiceInstance{v1, v2}, []*common.ServiceInstance{v1, v2}, ""},
+		{"灰度版本", &CanaryDecision{Rule: rule, Canary: true}, []*common.ServiceInstance{v1, v1b, v2}, []*common.ServiceInstance{v2}, "v2"},
+		{"稳定版本包括没有版本的实例", &CanaryDecision{Rule: rule}, []*common.ServiceInstance{v1, v1b, v2}, []*common.ServiceInstance{v1, v1b}, "stable"},
+		{"没有灰度实例时访问稳定版本", &CanaryDecision{Rule: rule, Canary: true}, []*common.ServiceInstance{v1}, []*common.ServiceInstance{v1}, "v2"},
+		{"没有稳定实例时访问全部实例", &CanaryDecision{Rule: rule}, []*common.ServiceInstance{v2}, []*common.ServiceInstance{v2}, "stable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.decision.Filter(tt.services)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Filter() = %d instances, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Filter()[%d] = %s, want %s", i, got[i].Address(), tt.want[i].Address())
+				}
+			}
+			if group := tt.decision.Group(); group != tt.wantGroup {
+				t.Errorf("Group() = %q, want %q", group, tt.wantGroup)
+			}
+		})
+	}
+}
+
+// 配置中心重新加载灰度配置后，用户的版本只随比例的变化单向移动，其它配置变化不影响已选择的版本
+func TestCanaryStickyAcrossReload(t *testing.T) {
+	canaryConfig = atomic.Value{}
+	const users = 2000
+	decideAll := func() map[string]bool {
+		canaryConf := CurrentCanaryConfig()
+		canary := make(map[string]bool)
+		for i := 0; i < users; i++ {
+			key := fmt.Sprint(i)
+			r := httptest.NewRequest(http.MethodGet, "/sk-app/sec/info", nil)
+			if canaryConf.Decide("sk-app", r, key).Canary {
+				canary[key] = true
+			}
+		}
+		return canary
+	}
+	reload := func(yaml string) error {
+		return LoadCanaryConfig(newTestViper(t, yaml))
+	}
+
+	if err := reload(`
+canary:
+  services:
+    sk-app: {version: v2, percent: 20}
+`); err != nil {
+		t.Fatal(err)
+	}
+	before := decideAll()
+
+	// 新增其它服务的规则、更换灰度版本号，原有用户的选择不变
+	if err := reload(`
+canary:
+  header: X-Canary
+  services:
+    sk-app: {version: v2.1, percent: 20}
+    sk-admin: {version: v3, percent: 50}
+`); err != nil {
+		t.Fatal(err)
+	}
+	if after := decideAll(); !sameKeys(before, after) {
+		t.Fatalf("%d users in canary before reload, %d after, or the set changed", len(before), len(after))
+	}
+
+	// 提高比例只会把稳定版本的用户移入灰度
+	if err := reload(`
+canary:
+  services:
+    sk-app: {version: v2.1, percent: 60}
+`); err != nil {
+		t.Fatal(err)
+	}
+	raised := decideAll()
+	for key := range before {
+		if !raised[key] {
+			t.Fatalf("user %s leaves canary when percent grows from 20 to 60", key)
+		}
+	}
+
+	// 新配置解析失败时保留原来的配置
+	if err := reload(`canary: broken`); err == nil {
+		t.Fatal("LoadCanaryConfig() accepts an invalid config")
+	}
+	if after := decideAll(); !sameKeys(raised, after) {
+		t.Fatal("users switch version after a failed reload")
+	}
+
+	// 降低比例只会把灰度用户移回稳定版本
+	if err := reload(`
+canary:
+  services:
+    sk-app: {version: v2.1, percent: 20}
+`); err != nil {
+		t.Fatal(err)
+	}
+	if lowered := decideAll(); !sameKeys(before, lowered) {
+		t.Fatal("lowering percent back to 20 does not restore the original canary users")
+	}
+}
+
+func sameKeys(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if !b[key] {
+			return false
+		}
+	}
+	return true
+}
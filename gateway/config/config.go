@@ -15,6 +15,13 @@ const (
 
 var Logger log.Logger
 
+var ReloadConfig ReloadConf
+
+// 配置热更新：每隔interval秒从配置中心重新加载配置，0表示不刷新；路由表、灰度、缓存规则、gRPC代理、熔断和限流配置支持热更新
+type ReloadConf struct {
+	Interval int
+}
+
 func init() {
 	Logger = log.NewLogfmtLogger(os.Stderr)
 	Logger = log.With(Logger, "ts", log.DefaultTimestampUTC)
@@ -28,6 +35,68 @@ func init() {
 	if err := conf.Sub("auth", &AuthPermitConfig); err != nil {
 		Logger.Log("Fail to parse config", err)
 	}
+	if err := conf.Sub("policy", &RoutePolicy); err != nil {
+		Logger.Log("Fail to parse policy", err)
+	}
+	if err := RoutePolicy.Init(AuthPermitConfig.PermitAll); err != nil {
+		Logger.Log("Fail to init policy", err)
+	}
+	if err := conf.Sub("loadBalance", &LoadBalanceConfig); err != nil {
+		Logger.Log("Fail to parse loadBalance", err)
+	}
+	if err := LoadBalanceConfig.Init(); err != nil {
+		Logger.Log("Fail to init loadBalance", err)
+		os.Exit(1)
+	}
+	if err := LoadRouteTable(viper.GetViper()); err != nil {
+		Logger.Log("Fail to parse routeTable", err)
+	}
+	if err := LoadCanaryConfig(viper.GetViper()); err != nil {
+		Logger.Log("Fail to parse canary", err)
+	}
+	if err := LoadCacheConfig(viper.GetViper()); err != nil {
+		Logger.Log("Fail to parse cache", err)
+	}
+	if err := LoadGrpcConfig(viper.GetViper()); err != nil {
+		Logger.Log("Fail to parse grpc", err)
+	}
+	if _, err := LoadHystrixConfig(viper.GetViper()); err != nil {
+		Logger.Log("Fail to parse hystrix", err)
+	}
+	if err := LoadRateLimitConfig(viper.GetViper()); err != nil {
+		Logger.Log("Fail to parse rateLimit", err)
+	}
+	if err := conf.Sub("reload", &ReloadConfig); err != nil {
+		Logger.Log("Fail to parse reload", err)
+	}
+	if err := conf.Sub("jwt", &conf.Jwt); err != nil {
+		Logger.Log("Fail to parse jwt", err)
+	}
+	conf.MustSub("redis", &conf.Redis)
+}
+
+// 配置中心的配置变化后从新配置v中重新解析支持热更新的配置，解析成功的配置整体替换当前配置
+func Reload(v *viper.Viper) {
+	if err := LoadRouteTable(v); err != nil {
+		Logger.Log("Fail to reload routeTable", err)
+	}
+	if err := LoadCanaryConfig(v); err != nil {
+		Logger.Log("Fail to reload canary", err)
+	}
+	if err := LoadCacheConfig(v); err != nil {
+		Logger.Log("Fail to reload cache", err)
+	}
+	if err := LoadGrpcConfig(v); err != nil {
+		Logger.Log("Fail to reload grpc", err)
+	}
+	if changed, err := LoadHystrixConfig(v); err != nil {
+		Logger.Log("Fail to reload hystrix", err)
+	} else if changed {
+		Logger.Log("reload", "hystrix")
+	}
+	if err := LoadRateLimitConfig(v); err != nil {
+		Logger.Log("Fail to reload rateLimit", err)
+	}
 }
 
 func initDefault() {
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func newTestViper(t *testing.T, yaml string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// 热更新从新的viper实例解析配置，不修改全局viper；请求处理中读取的配置整体替换
+func TestReload(t *testing.T) {
+	rateLimitConfig = atomic.Value{}
+	grpcConfig = atomic.Value{}
+	loadTestConfig(t, `
+rateLimit:
+  rules:
+    - {path: /sk-app/**, by: ip, rate: 5, period: 1}
+`)
+	if err := LoadRateLimitConfig(viper.GetViper()); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if rules := CurrentRateLimitConfig().Match("GET", "/sk-app/sec/list"); len(rules) != 1 {
+					t.Errorf("matched %d rules during reload, want 1", len(rules))
+					return
+				}
+			}
+		}()
+	}
+
+	for _, rate := range []int{10, 20, 30} {
+		Reload(newTestViper(t, fmt.Sprintf(`
+rateLimit:
+  rules:
+    - {path: /sk-app/**, by: ip, rate: %d, period: 1}
+grpc:
+  transcodePrefix: /grpc/
+`, rate)))
+		if got := CurrentRateLimitConfig().Rules[0].Rate; got != rate {
+			t.Errorf("rate after reload = %d, want %d", got, rate)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := CurrentGrpcConfig().TranscodePrefix; got != "/grpc" {
+		t.Errorf("grpc transcodePrefix = %q, want %q", got, "/grpc")
+	}
+	if viper.IsSet("grpc") {
+		t.Errorf("global viper changed by reload: %v", viper.AllSettings())
+	}
+
+	// 新配置解析失败时保留原来的配置
+	Reload(newTestViper(t, `
+rateLimit:
+  rules:
+    - {path: /sk-app/**, by: session, rate: 5, period: 1}
+`))
+	if got := CurrentRateLimitConfig().Rules[0].Rate; got != 30 {
+		t.Errorf("rate after invalid reload = %d, want 30", got)
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	conf "final-design/pkg/config"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// 当前生效的gRPC代理配置
+var grpcConfig atomic.Value
+
+// 允许通过网关访问的gRPC服务
+//
+//	name: proto中的服务全名，如pb.UserService
+//	service: 转发到的consul服务名，转发到实例注册的rpcPort
+//	methods: 允许访问的方法，为空时允许全部方法；同一个服务可以按方法配置多条，第一条匹配的生效
+//	transcode: 是否允许通过transcodePrefix使用JSON调用
+//	permitAll/roles/scopes: 访问要求，含义同policy.rules；都不配置时只要求令牌有效
+type GrpcService struct {
+	Name      string
+	Service   string
+	Methods   []string
+	Transcode bool
+	PermitAll bool
+	Roles     []string
+	Scopes    []string
+
+	policy *PolicyRule
+}
+
+// 网关gRPC代理配置：HTTP/2请求(Content-Type为application/grpc)路径为/服务全名/方法名，按services转发；
+// transcodePrefix不为空时，POST transcodePrefix/服务全名/方法名 的JSON请求转换为gRPC调用
+type GrpcConf struct {
+	TranscodePrefix string
+	Services        []*GrpcService
+}
+
+// 从viper中解析gRPC代理配置并替换当前配置，解析失败时保留原来的配置
+func LoadGrpcConfig(v *viper.Viper) error {
+	grpcConf := &GrpcConf{}
+	if err := conf.SubOf(v, "grpc", grpcConf); err != nil {
+		return err
+	}
+	grpcConf.TranscodePrefix = strings.TrimSuffix(grpcConf.TranscodePrefix, "/")
+	for _, grpcService := range grpcConf.Services {
+		if grpcService.Name == "" || grpcService.Service == "" {
+			return errors.New("grpc service name and service are required: " + grpcService.Name)
+		}
+		grpcService.policy = &PolicyRule{Path: "/" + grpcService.Name, PermitAll: grpcService.PermitAll,
+			Roles: grpcService.Roles, Scopes: grpcService.Scopes}
+	}
+	grpcConfig.Store(grpcConf)
+	return nil
+}
+
+// 当前生效的gRPC代理配置，没有配置时不代理gRPC请求
+func CurrentGrpcConfig() *GrpcConf {
+	if grpcConf, ok := grpcConfig.Load().(*GrpcConf); ok {
+		return grpcConf
+	}
+	return &GrpcConf{}
+}
+
+// 解析gRPC请求路径/服务全名/方法名，路径格式不正确时返回false
+func SplitGrpcPath(path string) (service string, method string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// 查找允许访问该方法的配置，没有时返回nil
+func (grpcConf *GrpcConf) Match(service, method string) *GrpcService {
+	for _, grpcService := range grpcConf.Services {
+		if grpcService.Name == service && (len(grpcService.Methods) == 0 || containsAny(grpcService.Methods, []string{method})) {
+			return grpcService
+		}
+	}
+	return nil
+}
+
+// 转发目标，路径为/服务全名/方法名
+func (grpcService *GrpcService) Target(method string) *RouteTarget {
+	return &RouteTarget{Service: grpcService.Service, DestPath: "/" + grpcService.Name + "/" + method, Grpc: true}
+}
+
+// 访问要求
+func (grpcService *GrpcService) Policy() *PolicyRule {
+	return grpcService.policy
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	conf "final-design/pkg/config"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/spf13/viper"
+)
+
+// 当前生效的熔断配置，配置中心的配置变化时整体替换
+var hystrixConfig atomic.Value
+
+// 熔断参数，0表示继承上一级的配置，单位：毫秒
+type CommandConf struct {
+	Timeout                int // 超时时间
+	MaxConcurrentRequests  int // 最大并发请求数
+	ErrorPercentThreshold  int // 错误率达到该百分比时熔断
+	SleepWindow            int // 熔断后经过该时间尝试恢复
+	RequestVolumeThreshold int // 统计窗口内请求数达到该值才计算错误率
+}
+
+// 按路由配置的熔断参数，路径模式同policy.rules
+type HystrixRouteConf struct {
+	Path        string
+	Methods     []string
+	CommandConf `mapstructure:",squash"`
+
+	pattern *regexp.Regexp
+}
+
+// 熔断配置，优先级：routes中第一条匹配的路由 > services中的服务 > default
+type HystrixConf struct {
+	Default  CommandConf
+	Services map[string]CommandConf
+	Routes   []*HystrixRouteConf
+
+	settings map[string]interface{} // 原始配置，用于判断配置是否变化
+}
+
+// 从viper中解析熔断配置并替换当前配置，返回配置是否变化；解析失败时保留原来的配置。
+// 配置变化时清空hystrix已创建的熔断器，新的并发数等参数在下一次请求时生效，熔断统计重新开始
+func LoadHystrixConfig(v *viper.Viper) (bool, error) {
+	sub := v.Sub("hystrix")
+	if sub == nil {
+		return false, errors.New("hystrix config not found")
+	}
+	settings := sub.AllSettings()
+	if current, ok := hystrixConfig.Load().(*HystrixConf); ok && reflect.DeepEqual(current.settings, settings) {
+		return false, nil
+	}
+
+	hystrixConf := &HystrixConf{settings: settings}
+	if err := conf.SubOf(v, "hystrix", hystrixConf); err != nil {
+		return false, err
+	}
+	for _, route := range hystrixConf.Routes {
+		pattern, err := compilePath(route.Path)
+		if err != nil {
+			return false, err
+		}
+		route.pattern = pattern
+	}
+	_, loaded := hystrixConfig.Load().(*HystrixConf)
+	hystrixConfig.Store(hystrixConf)
+	if loaded {
+		hystrix.Flush()
+	}
+	return true, nil
+}
+
+// 当前生效的熔断配置，没有配置时使用hystrix的默认值
+func CurrentHystrixConfig() *HystrixConf {
+	if hystrixConf, ok := hystrixConfig.Load().(*HystrixConf); ok {
+		return hystrixConf
+	}
+	return &HystrixConf{}
+}
+
+// 请求对应的熔断命令名称和参数，匹配路由时命令名称为"服务名 路由路径"，否则为服务名；
+// services的key由viper转为小写
+func (hystrixConf *HystrixConf) Command(method, path, serviceName string) (string, hystrix.CommandConfig) {
+	commandConf := hystrixConf.Default
+	name := serviceName
+	if serviceConf, ok := hystrixConf.Services[strings.ToLower(serviceName)]; ok {
+		commandConf = commandConf.merge(serviceConf)
+	}
+	for _, route := range hystrixConf.Routes {
+		if route.pattern != nil && route.pattern.MatchString(path) && matchMethod(route.Methods, method) {
+			commandConf = commandConf.merge(route.CommandConf)
+			name = serviceName + " " + route.Path
+			break
+		}
+	}
+	return name, hystrix.CommandConfig{
+		Timeout:                commandConf.Timeout,
+		MaxConcurrentRequests:  commandConf.MaxConcurrentRequests,
+		ErrorPercentThreshold:  commandConf.ErrorPercentThreshold,
+		SleepWindow:            commandConf.SleepWindow,
+		RequestVolumeThreshold: commandConf.RequestVolumeThreshold,
+	}
+}
+
+// 用override中非0的参数覆盖当前参数
+func (commandConf CommandConf) merge(override CommandConf) CommandConf {
+	if override.Timeout > 0 {
+		commandConf.Timeout = override.Timeout
+	}
+	if override.MaxConcurrentRequests > 0 {
+		commandConf.MaxConcurrentRequests = override.MaxConcurrentRequests
+	}
+	if override.ErrorPercentThreshold > 0 {
+		commandConf.ErrorPercentThreshold = override.ErrorPercentThreshold
+	}
+	if override.SleepWindow > 0 {
+		commandConf.SleepWindow = override.SleepWindow
+	}
+	if override.RequestVolumeThreshold > 0 {
+		commandConf.RequestVolumeThreshold = override.RequestVolumeThreshold
+	}
+	return commandConf
+}
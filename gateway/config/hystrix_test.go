@@ -0,0 +1,109 @@
+package config
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/spf13/viper"
+)
+
+const testHystrixYaml = `
+hystrix:
+  default:
+    timeout: 1000
+    maxConcurrentRequests: 100
+    errorPercentThreshold: 50
+    sleepWindow: 5000
+    requestVolumeThreshold: 20
+  services:
+    sk-app:
+      timeout: 300
+      maxConcurrentRequests: 500
+  routes:
+    - path: /sk-app/sec/kill
+      methods: [POST]
+      errorPercentThreshold: 25
+    - path: /sk-admin/**
+      timeout: 3000
+`
+
+// 读取yaml配置替换viper的全局配置，测试结束后清空
+func loadTestConfig(t *testing.T, yaml string) {
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+}
+
+func TestHystrixCommand(t *testing.T) {
+	loadTestConfig(t, testHystrixYaml)
+	hystrixConfig = atomic.Value{}
+	if changed, err := LoadHystrixConfig(viper.GetViper()); err != nil || !changed {
+		t.Fatalf("LoadHystrixConfig() = %v, %v", changed, err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		serviceName string
+		wantName    string
+		want        hystrix.CommandConfig
+	}{
+		{"默认配置", "GET", "/user/info", "user", "user",
+			hystrix.CommandConfig{Timeout: 1000, MaxConcurrentRequests: 100, ErrorPercentThreshold: 50, SleepWindow: 5000, RequestVolumeThreshold: 20}},
+		{"服务配置覆盖默认值", "GET", "/sk-app/sec/info", "sk-app", "sk-app",
+			hystrix.CommandConfig{Timeout: 300, MaxConcurrentRequests: 500, ErrorPercentThreshold: 50, SleepWindow: 5000, RequestVolumeThreshold: 20}},
+		{"服务名不区分大小写", "GET", "/SK-APP/sec/info", "SK-APP", "SK-APP",
+			hystrix.CommandConfig{Timeout: 300, MaxConcurrentRequests: 500, ErrorPercentThreshold: 50, SleepWindow: 5000, RequestVolumeThreshold: 20}},
+		{"路由配置覆盖服务配置", "POST", "/sk-app/sec/kill", "sk-app", "sk-app /sk-app/sec/kill",
+			hystrix.CommandConfig{Timeout: 300, MaxConcurrentRequests: 500, ErrorPercentThreshold: 25, SleepWindow: 5000, RequestVolumeThreshold: 20}},
+		{"方法不匹配", "GET", "/sk-app/sec/kill", "sk-app", "sk-app",
+			hystrix.CommandConfig{Timeout: 300, MaxConcurrentRequests: 500, ErrorPercentThreshold: 50, SleepWindow: 5000, RequestVolumeThreshold: 20}},
+		{"通配路由", "DELETE", "/sk-admin/product/1", "sk-admin", "sk-admin /sk-admin/**",
+			hystrix.CommandConfig{Timeout: 3000, MaxConcurrentRequests: 100, ErrorPercentThreshold: 50, SleepWindow: 5000, RequestVolumeThreshold: 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, got := CurrentHystrixConfig().Command(tt.method, tt.path, tt.serviceName)
+			if name != tt.wantName {
+				t.Errorf("Command() name = %q, want %q", name, tt.wantName)
+			}
+			if got != tt.want {
+				t.Errorf("Command() config = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadHystrixConfigReload(t *testing.T) {
+	hystrixConfig = atomic.Value{}
+	tests := []struct {
+		name        string
+		yaml        string
+		wantChanged bool
+		wantErr     bool
+		wantTimeout int
+	}{
+		{"首次加载", testHystrixYaml, true, false, 1000},
+		{"配置不变", testHystrixYaml, false, false, 1000},
+		{"配置变化", strings.Replace(testHystrixYaml, "timeout: 1000", "timeout: 2000", 1), true, false, 2000},
+		{"缺少配置时保留原配置", "other: 1", false, true, 2000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.yaml)
+			changed, err := LoadHystrixConfig(viper.GetViper())
+			if (err != nil) != tt.wantErr || changed != tt.wantChanged {
+				t.Fatalf("LoadHystrixConfig() = %v, %v, want %v, error %v", changed, err, tt.wantChanged, tt.wantErr)
+			}
+			if got := CurrentHystrixConfig().Default.Timeout; got != tt.wantTimeout {
+				t.Errorf("default timeout = %d, want %d", got, tt.wantTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"final-design/pkg/loadbalance"
+	"strings"
+)
+
+var (
+	LoadBalanceConfig LoadBalanceConf
+)
+
+const (
+	defaultHashHeader        = "X-User-Id"
+	defaultMaxRetryBodyBytes = 1 << 20
+	defaultEjectionSeconds   = 30
+)
+
+// 负载均衡配置
+//
+//	strategy: 默认策略，random(按权重随机)、weight_round_robin、least_conn、p2c、consistent_hash
+//	hashHeader: consistent_hash使用的请求头，网关根据令牌中的用户id设置，默认X-User-Id
+//	services: 按服务名单独配置策略，如sk-app: consistent_hash
+//	retry: 失败重试，outlier: 异常实例剔除
+type LoadBalanceConf struct {
+	Strategy   string
+	HashHeader string
+	Services   map[string]string
+	Retry      RetryConf
+	Outlier    OutlierConf
+}
+
+// 实例连接失败或返回5xx时换一个实例重试，只重试GET、HEAD和携带Idempotency-Key请求头的请求
+type RetryConf struct {
+	MaxRetries   int   // 最多重试次数，0表示不重试
+	MaxBodyBytes int64 // 请求体超过该大小时不重试，重试需要在内存中缓存请求体
+}
+
+// 实例连续失败consecutiveFailures次后剔除ejectionSeconds秒，再次剔除时时间递增
+type OutlierConf struct {
+	ConsecutiveFailures int // 0表示不剔除
+	EjectionSeconds     int
+	MaxEjectionPercent  int // 一个服务最多剔除的实例比例
+}
+
+// 服务使用的负载均衡策略，viper读取的map的key都是小写
+func (conf *LoadBalanceConf) StrategyOf(serviceName string) string {
+	if strategy, ok := conf.Services[strings.ToLower(serviceName)]; ok {
+		return strategy
+	}
+	return conf.Strategy
+}
+
+// 校验配置中的策略名称，配置错误时网关启动失败
+func (conf *LoadBalanceConf) Init() error {
+	if conf.HashHeader == "" {
+		conf.HashHeader = defaultHashHeader
+	}
+	if conf.Retry.MaxBodyBytes <= 0 {
+		conf.Retry.MaxBodyBytes = defaultMaxRetryBodyBytes
+	}
+	if conf.Outlier.EjectionSeconds <= 0 {
+		conf.Outlier.EjectionSeconds = defaultEjectionSeconds
+	}
+	if _, err := loadbalance.New(conf.Strategy); err != nil {
+		return err
+	}
+	for _, strategy := range conf.Services {
+		if _, err := loadbalance.New(strategy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"final-design/pb"
+	"regexp"
+	"strings"
+)
+
+var (
+	RoutePolicy Policy
+)
+
+// 路由访问策略，按顺序匹配，第一条匹配的规则生效；没有规则匹配的请求一律拒绝
+type Policy struct {
+	Rules []*PolicyRule
+}
+
+// 访问规则
+//
+//	path: 路径模式，**匹配任意多级路径，*匹配一级路径，如/sk-admin/**
+//	methods: HTTP方法，为空时匹配全部方法
+//	permitAll: 为true时不校验令牌
+//	denyAll: 为true时一律拒绝，用于只供内部服务调用的接口
+//	roles: 用户具有其中任一角色即可访问
+//	scopes: 客户端具有其中任一scope即可访问，用于client_credentials签发的令牌
+//
+// roles和scopes都为空时，只要求令牌有效
+type PolicyRule struct {
+	Path      string
+	Methods   []string
+	PermitAll bool
+	DenyAll   bool
+	Roles     []string
+	Scopes    []string
+
+	pattern *regexp.Regexp
+}
+
+// 编译路径模式，将旧的auth.permitAll配置转换为排在最前的permitAll规则
+func (policy *Policy) Init(permitAll []interface{}) error {
+	rules := make([]*PolicyRule, 0, len(permitAll)+len(policy.Rules))
+	for _, path := range permitAll {
+		if s, ok := path.(string); ok {
+			rules = append(rules, &PolicyRule{Path: s, PermitAll: true})
+		}
+	}
+	rules = append(rules, policy.Rules...)
+
+	for _, rule := range rules {
+		pattern, err := compilePath(rule.Path)
+		if err != nil {
+			return err
+		}
+		rule.pattern = pattern
+	}
+	policy.Rules = rules
+	return nil
+}
+
+// 查找请求对应的规则，没有匹配的规则时返回nil
+func (policy *Policy) Match(method string, path string) *PolicyRule {
+	for _, rule := range policy.Rules {
+		if rule.pattern != nil && rule.pattern.MatchString(path) && rule.matchMethod(method) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (rule *PolicyRule) matchMethod(method string) bool {
+	return matchMethod(rule.Methods, method)
+}
+
+// methods为空时匹配全部方法
+func matchMethod(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据CheckToken返回的令牌信息判断是否有权访问
+func (rule *PolicyRule) IsGranted(resp *pb.CheckTokenResponse) bool {
+	if len(rule.Roles) == 0 && len(rule.Scopes) == 0 {
+		return true
+	}
+	// 用户令牌按角色判断，客户端的scope不能代替用户的角色
+	if !resp.ClientOnly && resp.UserDetails != nil {
+		return containsAny(resp.UserDetails.Authorities, rule.Roles)
+	}
+	return resp.ClientDetails != nil && containsAny(resp.ClientDetails.Scope, rule.Scopes)
+}
+
+func containsAny(values []string, targets []string) bool {
+	for _, target := range targets {
+		for _, value := range values {
+			if value == target {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 路径模式转换为正则表达式，匹配完整路径
+func compilePath(path string) (*regexp.Regexp, error) {
+	parts := strings.Split(path, "**")
+	for i, part := range parts {
+		subParts := strings.Split(part, "*")
+		for j, subPart := range subParts {
+			subParts[j] = regexp.QuoteMeta(subPart)
+		}
+		parts[i] = strings.Join(subParts, "[^/]*")
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
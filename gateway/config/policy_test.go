@@ -0,0 +1,32 @@
+package config
+
+import "testing"
+
+func TestCompilePath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/sk-admin/**", "/sk-admin/product/list", true},
+		{"/sk-admin/**", "/sk-admin/", true},
+		{"/sk-admin/**", "/sk-admin", false},
+		{"/sk-admin/**", "/sk-admin-evil/product", false},
+		{"/user/user/register**", "/user/user/register", true},
+		{"/user/user/register**", "/user/user/register/resend", true},
+		{"/user/*/check", "/user/user/check", true},
+		{"/user/*/check", "/user/a/b/check", false},
+		{"/oauth/token", "/oauth/token", true},
+		{"/oauth/token", "/oauth/token/x", false},
+		{"/a.b/**", "/aXb/c", false}, // 路径中的正则字符按字面匹配
+	}
+	for _, tt := range tests {
+		pattern, err := compilePath(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pattern.MatchString(tt.path); got != tt.want {
+			t.Errorf("compilePath(%q).MatchString(%q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
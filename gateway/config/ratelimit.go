@@ -0,0 +1,119 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	conf "final-design/pkg/config"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// 限流对象
+const (
+	RateLimitByUser   = "user"   // 令牌中的用户id，没有用户时按IP
+	RateLimitByIp     = "ip"     // 客户端IP
+	RateLimitByApiKey = "apikey" // apiKeyHeader请求头中已登记的API key，没有或未登记时按用户，再没有时按IP
+	RateLimitByRoute  = "route"  // 匹配该规则的全部请求共享配额
+)
+
+const defaultApiKeyHeader = "X-Api-Key"
+
+// 当前生效的限流配置
+var rateLimitConfig atomic.Value
+
+// 限流规则，路径模式同policy.rules；每period秒最多rate个请求，允许突发burst个请求(默认等于rate)
+type RateLimitRule struct {
+	Path    string
+	Methods []string
+	By      string
+	Rate    int
+	Period  int
+	Burst   int
+
+	pattern *regexp.Regexp
+}
+
+// 网关限流配置，配额保存在redis中，多个网关实例共享；请求需要满足所有匹配的规则
+type RateLimitConf struct {
+	KeyPrefix    string   // redis key前缀
+	ApiKeyHeader string   // 按apikey限流时读取的请求头
+	ApiKeys      []string // 已登记的API key的sha256(十六进制)，配置中不保存明文
+	Rules        []*RateLimitRule
+
+	apiKeys map[string]bool
+}
+
+// 从viper中解析限流配置并替换当前配置，解析失败时保留原来的配置
+func LoadRateLimitConfig(v *viper.Viper) error {
+	rateLimitConf := &RateLimitConf{}
+	if err := conf.SubOf(v, "rateLimit", rateLimitConf); err != nil {
+		return err
+	}
+	if rateLimitConf.KeyPrefix == "" {
+		rateLimitConf.KeyPrefix = "gateway:ratelimit:"
+	}
+	if rateLimitConf.ApiKeyHeader == "" {
+		rateLimitConf.ApiKeyHeader = defaultApiKeyHeader
+	}
+	rateLimitConf.apiKeys = make(map[string]bool, len(rateLimitConf.ApiKeys))
+	for _, digest := range rateLimitConf.ApiKeys {
+		digest = strings.ToLower(digest)
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			return errors.New("rate limit api key must be a sha256 hex digest: " + digest)
+		}
+		rateLimitConf.apiKeys[digest] = true
+	}
+	for _, rule := range rateLimitConf.Rules {
+		switch rule.By {
+		case RateLimitByUser, RateLimitByIp, RateLimitByApiKey, RateLimitByRoute:
+		default:
+			return errors.New("unknown rate limit type: " + rule.By)
+		}
+		if rule.Rate <= 0 || rule.Period <= 0 {
+			return errors.New("rate limit rate and period must be positive: " + rule.Path)
+		}
+		pattern, err := compilePath(rule.Path)
+		if err != nil {
+			return err
+		}
+		rule.pattern = pattern
+	}
+	rateLimitConfig.Store(rateLimitConf)
+	return nil
+}
+
+// 当前生效的限流配置，没有配置时不限流
+func CurrentRateLimitConfig() *RateLimitConf {
+	if rateLimitConf, ok := rateLimitConfig.Load().(*RateLimitConf); ok {
+		return rateLimitConf
+	}
+	return &RateLimitConf{}
+}
+
+// 请求匹配的全部限流规则
+func (rateLimitConf *RateLimitConf) Match(method, path string) []*RateLimitRule {
+	var rules []*RateLimitRule
+	for _, rule := range rateLimitConf.Rules {
+		if rule.pattern.MatchString(path) && matchMethod(rule.Methods, method) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// 已登记的API key返回其标识(sha256的前16位)；未登记的key可以随意更换，不能作为限流对象
+func (rateLimitConf *RateLimitConf) ApiKeyId(apiKey string) (string, bool) {
+	if apiKey == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	digest := hex.EncodeToString(sum[:])
+	if !rateLimitConf.apiKeys[digest] {
+		return "", false
+	}
+	return digest[:16], true
+}
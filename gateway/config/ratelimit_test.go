@@ -0,0 +1,122 @@
+package config
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		yaml       string
+		wantErr    bool
+		wantPrefix string
+		wantHeader string
+		wantRules  int
+	}{
+		{"默认值", `
+rateLimit:
+  rules:
+    - {path: /sk-app/sec/kill, methods: [POST], by: user, rate: 5, period: 1}
+`, false, "gateway:ratelimit:", "X-Api-Key", 1},
+		{"自定义前缀和请求头", `
+rateLimit:
+  keyPrefix: "gw:rl:"
+  apiKeyHeader: X-Partner-Key
+  rules:
+    - {path: /sk-app/**, by: apikey, rate: 100, period: 60, burst: 20}
+    - {path: /oauth/token, by: ip, rate: 10, period: 60}
+    - {path: /sk-app/sec/info, by: route, rate: 1000, period: 1}
+`, false, "gw:rl:", "X-Partner-Key", 3},
+		{"未知限流对象", `
+rateLimit:
+  rules:
+    - {path: /sk-app/**, by: session, rate: 5, period: 1}
+`, true, "", "", 0},
+		{"速率为0", `
+rateLimit:
+  rules:
+    - {path: /sk-app/**, by: ip, rate: 0, period: 1}
+`, true, "", "", 0},
+		{"缺少周期", `
+rateLimit:
+  rules:
+    - {path: /sk-app/**, by: ip, rate: 5}
+`, true, "", "", 0},
+		{"登记的API key", `
+rateLimit:
+  apiKeys: [19F3DCE1FF021576B4498C55A5AAADF7B1983FCCCF907B72FD4C3F27BDDDC2AD]
+  rules:
+    - {path: /sk-app/**, by: apikey, rate: 100, period: 60}
+`, false, "gateway:ratelimit:", "X-Api-Key", 1},
+		{"API key不是sha256", `
+rateLimit:
+  apiKeys: [partner-secret-1]
+  rules:
+    - {path: /sk-app/**, by: apikey, rate: 100, period: 60}
+`, true, "", "", 0},
+		{"缺少配置", `other: 1`, true, "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimitConfig = atomic.Value{}
+			loadTestConfig(t, tt.yaml)
+			err := LoadRateLimitConfig(viper.GetViper())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadRateLimitConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			current := CurrentRateLimitConfig()
+			if tt.wantErr {
+				// 解析失败时保留原来的配置，这里原来没有配置，不限流
+				if len(current.Rules) != 0 {
+					t.Errorf("rules = %d after failed load, want 0", len(current.Rules))
+				}
+				return
+			}
+			if current.KeyPrefix != tt.wantPrefix || current.ApiKeyHeader != tt.wantHeader || len(current.Rules) != tt.wantRules {
+				t.Errorf("config = %+v, want prefix %q, header %q, %d rules", current, tt.wantPrefix, tt.wantHeader, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestRateLimitMatch(t *testing.T) {
+	rateLimitConfig = atomic.Value{}
+	loadTestConfig(t, `
+rateLimit:
+  rules:
+    - {path: /sk-app/sec/kill, methods: [POST], by: user, rate: 5, period: 1}
+    - {path: /sk-app/**, by: ip, rate: 100, period: 1}
+    - {path: /sk-app/sec/*, methods: [get], by: route, rate: 1000, period: 1}
+`)
+	if err := LoadRateLimitConfig(viper.GetViper()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   []string // 匹配的规则路径，按配置顺序
+	}{
+		{"匹配全部规则", "POST", "/sk-app/sec/kill", []string{"/sk-app/sec/kill", "/sk-app/**"}},
+		{"方法不区分大小写", "GET", "/sk-app/sec/info", []string{"/sk-app/**", "/sk-app/sec/*"}},
+		{"单层通配符不匹配多层路径", "GET", "/sk-app/sec/info/1", []string{"/sk-app/**"}},
+		{"没有匹配的规则", "GET", "/user/info", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := CurrentRateLimitConfig().Match(tt.method, tt.path)
+			if len(rules) != len(tt.want) {
+				t.Fatalf("Match() = %d rules, want %v", len(rules), tt.want)
+			}
+			for i, rule := range rules {
+				if rule.Path != tt.want[i] {
+					t.Errorf("rule %d = %s, want %s", i, rule.Path, tt.want[i])
+				}
+			}
+		})
+	}
+}
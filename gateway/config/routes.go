@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	conf "final-design/pkg/config"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+// 当前生效的路由表
+var routeTable atomic.Value
+
+// 请求头修改，先删除再设置
+type HeaderRule struct {
+	Set    map[string]string
+	Remove []string
+}
+
+// 路由，按顺序匹配，第一条匹配的路由生效
+//
+//	id: 路由名称，用于日志和熔断命令
+//	host: 匹配Host，为空时匹配全部，*.example.com匹配所有子域名
+//	prefix/regex: 路径前缀或正则表达式，二选一；前缀按路径段匹配，/api/v1不匹配/api/v10
+//	methods: HTTP方法，为空时匹配全部方法
+//	service: 转发到的consul服务名
+//	rewrite: 转发的路径，prefix路由替换匹配的前缀，regex路由作为替换模板(可以使用$1等)；为空时不改写
+//	requestHeaders/responseHeaders: 修改转发的请求头和返回的响应头
+//	timeout: 熔断超时时间：毫秒，0表示使用hystrix配置
+//	permitAll/roles/scopes: 访问要求，含义同policy.rules；都不配置时按转发后的路径(/服务名/路径)匹配policy.rules
+type Route struct {
+	Id              string
+	Host            string
+	Prefix          string
+	Regex           string
+	Methods         []string
+	Service         string
+	Rewrite         string
+	RequestHeaders  HeaderRule
+	ResponseHeaders HeaderRule
+	Timeout         int
+	PermitAll       bool
+	Roles           []string
+	Scopes          []string
+
+	regex  *regexp.Regexp
+	policy *PolicyRule // 路由自身的访问要求，没有配置时为nil
+}
+
+// 路由表，没有匹配的路由时按原来的规则转发：第一段路径是服务名，去掉后转发
+type RouteTable struct {
+	Routes []*Route
+}
+
+// 路由匹配结果
+type RouteTarget struct {
+	Route     *Route // 匹配的路由，按默认规则转发时为nil
+	Service   string // 服务名
+	DestPath  string // 转发给服务的路径
+	Grpc      bool   // gRPC请求，转发到实例的rpcPort
+	Transcode bool   // JSON请求转换为gRPC调用
+}
+
+// 从viper中解析路由表并替换当前路由表，解析失败时保留原来的路由表；没有配置时只使用默认规则
+func LoadRouteTable(v *viper.Viper) error {
+	table := &RouteTable{}
+	if err := conf.SubOf(v, "routeTable", table); err != nil {
+		return err
+	}
+	for _, route := range table.Routes {
+		if route.Service == "" {
+			return errors.New("route service is empty: " + route.Id)
+		}
+		switch {
+		case route.Regex != "":
+			regex, err := regexp.Compile(route.Regex)
+			if err != nil {
+				return err
+			}
+			route.regex = regex
+		case route.Prefix == "":
+			return errors.New("route prefix or regex is required: " + route.Id)
+		}
+		if route.PermitAll || len(route.Roles) > 0 || len(route.Scopes) > 0 {
+			route.policy = &PolicyRule{Path: route.Prefix + route.Regex, PermitAll: route.PermitAll,
+				Roles: route.Roles, Scopes: route.Scopes}
+		}
+	}
+	routeTable.Store(table)
+	return nil
+}
+
+// 当前生效的路由表
+func CurrentRouteTable() *RouteTable {
+	if table, ok := routeTable.Load().(*RouteTable); ok {
+		return table
+	}
+	return &RouteTable{}
+}
+
+// 查找请求对应的服务和转发路径，路径为空或没有服务名时返回false
+func (table *RouteTable) Resolve(r *http.Request) (*RouteTarget, bool) {
+	path := r.URL.Path
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, route := range table.Routes {
+		if !route.matchHost(host) || !matchMethod(route.Methods, r.Method) {
+			continue
+		}
+		if destPath, ok := route.rewrite(path); ok {
+			return &RouteTarget{Route: route, Service: route.Service, DestPath: destPath}, true
+		}
+	}
+
+	// 默认规则：按照分隔符'/'对路径进行分隔，第一段是服务名称
+	pathArray := strings.SplitN(path, "/", 3)
+	if len(pathArray) < 2 || pathArray[1] == "" {
+		return nil, false
+	}
+	destPath := "/"
+	if len(pathArray) == 3 {
+		destPath += pathArray[2]
+	}
+	return &RouteTarget{Service: pathArray[1], DestPath: destPath}, true
+}
+
+// 转发后的路径加上服务名，与默认规则下的请求路径相同，用于匹配policy、hystrix和rateLimit中的规则
+func (target *RouteTarget) Path() string {
+	return "/" + target.Service + target.DestPath
+}
+
+// 访问要求：路由自身配置的要求，没有时按转发后的路径匹配policy.rules
+func (target *RouteTarget) Policy(method string) *PolicyRule {
+	if target.Route != nil && target.Route.policy != nil {
+		return target.Route.policy
+	}
+	return RoutePolicy.Match(method, target.Path())
+}
+
+func (route *Route) matchHost(host string) bool {
+	switch {
+	case route.Host == "":
+		return true
+	case strings.HasPrefix(route.Host, "*."):
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(route.Host[1:]))
+	}
+	return strings.EqualFold(route.Host, host)
+}
+
+// 匹配路径并返回转发的路径
+func (route *Route) rewrite(path string) (string, bool) {
+	if route.regex != nil {
+		if !route.regex.MatchString(path) {
+			return "", false
+		}
+		if route.Rewrite == "" {
+			return path, true
+		}
+		return route.regex.ReplaceAllString(path, route.Rewrite), true
+	}
+
+	prefix := strings.TrimSuffix(route.Prefix, "/")
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return "", false
+	}
+	if route.Rewrite == "" {
+		return path, true
+	}
+	destPath := strings.TrimSuffix(route.Rewrite, "/") + strings.TrimPrefix(path, prefix)
+	if destPath == "" {
+		destPath = "/"
+	}
+	return destPath, true
+}
+
+// 按规则修改请求头或响应头
+func (rule HeaderRule) Apply(header http.Header) {
+	for _, key := range rule.Remove {
+		header.Del(key)
+	}
+	for key, value := range rule.Set {
+		header.Set(key, value)
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const testRoutesYaml = `
+routeTable:
+  routes:
+    - id: seckill-v2
+      prefix: /api/v2/seckill
+      methods: [POST]
+      service: sk-app
+      rewrite: /sec
+      permitAll: true
+    - id: admin-host
+      host: admin.example.com
+      prefix: /
+      service: sk-admin
+      roles: [ROLE_ADMIN]
+    - id: tenant
+      host: "*.shop.example.com"
+      prefix: /api/tenant
+      service: sk-core
+    - id: product
+      regex: ^/products/([0-9]+)/detail$
+      service: sk-admin
+      rewrite: /product/detail?id=$1
+    - id: user-legacy
+      regex: ^/u/.*
+      service: user
+    - id: oauth
+      prefix: /auth/
+      service: oauth
+`
+
+func TestLoadRouteTable(t *testing.T) {
+	tests := []struct {
+		name       string
+		yaml       string
+		wantErr    bool
+		wantRoutes int
+	}{
+		{"路由表", testRoutesYaml, false, 6},
+		{"缺少服务名", `
+routeTable:
+  routes:
+    - {id: a, prefix: /a}
+`, true, 0},
+		{"缺少前缀和正则", `
+routeTable:
+  routes:
+    - {id: a, service: sk-app}
+`, true, 0},
+		{"正则错误", `
+routeTable:
+  routes:
+    - {id: a, regex: "^/a/(", service: sk-app}
+`, true, 0},
+		{"没有配置", `other: 1`, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeTable = atomic.Value{}
+			loadTestConfig(t, tt.yaml)
+			if err := LoadRouteTable(viper.GetViper()); (err != nil) != tt.wantErr {
+				t.Fatalf("LoadRouteTable() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := len(CurrentRouteTable().Routes); got != tt.wantRoutes {
+				t.Errorf("routes = %d, want %d", got, tt.wantRoutes)
+			}
+		})
+	}
+}
+
+func TestRouteTableResolve(t *testing.T) {
+	routeTable = atomic.Value{}
+	loadTestConfig(t, testRoutesYaml)
+	if err := LoadRouteTable(viper.GetViper()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		host        string
+		path        string
+		wantRoute   string
+		wantService string
+		wantPath    string
+		wantOk      bool
+	}{
+		{"前缀改写", "POST", "gw.example.com", "/api/v2/seckill/kill", "seckill-v2", "sk-app", "/sec/kill", true},
+		{"前缀本身", "POST", "gw.example.com", "/api/v2/seckill", "seckill-v2", "sk-app", "/sec", true},
+		{"前缀按路径段匹配", "POST", "gw.example.com", "/api/v2/seckillx/kill", "", "api", "/v2/seckillx/kill", true},
+		{"方法不匹配时使用默认规则", "GET", "gw.example.com", "/api/v2/seckill/kill", "", "api", "/v2/seckill/kill", true},
+		{"按Host匹配", "GET", "admin.example.com:8080", "/product/list", "admin-host", "sk-admin", "/product/list", true},
+		{"Host不区分大小写", "GET", "ADMIN.example.com", "/", "admin-host", "sk-admin", "/", true},
+		{"子域名通配", "GET", "a.shop.example.com", "/api/tenant/info", "tenant", "sk-core", "/api/tenant/info", true},
+		{"通配不匹配上级域名", "GET", "shop.example.com", "/api/tenant/info", "", "api", "/tenant/info", true},
+		{"正则改写", "GET", "gw.example.com", "/products/42/detail", "product", "sk-admin", "/product/detail?id=42", true},
+		{"正则不匹配", "GET", "gw.example.com", "/products/abc/detail", "", "products", "/abc/detail", true},
+		{"正则不改写", "GET", "gw.example.com", "/u/1/info", "user-legacy", "user", "/u/1/info", true},
+		{"前缀以斜杠结尾", "POST", "gw.example.com", "/auth/token", "oauth", "oauth", "/auth/token", true},
+		{"默认规则", "GET", "gw.example.com", "/sk-app/sec/info", "", "sk-app", "/sec/info", true},
+		{"只有服务名", "GET", "gw.example.com", "/sk-app", "", "sk-app", "/", true},
+		{"没有服务名", "GET", "gw.example.com", "/", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://"+tt.host+tt.path, nil)
+			target, ok := CurrentRouteTable().Resolve(r)
+			if ok != tt.wantOk {
+				t.Fatalf("Resolve() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			routeId := ""
+			if target.Route != nil {
+				routeId = target.Route.Id
+			}
+			if routeId != tt.wantRoute || target.Service != tt.wantService || target.DestPath != tt.wantPath {
+				t.Errorf("Resolve() = %s %s %s, want %s %s %s", routeId, target.Service, target.DestPath,
+					tt.wantRoute, tt.wantService, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestRouteTargetPolicy(t *testing.T) {
+	routeTable = atomic.Value{}
+	loadTestConfig(t, testRoutesYaml)
+	if err := LoadRouteTable(viper.GetViper()); err != nil {
+		t.Fatal(err)
+	}
+	saved := RoutePolicy
+	RoutePolicy = Policy{Rules: []*PolicyRule{{Path: "/sk-admin/**", Roles: []string{"ROLE_OPS"}}}}
+	if err := RoutePolicy.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RoutePolicy = saved })
+
+	tests := []struct {
+		name          string
+		method        string
+		host          string
+		path          string
+		wantNil       bool
+		wantPermitAll bool
+		wantRoles     []string
+	}{
+		{"路由允许匿名访问", "POST", "gw.example.com", "/api/v2/seckill/kill", false, true, nil},
+		{"路由要求的角色", "GET", "admin.example.com", "/product/list", false, false, []string{"ROLE_ADMIN"}},
+		{"按转发后的路径匹配规则", "GET", "gw.example.com", "/products/1/detail", false, false, []string{"ROLE_OPS"}},
+		{"没有匹配的规则", "GET", "gw.example.com", "/u/1", true, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://"+tt.host+tt.path, nil)
+			target, _ := CurrentRouteTable().Resolve(r)
+			rule := target.Policy(tt.method)
+			if (rule == nil) != tt.wantNil {
+				t.Fatalf("Policy() = %+v, want nil %v", rule, tt.wantNil)
+			}
+			if rule == nil {
+				return
+			}
+			if rule.PermitAll != tt.wantPermitAll || len(rule.Roles) != len(tt.wantRoles) ||
+				(len(tt.wantRoles) > 0 && rule.Roles[0] != tt.wantRoles[0]) {
+				t.Errorf("Policy() = %+v, want permitAll %v roles %v", rule, tt.wantPermitAll, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestHeaderRuleApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   HeaderRule
+		header http.Header
+		want   http.Header
+	}{
+		{"设置", HeaderRule{Set: map[string]string{"x-gateway": "seckill"}}, http.Header{},
+			http.Header{"X-Gateway": {"seckill"}}},
+		{"删除", HeaderRule{Remove: []string{"server", "X-Powered-By"}},
+			http.Header{"Server": {"nginx"}, "X-Powered-By": {"go"}, "Content-Type": {"text/plain"}},
+			http.Header{"Content-Type": {"text/plain"}}},
+		{"先删除再设置", HeaderRule{Set: map[string]string{"X-Version": "v2"}, Remove: []string{"X-Version"}},
+			http.Header{"X-Version": {"v1", "v0"}}, http.Header{"X-Version": {"v2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Apply(tt.header)
+			if len(tt.header) != len(tt.want) {
+				t.Fatalf("header = %v, want %v", tt.header, tt.want)
+			}
+			for key, values := range tt.want {
+				if got := tt.header.Values(key); len(got) != len(values) || got[0] != values[0] {
+					t.Errorf("header %s = %v, want %v", key, got, values)
+				}
+			}
+		})
+	}
+}
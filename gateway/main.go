@@ -1,30 +1,37 @@
 package main
 
 import (
+	"context"
 	"final-design/pkg/bootstrap"
 	"flag"
-	"fmt"
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"time"
 
-	_ "final-design/gateway/config"
+	"final-design/gateway/config"
 	"final-design/gateway/route"
+	conf "final-design/pkg/config"
 	register "final-design/pkg/discover"
+	"final-design/pkg/redis"
+	"final-design/pkg/shutdown"
 
 	"github.com/afex/hystrix-go/hystrix"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	"github.com/go-kit/log"
 	"github.com/openzipkin/zipkin-go"
 	zipkinhttpsvr "github.com/openzipkin/zipkin-go/middleware/http"
 	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
 	// 创建环境变量
 	var (
-		zipkinURL = flag.String("zipkin.url", "http://127.0.0.1:9411/api/v2/spans", "Zipkin server url")
+		zipkinURL = flag.String("zipkin.url", conf.TraceConfig.ZipkinUrl(), "Zipkin server url")
 	)
 	flag.Parse()
 
@@ -56,12 +63,29 @@ func main() {
 		}
 	}
 
+	// 令牌黑名单保存在redis中
+	redis.InitRedis()
+
 	register.Register()
 	tags := map[string]string{
 		"component": "gateway_server",
 	}
 
-	hystrixRouter := route.Routes(zipkinTracer, "Circuit Breaker: Service unavailable", logger)
+	// 重试和实例剔除的统计，与hystrix监控使用同一个端口
+	retryCount := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "aoho",
+		Subsystem: "gateway",
+		Name:      "retry_count",
+		Help:      "Number of requests retried on another instance.",
+	}, []string{"service"})
+	ejectionCount := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "aoho",
+		Subsystem: "gateway",
+		Name:      "ejection_count",
+		Help:      "Number of instances ejected by outlier detection.",
+	}, []string{"service"})
+
+	hystrixRouter := route.Routes(zipkinTracer, "Circuit Breaker: Service unavailable", retryCount, ejectionCount, logger)
 	handler := zipkinhttpsvr.NewServerMiddleware(
 		zipkinTracer,
 		zipkinhttpsvr.SpanName(bootstrap.DiscoverConfig.ServiceName),
@@ -69,31 +93,46 @@ func main() {
 		zipkinhttpsvr.ServerTags(tags),
 	)(hystrixRouter)
 
+	// 配置中心的配置变化时热更新熔断配置
+	if config.ReloadConfig.Interval > 0 {
+		conf.WatchRemoteConfig(time.Duration(config.ReloadConfig.Interval)*time.Second, config.Reload)
+	}
+
 	errc := make(chan error)
 
-	// 启用hystrix 实时监控，监听端口为9010
+	// 启用hystrix 实时监控，监听端口为bootstrap中的monitor.port，/metrics为prometheus指标
 	hystrixStreamHandler := hystrix.NewStreamHandler()
 	hystrixStreamHandler.Start()
-	go func() {
-		errc <- http.ListenAndServe(net.JoinHostPort("", "9010"), hystrixStreamHandler)
-	}()
-
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errc <- fmt.Errorf("%s", <-c)
-	}()
+	monitorMux := http.NewServeMux()
+	monitorMux.Handle("/metrics", promhttp.Handler())
+	monitorMux.Handle("/", hystrixStreamHandler)
+	monitorServer := &http.Server{Addr: net.JoinHostPort("", bootstrap.MonitorConfig.Port), Handler: monitorMux}
+	if bootstrap.MonitorConfig.Port != "" {
+		go func() {
+			logger.Log("transport", "HTTP", "monitor", bootstrap.MonitorConfig.Port)
+			errc <- monitorServer.ListenAndServe()
+		}()
+	}
 
+	// 同时支持HTTP/2明文(h2c)，用于代理gRPC请求；
+	// h2c连接由h2c.Handler接管，server.Shutdown不会等待其中的gRPC调用，由tracker跟踪
+	tracker := shutdown.NewTracker()
+	server := &http.Server{Addr: ":" + bootstrap.HttpConfig.Port, Handler: h2c.NewHandler(tracker.Handler(handler), &http2.Server{})}
 	// 开始监听
 	go func() {
-		logger.Log("transport", "HTTP", "addr", "9090")
+		logger.Log("transport", "HTTP", "addr", bootstrap.HttpConfig.Port)
 		register.Register()
-		errc <- http.ListenAndServe(":9090", handler)
+		errc <- server.ListenAndServe()
 	}()
 
-	// 开始运行，等待结束
-	error := <-errc
-	// 服务退出取消注册
-	register.Deregister()
-	logger.Log("exit", error)
+	// 开始运行，等待结束：先取消注册，等待转发中的请求和h2c连接上的gRPC调用完成后再关闭监控
+	shutdown.New(register.Deregister).
+		HTTP(server).
+		OnShutdown("wait h2c requests", tracker.Wait).
+		OnShutdown("close monitor", func(ctx context.Context) error {
+			// hystrix实时监控是长连接，不等待直接关闭
+			hystrixStreamHandler.Stop()
+			return monitorServer.Close()
+		}).
+		Wait(errc)
 }
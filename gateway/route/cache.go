@@ -0,0 +1,261 @@
+package route
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"final-design/gateway/config"
+	"final-design/pkg/cache"
+	conf "final-design/pkg/config"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// 按启动时的配置创建缓存存储，没有配置backend时返回nil；同时订阅sk-admin发布的清除通知
+func newCacheStore(logger log.Logger) cache.Store {
+	cacheConf := config.CurrentCacheConfig()
+	var store cache.Store
+	switch cacheConf.Backend {
+	case config.CacheBackendMemory:
+		store = cache.NewLRUStore(cacheConf.MaxEntries)
+	case config.CacheBackendRedis:
+		store = cache.NewRedisStore(conf.Redis.RedisConn, cacheConf.KeyPrefix)
+	default:
+		return nil
+	}
+	cache.Subscribe(conf.Redis.RedisConn, purgeHandler(store, logger))
+	return store
+}
+
+// 收到清除通知时清除缓存；服务可能稍后才从zookeeper读到新的数据，
+// 这期间缓存的仍是旧数据，因此配置了purgeDelay时延迟后再清除一次
+func purgeHandler(store cache.Store, logger log.Logger) func(tags []string) {
+	return func(tags []string) {
+		logger.Log("purge cache", strings.Join(tags, ","))
+		if err := store.Purge(tags...); err != nil {
+			logger.Log("purge cache error", err)
+		}
+		if delay := config.CurrentCacheConfig().PurgeDelay; delay > 0 {
+			time.AfterFunc(time.Duration(delay)*time.Millisecond, func() {
+				if err := store.Purge(tags...); err != nil {
+					logger.Log("purge cache error", err)
+				}
+			})
+		}
+	}
+}
+
+// 查找请求对应的缓存规则并计算缓存key，不需要缓存时rule为nil；
+// key包括路由、方法、转发后的路径、查询参数、灰度版本、varyHeaders和请求体
+func (router HystrixRouter) cacheKey(r *http.Request, target *config.RouteTarget, canary *config.CanaryDecision) (*config.CacheRule, string) {
+	if router.cache == nil || (target.Grpc && !target.Transcode) || strings.Contains(r.Header.Get("Cache-Control"), "no-store") {
+		return nil, ""
+	}
+	cacheConf := config.CurrentCacheConfig()
+	rule := cacheConf.Match(r.Method, target.Path())
+	if rule == nil {
+		return nil, ""
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	h := sha256.New()
+	routeId := ""
+	if target.Route != nil {
+		routeId = target.Route.Id
+	}
+	io.WriteString(h, routeId+"\n"+method+"\n"+target.Path()+"?"+r.URL.Query().Encode()+"\n"+canary.Group()+"\n")
+	for _, header := range rule.VaryHeaders {
+		io.WriteString(h, header+":"+strings.Join(r.Header.Values(header), ",")+"\n")
+	}
+	if method != http.MethodGet {
+		body, ok := bufferBody(r, cacheConf.MaxBodyBytes)
+		if !ok {
+			return nil, ""
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return rule, hex.EncodeToString(h.Sum(nil))
+}
+
+// 返回缓存的响应，请求头If-None-Match与ETag相同时返回304；缓存不存在或请求要求重新验证时返回false
+func (router HystrixRouter) serveCached(w http.ResponseWriter, r *http.Request, key string) bool {
+	if strings.Contains(r.Header.Get("Cache-Control"), "no-cache") || r.Header.Get("Pragma") == "no-cache" {
+		return false
+	}
+	entry, err := router.cache.Get(key)
+	if err != nil {
+		router.logger.Log("cache error", err)
+		return false
+	}
+	if entry == nil {
+		return false
+	}
+	for header, values := range entry.Header {
+		w.Header()[header] = values
+	}
+	w.Header().Set("X-Cache", "HIT")
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+	writeCached(w, r, entry.Status, entry.ETag, entry.Body)
+	return true
+}
+
+// 将转发的响应写给客户端，可以缓存时保存到缓存中
+func (router HystrixRouter) storeCached(w http.ResponseWriter, r *http.Request, rec *cacheRecorder, key string, rule *config.CacheRule) {
+	if rec.passThrough {
+		return
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	for header, values := range rec.header {
+		w.Header()[header] = values
+	}
+	ttl, cacheable := cacheTtl(rec, rule)
+	if !cacheable {
+		w.Header().Set("X-Cache", "BYPASS")
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+		return
+	}
+
+	etag := rec.header.Get("ETag")
+	if etag == "" {
+		sum := sha256.Sum256(rec.body.Bytes())
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+	}
+	// 客户端每次都需要重新验证，缓存清除后客户端可以立即拿到新数据
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	header := w.Header().Clone()
+	w.Header().Set("X-Cache", "MISS")
+	writeCached(w, r, rec.status, etag, rec.body.Bytes())
+
+	now := time.Now()
+	err := router.cache.Set(key, &cache.Entry{
+		Status:   rec.status,
+		Header:   header,
+		Body:     rec.body.Bytes(),
+		ETag:     etag,
+		Tags:     rule.Tags,
+		StoredAt: now,
+		Expires:  now.Add(ttl),
+	})
+	if err != nil {
+		router.logger.Log("cache error", err)
+	}
+}
+
+// 只缓存200响应，服务返回no-store、private或Set-Cookie时不缓存；max-age或s-maxage小于规则的ttl时使用较小的值
+func cacheTtl(rec *cacheRecorder, rule *config.CacheRule) (time.Duration, bool) {
+	if rec.status != http.StatusOK || rec.header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	ttl := time.Duration(rule.Ttl) * time.Second
+	for _, directive := range strings.Split(rec.header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store" || directive == "private":
+			return 0, false
+		case strings.HasPrefix(directive, "max-age="), strings.HasPrefix(directive, "s-maxage="):
+			seconds, err := strconv.Atoi(directive[strings.Index(directive, "=")+1:])
+			if err == nil && time.Duration(seconds)*time.Second < ttl {
+				ttl = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return ttl, ttl > 0
+}
+
+func writeCached(w http.ResponseWriter, r *http.Request, status int, etag string, body []byte) {
+	if etag != "" && matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// If-None-Match中的任一ETag相同(忽略弱校验前缀W/)或为*时匹配
+func matchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// 缓存转发的响应，响应体超过maxBytes时改为直接写给客户端，不再缓存
+type cacheRecorder struct {
+	w        http.ResponseWriter
+	maxBytes int64
+
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	passThrough bool
+}
+
+func newCacheRecorder(w http.ResponseWriter, maxBytes int64) *cacheRecorder {
+	return &cacheRecorder{w: w, maxBytes: maxBytes, header: make(http.Header)}
+}
+
+func (rec *cacheRecorder) Header() http.Header {
+	if rec.passThrough {
+		return rec.w.Header()
+	}
+	return rec.header
+}
+
+func (rec *cacheRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	if rec.passThrough {
+		return rec.w.Write(b)
+	}
+	if int64(rec.body.Len()+len(b)) <= rec.maxBytes {
+		return rec.body.Write(b)
+	}
+	// 超过大小限制，写出已缓存的部分后直接转发
+	rec.passThrough = true
+	for header, values := range rec.header {
+		rec.w.Header()[header] = values
+	}
+	rec.w.WriteHeader(rec.status)
+	if _, err := rec.w.Write(rec.body.Bytes()); err != nil {
+		return 0, err
+	}
+	rec.body.Reset()
+	return rec.w.Write(b)
+}
+
+func (rec *cacheRecorder) Flush() {
+	if flusher, ok := rec.w.(http.Flusher); ok && rec.passThrough {
+		flusher.Flush()
+	}
+}
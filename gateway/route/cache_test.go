@@ -0,0 +1,355 @@
+package route
+
+import (
+	"final-design/gateway/config"
+	"final-design/pkg/cache"
+	"final-design/pkg/redistest"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/spf13/viper"
+)
+
+func TestCacheTtl(t *testing.T) {
+	rule := &config.CacheRule{Ttl: 60}
+	tests := []struct {
+		name          string
+		status        int
+		cacheControl  string
+		setCookie     bool
+		wantTtl       time.Duration
+		wantCacheable bool
+	}{
+		{"使用规则的ttl", 200, "", false, time.Minute, true},
+		{"max-age更小", 200, "public, max-age=10", false, 10 * time.Second, true},
+		{"s-maxage更小", 200, "s-maxage=5, max-age=30", false, 5 * time.Second, true},
+		{"max-age更大", 200, "max-age=3600", false, time.Minute, true},
+		{"max-age为0", 200, "max-age=0", false, 0, false},
+		{"max-age无法解析", 200, "max-age=abc", false, time.Minute, true},
+		{"no-store", 200, "No-Store", false, 0, false},
+		{"private", 200, "private, max-age=10", false, 0, false},
+		{"Set-Cookie", 200, "", true, 0, false},
+		{"非200响应", 404, "", false, 0, false},
+		{"服务错误", 500, "max-age=10", false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newCacheRecorder(httptest.NewRecorder(), 1024)
+			rec.status = tt.status
+			if tt.cacheControl != "" {
+				rec.header.Set("Cache-Control", tt.cacheControl)
+			}
+			if tt.setCookie {
+				rec.header.Set("Set-Cookie", "session=1")
+			}
+			ttl, cacheable := cacheTtl(rec, rule)
+			if cacheable != tt.wantCacheable || (cacheable && ttl != tt.wantTtl) {
+				t.Errorf("cacheTtl() = %v, %v, want %v, %v", ttl, cacheable, tt.wantTtl, tt.wantCacheable)
+			}
+		})
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		etag        string
+		want        bool
+	}{
+		{"相同", `"abc"`, `"abc"`, true},
+		{"不同", `"abd"`, `"abc"`, false},
+		{"没有If-None-Match", "", `"abc"`, false},
+		{"多个之一", `"x", "abc" , "y"`, `"abc"`, true},
+		{"弱校验", `W/"abc"`, `"abc"`, true},
+		{"弱ETag", `"abc"`, `W/"abc"`, true},
+		{"星号", "*", `"abc"`, true},
+		{"缺少引号", `abc`, `"abc"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchETag(tt.ifNoneMatch, tt.etag); got != tt.want {
+				t.Errorf("matchETag(%q, %q) = %v, want %v", tt.ifNoneMatch, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCached(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"返回响应体", http.MethodGet, "", http.StatusOK, "hello"},
+		{"ETag相同返回304", http.MethodGet, `"v1"`, http.StatusNotModified, ""},
+		{"ETag不同", http.MethodGet, `"v0"`, http.StatusOK, "hello"},
+		{"HEAD没有响应体", http.MethodHead, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/sk-app/sec/list", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			writeCached(w, r, http.StatusOK, `"v1"`, []byte("hello"))
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("writeCached() = %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusOK && w.Header().Get("Content-Length") != "5" {
+				t.Errorf("Content-Length = %q, want 5", w.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestCacheRecorderPassThrough(t *testing.T) {
+	tests := []struct {
+		name            string
+		writes          []string
+		wantPassThrough bool
+	}{
+		{"不超过上限", []string{"abc", "de"}, false},
+		{"超过上限后直接转发", []string{"abc", "defgh", "ij"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rec := newCacheRecorder(w, 5)
+			rec.Header().Set("Content-Type", "text/plain")
+			rec.WriteHeader(http.StatusCreated)
+			for _, s := range tt.writes {
+				if _, err := rec.Write([]byte(s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			all := strings.Join(tt.writes, "")
+			if rec.passThrough != tt.wantPassThrough {
+				t.Fatalf("passThrough = %v, want %v", rec.passThrough, tt.wantPassThrough)
+			}
+			if !tt.wantPassThrough {
+				if rec.body.String() != all || w.Body.Len() != 0 {
+					t.Errorf("recorded %q, written %q", rec.body.String(), w.Body.String())
+				}
+				return
+			}
+			// 已缓存的部分和后续内容按顺序写给客户端，状态码和响应头不丢失
+			if w.Body.String() != all || w.Code != http.StatusCreated || w.Header().Get("Content-Type") != "text/plain" {
+				t.Errorf("written %d %q %v, want %d %q", w.Code, w.Body.String(), w.Header(), http.StatusCreated, all)
+			}
+		})
+	}
+}
+
+func TestCacheStoreAndServe(t *testing.T) {
+	router := HystrixRouter{cache: cache.NewLRUStore(0), logger: log.NewNopLogger()}
+	rule := &config.CacheRule{Ttl: 60, Tags: []string{cache.TagProduct}}
+
+	// 第一次请求转发给服务并缓存
+	rec := newCacheRecorder(httptest.NewRecorder(), 1024)
+	rec.Header().Set("Content-Type", "application/json")
+	rec.Write([]byte(`{"id":1}`))
+	w := httptest.NewRecorder()
+	router.storeCached(w, httptest.NewRequest(http.MethodGet, "/sk-admin/product/1", nil), rec, "key", rule)
+	etag := w.Header().Get("ETag")
+	if w.Header().Get("X-Cache") != "MISS" || etag == "" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("first response header = %v", w.Header())
+	}
+
+	tests := []struct {
+		name       string
+		header     map[string]string
+		wantServed bool
+		wantStatus int
+		wantBody   string
+	}{
+		{"命中缓存", nil, true, http.StatusOK, `{"id":1}`},
+		{"ETag相同", map[string]string{"If-None-Match": etag}, true, http.StatusNotModified, ""},
+		{"要求重新验证", map[string]string{"Cache-Control": "no-cache"}, false, 0, ""},
+		{"Pragma", map[string]string{"Pragma": "no-cache"}, false, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/sk-admin/product/1", nil)
+			for key, value := range tt.header {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			if served := router.serveCached(w, r, "key"); served != tt.wantServed {
+				t.Fatalf("serveCached() = %v, want %v", served, tt.wantServed)
+			}
+			if !tt.wantServed {
+				return
+			}
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody || w.Header().Get("X-Cache") != "HIT" ||
+				w.Header().Get("Content-Type") != "application/json" || w.Header().Get("ETag") != etag {
+				t.Errorf("serveCached() = %d %q %v", w.Code, w.Body.String(), w.Header())
+			}
+		})
+	}
+
+	// 清除标签后不再命中
+	router.cache.Purge(cache.TagProduct)
+	if router.serveCached(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sk-admin/product/1", nil), "key") {
+		t.Error("purged entry is served")
+	}
+}
+
+func TestCacheStoreBypass(t *testing.T) {
+	router := HystrixRouter{cache: cache.NewLRUStore(0), logger: log.NewNopLogger()}
+	rec := newCacheRecorder(httptest.NewRecorder(), 1024)
+	rec.Header().Set("Cache-Control", "private")
+	rec.Write([]byte("secret"))
+	w := httptest.NewRecorder()
+	router.storeCached(w, httptest.NewRequest(http.MethodGet, "/user/info", nil), rec, "key", &config.CacheRule{Ttl: 60})
+	if w.Header().Get("X-Cache") != "BYPASS" || w.Body.String() != "secret" {
+		t.Errorf("response = %v %q, want bypass", w.Header(), w.Body.String())
+	}
+	if entry, _ := router.cache.Get("key"); entry != nil {
+		t.Error("private response is cached")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(`
+cache:
+  backend: memory
+  maxBodyBytes: 16
+  rules:
+    - {path: /sk-admin/product/**, ttl: 60, varyHeaders: [Accept-Language]}
+    - {path: /sk-app/sec/search, methods: [POST], ttl: 10}
+`)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+	if err := config.LoadCacheConfig(viper.GetViper()); err != nil {
+		t.Fatal(err)
+	}
+	router := HystrixRouter{cache: cache.NewLRUStore(0), logger: log.NewNopLogger()}
+	canary := &config.CanaryDecision{Rule: &config.CanaryRule{Version: "v2"}, Canary: true}
+
+	keyOf := func(method, path, body string, header map[string]string, decision *config.CanaryDecision) (bool, string) {
+		var r *http.Request
+		if body != "" {
+			r = httptest.NewRequest(method, path, strings.NewReader(body))
+		} else {
+			r = httptest.NewRequest(method, path, nil)
+		}
+		for key, value := range header {
+			r.Header.Set(key, value)
+		}
+		target, _ := config.CurrentRouteTable().Resolve(r)
+		rule, key := router.cacheKey(r, target, decision)
+		return rule != nil, key
+	}
+	_, base := keyOf("GET", "/sk-admin/product/1?a=1&b=2", "", nil, nil)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		header   map[string]string
+		canary   *config.CanaryDecision
+		wantRule bool
+		wantSame bool // 与base相同
+	}{
+		{"相同请求", "GET", "/sk-admin/product/1?a=1&b=2", "", nil, nil, true, true},
+		{"查询参数顺序不同", "GET", "/sk-admin/product/1?b=2&a=1", "", nil, nil, true, true},
+		{"HEAD与GET共享", "HEAD", "/sk-admin/product/1?a=1&b=2", "", nil, nil, true, true},
+		{"不在vary中的请求头", "GET", "/sk-admin/product/1?a=1&b=2", "", map[string]string{"User-Agent": "x"}, nil, true, true},
+		{"查询参数不同", "GET", "/sk-admin/product/1?a=2&b=2", "", nil, nil, true, false},
+		{"vary请求头不同", "GET", "/sk-admin/product/1?a=1&b=2", "", map[string]string{"Accept-Language": "en"}, nil, true, false},
+		{"灰度版本不同", "GET", "/sk-admin/product/1?a=1&b=2", "", nil, canary, true, false},
+		{"没有匹配的规则", "GET", "/sk-admin/order/list", "", nil, nil, false, false},
+		{"方法不匹配", "POST", "/sk-admin/product/1", "", nil, nil, false, false},
+		{"客户端要求不缓存", "GET", "/sk-admin/product/1?a=1&b=2", "", map[string]string{"Cache-Control": "no-store"}, nil, false, false},
+		{"请求体超过上限", "POST", "/sk-app/sec/search", strings.Repeat("x", 17), nil, nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasRule, key := keyOf(tt.method, tt.path, tt.body, tt.header, tt.canary)
+			if hasRule != tt.wantRule {
+				t.Fatalf("cacheKey() rule = %v, want %v", hasRule, tt.wantRule)
+			}
+			if hasRule && (key == base) != tt.wantSame {
+				t.Errorf("key equals base = %v, want %v", key == base, tt.wantSame)
+			}
+		})
+	}
+
+	// 请求体不同时分别缓存
+	_, first := keyOf("POST", "/sk-app/sec/search", `{"q":"a"}`, nil, nil)
+	_, second := keyOf("POST", "/sk-app/sec/search", `{"q":"b"}`, nil, nil)
+	if first == second {
+		t.Error("different bodies share a cache key")
+	}
+}
+
+// 清除通知经redis送达后立即清除，配置了purgeDelay时再清除一次服务更新数据前重新缓存的旧响应
+func TestPurgeHandlerDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		purgeDelay int // 毫秒
+		wantStale  bool
+	}{
+		{"不延迟清除时保留重新缓存的旧响应", 0, true},
+		{"延迟后再清除一次", 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			if err := v.ReadConfig(strings.NewReader(fmt.Sprintf("cache:\n  backend: memory\n  purgeDelay: %d\n", tt.purgeDelay))); err != nil {
+				t.Fatal(err)
+			}
+			if err := config.LoadCacheConfig(v); err != nil {
+				t.Fatal(err)
+			}
+			conn, _ := redistest.New(t)
+			store := cache.NewLRUStore(0)
+			cache.Subscribe(conn, purgeHandler(store, log.NewNopLogger()))
+			time.Sleep(20 * time.Millisecond) // 等待订阅生效
+
+			entryOf := func(body string) *cache.Entry {
+				return &cache.Entry{Status: 200, Body: []byte(body), Tags: []string{cache.TagProduct}, Expires: time.Now().Add(time.Minute)}
+			}
+			store.Set("product:1", entryOf("v1"))
+			if err := cache.Publish(conn, cache.TagProduct); err != nil {
+				t.Fatal(err)
+			}
+			if !waitFor(time.Second, func() bool { entry, _ := store.Get("product:1"); return entry == nil }) {
+				t.Fatal("entry is not purged after the notification")
+			}
+
+			// 服务还没有读到新数据，网关再次缓存了旧响应
+			store.Set("product:1", entryOf("v1-stale"))
+			time.Sleep(time.Duration(tt.purgeDelay)*time.Millisecond + 100*time.Millisecond)
+			entry, _ := store.Get("product:1")
+			if (entry != nil) != tt.wantStale {
+				t.Errorf("stale entry cached = %v, want %v", entry != nil, tt.wantStale)
+			}
+		})
+	}
+}
+
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
@@ -0,0 +1,116 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"final-design/pkg/discover"
+	"final-design/pkg/loadbalance"
+	"net/http"
+	"sync"
+
+	"github.com/afex/hystrix-go/hystrix"
+)
+
+var errWriterClosed = errors.New("response already finished by fallback")
+
+// 网关自身返回的错误响应，包括fallback和限流
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Service string `json:"service"`
+}
+
+// 熔断打开、并发数超限和没有可用实例返回503，超时返回504，其它转发错误返回502；
+// 转发已经开始写响应时不再写入
+func (router HystrixRouter) fallback(w *guardedWriter, serviceName string, err error) {
+	status, reason := http.StatusBadGateway, "bad_gateway"
+	switch {
+	case err == hystrix.ErrCircuitOpen:
+		status, reason = http.StatusServiceUnavailable, "circuit_open"
+	case err == hystrix.ErrMaxConcurrency:
+		status, reason = http.StatusServiceUnavailable, "max_concurrency"
+	case err == hystrix.ErrTimeout:
+		status, reason = http.StatusGatewayTimeout, "timeout"
+	case errors.Is(err, discover.ErrNoInstanceExited), errors.Is(err, loadbalance.ErrServiceInstanceNotExist):
+		status, reason = http.StatusServiceUnavailable, "no_instance"
+	}
+	w.fail(status, errorResponse{
+		Code:    status,
+		Error:   reason,
+		Message: router.fallbackMsg,
+		Service: serviceName,
+	})
+}
+
+// 转发和fallback共用的ResponseWriter：fallback写入后丢弃转发写入的内容，
+// 转发已经写入响应头时fallback不再写入
+type guardedWriter struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	header      http.Header // 转发使用的响应头，写入响应头时复制到w
+	wroteHeader bool
+	closed      bool
+}
+
+func newGuardedWriter(w http.ResponseWriter) *guardedWriter {
+	return &guardedWriter{w: w, header: make(http.Header)}
+}
+
+// 写入响应头后返回w的响应头，反向代理在响应体之后设置的trailer(如gRPC的grpc-status)直接写入w
+func (g *guardedWriter) Header() http.Header {
+	if g.wroteHeader {
+		return g.w.Header()
+	}
+	return g.header
+}
+
+func (g *guardedWriter) WriteHeader(status int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(status)
+}
+
+func (g *guardedWriter) writeHeader(status int) {
+	if g.closed || g.wroteHeader {
+		return
+	}
+	for key, values := range g.header {
+		g.w.Header()[key] = values
+	}
+	g.w.WriteHeader(status)
+	g.wroteHeader = true
+}
+
+func (g *guardedWriter) Write(b []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return 0, errWriterClosed
+	}
+	g.writeHeader(http.StatusOK)
+	return g.w.Write(b)
+}
+
+func (g *guardedWriter) Flush() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if flusher, ok := g.w.(http.Flusher); ok && !g.closed && g.wroteHeader {
+		flusher.Flush()
+	}
+}
+
+func (g *guardedWriter) fail(status int, body interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	g.closed = true
+	if g.wroteHeader {
+		return
+	}
+	g.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	g.w.WriteHeader(status)
+	json.NewEncoder(g.w).Encode(body)
+}
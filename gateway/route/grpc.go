@@ -0,0 +1,281 @@
+package route
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"final-design/gateway/config"
+	"final-design/pkg/common"
+	"final-design/pkg/loadbalance"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// 转发gRPC请求使用的HTTP/2明文(h2c)连接
+var h2cTransport = &http2.Transport{
+	AllowHTTP: true,
+	DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+		return net.Dial(network, addr)
+	},
+}
+
+// JSON转gRPC调用时使用的连接，实例地址 -> *grpc.ClientConn
+var grpcConns sync.Map
+
+// HTTP/2且Content-Type为application/grpc的请求
+func isGrpcRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// 路径以transcodePrefix开头的JSON请求
+func isTranscodeRequest(r *http.Request) bool {
+	prefix := config.CurrentGrpcConfig().TranscodePrefix
+	return prefix != "" && strings.HasPrefix(r.URL.Path, prefix+"/")
+}
+
+// 按grpc配置查找gRPC请求或JSON转gRPC请求的转发目标和访问要求，服务或方法不允许访问时返回nil
+func grpcTarget(r *http.Request, transcode bool) (*config.RouteTarget, *config.PolicyRule) {
+	grpcConf := config.CurrentGrpcConfig()
+	path := r.URL.Path
+	if transcode {
+		if r.Method != http.MethodPost {
+			return nil, nil
+		}
+		path = strings.TrimPrefix(path, grpcConf.TranscodePrefix)
+	}
+	serviceName, method, ok := config.SplitGrpcPath(path)
+	if !ok {
+		return nil, nil
+	}
+	grpcService := grpcConf.Match(serviceName, method)
+	if grpcService == nil || (transcode && !grpcService.Transcode) {
+		return nil, nil
+	}
+	target := grpcService.Target(method)
+	target.Transcode = transcode
+	return target, grpcService.Policy()
+}
+
+// 将JSON请求体转换为gRPC请求调用指定实例，返回值转换为JSON；
+// 实例不可用时返回错误用于重试和异常检测，其它gRPC错误按状态码转换为HTTP错误响应
+func (router HystrixRouter) invoke(w http.ResponseWriter, r *http.Request, serviceInstance *common.ServiceInstance,
+	target *config.RouteTarget, outlier *loadbalance.OutlierDetector) error {
+	fullMethod := target.DestPath
+	serviceName, methodName, _ := config.SplitGrpcPath(fullMethod)
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(serviceName))
+	serviceDescriptor, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if err != nil || !ok {
+		writeGrpcError(w, target.Service, status.New(codes.Unimplemented, "unknown service "+serviceName))
+		return nil
+	}
+	methodDescriptor := serviceDescriptor.Methods().ByName(protoreflect.Name(methodName))
+	if methodDescriptor == nil || methodDescriptor.IsStreamingClient() || methodDescriptor.IsStreamingServer() {
+		writeGrpcError(w, target.Service, status.New(codes.Unimplemented, "unknown or streaming method "+fullMethod))
+		return nil
+	}
+	inType, err := protoregistry.GlobalTypes.FindMessageByName(methodDescriptor.Input().FullName())
+	if err != nil {
+		writeGrpcError(w, target.Service, status.New(codes.Unimplemented, err.Error()))
+		return nil
+	}
+	outType, err := protoregistry.GlobalTypes.FindMessageByName(methodDescriptor.Output().FullName())
+	if err != nil {
+		writeGrpcError(w, target.Service, status.New(codes.Unimplemented, err.Error()))
+		return nil
+	}
+
+	in, out := inType.New().Interface(), outType.New().Interface()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, in); err != nil {
+			writeGrpcError(w, target.Service, status.New(codes.InvalidArgument, err.Error()))
+			return nil
+		}
+	}
+
+	conn, err := grpcConnOf(serviceInstance)
+	if err != nil {
+		outlier.ReportFailure(serviceInstance)
+		return err
+	}
+	ctx := metadata.NewOutgoingContext(r.Context(), grpcMetadata(r))
+	if err := conn.Invoke(ctx, fullMethod, in, out); err != nil {
+		st := status.Convert(err)
+		if st.Code() == codes.Unavailable && r.Context().Err() == nil {
+			outlier.ReportFailure(serviceInstance)
+			return err
+		}
+		outlier.ReportSuccess(serviceInstance)
+		writeGrpcError(w, target.Service, st)
+		return nil
+	}
+	outlier.ReportSuccess(serviceInstance)
+
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(out)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return nil
+}
+
+// 实例的gRPC连接，第一次调用时创建并复用
+func grpcConnOf(serviceInstance *common.ServiceInstance) (*grpc.ClientConn, error) {
+	address := net.JoinHostPort(serviceInstance.Host, strconv.Itoa(serviceInstance.GrpcPort))
+	if conn, ok := grpcConns.Load(address); ok {
+		return conn.(*grpc.ClientConn), nil
+	}
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	if actual, loaded := grpcConns.LoadOrStore(address, conn); loaded {
+		conn.Close()
+		return actual.(*grpc.ClientConn), nil
+	}
+	return conn, nil
+}
+
+// 转发给服务的gRPC metadata：令牌和网关设置的X-开头的请求头
+func grpcMetadata(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		if key == "Authorization" || strings.HasPrefix(key, "X-") {
+			md.Append(strings.ToLower(key), values...)
+		}
+	}
+	return md
+}
+
+// gRPC状态码对应的HTTP状态码，同grpc-gateway
+func httpStatusOf(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func writeGrpcError(w http.ResponseWriter, serviceName string, st *status.Status) {
+	code := httpStatusOf(st.Code())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResponse{
+		Code:    code,
+		Error:   snakeCase(st.Code().String()),
+		Message: st.Message(),
+		Service: serviceName,
+	})
+}
+
+// gRPC状态码名称转换为与fallback一致的格式，如InvalidArgument -> invalid_argument
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// HTTP状态码对应的gRPC状态码
+func grpcCodeOf(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+// gRPC客户端只识别grpc-status：网关自身返回的错误(鉴权、限流、fallback)转换为只有响应头的gRPC错误响应，
+// 服务返回的gRPC响应(200)原样转发
+type grpcStatusWriter struct {
+	http.ResponseWriter
+	failed bool
+}
+
+func newGrpcStatusWriter(w http.ResponseWriter) *grpcStatusWriter {
+	return &grpcStatusWriter{ResponseWriter: w}
+}
+
+func (g *grpcStatusWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusOK || g.failed {
+		g.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	g.failed = true
+	header := g.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(int(grpcCodeOf(statusCode))))
+	header.Set("Grpc-Message", http.StatusText(statusCode))
+	g.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+func (g *grpcStatusWriter) Write(b []byte) (int, error) {
+	if g.failed { // 丢弃错误响应体
+		return len(b), nil
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+func (g *grpcStatusWriter) Flush() {
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
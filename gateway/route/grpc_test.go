@@ -0,0 +1,293 @@
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"final-design/gateway/config"
+	"final-design/pb"
+	"final-design/pkg/common"
+	"final-design/pkg/loadbalance"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func loadGrpcConfig(t *testing.T, yaml string) {
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+	if err := config.LoadGrpcConfig(viper.GetViper()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGrpcTarget(t *testing.T) {
+	loadGrpcConfig(t, `
+grpc:
+  transcodePrefix: /rpc/
+  services:
+    - {name: pb.UserService, service: user, methods: [GetUser, Authorities], transcode: true, roles: [ROLE_ADMIN]}
+    - {name: pb.UserService, service: user, methods: [Check], permitAll: true}
+    - {name: pb.SecKillService, service: sk-core}
+`)
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		transcode     bool
+		wantService   string
+		wantDestPath  string
+		wantPermitAll bool
+	}{
+		{"gRPC请求", "POST", "/pb.UserService/GetUser", false, "user", "/pb.UserService/GetUser", false},
+		{"按方法匹配配置", "POST", "/pb.UserService/Check", false, "user", "/pb.UserService/Check", true},
+		{"没有限制方法", "POST", "/pb.SecKillService/secKill", false, "sk-core", "/pb.SecKillService/secKill", false},
+		{"方法不允许", "POST", "/pb.UserService/DeleteUser", false, "", "", false},
+		{"服务未配置", "POST", "/pb.OAuthService/CheckToken", false, "", "", false},
+		{"路径格式错误", "POST", "/pb.UserService/GetUser/1", false, "", "", false},
+		{"JSON调用", "POST", "/rpc/pb.UserService/GetUser", true, "user", "/pb.UserService/GetUser", false},
+		{"JSON调用只支持POST", "GET", "/rpc/pb.UserService/GetUser", true, "", "", false},
+		{"方法不允许JSON调用", "POST", "/rpc/pb.UserService/Check", true, "", "", false},
+		{"服务不允许JSON调用", "POST", "/rpc/pb.SecKillService/secKill", true, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			target, policy := grpcTarget(r, tt.transcode)
+			if (target == nil) != (tt.wantService == "") {
+				t.Fatalf("grpcTarget() = %+v, want service %q", target, tt.wantService)
+			}
+			if target == nil {
+				return
+			}
+			if target.Service != tt.wantService || target.DestPath != tt.wantDestPath || !target.Grpc || target.Transcode != tt.transcode {
+				t.Errorf("grpcTarget() = %+v", target)
+			}
+			if policy == nil || policy.PermitAll != tt.wantPermitAll {
+				t.Errorf("policy = %+v, want permitAll %v", policy, tt.wantPermitAll)
+			}
+		})
+	}
+}
+
+func TestIsTranscodeRequest(t *testing.T) {
+	loadGrpcConfig(t, `
+grpc:
+  transcodePrefix: /rpc
+`)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/rpc/pb.UserService/GetUser", true},
+		{"/rpcx/pb.UserService/GetUser", false},
+		{"/rpc", false},
+		{"/user/rpc/x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isTranscodeRequest(httptest.NewRequest(http.MethodPost, tt.path, nil)); got != tt.want {
+				t.Errorf("isTranscodeRequest(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+type testUserServer struct {
+	pb.UnimplementedUserServiceServer
+	md metadata.MD
+}
+
+func (s *testUserServer) GetUser(ctx context.Context, req *pb.UserIdRequest) (*pb.GetUserResponse, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	if req.UserId != 1 {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &pb.GetUserResponse{UserId: 1, Username: "alice"}, nil
+}
+
+// 启动只实现GetUser的gRPC服务，返回实例
+func startUserServer(t *testing.T) (*common.ServiceInstance, *testUserServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	userServer := &testUserServer{}
+	pb.RegisterUserServiceServer(server, userServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return &common.ServiceInstance{Host: "127.0.0.1", GrpcPort: listener.Addr().(*net.TCPAddr).Port}, userServer
+}
+
+func TestInvoke(t *testing.T) {
+	instance, userServer := startUserServer(t)
+	router := HystrixRouter{logger: log.NewNopLogger()}
+
+	tests := []struct {
+		name       string
+		destPath   string
+		body       string
+		wantStatus int
+		wantFields map[string]interface{} // 成功时响应中的字段，失败时为error和message
+	}{
+		{"成功", "/pb.UserService/GetUser", `{"userId": "1"}`, http.StatusOK,
+			map[string]interface{}{"userId": "1", "username": "alice", "age": float64(0), "err": ""}},
+		{"数字类型的int64", "/pb.UserService/GetUser", `{"userId": 1}`, http.StatusOK,
+			map[string]interface{}{"username": "alice"}},
+		{"gRPC错误转换为HTTP错误", "/pb.UserService/GetUser", `{"userId": "2"}`, http.StatusNotFound,
+			map[string]interface{}{"error": "not_found", "message": "user not found", "service": "user"}},
+		{"空请求体", "/pb.UserService/GetUser", "", http.StatusNotFound,
+			map[string]interface{}{"error": "not_found"}},
+		{"JSON错误", "/pb.UserService/GetUser", `{"userId": "x"}`, http.StatusBadRequest,
+			map[string]interface{}{"error": "invalid_argument"}},
+		{"未知字段", "/pb.UserService/GetUser", `{"id": 1}`, http.StatusBadRequest,
+			map[string]interface{}{"error": "invalid_argument"}},
+		{"服务未实现的方法", "/pb.UserService/Check", `{}`, http.StatusNotImplemented,
+			map[string]interface{}{"error": "unimplemented"}},
+		{"未知方法", "/pb.UserService/Nothing", `{}`, http.StatusNotImplemented,
+			map[string]interface{}{"error": "unimplemented"}},
+		{"未知服务", "/pb.NothingService/GetUser", `{}`, http.StatusNotImplemented,
+			map[string]interface{}{"error": "unimplemented"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/rpc"+tt.destPath, strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer token")
+			r.Header.Set("X-User-Id", "1")
+			r.Header.Set("Cookie", "session=1")
+			w := httptest.NewRecorder()
+			outlier := loadbalance.NewOutlierDetector(1, time.Minute, 100, nil)
+			target := &config.RouteTarget{Service: "user", DestPath: tt.destPath, Grpc: true, Transcode: true}
+			if err := router.invoke(w, r, instance, target, outlier); err != nil {
+				t.Fatalf("invoke() error = %v", err)
+			}
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response %q is not json: %v", w.Body.String(), err)
+			}
+			for key, want := range tt.wantFields {
+				if got[key] != want {
+					t.Errorf("response %s = %v, want %v", key, got[key], want)
+				}
+			}
+			// 服务返回的业务错误不剔除实例
+			if len(outlier.Filter([]*common.ServiceInstance{instance})) != 1 {
+				t.Error("instance is ejected")
+			}
+		})
+	}
+
+	// 只转发令牌和X-开头的请求头
+	md := userServer.md
+	if len(md.Get("authorization")) != 1 || len(md.Get("x-user-id")) != 1 || len(md.Get("cookie")) != 0 {
+		t.Errorf("forwarded metadata = %v", md)
+	}
+}
+
+func TestInvokeUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := &common.ServiceInstance{Host: "127.0.0.1", GrpcPort: listener.Addr().(*net.TCPAddr).Port}
+	listener.Close()
+
+	router := HystrixRouter{logger: log.NewNopLogger()}
+	outlier := loadbalance.NewOutlierDetector(1, time.Minute, 100, nil)
+	target := &config.RouteTarget{Service: "user", DestPath: "/pb.UserService/GetUser", Grpc: true, Transcode: true}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/rpc/pb.UserService/GetUser", strings.NewReader(`{"userId": "1"}`))
+	// 实例不可用时返回错误，由调用方换一个实例重试，响应不写给客户端
+	if err := router.invoke(w, r, instance, target, outlier); status.Code(err) != codes.Unavailable {
+		t.Fatalf("invoke() error = %v, want unavailable", err)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("response written: %s", w.Body.String())
+	}
+	if len(outlier.Filter([]*common.ServiceInstance{instance})) != 0 {
+		t.Error("unavailable instance is not ejected")
+	}
+}
+
+func TestGrpcStatusMapping(t *testing.T) {
+	tests := []struct {
+		code     codes.Code
+		wantHttp int
+		wantName string
+	}{
+		{codes.OK, http.StatusOK, ""}, // OK不会作为错误返回
+		{codes.InvalidArgument, http.StatusBadRequest, "invalid_argument"},
+		{codes.Unauthenticated, http.StatusUnauthorized, "unauthenticated"},
+		{codes.PermissionDenied, http.StatusForbidden, "permission_denied"},
+		{codes.NotFound, http.StatusNotFound, "not_found"},
+		{codes.AlreadyExists, http.StatusConflict, "already_exists"},
+		{codes.ResourceExhausted, http.StatusTooManyRequests, "resource_exhausted"},
+		{codes.Canceled, 499, "canceled"},
+		{codes.Unavailable, http.StatusServiceUnavailable, "unavailable"},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout, "deadline_exceeded"},
+		{codes.DataLoss, http.StatusInternalServerError, "data_loss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			if got := httpStatusOf(tt.code); got != tt.wantHttp {
+				t.Errorf("httpStatusOf() = %d, want %d", got, tt.wantHttp)
+			}
+			if got := snakeCase(tt.code.String()); tt.wantName != "" && got != tt.wantName {
+				t.Errorf("snakeCase(%s) = %s, want %s", tt.code, got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestGrpcStatusWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		wantGrpc string // grpc-status响应头
+		wantBody string
+	}{
+		{"服务的gRPC响应原样转发", http.StatusOK, "", "payload"},
+		{"未认证", http.StatusUnauthorized, "16", ""},
+		{"无权访问", http.StatusForbidden, "7", ""},
+		{"限流", http.StatusTooManyRequests, "8", ""},
+		{"服务不可用", http.StatusServiceUnavailable, "14", ""},
+		{"超时", http.StatusGatewayTimeout, "4", ""},
+		{"其它错误", http.StatusInternalServerError, "2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w := newGrpcStatusWriter(rec)
+			w.Header().Set("Content-Length", "7")
+			w.WriteHeader(tt.status)
+			w.Write([]byte("payload"))
+			// gRPC错误也使用HTTP 200
+			if rec.Code != http.StatusOK || rec.Body.String() != tt.wantBody {
+				t.Errorf("response = %d %q, want 200 %q", rec.Code, rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get("Grpc-Status"); got != tt.wantGrpc {
+				t.Errorf("Grpc-Status = %q, want %q", got, tt.wantGrpc)
+			}
+			if tt.wantGrpc != "" && (rec.Header().Get("Content-Type") != "application/grpc" || rec.Header().Get("Content-Length") != "") {
+				t.Errorf("header = %v", rec.Header())
+			}
+		})
+	}
+}
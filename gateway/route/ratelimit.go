@@ -0,0 +1,85 @@
+package route
+
+import (
+	"encoding/json"
+	"final-design/gateway/config"
+	"final-design/pb"
+	"final-design/pkg/ratelimiter"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 按匹配的限流规则消耗配额，超过配额时返回429并返回false；
+// 响应头X-RateLimit-*取剩余配额最少的规则，redis不可用时不限流
+func (router HystrixRouter) rateLimit(w http.ResponseWriter, r *http.Request, target *config.RouteTarget, token *pb.CheckTokenResponse) bool {
+	rateLimitConf := config.CurrentRateLimitConfig()
+	rules := rateLimitConf.Match(r.Method, target.Path())
+	if len(rules) == 0 {
+		return true
+	}
+
+	var tightest *ratelimiter.Result
+	for _, rule := range rules {
+		key := rateLimitConf.KeyPrefix + rule.Path + ":" + rateLimitSubject(rateLimitConf, rule, r, token)
+		result, err := router.limiter.Allow(key, ratelimiter.Limit{
+			Rate:   rule.Rate,
+			Period: time.Duration(rule.Period) * time.Second,
+			Burst:  rule.Burst,
+		})
+		if err != nil {
+			router.logger.Log("rate limit error", err)
+			continue
+		}
+		if !result.Allowed {
+			setRateLimitHeaders(w.Header(), result)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(errorResponse{
+				Code:    http.StatusTooManyRequests,
+				Error:   "rate_limited",
+				Message: "too many requests",
+				Service: target.Service,
+			})
+			return false
+		}
+		if tightest == nil || result.Remaining < tightest.Remaining {
+			tightest = result
+		}
+	}
+	if tightest != nil {
+		setRateLimitHeaders(w.Header(), tightest)
+	}
+	return true
+}
+
+// 限流对象：用户id、客户端IP、已登记API key的标识或整个路由
+func rateLimitSubject(rateLimitConf *config.RateLimitConf, rule *config.RateLimitRule, r *http.Request, token *pb.CheckTokenResponse) string {
+	switch rule.By {
+	case config.RateLimitByRoute:
+		return "route"
+	case config.RateLimitByApiKey:
+		if apiKeyId, ok := rateLimitConf.ApiKeyId(r.Header.Get(rateLimitConf.ApiKeyHeader)); ok {
+			return "apikey:" + apiKeyId
+		}
+		// 未登记的API key按用户或IP限流，避免每次请求更换key绕过限流
+		fallthrough
+	case config.RateLimitByUser:
+		if token != nil && token.UserDetails != nil {
+			return "user:" + strconv.FormatInt(token.UserDetails.UserId, 10)
+		}
+	}
+	return "ip:" + clientIp(r)
+}
+
+func setRateLimitHeaders(header http.Header, result *ratelimiter.Result) {
+	header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit.Rate))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
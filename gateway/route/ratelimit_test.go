@@ -0,0 +1,127 @@
+package route
+
+import (
+	"final-design/gateway/config"
+	"final-design/pb"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRateLimitSubject(t *testing.T) {
+	rateLimitConf := &config.RateLimitConf{ApiKeyHeader: "X-Api-Key"}
+	userToken := &pb.CheckTokenResponse{UserDetails: &pb.UserDetails{UserId: 42}}
+	clientToken := &pb.CheckTokenResponse{ClientOnly: true, ClientDetails: &pb.ClientDetails{ClientId: "report"}}
+
+	tests := []struct {
+		name   string
+		by     string
+		apiKey string
+		token  *pb.CheckTokenResponse
+		want   string
+	}{
+		{"按路由", config.RateLimitByRoute, "", userToken, "route"},
+		{"按用户", config.RateLimitByUser, "", userToken, "user:42"},
+		{"没有用户时按IP", config.RateLimitByUser, "", clientToken, "ip:203.0.113.7"},
+		{"未登录时按IP", config.RateLimitByUser, "", nil, "ip:203.0.113.7"},
+		{"按IP", config.RateLimitByIp, "", userToken, "ip:203.0.113.7"},
+		{"没有API key时按IP", config.RateLimitByApiKey, "", nil, "ip:203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/sk-app/sec/info", nil)
+			r.RemoteAddr = "203.0.113.7:5555"
+			r.Header.Set("X-Forwarded-For", "1.1.1.1") // 网关是入口，不信任客户端填写的地址
+			if tt.apiKey != "" {
+				r.Header.Set("X-Api-Key", tt.apiKey)
+			}
+			if got := rateLimitSubject(rateLimitConf, &config.RateLimitRule{By: tt.by}, r, tt.token); got != tt.want {
+				t.Errorf("rateLimitSubject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitSubjectApiKey(t *testing.T) {
+	// 只登记partner-secret-1和partner-secret-2
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(`
+rateLimit:
+  apiKeyHeader: X-Partner-Key
+  apiKeys:
+    - 19f3dce1ff021576b4498c55a5aaadf7b1983fcccf907b72fd4c3f27bdddc2ad
+    - 07d3d87cf27192e5e4d2c6a4334c3cc6f3a8d9dc4fa90fcbe4a1d9f4ccb712cf
+  rules:
+    - {path: /sk-app/**, by: apikey, rate: 100, period: 60}
+`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadRateLimitConfig(v); err != nil {
+		t.Fatal(err)
+	}
+	rateLimitConf := config.CurrentRateLimitConfig()
+	rule := rateLimitConf.Rules[0]
+	userToken := &pb.CheckTokenResponse{UserDetails: &pb.UserDetails{UserId: 42}}
+	subjectOf := func(apiKey string, token *pb.CheckTokenResponse) string {
+		r := httptest.NewRequest(http.MethodGet, "/sk-app/sec/info", nil)
+		r.RemoteAddr = "203.0.113.7:5555"
+		r.Header.Set("X-Partner-Key", apiKey)
+		return rateLimitSubject(rateLimitConf, rule, r, token)
+	}
+
+	first, second := subjectOf("partner-secret-1", nil), subjectOf("partner-secret-2", nil)
+	if !strings.HasPrefix(first, "apikey:") || strings.Contains(first, "partner-secret") {
+		t.Errorf("subject = %q, want hashed api key", first)
+	}
+	if first != subjectOf("partner-secret-1", userToken) {
+		t.Error("same api key gives different subjects")
+	}
+	if first == second {
+		t.Error("different api keys share a subject")
+	}
+
+	// 每次请求更换未登记的key不能得到新的配额
+	tests := []struct {
+		name  string
+		token *pb.CheckTokenResponse
+		want  string
+	}{
+		{"未登记的key按用户", userToken, "user:42"},
+		{"未登记的key且未登录时按IP", nil, "ip:203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				if got := subjectOf(fmt.Sprintf("random-key-%d", i), tt.token); got != tt.want {
+					t.Errorf("rateLimitSubject() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCeilSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{time.Minute, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d.String(), func(t *testing.T) {
+			if got := ceilSeconds(tt.d); got != tt.want {
+				t.Errorf("ceilSeconds(%v) = %d, want %d", tt.d, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,73 +1,221 @@
 package route
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"final-design/gateway/config"
 	"final-design/pb"
-	"final-design/pkg/client"
-	"final-design/pkg/discover"
+	"final-design/pkg/cache"
+	"final-design/pkg/common"
+	conf "final-design/pkg/config"
 	"final-design/pkg/loadbalance"
+	"final-design/pkg/ratelimiter"
+	"final-design/pkg/verifier"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/afex/hystrix-go/hystrix"
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/log"
 	"github.com/openzipkin/zipkin-go"
 	zipkinhttpsvr "github.com/openzipkin/zipkin-go/middleware/http"
 )
 
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrAccessDenied = errors.New("access denied")
+
+	ErrUpstreamStatus = errors.New("upstream server error")
+)
+
 // HystrixRouter hystric路由
 type HystrixRouter struct {
-	svcMap      *sync.Map      // 服务实例，存储已经通过hystrix监控服务列表
-	logger      log.Logger     // 日志工具
-	fallbackMsg string         // 回调消息
-	tracer      *zipkin.Tracer // 服务追踪对象
-	loadBalance loadbalance.LoadBalance
+	svcMap      *sync.Map                 // 已设置熔断参数的hystrix命令 -> 设置的熔断参数
+	logger      log.Logger                // 日志工具
+	fallbackMsg string                    // 回调消息
+	tracer      *zipkin.Tracer            // 服务追踪对象
+	upstreams   *sync.Map                 // 服务名 -> 该服务的负载均衡器和异常检测，第一次请求该服务时创建
+	verifier    verifier.TokenVerifier    // 令牌校验
+	limiter     *ratelimiter.RedisLimiter // 限流，配额保存在redis中
+	cache       cache.Store               // 响应缓存，没有配置时为nil
+
+	retryCount    metrics.Counter // 重试次数，按服务名统计
+	ejectionCount metrics.Counter // 实例被剔除次数，按服务名统计
 }
 
-func Routes(zipkinTracer *zipkin.Tracer, fbMsg string, logger log.Logger) http.Handler {
+func Routes(zipkinTracer *zipkin.Tracer, fbMsg string, retryCount, ejectionCount metrics.Counter, logger log.Logger) http.Handler {
 	return HystrixRouter{
-		svcMap:      &sync.Map{},
-		logger:      logger,
-		fallbackMsg: fbMsg,
-		tracer:      zipkinTracer,
-		loadBalance: &loadbalance.RandomLoadBalance{},
+		svcMap:        &sync.Map{},
+		logger:        logger,
+		fallbackMsg:   fbMsg,
+		tracer:        zipkinTracer,
+		upstreams:     &sync.Map{},
+		verifier:      verifier.NewTokenVerifier(),
+		limiter:       ratelimiter.NewRedisLimiter(conf.Redis.RedisConn),
+		cache:         newCacheStore(logger),
+		retryCount:    retryCount,
+		ejectionCount: ejectionCount,
 	}
 }
 
-func preFilter(r *http.Request) bool {
-	// 查询原始请求路径，如：/string-service/calculate/10/5
-	reqPath := r.URL.Path
-	if reqPath == "" {
-		return false
+// 按路由访问策略校验请求，返回令牌的校验结果(不校验令牌的路径为nil)，返回错误时同时返回响应状态码：
+// 缺少令牌或令牌无效返回401，没有匹配的规则或权限不足返回403
+func (router HystrixRouter) preFilter(r *http.Request, rule *config.PolicyRule) (*pb.CheckTokenResponse, int, error) {
+	if rule == nil || rule.DenyAll { // 默认拒绝
+		return nil, http.StatusForbidden, ErrAccessDenied
 	}
-
-	res := config.Match(reqPath) // 匹配成功的不验证token
-	if res {
-		return true
+	if rule.PermitAll { // 不验证token
+		return nil, http.StatusOK, nil
 	}
 
-	authToken := r.Header.Get("Authorization")
+	authToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 	if authToken == "" {
-		return false
+		return nil, http.StatusUnauthorized, ErrUnauthorized
 	}
 
-	oauthClient, _ := client.NewOAuthClient("oauth", nil, nil)
-	resp, remoteErr := oauthClient.CheckToken(context.Background(), nil, &pb.CheckTokenRequest{
-		Token: authToken,
-	})
-	// fmt.Printf("%+v\n", resp)
-	if remoteErr != nil || resp == nil {
+	resp, remoteErr := router.verifier.Verify(context.Background(), authToken)
+	if remoteErr != nil || resp == nil || !resp.IsValidToken {
 		config.Logger.Log("resp", resp)
 		config.Logger.Log("remoteErr", remoteErr)
-		return false
-	} else {
-		return true
+		return nil, http.StatusUnauthorized, ErrUnauthorized
+	}
+	if !rule.IsGranted(resp) {
+		return nil, http.StatusForbidden, ErrAccessDenied
+	}
+	return resp, http.StatusOK, nil
+}
+
+// 设置转发给服务的用户id请求头，同时作为一致性哈希的key；
+// 请求头只能由网关根据令牌设置，客户端传入的值被丢弃，没有用户时按客户端IP哈希
+func (router HystrixRouter) balanceKey(r *http.Request, token *pb.CheckTokenResponse) string {
+	header := config.LoadBalanceConfig.HashHeader
+	r.Header.Del(header)
+	if token != nil && token.UserDetails != nil {
+		userId := strconv.FormatInt(token.UserDetails.UserId, 10)
+		r.Header.Set(header, userId)
+		return userId
+	}
+	return clientIp(r)
+}
+
+// 客户端IP，网关直接面对客户端，不信任客户端传入的X-Forwarded-For
+func clientIp(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// 转发请求，实例连接失败或返回5xx时按配置换一个没有尝试过的实例重试
+func (router HystrixRouter) forward(w http.ResponseWriter, r *http.Request, target *config.RouteTarget,
+	balanceKey string, canary *config.CanaryDecision) error {
+	serviceName := target.Service
+	up := router.upstreamOf(serviceName, canary.Group())
+	retryConf := config.LoadBalanceConfig.Retry
+	maxRetries := 0
+	if isIdempotent(r) {
+		maxRetries = retryConf.MaxRetries
+	}
+	var body []byte
+	if maxRetries > 0 {
+		var ok bool
+		if body, ok = bufferBody(r, retryConf.MaxBodyBytes); !ok {
+			maxRetries = 0
+		}
+	}
+
+	// 为反向代理增加追踪逻辑，使用如下RoundTrip代替默认Transport；gRPC请求使用HTTP/2明文连接
+	transportOptions := []zipkinhttpsvr.TransportOption{zipkinhttpsvr.TransportTrace(true)}
+	if target.Grpc {
+		transportOptions = append(transportOptions, zipkinhttpsvr.RoundTripper(h2cTransport))
+	}
+	roundTrip, _ := zipkinhttpsvr.NewTransport(router.tracer, transportOptions...)
+	tried := make(map[string]bool)
+	for attempt := 0; ; attempt++ {
+		// 调用consul api 查询serviceName，按该服务配置的策略选择实例
+		serviceInstance, remaining, release, err := up.selectService(serviceName, balanceKey, canary, tried)
+		if err != nil {
+			return err
+		}
+		tried[serviceInstance.Address()] = true
+		canRetry := attempt < maxRetries && remaining > 0
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if target.Transcode {
+			err = router.invoke(w, r, serviceInstance, target, up.outlier)
+		} else {
+			err = router.proxy(w, r, roundTrip, serviceInstance, target, up.outlier, canRetry)
+		}
+		release()
+		// 客户端已断开时不再重试
+		if err == nil || !canRetry || r.Context().Err() != nil {
+			return err
+		}
+		router.logger.Log("retry", serviceName, "service_addr", serviceInstance.Address(), "err", err)
+		router.retryCount.With("service", serviceName).Add(1)
+	}
+}
+
+// 转发到指定实例；canRetry为true时实例返回的5xx响应不写给客户端，而是作为错误返回
+func (router HystrixRouter) proxy(w http.ResponseWriter, r *http.Request, roundTrip http.RoundTripper,
+	serviceInstance *common.ServiceInstance, target *config.RouteTarget, outlier *loadbalance.OutlierDetector, canRetry bool) error {
+	director := func(req *http.Request) {
+		router.logger.Log("service_addr", serviceInstance.Host, serviceInstance.Port, "")
+
+		// 设置代理服务地址信息，请求路径为路由改写后的路径；gRPC请求转发到实例的rpcPort
+		port := serviceInstance.Port
+		if target.Grpc {
+			port = serviceInstance.GrpcPort
+		}
+		req.URL.Scheme = "http"
+		req.URL.Host = fmt.Sprintf("%s:%d", serviceInstance.Host, port)
+		req.URL.Path = target.DestPath
+		req.URL.RawPath = ""
+	}
+
+	modifyResponse := func(resp *http.Response) error {
+		if resp.StatusCode < http.StatusInternalServerError {
+			outlier.ReportSuccess(serviceInstance)
+		} else {
+			outlier.ReportFailure(serviceInstance)
+			if canRetry {
+				return fmt.Errorf("%w: %d", ErrUpstreamStatus, resp.StatusCode)
+			}
+		}
+		if target.Route != nil {
+			target.Route.ResponseHeaders.Apply(resp.Header)
+		}
+		return nil
+	}
+
+	var proxyError error = nil
+	// 反向代理失败时错误处理
+	errHandler := func(ew http.ResponseWriter, er *http.Request, err error) {
+		proxyError = err
+		// 5xx已在modifyResponse中计数，客户端断开不算实例失败
+		if !errors.Is(err, ErrUpstreamStatus) && r.Context().Err() == nil {
+			outlier.ReportFailure(serviceInstance)
+		}
 	}
+
+	proxy := &httputil.ReverseProxy{
+		Director:       director,
+		Transport:      roundTrip,
+		ModifyResponse: modifyResponse,
+		ErrorHandler:   errHandler,
+	}
+	proxy.ServeHTTP(w, r)
+
+	return proxyError
 }
 
 // func postFilter() {
@@ -85,72 +233,85 @@ func (router HystrixRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var err error
-	if reqPath == "" || !preFilter(r) { // 可能checkToken失败，过期或者不合法
-		err = errors.New("illegal request")
-		w.WriteHeader(403)
+	// gRPC请求和JSON转gRPC请求按grpc配置查找服务；其它请求按路由表查找服务名称和转发路径，没有匹配的路由时第一段路径是服务名称
+	var target *config.RouteTarget
+	var rule *config.PolicyRule
+	if grpcRequest := isGrpcRequest(r); grpcRequest || isTranscodeRequest(r) {
+		if grpcRequest {
+			w = newGrpcStatusWriter(w)
+		}
+		if target, rule = grpcTarget(r, !grpcRequest); target == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else {
+		var ok bool
+		if target, ok = config.CurrentRouteTable().Resolve(r); !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// 路由配置了访问要求时使用路由的要求，否则按转发后的路径匹配，如：/string-service/calculate/10/5
+		rule = target.Policy(r.Method)
+	}
+	serviceName := target.Service
+	if target.Route != nil {
+		router.logger.Log("route", target.Route.Id, "service", serviceName, "destPath", target.DestPath)
+	}
+
+	token, status, err := router.preFilter(r, rule) // 可能checkToken失败，过期或者不合法，或者权限不足
+	if err != nil {
+		w.WriteHeader(status)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	// 按照分隔符'/'对路径进行分隔，获取服务名称serviceName
-	pathArray := strings.Split(reqPath, "/")
-	serviceName := pathArray[1]
-
-	// 检查是否已经加入监控
-	if _, ok := router.svcMap.Load(serviceName); !ok {
-		// 把serviceName 作为命令对象，设置参数
-		hystrix.ConfigureCommand(serviceName, hystrix.CommandConfig{Timeout: 1000})
-		router.svcMap.Store(serviceName, serviceName)
+	// 先按路由修改请求头，用户id请求头只能由网关设置
+	if target.Route != nil {
+		target.Route.RequestHeaders.Apply(r.Header)
 	}
+	balanceKey := router.balanceKey(r, token)
+	// 按灰度规则选择服务版本
+	canary := config.CurrentCanaryConfig().Decide(serviceName, r, balanceKey)
 
-	// 执行命令
-	err = hystrix.Do(serviceName, func() (err error) {
-		// 调用consul api 查询serviceName
-		serviceInstance, err := discover.DiscoverService(serviceName)
-		if err != nil {
-			return err
-		}
-
-		director := func(req *http.Request) {
-			// 重新组织请求路径，去掉服务名称部分
-			destPath := strings.Join(pathArray[2:], "/")
-
-			// 随机选择一个服务实例
-			router.logger.Log("service_addr", serviceInstance.Host, serviceInstance.Port, "")
-
-			// 设置代理服务地址信息
-			req.URL.Scheme = "http"
-			req.URL.Host = fmt.Sprintf("%s:%d", serviceInstance.Host, serviceInstance.Port)
-			req.URL.Path = "/" + destPath
-		}
-
-		var proxyError error = nil
-		// 为反向代理增加追踪逻辑，使用如下RoundTrip代替默认Transport
-		roundTrip, _ := zipkinhttpsvr.NewTransport(router.tracer, zipkinhttpsvr.TransportTrace(true))
+	// 限流，超过配额返回429
+	if !router.rateLimit(w, r, target, token) {
+		return
+	}
 
-		// 反向代理失败时错误处理
-		errHandler := func(ew http.ResponseWriter, er *http.Request, err error) {
-			proxyError = err
-		}
+	// 读接口的响应缓存，命中时不再转发
+	cacheRule, cacheKey := router.cacheKey(r, target, canary)
+	if cacheRule != nil && router.serveCached(w, r, cacheKey) {
+		return
+	}
 
-		proxy := &httputil.ReverseProxy{
-			Director:     director,
-			Transport:    roundTrip,
-			ErrorHandler: errHandler,
-		}
-		proxy.ServeHTTP(w, r)
+	// 按路由和服务查找熔断参数，路由配置了超时时间时使用单独的熔断器；参数变化后重新设置
+	commandName, commandConfig := config.CurrentHystrixConfig().Command(r.Method, target.Path(), serviceName)
+	if target.Route != nil && target.Route.Timeout > 0 {
+		commandName += " @" + target.Route.Id
+		commandConfig.Timeout = target.Route.Timeout
+	}
+	if configured, ok := router.svcMap.Load(commandName); !ok || configured != commandConfig {
+		hystrix.ConfigureCommand(commandName, commandConfig)
+		router.svcMap.Store(commandName, commandConfig)
+	}
 
-		return proxyError
-	}, func(err error) error {
-		// run执行失败，返回fallback信息
-		router.logger.Log("fallback error description", err.Error())
-		return errors.New(router.fallbackMsg)
-	})
+	// 执行命令，超时后转发可能仍在进行，通过guardedWriter避免与fallback响应同时写入
+	gw := newGuardedWriter(w)
+	var out http.ResponseWriter = gw
+	var rec *cacheRecorder
+	if cacheRule != nil { // 需要缓存的响应先写入rec，转发成功后再写给客户端
+		rec = newCacheRecorder(gw, config.CurrentCacheConfig().MaxBodyBytes)
+		out = rec
+	}
+	err = hystrix.Do(commandName, func() error {
+		return router.forward(out, r, target, balanceKey, canary)
+	}, nil)
 
-	// Do方法执行失败，响应错误信息
+	// Do方法执行失败，返回fallback信息
 	if err != nil {
-		w.WriteHeader(500)
-		w.Write([]byte(err.Error()))
+		router.logger.Log("fallback error description", err.Error())
+		router.fallback(gw, serviceName, err)
+	} else if rec != nil {
+		router.storeCached(gw, r, rec, cacheKey, cacheRule)
 	}
 }
@@ -0,0 +1,99 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"final-design/gateway/config"
+	"final-design/pb"
+	conf "final-design/pkg/config"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+type staticVerifier map[string]*pb.CheckTokenResponse
+
+func (v staticVerifier) Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error) {
+	if resp, ok := v[tokenValue]; ok {
+		return resp, nil
+	}
+	return nil, errors.New("oauth-service unavailable")
+}
+
+// 使用配置中心中gateway-dev.yaml的访问策略，配置修改后规则仍然符合预期
+func loadDevPolicy(t *testing.T) {
+	content, err := os.ReadFile("../../configServer/master/gateway-dev.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.RoutePolicy
+	t.Cleanup(func() {
+		viper.Reset()
+		config.RoutePolicy = saved
+	})
+	config.RoutePolicy = config.Policy{}
+	if err := conf.Sub("policy", &config.RoutePolicy); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.RoutePolicy.Init([]interface{}{"/oauth/**", "/string/**"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreFilter(t *testing.T) {
+	loadDevPolicy(t)
+	router := HystrixRouter{verifier: staticVerifier{
+		"admin": {IsValidToken: true, ClientDetails: &pb.ClientDetails{ClientId: "admin"},
+			UserDetails: &pb.UserDetails{UserId: 1, Authorities: []string{"ROLE_ADMIN"}}},
+		"user": {IsValidToken: true, ClientDetails: &pb.ClientDetails{ClientId: "app", Scope: []string{"order.read"}},
+			UserDetails: &pb.UserDetails{UserId: 2, Authorities: []string{"ROLE_USER"}}},
+		"report": {IsValidToken: true, ClientOnly: true,
+			ClientDetails: &pb.ClientDetails{ClientId: "report", Scope: []string{"order.read"}}},
+		"expired": {IsValidToken: false, Err: "token is expired"},
+	}}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"登录不需要令牌", "POST", "/oauth/token", "", http.StatusOK},
+		{"注册不需要令牌", "POST", "/user/user/register", "", http.StatusOK},
+		{"管理员访问后台", "GET", "/sk-admin/product/list", "admin", http.StatusOK},
+		{"普通用户访问后台", "GET", "/sk-admin/product/list", "user", http.StatusForbidden},
+		{"未登录访问后台", "GET", "/sk-admin/product/list", "", http.StatusUnauthorized},
+		{"令牌过期", "GET", "/sk-admin/product/list", "expired", http.StatusUnauthorized},
+		{"令牌无法校验", "GET", "/sk-admin/product/list", "unknown", http.StatusUnauthorized},
+		{"客户端令牌读取订单", "GET", "/sk-admin/order/list", "report", http.StatusOK},
+		{"客户端令牌只能读取", "POST", "/sk-admin/order/list", "report", http.StatusForbidden},
+		{"用户令牌不能使用客户端的scope", "GET", "/sk-admin/order/list", "user", http.StatusForbidden},
+		{"用户秒杀", "POST", "/sk-app/sec/kill", "user", http.StatusOK},
+		{"客户端令牌不能秒杀", "POST", "/sk-app/sec/kill", "report", http.StatusForbidden},
+		{"内部接口对管理员也拒绝", "POST", "/user/user/check", "admin", http.StatusForbidden},
+		{"个人信息", "GET", "/user/user/profile", "user", http.StatusOK},
+		{"管理用户", "POST", "/user/user/manage/disable", "user", http.StatusForbidden},
+		{"没有匹配的规则", "GET", "/unknown/path", "admin", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			_, status, err := router.preFilter(r, config.RoutePolicy.Match(tt.method, tt.path))
+			if status != tt.want || (err == nil) != (tt.want == http.StatusOK) {
+				t.Errorf("preFilter() = %d, %v, want %d", status, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package route
+
+import (
+	"bytes"
+	"final-design/gateway/config"
+	"final-design/pkg/common"
+	"final-design/pkg/discover"
+	"final-design/pkg/loadbalance"
+	"io"
+	"net/http"
+	"time"
+)
+
+// 一个服务的负载均衡器和异常检测
+type upstream struct {
+	loadBalance loadbalance.LoadBalance
+	outlier     *loadbalance.OutlierDetector
+}
+
+// 服务的负载均衡器和异常检测，按灰度版本分组，第一次请求该服务(版本)时按配置创建
+func (router HystrixRouter) upstreamOf(serviceName, group string) *upstream {
+	key := serviceName
+	if group != "" {
+		key += "@" + group
+	}
+	if up, ok := router.upstreams.Load(key); ok {
+		return up.(*upstream)
+	}
+	lb, err := loadbalance.New(config.LoadBalanceConfig.StrategyOf(serviceName))
+	if err != nil { // 启动时已校验，不会发生
+		lb = &loadbalance.RandomLoadBalance{}
+	}
+	outlierConf := config.LoadBalanceConfig.Outlier
+	outlier := loadbalance.NewOutlierDetector(outlierConf.ConsecutiveFailures,
+		time.Duration(outlierConf.EjectionSeconds)*time.Second, outlierConf.MaxEjectionPercent,
+		func(service *common.ServiceInstance) {
+			router.logger.Log("eject", serviceName, "version", service.Version, "service_addr", service.Address())
+			router.ejectionCount.With("service", serviceName).Add(1)
+		})
+	up, _ := router.upstreams.LoadOrStore(key, &upstream{loadBalance: lb, outlier: outlier})
+	return up.(*upstream)
+}
+
+// 从consul中查询服务实例，按灰度规则选择版本，去掉被剔除和已经尝试过的实例后，使用该服务的负载均衡器选择一个实例；
+// remaining为选择后还可以重试的实例数，release在请求结束后调用，供最少连接等策略统计正在处理的请求
+func (up *upstream) selectService(serviceName, key string, canary *config.CanaryDecision, tried map[string]bool) (
+	instance *common.ServiceInstance, remaining int, release func(), err error) {
+	instances := canary.Filter(discover.ConsulService.DiscoverServices(serviceName, discover.Logger))
+	instances = up.outlier.Filter(instances)
+	if len(tried) > 0 {
+		candidates := make([]*common.ServiceInstance, 0, len(instances))
+		for _, service := range instances {
+			if !tried[service.Address()] {
+				candidates = append(candidates, service)
+			}
+		}
+		instances = candidates
+	}
+	if len(instances) == 0 {
+		return nil, 0, nil, discover.ErrNoInstanceExited
+	}
+
+	if keyed, ok := up.loadBalance.(loadbalance.KeyedLoadBalance); ok {
+		instance, err = keyed.SelectServiceByKey(instances, key)
+	} else {
+		instance, err = up.loadBalance.SelectService(instances)
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	release = func() {}
+	if releasable, ok := up.loadBalance.(loadbalance.ReleasableLoadBalance); ok {
+		release = func() { releasable.Release(instance) }
+	}
+	return instance, len(instances) - 1, release, nil
+}
+
+// 可以重试的请求：GET、HEAD，以及由客户端保证幂等、携带Idempotency-Key请求头的请求
+func isIdempotent(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead || r.Header.Get("Idempotency-Key") != ""
+}
+
+// 缓存请求体用于重试，请求体超过maxBytes时返回false，已读取的部分放回请求中不影响转发
+func bufferBody(r *http.Request, maxBytes int64) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil || int64(len(body)) > maxBytes {
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		return nil, false
+	}
+	r.Body.Close()
+	return body, true
+}
@@ -0,0 +1,74 @@
+package route
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		method         string
+		idempotencyKey string
+		want           bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodHead, "", true},
+		{http.MethodPost, "", false},
+		{http.MethodPut, "", false},
+		{http.MethodDelete, "", false},
+		{http.MethodPost, "order-1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+tt.idempotencyKey, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/sk-app/sec/info", nil)
+			if tt.idempotencyKey != "" {
+				r.Header.Set("Idempotency-Key", tt.idempotencyKey)
+			}
+			if got := isIdempotent(r); got != tt.want {
+				t.Errorf("isIdempotent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		noBody   bool
+		maxBytes int64
+		wantOk   bool
+	}{
+		{"没有请求体", "", true, 4, true},
+		{"小于上限", "abc", false, 4, true},
+		{"等于上限", "abcd", false, 4, true},
+		{"超过上限", "abcdefgh", false, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if !tt.noBody {
+				body = strings.NewReader(tt.body)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/sk-app/sec/kill", body)
+			got, ok := bufferBody(r, tt.maxBytes)
+			if ok != tt.wantOk {
+				t.Fatalf("bufferBody() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok {
+				if string(got) != tt.body {
+					t.Errorf("bufferBody() = %q, want %q", got, tt.body)
+				}
+				return
+			}
+			// 超过上限时请求体原样放回，仍能完整转发
+			rest, _ := io.ReadAll(r.Body)
+			if string(rest) != tt.body {
+				t.Errorf("request body after bufferBody() = %q, want %q", rest, tt.body)
+			}
+		})
+	}
+}
@@ -30,12 +30,17 @@ func init() {
 		Logger.Log("Fail to load remote config", err)
 	}
 
-	if err := conf.Sub("mysql", &conf.MysqlConfig); err != nil {
-		Logger.Log("Fail to parse mysql", err)
-	}
+	conf.MustSub("mysql", &conf.MysqlConfig)
 	if err := conf.Sub("trace", &conf.TraceConfig); err != nil {
 		Logger.Log("Fail to parse trace", err)
 	}
+	if err := conf.Sub("jwt", &conf.Jwt); err != nil {
+		Logger.Log("Fail to parse jwt", err)
+	}
+	if err := conf.Sub("oauth", &conf.OAuth); err != nil {
+		Logger.Log("Fail to parse oauth", err)
+	}
+	conf.MustSub("redis", &conf.Redis)
 	zipkinUrl := "http://" + conf.TraceConfig.Host + ":" + conf.TraceConfig.Port + conf.TraceConfig.Url
 	Logger.Log("zipkin url", zipkinUrl)
 	initTracer(zipkinUrl)
@@ -15,6 +15,7 @@ const (
 	OAuth2DetailsKey       = "OAuth2Details"
 	OAuth2ClientDetailsKey = "OAuth2ClientDetails"
 	OAuth2ErrorKey         = "OAuth2Error"
+	MfaUserKey             = "MfaUser" // 两步验证接口的当前用户，来自访问令牌或mfa_token
 )
 
 var (
@@ -28,7 +29,29 @@ type OAuth2Endpoints struct {
 	TokenEndpoint          endpoint.Endpoint
 	CheckTokenEndpoint     endpoint.Endpoint
 	GRPCCheckTokenEndpoint endpoint.Endpoint
+	TokenKeyEndpoint       endpoint.Endpoint
+	JwksEndpoint           endpoint.Endpoint
+	LogoutEndpoint         endpoint.Endpoint
+	AuthorizeEndpoint      endpoint.Endpoint
+	AuthorizePageEndpoint  endpoint.Endpoint
 	HealthCheckEndpoint    endpoint.Endpoint
+
+	// 客户端管理，需要管理员令牌
+	CreateClientEndpoint       endpoint.Endpoint
+	GetClientListEndpoint      endpoint.Endpoint
+	UpdateClientEndpoint       endpoint.Endpoint
+	RotateClientSecretEndpoint endpoint.Endpoint
+	DisableClientEndpoint      endpoint.Endpoint
+	DeleteClientEndpoint       endpoint.Endpoint
+
+	// 解除登录锁定，需要管理员令牌
+	UnlockLoginEndpoint endpoint.Endpoint
+
+	// 两步验证，需要管理员访问令牌或登录时返回的mfa_token
+	MfaStatusEndpoint   endpoint.Endpoint
+	MfaEnrollEndpoint   endpoint.Endpoint
+	MfaActivateEndpoint endpoint.Endpoint
+	MfaDisableEndpoint  endpoint.Endpoint
 }
 
 func MakeClientAuthorizationMiddleware(logger log.Logger) endpoint.Middleware {
@@ -70,6 +93,8 @@ func MakeAuthorityAuthorizationMiddleware(authority string, logger log.Logger) e
 
 			if details, ok := ctx.Value(OAuth2DetailsKey).(*model.OAuth2Details); !ok {
 				return nil, ErrInvalidClientRequest
+			} else if details.IsClientOnly() {
+				return nil, ErrNotPermit
 			} else {
 				for _, value := range details.User.Authorities {
 					if value == authority {
@@ -82,14 +107,58 @@ func MakeAuthorityAuthorizationMiddleware(authority string, logger log.Logger) e
 	}
 }
 
+// 用户令牌需要具有authority角色，client_credentials签发的令牌需要客户端具有scope
+func MakeAuthorityOrScopeAuthorizationMiddleware(authority, scope string, logger log.Logger) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			if err, ok := ctx.Value(OAuth2ErrorKey).(error); ok {
+				return nil, err
+			}
+
+			details, ok := ctx.Value(OAuth2DetailsKey).(*model.OAuth2Details)
+			if !ok || details.Client == nil {
+				return nil, ErrInvalidClientRequest
+			}
+			granted, required := details.Client.Scope, scope
+			if !details.IsClientOnly() {
+				granted, required = details.User.Authorities, authority
+			}
+			for _, value := range granted {
+				if value == required {
+					return next(ctx, request)
+				}
+			}
+			return nil, ErrNotPermit
+		}
+	}
+}
+
+func MakeMfaAuthorizationMiddleware(logger log.Logger) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			if err, ok := ctx.Value(OAuth2ErrorKey).(error); ok {
+				return nil, err
+			}
+
+			if _, ok := ctx.Value(MfaUserKey).(*model.UserDetails); !ok {
+				return nil, ErrInvalidUserRequest
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
 type TokenRequest struct {
 	GrantType string
 	Reader    *http.Request
 }
 
+// 需要两步验证时AccessToken为空，返回MfaToken，EnrollRequired表示需要先绑定
 type TokenResponse struct {
-	AccessToken *model.OAuth2Token `json:"access_token"`
-	Error       string             `json:"error"`
+	AccessToken    *model.OAuth2Token `json:"access_token"`
+	MfaToken       string             `json:"mfa_token,omitempty"`
+	EnrollRequired bool               `json:"enroll_required,omitempty"`
+	Error          string             `json:"error"`
 }
 
 // Make endpoint
@@ -102,10 +171,15 @@ func MakeTokenEndpoint(svc service.TokenGranter, clientSever service.ClientDetai
 			errString = err.Error()
 		}
 
-		return TokenResponse{
+		resp := TokenResponse{
 			AccessToken: token,
 			Error:       errString,
-		}, nil
+		}
+		var mfaErr *service.MfaRequiredError
+		if errors.As(err, &mfaErr) {
+			resp.MfaToken, resp.EnrollRequired = mfaErr.MfaToken, mfaErr.EnrollRequired
+		}
+		return resp, nil
 	}
 }
 
@@ -116,6 +190,8 @@ type CheckTokenRequest struct {
 
 type CheckTokenResponse struct {
 	OAuthDetails *model.OAuth2Details `json:"o_auth_details"`
+	IssuedAt     int64                `json:"issued_at"`   // 令牌签发时间
+	ClientOnly   bool                 `json:"client_only"` // 只代表客户端的令牌，没有用户信息
 	Error        string               `json:"error"`
 }
 
@@ -125,17 +201,357 @@ func MakeCheckTokenEndpoint(svc service.TokenService) endpoint.Endpoint {
 		tokenDetails, err := svc.GetOAuth2DetailsByAccessToken(req.Token)
 
 		var errString = ""
+		var issuedAt int64
 		if err != nil { // token过期 或者 解析错误 都会使err!=nil
 			errString = err.Error()
+		} else if token, err := svc.ReadAccessToken(req.Token); err == nil && token.IssuedTime != nil {
+			issuedAt = token.IssuedTime.Unix()
 		}
 
 		return CheckTokenResponse{
 			OAuthDetails: tokenDetails,
+			IssuedAt:     issuedAt,
+			ClientOnly:   tokenDetails != nil && tokenDetails.IsClientOnly(),
 			Error:        errString,
 		}, nil
 	}
 }
 
+type TokenKeyRequest struct {
+}
+
+// 网关、sk-app等服务拉取校验令牌的密钥，用于在本地校验令牌，只允许keyClients中的客户端访问
+func MakeTokenKeyEndpoint(svc service.TokenEnhancer, keyClients []string) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		clientDetails := ctx.Value(OAuth2ClientDetailsKey).(*model.ClientDetails)
+		for _, clientId := range keyClients {
+			if clientId == clientDetails.ClientId {
+				return svc.TokenKeys(), nil
+			}
+		}
+		return nil, ErrNotPermit
+	}
+}
+
+// 公开发布校验令牌的公钥，不包含对称密钥
+func MakeJwksEndpoint(svc service.TokenEnhancer) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		return svc.TokenKeys().PublicKeys(), nil
+	}
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectUri         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	User                model.UserInfo // 登录表单中的用户名密码
+	MfaCode             string         // 启用两步验证的管理员需要同时提交动态码
+	Denied              bool           // 用户在授权页面拒绝授权
+}
+
+// RedirectUri不为空时重定向到客户端，携带Code或Error；为空说明客户端或重定向地址无效，不能重定向
+type AuthorizeResponse struct {
+	RedirectUri string `json:"-"`
+	Code        string `json:"-"`
+	State       string `json:"-"`
+	Error       string `json:"error"`
+}
+
+// 授权码模式：用户在oauth-service登录并同意授权，客户端只拿到授权码，不接触用户密码
+func MakeAuthorizeEndpoint(svc service.AuthorizationCodeService, userDetailsService service.UserDetailsService,
+	mfaService service.MfaService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*AuthorizeRequest)
+		client, redirectUri, err := svc.ValidateRedirectUri(ctx, req.ClientId, req.RedirectUri)
+		if err != nil {
+			return AuthorizeResponse{Error: err.Error()}, nil
+		}
+
+		resp := AuthorizeResponse{RedirectUri: redirectUri, State: req.State}
+		if req.ResponseType != "code" {
+			resp.Error = "unsupported_response_type"
+			return resp, nil
+		}
+		if req.Denied {
+			resp.Error = "access_denied"
+			return resp, nil
+		}
+		userDetails, err := userDetailsService.GetUserDetailByUsername(ctx, req.User.Username, req.User.Password, req.User.IdType)
+		if err != nil {
+			resp.Error = "access_denied"
+			return resp, nil
+		}
+		if err := mfaService.VerifyLogin(ctx, userDetails, req.MfaCode); err != nil {
+			resp.Error = "access_denied"
+			return resp, nil
+		}
+		code, err := svc.CreateAuthorizationCode(ctx, client, userDetails, req.RedirectUri, req.CodeChallenge, req.CodeChallengeMethod)
+		if err == service.ErrInvalidCodeChallenge {
+			resp.Error = "invalid_request"
+			return resp, nil
+		} else if err != nil {
+			resp.Error = "server_error"
+			return resp, nil
+		}
+		resp.Code = code
+		return resp, nil
+	}
+}
+
+// 授权页面：登录表单中回传的授权参数；Error不为空时不显示表单
+type AuthorizePageResponse struct {
+	ResponseType        string
+	ClientId            string
+	RedirectUri         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Error               string
+}
+
+// 授权页面：校验客户端和重定向地址后由oauth-service显示登录和授权表单，用户名密码只提交到oauth-service
+func MakeAuthorizePageEndpoint(svc service.AuthorizationCodeService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*AuthorizeRequest)
+		if _, _, err := svc.ValidateRedirectUri(ctx, req.ClientId, req.RedirectUri); err != nil {
+			return AuthorizePageResponse{Error: err.Error()}, nil
+		}
+		return AuthorizePageResponse{
+			ResponseType:        req.ResponseType,
+			ClientId:            req.ClientId,
+			RedirectUri:         req.RedirectUri,
+			State:               req.State,
+			CodeChallenge:       req.CodeChallenge,
+			CodeChallengeMethod: req.CodeChallengeMethod,
+		}, nil
+	}
+}
+
+type LogoutRequest struct {
+	Token string
+}
+
+// 注销：吊销访问令牌及其刷新令牌，只允许令牌所属的客户端调用
+func MakeLogoutEndpoint(svc service.TokenService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*LogoutRequest)
+		tokenDetails, err := svc.GetOAuth2DetailsByAccessToken(req.Token)
+		if err != nil {
+			return SimpleResponse{Error: err.Error()}, nil
+		}
+		clientDetails := ctx.Value(OAuth2ClientDetailsKey).(*model.ClientDetails)
+		if tokenDetails.Client.ClientId != clientDetails.ClientId {
+			return nil, ErrNotPermit
+		}
+		if err := svc.RevokeAccessToken(req.Token); err != nil {
+			return SimpleResponse{Error: err.Error()}, nil
+		}
+		return SimpleResponse{Result: "success"}, nil
+	}
+}
+
+// 客户端信息，不包含密钥
+type ClientInfo struct {
+	ClientId                    string   `json:"client_id"`
+	AccessTokenValiditySeconds  int      `json:"access_token_validity_seconds"`
+	RefreshTokenValiditySeconds int      `json:"refresh_token_validity_seconds"`
+	RegisteredRedirectUri       string   `json:"registered_redirect_uri"`
+	AuthorizedGrantTypes        []string `json:"authorized_grant_types"`
+	Scope                       []string `json:"scope"`
+	PublicClient                bool     `json:"public_client"` // 没有密钥
+	Disabled                    bool     `json:"disabled"`
+}
+
+func toClientDetails(info *ClientInfo) *model.ClientDetails {
+	return &model.ClientDetails{
+		ClientId:                    info.ClientId,
+		AccessTokenValiditySeconds:  info.AccessTokenValiditySeconds,
+		RefreshTokenValiditySeconds: info.RefreshTokenValiditySeconds,
+		RegisteredRedirectUri:       info.RegisteredRedirectUri,
+		AuthorizedGrantTypes:        info.AuthorizedGrantTypes,
+		Scope:                       info.Scope,
+	}
+}
+
+func toClientInfo(client *model.ClientDetails) ClientInfo {
+	return ClientInfo{
+		ClientId:                    client.ClientId,
+		AccessTokenValiditySeconds:  client.AccessTokenValiditySeconds,
+		RefreshTokenValiditySeconds: client.RefreshTokenValiditySeconds,
+		RegisteredRedirectUri:       client.RegisteredRedirectUri,
+		AuthorizedGrantTypes:        client.AuthorizedGrantTypes,
+		Scope:                       client.Scope,
+		PublicClient:                client.ClientSecret == "",
+		Disabled:                    client.Disabled,
+	}
+}
+
+type ClientRequest struct {
+	ClientId string
+	Disabled bool // 禁用接口使用
+}
+
+// 创建和轮换密钥时返回密钥明文，只返回这一次
+type ClientSecretResponse struct {
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	Error        string `json:"error"`
+}
+
+type ClientListResponse struct {
+	Clients []ClientInfo `json:"clients"`
+	Error   string       `json:"error"`
+}
+
+func MakeCreateClientEndpoint(svc service.ClientManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*ClientInfo)
+		secret, err := svc.CreateClient(ctx, toClientDetails(req), req.PublicClient)
+		if err != nil {
+			return ClientSecretResponse{ClientId: req.ClientId, Error: err.Error()}, nil
+		}
+		return ClientSecretResponse{ClientId: req.ClientId, ClientSecret: secret}, nil
+	}
+}
+
+func MakeGetClientListEndpoint(svc service.ClientManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		clients, err := svc.GetClientList(ctx)
+		if err != nil {
+			return ClientListResponse{Error: err.Error()}, nil
+		}
+		infos := make([]ClientInfo, 0, len(clients))
+		for _, client := range clients {
+			infos = append(infos, toClientInfo(client))
+		}
+		return ClientListResponse{Clients: infos}, nil
+	}
+}
+
+func MakeUpdateClientEndpoint(svc service.ClientManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*ClientInfo)
+		if err := svc.UpdateClient(ctx, toClientDetails(req)); err != nil {
+			return SimpleResponse{Error: err.Error()}, nil
+		}
+		return SimpleResponse{Result: "success"}, nil
+	}
+}
+
+func MakeRotateClientSecretEndpoint(svc service.ClientManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*ClientRequest)
+		secret, err := svc.RotateClientSecret(ctx, req.ClientId)
+		if err != nil {
+			return ClientSecretResponse{ClientId: req.ClientId, Error: err.Error()}, nil
+		}
+		return ClientSecretResponse{ClientId: req.ClientId, ClientSecret: secret}, nil
+	}
+}
+
+func MakeDisableClientEndpoint(svc service.ClientManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*ClientRequest)
+		if err := svc.DisableClient(ctx, req.ClientId, req.Disabled); err != nil {
+			return SimpleResponse{Error: err.Error()}, nil
+		}
+		return SimpleResponse{Result: "success"}, nil
+	}
+}
+
+func MakeDeleteClientEndpoint(svc service.ClientManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*ClientRequest)
+		if err := svc.DeleteClient(ctx, req.ClientId); err != nil {
+			return SimpleResponse{Error: err.Error()}, nil
+		}
+		return SimpleResponse{Result: "success"}, nil
+	}
+}
+
+type UnlockLoginRequest struct {
+	Username string
+	IdType   int
+	Ip       string
+}
+
+// 解除用户名或IP的登录锁定，同时清除失败计数
+func MakeUnlockLoginEndpoint(svc service.LoginAttemptService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*UnlockLoginRequest)
+		if err := svc.Unlock(req.Username, req.IdType, req.Ip); err != nil {
+			return SimpleResponse{Error: err.Error()}, nil
+		}
+		return SimpleResponse{Result: "success"}, nil
+	}
+}
+
+type MfaCodeRequest struct {
+	Code string
+}
+
+type MfaStatusResponse struct {
+	Enabled bool   `json:"enabled"`
+	Error   string `json:"error"`
+}
+
+// Uri为otpauth地址，生成二维码后用认证器App扫描
+type MfaEnrollResponse struct {
+	Secret string `json:"secret,omitempty"`
+	Uri    string `json:"uri,omitempty"`
+	Error  string `json:"error"`
+}
+
+// 恢复码明文只返回这一次，每个恢复码只能使用一次
+type MfaActivateResponse struct {
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	Error         string   `json:"error"`
+}
+
+func MakeMfaStatusEndpoint(svc service.MfaService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		enabled, err := svc.Status(ctx, ctx.Value(MfaUserKey).(*model.UserDetails))
+		if err != nil {
+			return MfaStatusResponse{Error: err.Error()}, nil
+		}
+		return MfaStatusResponse{Enabled: enabled}, nil
+	}
+}
+
+func MakeMfaEnrollEndpoint(svc service.MfaService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		secret, uri, err := svc.Enroll(ctx, ctx.Value(MfaUserKey).(*model.UserDetails))
+		if err != nil {
+			return MfaEnrollResponse{Error: err.Error()}, nil
+		}
+		return MfaEnrollResponse{Secret: secret, Uri: uri}, nil
+	}
+}
+
+func MakeMfaActivateEndpoint(svc service.MfaService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*MfaCodeRequest)
+		recoveryCodes, err := svc.Activate(ctx, ctx.Value(MfaUserKey).(*model.UserDetails), req.Code)
+		if err != nil {
+			return MfaActivateResponse{Error: err.Error()}, nil
+		}
+		return MfaActivateResponse{RecoveryCodes: recoveryCodes}, nil
+	}
+}
+
+func MakeMfaDisableEndpoint(svc service.MfaService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*MfaCodeRequest)
+		if err := svc.Disable(ctx, ctx.Value(MfaUserKey).(*model.UserDetails), req.Code); err != nil {
+			return SimpleResponse{Error: err.Error()}, nil
+		}
+		return SimpleResponse{Result: "success"}, nil
+	}
+}
+
 type SimpleRequest struct {
 }
 
@@ -0,0 +1,57 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"final-design/oauth-service/model"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestAuthorityOrScopeAuthorizationMiddleware(t *testing.T) {
+	errToken := errors.New("token is expired")
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{"管理员用户", context.WithValue(context.Background(), OAuth2DetailsKey, &model.OAuth2Details{
+			Client: &model.ClientDetails{ClientId: "app"},
+			User:   &model.UserDetails{Authorities: []string{"ROLE_USER", "ROLE_ADMIN"}},
+		}), nil},
+		{"普通用户", context.WithValue(context.Background(), OAuth2DetailsKey, &model.OAuth2Details{
+			Client: &model.ClientDetails{ClientId: "app", Scope: []string{"order.read"}},
+			User:   &model.UserDetails{Authorities: []string{"ROLE_USER"}},
+		}), ErrNotPermit},
+		{"具有scope的客户端", context.WithValue(context.Background(), OAuth2DetailsKey, &model.OAuth2Details{
+			Client: &model.ClientDetails{ClientId: "report", Scope: []string{"order.read"}},
+		}), nil},
+		{"缺少scope的客户端", context.WithValue(context.Background(), OAuth2DetailsKey, &model.OAuth2Details{
+			Client: &model.ClientDetails{ClientId: "report", Scope: []string{"order.write"}},
+		}), ErrNotPermit},
+		{"客户端scope不能代替用户权限", context.WithValue(context.Background(), OAuth2DetailsKey, &model.OAuth2Details{
+			Client: &model.ClientDetails{ClientId: "app", Scope: []string{"ROLE_ADMIN"}},
+		}), ErrNotPermit},
+		{"没有客户端", context.WithValue(context.Background(), OAuth2DetailsKey, &model.OAuth2Details{}), ErrInvalidClientRequest},
+		{"未认证", context.Background(), ErrInvalidClientRequest},
+		{"令牌错误", context.WithValue(context.Background(), OAuth2ErrorKey, errToken), errToken},
+	}
+
+	middleware := MakeAuthorityOrScopeAuthorizationMiddleware("ROLE_ADMIN", "order.read", log.NewNopLogger())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := middleware(func(ctx context.Context, request interface{}) (interface{}, error) {
+				called = true
+				return nil, nil
+			})
+			if _, err := next(tt.ctx, nil); err != tt.wantErr {
+				t.Fatalf("middleware error = %v, want %v", err, tt.wantErr)
+			}
+			if called != (tt.wantErr == nil) {
+				t.Errorf("next called = %v, want %v", called, tt.wantErr == nil)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"final-design/oauth-service/endpoint"
+	"final-design/oauth-service/model"
 	"final-design/oauth-service/plugins"
 	"final-design/oauth-service/service"
 	"final-design/oauth-service/transport"
@@ -13,15 +14,16 @@ import (
 	conf "final-design/pkg/config"
 	register "final-design/pkg/discover"
 	"final-design/pkg/mysql"
+	"final-design/pkg/redis"
+	"final-design/pkg/shutdown"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
+	kitendpoint "github.com/go-kit/kit/endpoint"
 	kitzipkin "github.com/go-kit/kit/tracing/zipkin"
 	"github.com/openzipkin/zipkin-go/propagation/b3"
 	"golang.org/x/time/rate"
@@ -50,16 +52,45 @@ func main() {
 
 	// add logging middleware
 
-	tokenEnhancer = service.NewJwtTokenEnhancer("secret")
-	tokenStore = service.NewJwtTokenStore(tokenEnhancer.(*service.JwtTokenEnhancer))
+	if len(conf.Jwt.SigningKeys) > 0 {
+		// RS256/ES256等密钥，jwt头部携带kid，activeKid之外的密钥只用于校验
+		signingKey, keys, err := service.LoadSigningKeys(conf.Jwt.ActiveKid, conf.Jwt.SigningKeys)
+		if err != nil {
+			localconfig.Logger.Log("Fail to load signing keys", err)
+			os.Exit(1)
+		}
+		tokenEnhancer = service.NewJwtTokenEnhancerWithKeys(signingKey, keys)
+	} else if conf.Jwt.Secret != "" {
+		tokenEnhancer = service.NewJwtTokenEnhancer(conf.Jwt.Secret)
+	} else {
+		localconfig.Logger.Log("Invalid config", "jwt", "err", "jwt.signingKeys or jwt.secret (env JWT_SECRET) is required")
+		os.Exit(1)
+	}
+	// 授权码保存在redis中，redis令牌存储也使用该连接
+	redis.InitRedis()
+	switch conf.OAuth.TokenStore {
+	case "redis":
+		// 记录已签发的令牌，支持注销和吊销
+		tokenStore = service.NewRedisTokenStore(conf.Redis.RedisConn, tokenEnhancer.(*service.JwtTokenEnhancer))
+	default:
+		tokenStore = service.NewJwtTokenStore(tokenEnhancer.(*service.JwtTokenEnhancer))
+	}
 	tokenService = service.NewTokenService(tokenStore, tokenEnhancer)
-	userDetailsService = service.NewRemoteUserDetailService()
+	// 登录失败计数和锁定，密码模式和授权码模式共用
+	loginAttemptService := service.NewRedisLoginAttemptService(conf.Redis.RedisConn)
+	userDetailsService = service.NewLoginProtectedUserDetailsService(service.NewRemoteUserDetailService(), loginAttemptService)
 	clientDetailsService = service.NewMysqlClientDetailsService()
 	srv = service.NewCommonService()
+	codeService := service.NewRedisAuthorizationCodeService(conf.Redis.RedisConn, clientDetailsService)
+	// 管理员两步验证，动态码错误同样计入登录失败次数
+	mfaService := service.NewRemoteMfaService(conf.Redis.RedisConn, loginAttemptService)
 
 	tokenGranter = service.NewComposeTokenGranter(map[string]service.TokenGranter{
-		"password":      service.NewUsernamePasswordTokenGranter("password", userDetailsService, tokenService),
-		"refresh_token": service.NewRefreshTokenGranter("refresh_token", userDetailsService, tokenService),
+		"password":           service.NewUsernamePasswordTokenGranter("password", userDetailsService, mfaService, tokenService),
+		"refresh_token":      service.NewRefreshTokenGranter("refresh_token", userDetailsService, tokenService),
+		"authorization_code": service.NewAuthorizationCodeTokenGranter("authorization_code", codeService, tokenService),
+		"client_credentials": service.NewClientCredentialsTokenGranter("client_credentials", tokenService),
+		"mfa":                service.NewMfaTokenGranter("mfa", mfaService, tokenService),
 	})
 
 	tokenEndpoint := endpoint.MakeTokenEndpoint(tokenGranter, clientDetailsService)
@@ -79,6 +110,55 @@ func main() {
 	gRPCCheckTokenEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "grpc-check-endpoint")(gRPCCheckTokenEndpoint)
 	//tokenEndpoint = plugins.ClientAuthorizationMiddleware(clientDetailsService)(checkTokenEndpoint)
 
+	tokenKeyEndpoint := endpoint.MakeTokenKeyEndpoint(tokenEnhancer, conf.Jwt.KeyClients)
+	tokenKeyEndpoint = endpoint.MakeClientAuthorizationMiddleware(localconfig.Logger)(tokenKeyEndpoint)
+	tokenKeyEndpoint = plugins.NewTokenBucketLimitterWithBuildIn(rateBucket)(tokenKeyEndpoint)
+	tokenKeyEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "token-key-endpoint")(tokenKeyEndpoint)
+
+	jwksEndpoint := endpoint.MakeJwksEndpoint(tokenEnhancer)
+	jwksEndpoint = plugins.NewTokenBucketLimitterWithBuildIn(rateBucket)(jwksEndpoint)
+	jwksEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "jwks-endpoint")(jwksEndpoint)
+
+	authorizeEndpoint := endpoint.MakeAuthorizeEndpoint(codeService, userDetailsService, mfaService)
+	authorizeEndpoint = plugins.NewTokenBucketLimitterWithBuildIn(rateBucket)(authorizeEndpoint)
+	authorizeEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "authorize-endpoint")(authorizeEndpoint)
+
+	authorizePageEndpoint := endpoint.MakeAuthorizePageEndpoint(codeService)
+	authorizePageEndpoint = plugins.NewTokenBucketLimitterWithBuildIn(rateBucket)(authorizePageEndpoint)
+	authorizePageEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "authorize-page-endpoint")(authorizePageEndpoint)
+
+	logoutEndpoint := endpoint.MakeLogoutEndpoint(tokenService)
+	logoutEndpoint = endpoint.MakeClientAuthorizationMiddleware(localconfig.Logger)(logoutEndpoint)
+	logoutEndpoint = plugins.NewTokenBucketLimitterWithBuildIn(rateBucket)(logoutEndpoint)
+	logoutEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "logout-endpoint")(logoutEndpoint)
+
+	// 客户端管理和登录解锁，只允许管理员调用
+	clientManageService := service.NewMysqlClientManageService()
+	adminAuthority := endpoint.MakeAuthorityAuthorizationMiddleware(model.RoleAdmin, localconfig.Logger)
+	adminEndpoint := func(e kitendpoint.Endpoint, name string) kitendpoint.Endpoint {
+		e = adminAuthority(e)
+		e = plugins.NewTokenBucketLimitterWithBuildIn(rateBucket)(e)
+		return kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, name)(e)
+	}
+	createClientEndpoint := adminEndpoint(endpoint.MakeCreateClientEndpoint(clientManageService), "create-client-endpoint")
+	getClientListEndpoint := adminEndpoint(endpoint.MakeGetClientListEndpoint(clientManageService), "get-client-list-endpoint")
+	updateClientEndpoint := adminEndpoint(endpoint.MakeUpdateClientEndpoint(clientManageService), "update-client-endpoint")
+	rotateClientSecretEndpoint := adminEndpoint(endpoint.MakeRotateClientSecretEndpoint(clientManageService), "rotate-client-secret-endpoint")
+	disableClientEndpoint := adminEndpoint(endpoint.MakeDisableClientEndpoint(clientManageService), "disable-client-endpoint")
+	deleteClientEndpoint := adminEndpoint(endpoint.MakeDeleteClientEndpoint(clientManageService), "delete-client-endpoint")
+	unlockLoginEndpoint := adminEndpoint(endpoint.MakeUnlockLoginEndpoint(loginAttemptService), "unlock-login-endpoint")
+
+	mfaAuthorization := endpoint.MakeMfaAuthorizationMiddleware(localconfig.Logger)
+	mfaEndpoint := func(e kitendpoint.Endpoint, name string) kitendpoint.Endpoint {
+		e = mfaAuthorization(e)
+		e = plugins.NewTokenBucketLimitterWithBuildIn(rateBucket)(e)
+		return kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, name)(e)
+	}
+	mfaStatusEndpoint := mfaEndpoint(endpoint.MakeMfaStatusEndpoint(mfaService), "mfa-status-endpoint")
+	mfaEnrollEndpoint := mfaEndpoint(endpoint.MakeMfaEnrollEndpoint(mfaService), "mfa-enroll-endpoint")
+	mfaActivateEndpoint := mfaEndpoint(endpoint.MakeMfaActivateEndpoint(mfaService), "mfa-activate-endpoint")
+	mfaDisableEndpoint := mfaEndpoint(endpoint.MakeMfaDisableEndpoint(mfaService), "mfa-disable-endpoint")
+
 	// 创建健康检查的Endpoint
 	healthEndpoint := endpoint.MakeHealthCheckEndpoint(srv)
 	healthEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "health-endpoint")(healthEndpoint)
@@ -87,11 +167,31 @@ func main() {
 		CheckTokenEndpoint:     checkTokenEndpoint,
 		HealthCheckEndpoint:    healthEndpoint,
 		GRPCCheckTokenEndpoint: gRPCCheckTokenEndpoint,
+		TokenKeyEndpoint:       tokenKeyEndpoint,
+		JwksEndpoint:           jwksEndpoint,
+		LogoutEndpoint:         logoutEndpoint,
+		AuthorizeEndpoint:      authorizeEndpoint,
+		AuthorizePageEndpoint:  authorizePageEndpoint,
+
+		CreateClientEndpoint:       createClientEndpoint,
+		GetClientListEndpoint:      getClientListEndpoint,
+		UpdateClientEndpoint:       updateClientEndpoint,
+		RotateClientSecretEndpoint: rotateClientSecretEndpoint,
+		DisableClientEndpoint:      disableClientEndpoint,
+		DeleteClientEndpoint:       deleteClientEndpoint,
+		UnlockLoginEndpoint:        unlockLoginEndpoint,
+
+		MfaStatusEndpoint:   mfaStatusEndpoint,
+		MfaEnrollEndpoint:   mfaEnrollEndpoint,
+		MfaActivateEndpoint: mfaActivateEndpoint,
+		MfaDisableEndpoint:  mfaDisableEndpoint,
 	}
 
 	// 创建http.Handler
-	r := transport.MakeHttpHandler(ctx, endpts, tokenService, clientDetailsService, localconfig.ZipkinTracer, localconfig.Logger)
+	r := transport.MakeHttpHandler(ctx, endpts, tokenService, clientDetailsService, mfaService, localconfig.ZipkinTracer, localconfig.Logger)
 
+	server := &http.Server{Addr: ":" + *servicePort, Handler: r}
+	gRPCServer := grpc.NewServer()
 	// http server
 	go func() {
 		fmt.Println("Http Server start at port:" + *servicePort)
@@ -99,8 +199,7 @@ func main() {
 			conf.MysqlConfig.Pwd, conf.MysqlConfig.Db)
 		// 启动前执行注册
 		register.Register()
-		handler := r
-		errChan <- http.ListenAndServe(":"+*servicePort, handler)
+		errChan <- server.ListenAndServe()
 	}()
 
 	// grpc server
@@ -121,19 +220,13 @@ func main() {
 
 		ctx := metadata.NewIncomingContext(context.Background(), md)
 		handler := transport.NewGRPCServer(ctx, endpts, serverTracer)
-		gRPCServer := grpc.NewServer()
 		pb.RegisterOAuthServiceServer(gRPCServer, handler)
 		errChan <- gRPCServer.Serve(listener)
 	}()
 
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errChan <- fmt.Errorf("%s", <-c)
-	}()
-
-	error := <-errChan
-	// 服务退出取消注册
-	register.Deregister()
-	fmt.Println(error)
+	// 服务退出取消注册，再等待处理中的HTTP请求和gRPC调用完成
+	shutdown.New(register.Deregister).
+		HTTP(server).
+		GRPC(gRPCServer).
+		Wait(errChan)
 }
@@ -0,0 +1,10 @@
+package model
+
+// 授权码对应的授权信息，保存在redis中，使用一次后删除
+type AuthorizationCode struct {
+	ClientId            string       `json:"client_id"`             // 申请授权的客户端
+	RedirectUri         string       `json:"redirect_uri"`          // 授权请求中携带的重定向地址，换取令牌时必须一致
+	CodeChallenge       string       `json:"code_challenge"`        // PKCE校验值
+	CodeChallengeMethod string       `json:"code_challenge_method"` // PKCE校验方法，只支持S256
+	User                *UserDetails `json:"user"`                  // 授权的用户
+}
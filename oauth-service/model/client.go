@@ -1,23 +1,96 @@
 package model
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"final-design/pkg/mysql"
 	"fmt"
 	"log"
+	"sync"
+	"time"
+
+	"github.com/gohouse/gorose/v2"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// client_details表：
+//
+//	client_id, client_secret, access_token_validity_seconds, refresh_token_validity_seconds,
+//	registerd_redirect_uri, authorized_grant_types(json数组), scope(json数组), disabled(tinyint)
+var ErrClientNotFound = errors.New("client not found")
+
 type ClientDetails struct {
 	ClientId                    string   // client 的标识
-	ClientSecret                string   // client 的密钥
+	ClientSecret                string   // client 的密钥，bcrypt哈希；公开客户端(如移动端)没有密钥
 	AccessTokenValiditySeconds  int      // 访问令牌有效时间：秒
 	RefreshTokenValiditySeconds int      // 刷新令牌有效时间：秒
 	RegisteredRedirectUri       string   // 重定向地址，授权码类型中使用
 	AuthorizedGrantTypes        []string // 可以使用的授权类型
+	Scope                       []string // 客户端具有的权限范围，client_credentials令牌只携带这些权限
+	Disabled                    bool     // 被禁用的客户端不能再获取令牌
 }
 
+// 校验客户端密钥，兼容尚未迁移的明文密钥
 func (clientDetails *ClientDetails) IsMatch(clientId string, clientSecret string) bool {
-	return clientId == clientDetails.ClientId && clientSecret == clientDetails.ClientSecret
+	if clientId != clientDetails.ClientId {
+		return false
+	}
+	if !clientDetails.IsHashedSecret() {
+		return subtle.ConstantTimeCompare([]byte(clientSecret), []byte(clientDetails.ClientSecret)) == 1
+	}
+	// 网关等客户端每个请求都携带密钥，bcrypt比较很慢，校验通过的结果缓存一段时间
+	key := secretMatchKey(clientId, clientDetails.ClientSecret, clientSecret)
+	if expireAt, ok := secretMatchCache.Load(key); ok {
+		if time.Now().Before(expireAt.(time.Time)) {
+			return true
+		}
+		secretMatchCache.Delete(key)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(clientDetails.ClientSecret), []byte(clientSecret)) != nil {
+		return false
+	}
+	secretMatchCache.Store(key, time.Now().Add(secretMatchTtl))
+	return true
+}
+
+// 密钥校验结果的缓存时间，密钥轮换后哈希变化，旧的缓存不会再命中
+const secretMatchTtl = time.Minute
+
+// 校验通过的 (clientId, 密钥哈希, 提交的密钥) -> 过期时间；只缓存成功的结果，条数不超过有效密钥数
+var secretMatchCache sync.Map
+
+func secretMatchKey(clientId, secretHash, clientSecret string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(clientId + "\x00" + secretHash + "\x00" + clientSecret))
+}
+
+// 密钥是否已使用bcrypt保存
+func (clientDetails *ClientDetails) IsHashedSecret() bool {
+	_, err := bcrypt.Cost([]byte(clientDetails.ClientSecret))
+	return err == nil
+}
+
+// 客户端是否可以使用该授权类型
+func (clientDetails *ClientDetails) IsAuthorizedGrantType(grantType string) bool {
+	for _, authorizedGrantType := range clientDetails.AuthorizedGrantTypes {
+		if authorizedGrantType == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// 生成保存到数据库的密钥哈希，空密钥表示公开客户端，原样保存
+func HashClientSecret(clientSecret string) (string, error) {
+	if clientSecret == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
 }
 
 type ClientDetailsModel struct{}
@@ -34,36 +107,45 @@ func (c *ClientDetailsModel) GetClientDetailsByClientId(clientId string) (*Clien
 	conn := mysql.DB()
 	// fmt.Println("GetClientDetailsByClientId:", clientId)
 	result, err := conn.Table(c.getTableName()).Where(map[string]interface{}{"client_id": clientId}).First()
-	fmt.Println("result:", result, "\nerr:", err)
+	if err == nil && result == nil {
+		err = ErrClientNotFound
+	}
 	if err == nil {
-		var authorizedGrantTypes []string
-		_ = json.Unmarshal([]byte(result["authorized_grant_types"].(string)), &authorizedGrantTypes)
-
-		return &ClientDetails{
-			ClientId:                    result["client_id"].(string),
-			ClientSecret:                result["client_secret"].(string),
-			AccessTokenValiditySeconds:  int(result["access_token_validity_seconds"].(int64)),
-			RefreshTokenValiditySeconds: int(result["refresh_token_validity_seconds"].(int64)),
-			RegisteredRedirectUri:       result["registerd_redirect_uri"].(string),
-			AuthorizedGrantTypes:        authorizedGrantTypes,
-		}, nil
+		return toClientDetails(result), nil
 	} else {
 		fmt.Println("查询client_id出错")
 		return nil, err
 	}
 }
 
+func (c *ClientDetailsModel) GetClientDetailsList() ([]*ClientDetails, error) {
+	conn := mysql.DB()
+	list, err := conn.Table(c.getTableName()).Order("client_id asc").Get()
+	if err != nil {
+		log.Printf("GetClientDetailsList, Error: %v", err)
+		return nil, err
+	}
+	clients := make([]*ClientDetails, 0, len(list))
+	for _, data := range list {
+		clients = append(clients, toClientDetails(data))
+	}
+	return clients, nil
+}
+
 func (c *ClientDetailsModel) CreateClientDetails(clientDetails *ClientDetails) error {
 	conn := mysql.DB()
 
 	grantTypeString, _ := json.Marshal(clientDetails.AuthorizedGrantTypes)
+	scopeString, _ := json.Marshal(clientDetails.Scope)
 	_, err := conn.Table(c.getTableName()).Data(map[string]interface{}{
 		"client_id":                      clientDetails.ClientId,
 		"client_secret":                  clientDetails.ClientSecret,
 		"access_token_validity_seconds":  clientDetails.AccessTokenValiditySeconds,
 		"refresh_token_validity_seconds": clientDetails.RefreshTokenValiditySeconds,
-		"register_redirect_uri":          clientDetails.RegisteredRedirectUri,
-		"authorized_grant_types":         grantTypeString,
+		"registerd_redirect_uri":         clientDetails.RegisteredRedirectUri,
+		"authorized_grant_types":         string(grantTypeString),
+		"scope":                          string(scopeString),
+		"disabled":                       boolToInt(clientDetails.Disabled),
 	}).Insert()
 
 	if err != nil {
@@ -72,3 +154,85 @@ func (c *ClientDetailsModel) CreateClientDetails(clientDetails *ClientDetails) e
 	}
 	return nil
 }
+
+// 更新令牌有效期、重定向地址、授权类型和scope，密钥和禁用状态单独修改
+func (c *ClientDetailsModel) UpdateClientDetails(clientDetails *ClientDetails) error {
+	conn := mysql.DB()
+
+	grantTypeString, _ := json.Marshal(clientDetails.AuthorizedGrantTypes)
+	scopeString, _ := json.Marshal(clientDetails.Scope)
+	_, err := conn.Table(c.getTableName()).Data(map[string]interface{}{
+		"access_token_validity_seconds":  clientDetails.AccessTokenValiditySeconds,
+		"refresh_token_validity_seconds": clientDetails.RefreshTokenValiditySeconds,
+		"registerd_redirect_uri":         clientDetails.RegisteredRedirectUri,
+		"authorized_grant_types":         string(grantTypeString),
+		"scope":                          string(scopeString),
+	}).Where("client_id", clientDetails.ClientId).Update()
+	if err != nil {
+		log.Printf("UpdateClientDetails, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (c *ClientDetailsModel) UpdateClientSecret(clientId string, clientSecret string) error {
+	conn := mysql.DB()
+	_, err := conn.Table(c.getTableName()).Data(map[string]interface{}{
+		"client_secret": clientSecret,
+	}).Where("client_id", clientId).Update()
+	if err != nil {
+		log.Printf("UpdateClientSecret, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (c *ClientDetailsModel) UpdateClientDisabled(clientId string, disabled bool) error {
+	conn := mysql.DB()
+	_, err := conn.Table(c.getTableName()).Data(map[string]interface{}{
+		"disabled": boolToInt(disabled),
+	}).Where("client_id", clientId).Update()
+	if err != nil {
+		log.Printf("UpdateClientDisabled, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (c *ClientDetailsModel) DeleteClientDetails(clientId string) error {
+	conn := mysql.DB()
+	_, err := conn.Table(c.getTableName()).Where("client_id", clientId).Delete()
+	if err != nil {
+		log.Printf("DeleteClientDetails, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func toClientDetails(result gorose.Data) *ClientDetails {
+	var authorizedGrantTypes []string
+	_ = json.Unmarshal([]byte(result["authorized_grant_types"].(string)), &authorizedGrantTypes)
+	var scope []string
+	if scopeString, ok := result["scope"].(string); ok {
+		_ = json.Unmarshal([]byte(scopeString), &scope)
+	}
+	disabled, _ := result["disabled"].(int64)
+
+	return &ClientDetails{
+		ClientId:                    result["client_id"].(string),
+		ClientSecret:                result["client_secret"].(string),
+		AccessTokenValiditySeconds:  int(result["access_token_validity_seconds"].(int64)),
+		RefreshTokenValiditySeconds: int(result["refresh_token_validity_seconds"].(int64)),
+		RegisteredRedirectUri:       result["registerd_redirect_uri"].(string),
+		AuthorizedGrantTypes:        authorizedGrantTypes,
+		Scope:                       scope,
+		Disabled:                    disabled != 0,
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHashClientSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		wantHashed bool
+	}{
+		{"普通密钥", "gateway-secret", true},
+		{"公开客户端", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := HashClientSecret(tt.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &ClientDetails{ClientId: "app", ClientSecret: hash}
+			if got := client.IsHashedSecret(); got != tt.wantHashed {
+				t.Errorf("IsHashedSecret() = %v, want %v", got, tt.wantHashed)
+			}
+			if tt.wantHashed && hash == tt.secret {
+				t.Error("secret is stored in plain text")
+			}
+		})
+	}
+}
+
+func TestClientDetailsIsMatch(t *testing.T) {
+	hash, err := HashClientSecret("new-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		stored   string // 数据库中保存的密钥
+		clientId string
+		secret   string
+		want     bool
+	}{
+		{"bcrypt密钥正确", hash, "app", "new-secret", true},
+		{"bcrypt密钥错误", hash, "app", "wrong-secret", false},
+		{"提交哈希值本身", hash, "app", hash, false},
+		{"未迁移的明文密钥正确", "old-secret", "app", "old-secret", true},
+		{"未迁移的明文密钥错误", "old-secret", "app", "old-secre", false},
+		{"客户端不一致", hash, "other", "new-secret", false},
+		{"公开客户端不带密钥", "", "app", "", true},
+		{"公开客户端带密钥", "", "app", "new-secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &ClientDetails{ClientId: "app", ClientSecret: tt.stored}
+			// 第二次校验可能命中缓存，结果必须一致
+			for i := 0; i < 2; i++ {
+				if got := client.IsMatch(tt.clientId, tt.secret); got != tt.want {
+					t.Errorf("IsMatch() #%d = %v, want %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestClientDetailsIsMatchCache(t *testing.T) {
+	oldHash, _ := HashClientSecret("secret-v1")
+	newHash, _ := HashClientSecret("secret-v2")
+	client := &ClientDetails{ClientId: "cache", ClientSecret: oldHash}
+	if !client.IsMatch("cache", "secret-v1") {
+		t.Fatal("IsMatch() = false, want true")
+	}
+	if _, ok := secretMatchCache.Load(secretMatchKey("cache", oldHash, "secret-v1")); !ok {
+		t.Error("successful check is not cached")
+	}
+	if client.IsMatch("cache", "secret-v2") {
+		t.Error("IsMatch() with another secret = true, want false")
+	}
+	if _, ok := secretMatchCache.Load(secretMatchKey("cache", oldHash, "secret-v2")); ok {
+		t.Error("failed check is cached")
+	}
+
+	// 轮换密钥后旧密钥不能通过缓存校验
+	client.ClientSecret = newHash
+	if client.IsMatch("cache", "secret-v1") {
+		t.Error("IsMatch() with rotated secret = true, want false")
+	}
+	if !client.IsMatch("cache", "secret-v2") {
+		t.Error("IsMatch() with new secret = false, want true")
+	}
+
+	// 缓存过期后重新比较哈希
+	key := secretMatchKey("cache", newHash, "secret-v2")
+	secretMatchCache.Store(key, time.Now().Add(-time.Second))
+	if !client.IsMatch("cache", "secret-v2") {
+		t.Error("IsMatch() after cache expiry = false, want true")
+	}
+	if expireAt, ok := secretMatchCache.Load(key); !ok || !time.Now().Before(expireAt.(time.Time)) {
+		t.Error("expired cache entry is not refreshed")
+	}
+}
@@ -7,6 +7,7 @@ type OAuth2Token struct {
 	TokenType    string       // 令牌类型
 	TokenValue   string       // 令牌
 	ExpiresTime  *time.Time   // 过期时间
+	IssuedTime   *time.Time   // 签发时间
 }
 
 func (OAuth2Token *OAuth2Token) IsExpired() bool {
@@ -15,5 +16,10 @@ func (OAuth2Token *OAuth2Token) IsExpired() bool {
 
 type OAuth2Details struct {
 	Client *ClientDetails
-	User   *UserDetails
+	User   *UserDetails // client_credentials签发的令牌没有用户信息，为nil
+}
+
+// 是否为只代表客户端自身的令牌
+func (oauth2Details *OAuth2Details) IsClientOnly() bool {
+	return oauth2Details.User == nil
 }
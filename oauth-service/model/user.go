@@ -1,13 +1,23 @@
 package model
 
+const (
+	IdTypeUser  = 0 // 普通用户
+	IdTypeAdmin = 1 // 管理员
+
+	RoleUser  = "ROLE_USER"  // 普通用户角色
+	RoleAdmin = "ROLE_ADMIN" // 管理员角色
+)
+
 type UserDetails struct {
 	// 用户标识
 	UserId int64
 	// 用户名 唯一
 	Username string
+	// 用户身份：0普通用户，1管理员
+	IdType int
 	// 用户密码
 	Password string
-	// 用户具有的权限
+	// 用户具有的角色和权限，由user-service提供，角色以ROLE_开头
 	Authorities []string // 具备的权限
 }
 
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	. "final-design/oauth-service/model"
+	conf "final-design/pkg/config"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	authorizationCodePrefix = "oauth:code:" // 授权码 -> 授权信息
+
+	CodeChallengeMethodS256 = "S256"
+
+	defaultCodeValiditySeconds = 60
+)
+
+var (
+	ErrInvalidRedirectUri   = errors.New("invalid redirect uri")
+	ErrUnauthorizedClient   = errors.New("client is not authorized to use this grant type")
+	ErrInvalidCodeChallenge = errors.New("invalid code challenge")
+	ErrInvalidCode          = errors.New("invalid authorization code")
+	ErrInvalidCodeVerifier  = errors.New("invalid code verifier")
+
+	// RFC 7636：code_verifier为43-128位的非保留字符，S256得到的code_challenge为43位
+	codeVerifierPattern  = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+	codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+)
+
+// 授权码服务，授权码保存在redis中，有效期短且只能使用一次
+type AuthorizationCodeService interface {
+	// 校验客户端能否使用授权码模式及重定向地址，返回本次授权的重定向地址
+	ValidateRedirectUri(ctx context.Context, clientId string, redirectUri string) (*ClientDetails, string, error)
+	// 用户同意授权后生成授权码，redirectUri为授权请求中携带的重定向地址
+	CreateAuthorizationCode(ctx context.Context, client *ClientDetails, user *UserDetails, redirectUri string,
+		codeChallenge string, codeChallengeMethod string) (string, error)
+	// 使用授权码，返回授权信息
+	ConsumeAuthorizationCode(code string) (*AuthorizationCode, error)
+}
+
+type RedisAuthorizationCodeService struct {
+	conn                 *redis.Client
+	clientDetailsService ClientDetailsService
+}
+
+func NewRedisAuthorizationCodeService(conn *redis.Client, clientDetailsService ClientDetailsService) AuthorizationCodeService {
+	return &RedisAuthorizationCodeService{
+		conn:                 conn,
+		clientDetailsService: clientDetailsService,
+	}
+}
+
+func (service *RedisAuthorizationCodeService) ValidateRedirectUri(ctx context.Context, clientId string, redirectUri string) (*ClientDetails, string, error) {
+	client, err := service.clientDetailsService.LoadClientDetailByClientId(ctx, clientId)
+	if err != nil {
+		return nil, "", ErrClientMessage
+	}
+	if !client.IsAuthorizedGrantType("authorization_code") {
+		return nil, "", ErrUnauthorizedClient
+	}
+
+	// 注册的重定向地址可以有多个，以逗号分隔，必须完全匹配
+	registered := strings.Split(client.RegisteredRedirectUri, ",")
+	if redirectUri == "" {
+		if len(registered) != 1 || strings.TrimSpace(registered[0]) == "" {
+			return nil, "", ErrInvalidRedirectUri
+		}
+		return client, strings.TrimSpace(registered[0]), nil
+	}
+	for _, uri := range registered {
+		if strings.TrimSpace(uri) == redirectUri {
+			return client, redirectUri, nil
+		}
+	}
+	return nil, "", ErrInvalidRedirectUri
+}
+
+func (service *RedisAuthorizationCodeService) CreateAuthorizationCode(ctx context.Context, client *ClientDetails, user *UserDetails,
+	redirectUri string, codeChallenge string, codeChallengeMethod string) (string, error) {
+	if codeChallenge != "" || codeChallengeMethod != "" {
+		if codeChallengeMethod != CodeChallengeMethodS256 || !codeChallengePattern.MatchString(codeChallenge) {
+			return "", ErrInvalidCodeChallenge
+		}
+	} else if client.ClientSecret == "" {
+		// 移动端等公开客户端无法保管密钥，必须使用PKCE
+		return "", ErrInvalidCodeChallenge
+	}
+
+	code, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	userDetails := *user
+	userDetails.Password = ""
+	data, _ := json.Marshal(&AuthorizationCode{
+		ClientId:            client.ClientId,
+		RedirectUri:         redirectUri,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		User:                &userDetails,
+	})
+
+	validitySeconds := conf.OAuth.CodeValiditySeconds
+	if validitySeconds <= 0 {
+		validitySeconds = defaultCodeValiditySeconds
+	}
+	if err := service.conn.Set(authorizationCodePrefix+code, data, time.Duration(validitySeconds)*time.Second).Err(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func (service *RedisAuthorizationCodeService) ConsumeAuthorizationCode(code string) (*AuthorizationCode, error) {
+	// 读取和删除在同一事务中执行，并发使用同一授权码时只有一个请求能读到
+	pipe := service.conn.TxPipeline()
+	get := pipe.Get(authorizationCodePrefix + code)
+	pipe.Del(authorizationCodePrefix + code)
+	if _, err := pipe.Exec(); err == redis.Nil {
+		return nil, ErrInvalidCode
+	} else if err != nil {
+		return nil, err
+	}
+
+	var authorizationCode AuthorizationCode
+	if err := json.Unmarshal([]byte(get.Val()), &authorizationCode); err != nil {
+		return nil, err
+	}
+	return &authorizationCode, nil
+}
+
+type AuthorizationCodeTokenGranter struct {
+	supportGrantType string
+	codeService      AuthorizationCodeService
+	tokenService     TokenService
+}
+
+func NewAuthorizationCodeTokenGranter(grantType string, codeService AuthorizationCodeService, tokenService TokenService) TokenGranter {
+	return &AuthorizationCodeTokenGranter{
+		supportGrantType: grantType,
+		codeService:      codeService,
+		tokenService:     tokenService,
+	}
+}
+
+func (tokenGranter *AuthorizationCodeTokenGranter) Grant(ctx context.Context, grantType string, client *ClientDetails, reader *http.Request) (*OAuth2Token, error) {
+	if grantType != tokenGranter.supportGrantType {
+		return nil, ErrNotSupportGrantType
+	}
+	code := reader.FormValue("code")
+	if code == "" {
+		return nil, ErrInvalidCode
+	}
+
+	authorizationCode, err := tokenGranter.codeService.ConsumeAuthorizationCode(code)
+	if err != nil {
+		return nil, err
+	}
+	// 授权码只能由申请它的客户端使用
+	if authorizationCode.ClientId != client.ClientId {
+		return nil, ErrInvalidCode
+	}
+	if authorizationCode.RedirectUri != "" && authorizationCode.RedirectUri != reader.FormValue("redirect_uri") {
+		return nil, ErrInvalidRedirectUri
+	}
+	if authorizationCode.CodeChallenge != "" &&
+		!verifyCodeChallenge(reader.FormValue("code_verifier"), authorizationCode.CodeChallenge) {
+		return nil, ErrInvalidCodeVerifier
+	}
+
+	return tokenGranter.tokenService.CreateAccessToken(&OAuth2Details{
+		Client: client,
+		User:   authorizationCode.User,
+	})
+}
+
+// S256：BASE64URL(SHA256(code_verifier)) == code_challenge
+func verifyCodeChallenge(codeVerifier string, codeChallenge string) bool {
+	if !codeVerifierPattern.MatchString(codeVerifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == codeChallenge
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
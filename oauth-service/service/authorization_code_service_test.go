@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	. "final-design/oauth-service/model"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClientDetailsService map[string]*ClientDetails
+
+func (s fakeClientDetailsService) GetClientDetailByClientId(ctx context.Context, clientId string, clientSecret string) (*ClientDetails, error) {
+	return s.LoadClientDetailByClientId(ctx, clientId)
+}
+
+func (s fakeClientDetailsService) LoadClientDetailByClientId(ctx context.Context, clientId string) (*ClientDetails, error) {
+	client, ok := s[clientId]
+	if !ok {
+		return nil, ErrClientMessage
+	}
+	return client, nil
+}
+
+func s256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	verifier := strings.Repeat("a1-._~", 8) // 48位
+	tests := []struct {
+		name          string
+		codeVerifier  string
+		codeChallenge string
+		want          bool
+	}{
+		{"匹配", verifier, s256(verifier), true},
+		{"最短43位", strings.Repeat("x", 43), s256(strings.Repeat("x", 43)), true},
+		{"最长128位", strings.Repeat("x", 128), s256(strings.Repeat("x", 128)), true},
+		{"不匹配", verifier, s256(verifier + "b"), false},
+		{"plain不支持", verifier, verifier, false},
+		{"少于43位", strings.Repeat("x", 42), s256(strings.Repeat("x", 42)), false},
+		{"超过128位", strings.Repeat("x", 129), s256(strings.Repeat("x", 129)), false},
+		{"非法字符", strings.Repeat("x", 42) + "+", s256(strings.Repeat("x", 42) + "+"), false},
+		{"空", "", s256(""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.codeVerifier, tt.codeChallenge); got != tt.want {
+				t.Errorf("verifyCodeChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRedirectUri(t *testing.T) {
+	service := NewRedisAuthorizationCodeService(nil, fakeClientDetailsService{
+		"single": {ClientId: "single", RegisteredRedirectUri: "https://app.example.com/cb",
+			AuthorizedGrantTypes: []string{"authorization_code"}},
+		"multi": {ClientId: "multi", RegisteredRedirectUri: "https://a.example.com/cb, https://b.example.com/cb",
+			AuthorizedGrantTypes: []string{"authorization_code", "refresh_token"}},
+		"none": {ClientId: "none", AuthorizedGrantTypes: []string{"authorization_code"}},
+		"password": {ClientId: "password", RegisteredRedirectUri: "https://app.example.com/cb",
+			AuthorizedGrantTypes: []string{"password"}},
+	})
+
+	tests := []struct {
+		name        string
+		clientId    string
+		redirectUri string
+		want        string
+		wantErr     error
+	}{
+		{"完全匹配", "single", "https://app.example.com/cb", "https://app.example.com/cb", nil},
+		{"省略时使用唯一注册地址", "single", "", "https://app.example.com/cb", nil},
+		{"多个地址之一", "multi", "https://b.example.com/cb", "https://b.example.com/cb", nil},
+		{"多个地址时不能省略", "multi", "", "", ErrInvalidRedirectUri},
+		{"未注册地址", "none", "https://app.example.com/cb", "", ErrInvalidRedirectUri},
+		{"未注册且省略", "none", "", "", ErrInvalidRedirectUri},
+		{"路径前缀不匹配", "single", "https://app.example.com/cb/evil", "", ErrInvalidRedirectUri},
+		{"查询参数不匹配", "single", "https://app.example.com/cb?x=1", "", ErrInvalidRedirectUri},
+		{"主机不匹配", "single", "https://app.example.com.evil.com/cb", "", ErrInvalidRedirectUri},
+		{"大小写不匹配", "single", "https://APP.example.com/cb", "", ErrInvalidRedirectUri},
+		{"不能使用授权码模式", "password", "https://app.example.com/cb", "", ErrUnauthorizedClient},
+		{"客户端不存在", "unknown", "https://app.example.com/cb", "", ErrClientMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, err := service.ValidateRedirectUri(context.Background(), tt.clientId, tt.redirectUri)
+			if err != tt.wantErr {
+				t.Fatalf("ValidateRedirectUri() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ValidateRedirectUri() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 参数不合法时在访问redis之前返回
+func TestCreateAuthorizationCodeChallenge(t *testing.T) {
+	service := NewRedisAuthorizationCodeService(nil, fakeClientDetailsService{})
+	public := &ClientDetails{ClientId: "mobile"}
+	user := &UserDetails{UserId: 1, Username: "alice"}
+
+	tests := []struct {
+		name   string
+		method string
+		value  string
+	}{
+		{"公开客户端必须使用PKCE", "", ""},
+		{"plain不支持", "plain", s256("x")},
+		{"缺少方法", "", s256("x")},
+		{"缺少校验值", CodeChallengeMethodS256, ""},
+		{"校验值长度错误", CodeChallengeMethodS256, s256("x") + "A"},
+		{"校验值含非法字符", CodeChallengeMethodS256, strings.Repeat("a", 42) + "="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateAuthorizationCode(context.Background(), public, user,
+				"https://app.example.com/cb", tt.value, tt.method)
+			if err != ErrInvalidCodeChallenge {
+				t.Errorf("CreateAuthorizationCode() error = %v, want %v", err, ErrInvalidCodeChallenge)
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeTokenGranter(t *testing.T) {
+	tokenService, conn := newTestTokenService(t)
+	codeService := NewRedisAuthorizationCodeService(conn, fakeClientDetailsService{})
+	granter := NewAuthorizationCodeTokenGranter("authorization_code", codeService, tokenService)
+
+	const redirectUri = "https://app.example.com/cb"
+	verifier := strings.Repeat("v", 64)
+	tests := []struct {
+		name        string
+		grantType   string
+		clientId    string // 换取令牌的客户端，为空时与申请授权码的客户端相同
+		redirectUri string
+		verifier    string
+		wantErr     error
+	}{
+		{"成功", "authorization_code", "", redirectUri, verifier, nil},
+		{"授权类型错误", "password", "", redirectUri, verifier, ErrNotSupportGrantType},
+		{"其它客户端", "authorization_code", "other", redirectUri, verifier, ErrInvalidCode},
+		{"重定向地址不一致", "authorization_code", "", redirectUri + "/x", verifier, ErrInvalidRedirectUri},
+		{"code_verifier错误", "authorization_code", "", redirectUri, strings.Repeat("w", 64), ErrInvalidCodeVerifier},
+		{"缺少code_verifier", "authorization_code", "", redirectUri, "", ErrInvalidCodeVerifier},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testDetails("code", time.Now().UnixNano()+int64(i)).Client
+			code, err := codeService.CreateAuthorizationCode(context.Background(), client,
+				&UserDetails{UserId: 1, Username: "alice", Password: "secret"},
+				redirectUri, s256(verifier), CodeChallengeMethodS256)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			grantClient := client
+			if tt.clientId != "" {
+				grantClient = &ClientDetails{ClientId: tt.clientId}
+			}
+			form := url.Values{"code": {code}, "redirect_uri": {tt.redirectUri}, "code_verifier": {tt.verifier}}
+			req := &http.Request{Form: form}
+			token, err := granter.Grant(context.Background(), tt.grantType, grantClient, req)
+			if err != tt.wantErr {
+				t.Fatalf("Grant() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			details, err := tokenService.GetOAuth2DetailsByAccessToken(token.TokenValue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if details.User.Username != "alice" || details.User.Password != "" {
+				t.Errorf("token user = %+v, want alice without password", details.User)
+			}
+			// 授权码只能使用一次
+			if _, err := granter.Grant(context.Background(), tt.grantType, grantClient, req); err != ErrInvalidCode {
+				t.Errorf("reuse code error = %v, want %v", err, ErrInvalidCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"final-design/oauth-service/model"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrClientExists        = errors.New("client already exists")
+	ErrInvalidClientId     = errors.New("invalid client id")
+	ErrInvalidGrantType    = errors.New("invalid grant type")
+	ErrInvalidValidity     = errors.New("invalid token validity seconds")
+	ErrRedirectUriRequired = errors.New("redirect uri is required for authorization_code")
+
+	clientIdPattern = regexp.MustCompile(`^[A-Za-z0-9\-_.]{2,64}$`)
+
+	// 可以授权给客户端的授权类型
+	SupportedGrantTypes = []string{"password", "refresh_token", "authorization_code", "client_credentials", "mfa"}
+)
+
+// 客户端管理，供管理员维护client_details表；密钥由服务端生成，只在创建和轮换时返回一次明文
+type ClientManageService interface {
+	// 创建客户端，publicClient为true时不生成密钥(只能使用授权码+PKCE)，返回密钥明文
+	CreateClient(ctx context.Context, client *model.ClientDetails, publicClient bool) (string, error)
+	GetClientList(ctx context.Context) ([]*model.ClientDetails, error)
+	// 修改令牌有效期、重定向地址、授权类型和scope
+	UpdateClient(ctx context.Context, client *model.ClientDetails) error
+	// 生成新密钥，旧密钥立即失效，返回新密钥明文
+	RotateClientSecret(ctx context.Context, clientId string) (string, error)
+	// 禁用后客户端不能再获取或刷新令牌，已签发的访问令牌在过期前仍有效
+	DisableClient(ctx context.Context, clientId string, disabled bool) error
+	DeleteClient(ctx context.Context, clientId string) error
+}
+
+type MysqlClientManageService struct{}
+
+func NewMysqlClientManageService() ClientManageService {
+	return &MysqlClientManageService{}
+}
+
+func (service *MysqlClientManageService) CreateClient(ctx context.Context, client *model.ClientDetails, publicClient bool) (string, error) {
+	if !clientIdPattern.MatchString(client.ClientId) {
+		return "", ErrInvalidClientId
+	}
+	if err := validateClient(client); err != nil {
+		return "", err
+	}
+	// 没有密钥的客户端无法证明自身身份
+	if publicClient && client.IsAuthorizedGrantType("client_credentials") {
+		return "", ErrInvalidGrantType
+	}
+
+	clientDetailsModel := model.NewClientDetailsModel()
+	if _, err := clientDetailsModel.GetClientDetailsByClientId(client.ClientId); err == nil {
+		return "", ErrClientExists
+	} else if err != model.ErrClientNotFound {
+		return "", err
+	}
+
+	var secret string
+	if !publicClient {
+		var err error
+		if secret, err = randomString(32); err != nil {
+			return "", err
+		}
+	}
+	hash, err := model.HashClientSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	client.ClientSecret = hash
+	client.Disabled = false
+	if err := clientDetailsModel.CreateClientDetails(client); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (service *MysqlClientManageService) GetClientList(ctx context.Context) ([]*model.ClientDetails, error) {
+	return model.NewClientDetailsModel().GetClientDetailsList()
+}
+
+func (service *MysqlClientManageService) UpdateClient(ctx context.Context, client *model.ClientDetails) error {
+	if err := validateClient(client); err != nil {
+		return err
+	}
+	clientDetailsModel := model.NewClientDetailsModel()
+	if _, err := clientDetailsModel.GetClientDetailsByClientId(client.ClientId); err != nil {
+		return err
+	}
+	return clientDetailsModel.UpdateClientDetails(client)
+}
+
+func (service *MysqlClientManageService) RotateClientSecret(ctx context.Context, clientId string) (string, error) {
+	clientDetailsModel := model.NewClientDetailsModel()
+	if _, err := clientDetailsModel.GetClientDetailsByClientId(clientId); err != nil {
+		return "", err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	hash, err := model.HashClientSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	if err := clientDetailsModel.UpdateClientSecret(clientId, hash); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (service *MysqlClientManageService) DisableClient(ctx context.Context, clientId string, disabled bool) error {
+	clientDetailsModel := model.NewClientDetailsModel()
+	if _, err := clientDetailsModel.GetClientDetailsByClientId(clientId); err != nil {
+		return err
+	}
+	return clientDetailsModel.UpdateClientDisabled(clientId, disabled)
+}
+
+func (service *MysqlClientManageService) DeleteClient(ctx context.Context, clientId string) error {
+	clientDetailsModel := model.NewClientDetailsModel()
+	if _, err := clientDetailsModel.GetClientDetailsByClientId(clientId); err != nil {
+		return err
+	}
+	return clientDetailsModel.DeleteClientDetails(clientId)
+}
+
+func validateClient(client *model.ClientDetails) error {
+	if client.AccessTokenValiditySeconds <= 0 || client.RefreshTokenValiditySeconds < 0 {
+		return ErrInvalidValidity
+	}
+	if len(client.AuthorizedGrantTypes) == 0 {
+		return ErrInvalidGrantType
+	}
+	for _, grantType := range client.AuthorizedGrantTypes {
+		if !containsString(SupportedGrantTypes, grantType) {
+			return ErrInvalidGrantType
+		}
+	}
+	if client.IsAuthorizedGrantType("authorization_code") && strings.TrimSpace(client.RegisteredRedirectUri) == "" {
+		return ErrRedirectUriRequired
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
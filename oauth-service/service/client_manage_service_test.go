@@ -0,0 +1,33 @@
+package service
+
+import (
+	. "final-design/oauth-service/model"
+	"testing"
+)
+
+func TestValidateClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  ClientDetails
+		wantErr error
+	}{
+		{"密码模式", ClientDetails{AccessTokenValiditySeconds: 60, AuthorizedGrantTypes: []string{"password", "refresh_token"}}, nil},
+		{"客户端凭证不需要刷新令牌", ClientDetails{AccessTokenValiditySeconds: 60, AuthorizedGrantTypes: []string{"client_credentials"}}, nil},
+		{"授权码模式", ClientDetails{AccessTokenValiditySeconds: 60, RegisteredRedirectUri: "https://app.example.com/cb",
+			AuthorizedGrantTypes: []string{"authorization_code"}}, nil},
+		{"授权码模式缺少重定向地址", ClientDetails{AccessTokenValiditySeconds: 60, RegisteredRedirectUri: " ",
+			AuthorizedGrantTypes: []string{"authorization_code"}}, ErrRedirectUriRequired},
+		{"不支持的授权类型", ClientDetails{AccessTokenValiditySeconds: 60, AuthorizedGrantTypes: []string{"password", "implicit"}}, ErrInvalidGrantType},
+		{"没有授权类型", ClientDetails{AccessTokenValiditySeconds: 60}, ErrInvalidGrantType},
+		{"访问令牌有效期为0", ClientDetails{AuthorizedGrantTypes: []string{"password"}}, ErrInvalidValidity},
+		{"刷新令牌有效期为负", ClientDetails{AccessTokenValiditySeconds: 60, RefreshTokenValiditySeconds: -1,
+			AuthorizedGrantTypes: []string{"password"}}, ErrInvalidValidity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateClient(&tt.client); err != tt.wantErr {
+				t.Errorf("validateClient() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
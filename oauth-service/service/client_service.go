@@ -12,6 +12,8 @@ var ErrClientMessage = errors.New("invalid client")
 // Service Define a service interface
 type ClientDetailsService interface {
 	GetClientDetailByClientId(ctx context.Context, clientId string, clientSecret string) (*model.ClientDetails, error)
+	// 只根据clientId获取客户端信息，用于授权码模式中尚未校验客户端密钥的请求
+	LoadClientDetailByClientId(ctx context.Context, clientId string) (*model.ClientDetails, error)
 }
 
 type MysqlClientDetailsService struct{}
@@ -23,14 +25,32 @@ func NewMysqlClientDetailsService() ClientDetailsService {
 func (service *MysqlClientDetailsService) GetClientDetailByClientId(ctx context.Context, clientId string, clientSecret string) (*model.ClientDetails, error) {
 	clientDetailsModel := model.NewClientDetailsModel()
 	if clientDetails, err := clientDetailsModel.GetClientDetailsByClientId(clientId); err == nil {
-		fmt.Println(clientDetails)
-		if clientSecret == clientDetails.ClientSecret {
-			return clientDetails, nil
-		} else {
+		if clientDetails.Disabled || !clientDetails.IsMatch(clientId, clientSecret) {
 			return nil, ErrClientMessage
 		}
+		// 旧数据中的明文密钥校验通过后升级为bcrypt
+		if !clientDetails.IsHashedSecret() && clientDetails.ClientSecret != "" {
+			if hash, err := model.HashClientSecret(clientSecret); err == nil {
+				if err := clientDetailsModel.UpdateClientSecret(clientId, hash); err == nil {
+					clientDetails.ClientSecret = hash
+				}
+			}
+		}
+		return clientDetails, nil
 	} else {
 		fmt.Println("err:", err)
 		return nil, err
 	}
 }
+
+func (service *MysqlClientDetailsService) LoadClientDetailByClientId(ctx context.Context, clientId string) (*model.ClientDetails, error) {
+	clientDetailsModel := model.NewClientDetailsModel()
+	clientDetails, err := clientDetailsModel.GetClientDetailsByClientId(clientId)
+	if err != nil {
+		return nil, err
+	}
+	if clientDetails.Disabled {
+		return nil, ErrClientMessage
+	}
+	return clientDetails, nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "final-design/oauth-service/model"
+	conf "final-design/pkg/config"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	ClientIpKey = "ClientIp" // context中保存的客户端IP，由transport层写入
+
+	loginFailUserPrefix = "oauth:login_fail:user:" // idType:username -> 连续失败次数
+	loginFailIpPrefix   = "oauth:login_fail:ip:"   // ip -> 失败次数
+	loginLockUserPrefix = "oauth:login_lock:user:" // idType:username，存在即锁定
+	loginLockIpPrefix   = "oauth:login_lock:ip:"   // ip，存在即锁定
+	loginAuditKey       = "oauth:login_audit"      // 登录审计事件列表，最新的在前
+
+	maxLoginAuditEvents = 10000
+
+	LoginEventSuccess = "login_success"
+	LoginEventFailure = "login_failure"
+	LoginEventLocked  = "login_locked"  // 失败次数达到上限被锁定
+	LoginEventBlocked = "login_blocked" // 锁定期间尝试登录
+	LoginEventUnlock  = "login_unlock"  // 管理员解锁
+)
+
+var ErrLoginLocked = errors.New("too many failed login attempts, try again later")
+
+// 登录审计事件
+type LoginAuditEvent struct {
+	Event    string `json:"event"`
+	Username string `json:"username"`
+	IdType   int    `json:"id_type"`
+	Ip       string `json:"ip"`
+	Time     int64  `json:"time"`
+}
+
+// 登录失败计数和锁定
+type LoginAttemptService interface {
+	// 用户名或IP被锁定时返回ErrLoginLocked
+	Check(username string, idType int, ip string) error
+	// 记录一次失败，返回响应前需要延迟的时间
+	RecordFailure(username string, idType int, ip string) time.Duration
+	// 登录成功后清除该用户名的失败计数
+	RecordSuccess(username string, idType int, ip string)
+	// 管理员解锁用户名和IP，为空的不处理
+	Unlock(username string, idType int, ip string) error
+}
+
+type RedisLoginAttemptService struct {
+	conn *redis.Client
+}
+
+func NewRedisLoginAttemptService(conn *redis.Client) LoginAttemptService {
+	return &RedisLoginAttemptService{conn: conn}
+}
+
+func userKey(username string, idType int) string {
+	return fmt.Sprintf("%d:%s", idType, username)
+}
+
+func (service *RedisLoginAttemptService) Check(username string, idType int, ip string) error {
+	keys := []string{loginLockUserPrefix + userKey(username, idType)}
+	if ip != "" {
+		keys = append(keys, loginLockIpPrefix+ip)
+	}
+	n, err := service.conn.Exists(keys...).Result()
+	if err != nil {
+		// redis不可用时不影响登录
+		log.Printf("Check login lock failed, Error: %v", err)
+		return nil
+	}
+	if n > 0 {
+		service.audit(LoginEventBlocked, username, idType, ip)
+		return ErrLoginLocked
+	}
+	return nil
+}
+
+func (service *RedisLoginAttemptService) RecordFailure(username string, idType int, ip string) time.Duration {
+	loginConf := conf.OAuth.LoginProtect
+	service.audit(LoginEventFailure, username, idType, ip)
+
+	userFailures := service.incr(loginFailUserPrefix+userKey(username, idType), loginConf.WindowSeconds)
+	if loginConf.MaxUserFailures > 0 && userFailures >= int64(loginConf.MaxUserFailures) {
+		service.lock(loginLockUserPrefix+userKey(username, idType), loginConf.LockSeconds)
+		service.audit(LoginEventLocked, username, idType, "")
+	}
+	if ip != "" {
+		ipFailures := service.incr(loginFailIpPrefix+ip, loginConf.WindowSeconds)
+		if loginConf.MaxIpFailures > 0 && ipFailures >= int64(loginConf.MaxIpFailures) {
+			service.lock(loginLockIpPrefix+ip, loginConf.LockSeconds)
+			service.audit(LoginEventLocked, "", idType, ip)
+		}
+	}
+	return loginDelay(userFailures, loginConf)
+}
+
+func (service *RedisLoginAttemptService) RecordSuccess(username string, idType int, ip string) {
+	service.conn.Del(loginFailUserPrefix + userKey(username, idType))
+	service.audit(LoginEventSuccess, username, idType, ip)
+}
+
+func (service *RedisLoginAttemptService) Unlock(username string, idType int, ip string) error {
+	keys := make([]string, 0, 4)
+	if username != "" {
+		keys = append(keys, loginLockUserPrefix+userKey(username, idType), loginFailUserPrefix+userKey(username, idType))
+	}
+	if ip != "" {
+		keys = append(keys, loginLockIpPrefix+ip, loginFailIpPrefix+ip)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := service.conn.Del(keys...).Err(); err != nil {
+		return err
+	}
+	service.audit(LoginEventUnlock, username, idType, ip)
+	return nil
+}
+
+// 失败计数加一并刷新有效期
+func (service *RedisLoginAttemptService) incr(key string, windowSeconds int) int64 {
+	if windowSeconds <= 0 {
+		windowSeconds = 900
+	}
+	pipe := service.conn.TxPipeline()
+	incr := pipe.Incr(key)
+	pipe.Expire(key, time.Duration(windowSeconds)*time.Second)
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("Record login failure failed, Error: %v", err)
+		return 0
+	}
+	return incr.Val()
+}
+
+func (service *RedisLoginAttemptService) lock(key string, lockSeconds int) {
+	if lockSeconds <= 0 {
+		lockSeconds = 900
+	}
+	if err := service.conn.Set(key, time.Now().Unix(), time.Duration(lockSeconds)*time.Second).Err(); err != nil {
+		log.Printf("Lock login failed, Error: %v", err)
+	}
+}
+
+// 审计事件写入日志和redis列表，列表只保留最近的maxLoginAuditEvents条
+func (service *RedisLoginAttemptService) audit(event string, username string, idType int, ip string) {
+	data, _ := json.Marshal(LoginAuditEvent{
+		Event:    event,
+		Username: username,
+		IdType:   idType,
+		Ip:       ip,
+		Time:     time.Now().Unix(),
+	})
+	log.Printf("login audit: %s", data)
+
+	pipe := service.conn.Pipeline()
+	pipe.LPush(loginAuditKey, data)
+	pipe.LTrim(loginAuditKey, 0, maxLoginAuditEvents-1)
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("Write login audit failed, Error: %v", err)
+	}
+}
+
+// 渐进延迟：第n次失败延迟base*2^(n-1)，不超过maxDelay
+func loginDelay(failures int64, loginConf conf.LoginProtectConf) time.Duration {
+	if failures <= 0 || loginConf.BaseDelayMillis <= 0 {
+		return 0
+	}
+	delay := time.Duration(loginConf.BaseDelayMillis) * time.Millisecond
+	maxDelay := time.Duration(loginConf.MaxDelayMillis) * time.Millisecond
+	for i := int64(1); i < failures && (maxDelay <= 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// 在用户名密码校验前后检查锁定状态、记录失败次数，密码模式和授权码模式的登录都经过这里
+type LoginProtectedUserDetailsService struct {
+	next     UserDetailsService
+	attempts LoginAttemptService
+}
+
+func NewLoginProtectedUserDetailsService(next UserDetailsService, attempts LoginAttemptService) UserDetailsService {
+	return &LoginProtectedUserDetailsService{
+		next:     next,
+		attempts: attempts,
+	}
+}
+
+func (service *LoginProtectedUserDetailsService) GetUserDetailByUsername(ctx context.Context, username, password string, idType int) (*UserDetails, error) {
+	ip, _ := ctx.Value(ClientIpKey).(string)
+	if err := service.attempts.Check(username, idType, ip); err != nil {
+		return nil, err
+	}
+
+	userDetails, err := service.next.GetUserDetailByUsername(ctx, username, password, idType)
+	if err == ErrInvalidUserInfo {
+		// 用户名或密码错误，延迟响应降低撞库速度
+		time.Sleep(service.attempts.RecordFailure(username, idType, ip))
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	service.attempts.RecordSuccess(username, idType, ip)
+	return userDetails, nil
+}
+
+func (service *LoginProtectedUserDetailsService) CheckUserStatus(ctx context.Context, userId int64) error {
+	return service.next.CheckUserStatus(ctx, userId)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	. "final-design/oauth-service/model"
+	conf "final-design/pkg/config"
+	"final-design/pkg/redistest"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	loginConf := conf.LoginProtectConf{BaseDelayMillis: 100, MaxDelayMillis: 1000}
+	tests := []struct {
+		name      string
+		failures  int64
+		loginConf conf.LoginProtectConf
+		want      time.Duration
+	}{
+		{"没有失败", 0, loginConf, 0},
+		{"计数失败", -1, loginConf, 0},
+		{"第1次", 1, loginConf, 100 * time.Millisecond},
+		{"第2次", 2, loginConf, 200 * time.Millisecond},
+		{"第4次", 4, loginConf, 800 * time.Millisecond},
+		{"达到上限", 5, loginConf, time.Second},
+		{"远超上限", 1000, loginConf, time.Second},
+		{"未配置延迟", 3, conf.LoginProtectConf{MaxDelayMillis: 1000}, 0},
+		{"未配置上限", 11, conf.LoginProtectConf{BaseDelayMillis: 1}, 1024 * time.Millisecond},
+		{"基础延迟超过上限", 1, conf.LoginProtectConf{BaseDelayMillis: 2000, MaxDelayMillis: 1000}, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loginDelay(tt.failures, tt.loginConf); got != tt.want {
+				t.Errorf("loginDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeLoginAttemptService struct {
+	locked              bool
+	failures, successes int
+}
+
+func (s *fakeLoginAttemptService) Check(username string, idType int, ip string) error {
+	if s.locked {
+		return ErrLoginLocked
+	}
+	return nil
+}
+
+func (s *fakeLoginAttemptService) RecordFailure(username string, idType int, ip string) time.Duration {
+	s.failures++
+	return 0
+}
+
+func (s *fakeLoginAttemptService) RecordSuccess(username string, idType int, ip string) {
+	s.successes++
+}
+
+func (s *fakeLoginAttemptService) Unlock(username string, idType int, ip string) error {
+	return nil
+}
+
+type fakeUserDetailsService struct {
+	password string
+	err      error
+	called   bool
+}
+
+func (s *fakeUserDetailsService) GetUserDetailByUsername(ctx context.Context, username, password string, idType int) (*UserDetails, error) {
+	s.called = true
+	if s.err != nil {
+		return nil, s.err
+	}
+	if password != s.password {
+		return nil, ErrInvalidUserInfo
+	}
+	return &UserDetails{Username: username}, nil
+}
+
+func (s *fakeUserDetailsService) CheckUserStatus(ctx context.Context, userId int64) error {
+	return nil
+}
+
+func TestLoginProtectedUserDetailsService(t *testing.T) {
+	errRpc := errors.New("rpc error")
+	tests := []struct {
+		name          string
+		locked        bool
+		password      string
+		nextErr       error
+		wantErr       error
+		wantCalled    bool
+		wantFailures  int
+		wantSuccesses int
+	}{
+		{"登录成功", false, "right", nil, nil, true, 0, 1},
+		{"密码错误", false, "wrong", nil, ErrInvalidUserInfo, true, 1, 0},
+		{"锁定时不校验密码", true, "right", nil, ErrLoginLocked, false, 0, 0},
+		{"服务错误不计入失败", false, "right", errRpc, errRpc, true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := &fakeLoginAttemptService{locked: tt.locked}
+			next := &fakeUserDetailsService{password: "right", err: tt.nextErr}
+			service := NewLoginProtectedUserDetailsService(next, attempts)
+			_, err := service.GetUserDetailByUsername(context.Background(), "alice", tt.password, 0)
+			if err != tt.wantErr {
+				t.Fatalf("GetUserDetailByUsername() error = %v, want %v", err, tt.wantErr)
+			}
+			if next.called != tt.wantCalled {
+				t.Errorf("next called = %v, want %v", next.called, tt.wantCalled)
+			}
+			if attempts.failures != tt.wantFailures || attempts.successes != tt.wantSuccesses {
+				t.Errorf("failures, successes = %d, %d, want %d, %d",
+					attempts.failures, attempts.successes, tt.wantFailures, tt.wantSuccesses)
+			}
+		})
+	}
+}
+
+func TestRedisLoginAttemptService(t *testing.T) {
+	conn, _ := redistest.New(t)
+	service := NewRedisLoginAttemptService(conn)
+	saved := conf.OAuth.LoginProtect
+	conf.OAuth.LoginProtect = conf.LoginProtectConf{
+		MaxUserFailures: 3, MaxIpFailures: 5, WindowSeconds: 60, LockSeconds: 60,
+		BaseDelayMillis: 100, MaxDelayMillis: 300,
+	}
+	t.Cleanup(func() { conf.OAuth.LoginProtect = saved })
+
+	tests := []struct {
+		name       string
+		idType     int
+		failures   int    // 连续失败次数
+		otherUsers int    // 同一IP下其它用户名各失败一次
+		unlock     string // 失败后解锁："user"、"ip"或不解锁
+		wantDelay  time.Duration
+		wantLocked bool
+	}{
+		{"未达到上限", 0, 2, 0, "", 200 * time.Millisecond, false},
+		{"用户名锁定", 0, 3, 0, "", 300 * time.Millisecond, true},
+		{"延迟不超过上限", 0, 4, 0, "", 300 * time.Millisecond, true},
+		{"不同账号类型分别计数", 1, 2, 0, "", 200 * time.Millisecond, false},
+		{"IP锁定", 0, 1, 4, "", 100 * time.Millisecond, true},
+		{"解锁用户名", 0, 3, 0, "user", 300 * time.Millisecond, false},
+		{"解锁IP", 0, 1, 4, "ip", 100 * time.Millisecond, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suffix := fmt.Sprintf("%d-%d", time.Now().UnixNano(), i)
+			username, ip := "user-"+suffix, "ip-"+suffix
+			if tt.idType != 0 {
+				// 另一账号类型下的同名用户失败次数达到上限，不影响本次的用户
+				for j := 0; j < 3; j++ {
+					service.RecordFailure(username, 0, "")
+				}
+			}
+			for j := 0; j < tt.otherUsers; j++ {
+				service.RecordFailure(fmt.Sprintf("other-%d-%s", j, suffix), tt.idType, ip)
+			}
+			var delay time.Duration
+			for j := 0; j < tt.failures; j++ {
+				delay = service.RecordFailure(username, tt.idType, ip)
+			}
+			if delay != tt.wantDelay {
+				t.Errorf("RecordFailure() delay = %v, want %v", delay, tt.wantDelay)
+			}
+			switch tt.unlock {
+			case "user":
+				if err := service.Unlock(username, tt.idType, ""); err != nil {
+					t.Fatal(err)
+				}
+			case "ip":
+				if err := service.Unlock("", tt.idType, ip); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := service.Check(username, tt.idType, ip)
+			if locked := err == ErrLoginLocked; locked != tt.wantLocked {
+				t.Errorf("Check() error = %v, want locked %v", err, tt.wantLocked)
+			}
+		})
+	}
+
+	// 登录成功清除用户名的失败计数
+	username := fmt.Sprintf("success-%d", time.Now().UnixNano())
+	service.RecordFailure(username, 0, "")
+	service.RecordFailure(username, 0, "")
+	service.RecordSuccess(username, 0, "")
+	if delay := service.RecordFailure(username, 0, ""); delay != 100*time.Millisecond {
+		t.Errorf("delay after success = %v, want %v", delay, 100*time.Millisecond)
+	}
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "final-design/oauth-service/model"
+	"final-design/pb"
+	"final-design/pkg/client"
+	conf "final-design/pkg/config"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	mfaTokenPrefix    = "oauth:mfa:"          // mfa_token -> 通过密码校验的登录信息
+	mfaAttemptsPrefix = "oauth:mfa_attempts:" // mfa_token -> 已尝试次数
+
+	defaultMfaIssuer               = "final-design"
+	defaultMfaTokenValiditySeconds = 300
+	defaultMfaMaxAttempts          = 5
+)
+
+var (
+	ErrInvalidMfaToken = errors.New("invalid mfa token")
+	ErrInvalidMfaCode  = errors.New("invalid mfa code")
+	ErrMfaRequired     = errors.New("mfa code is required")
+	ErrMfaNotPermit    = errors.New("mfa is only available for admin users")
+)
+
+// 密码校验通过但还需要第二因素，客户端使用MfaToken和动态码通过grant_type=mfa换取令牌；
+// EnrollRequired为true时用户尚未绑定，需要先用MfaToken绑定并启用两步验证
+type MfaRequiredError struct {
+	MfaToken       string
+	EnrollRequired bool
+}
+
+func (e *MfaRequiredError) Error() string {
+	if e.EnrollRequired {
+		return "mfa enrollment required"
+	}
+	return "mfa required"
+}
+
+// redis中保存的待验证登录
+type mfaChallenge struct {
+	ClientId string       `json:"client_id"`
+	User     *UserDetails `json:"user"`
+}
+
+// 两步验证，密钥和恢复码保存在user-service中
+type MfaService interface {
+	// 密码校验通过后调用，需要第二因素时返回*MfaRequiredError
+	Challenge(ctx context.Context, client *ClientDetails, user *UserDetails) error
+	// 读取mfa_token对应的用户，用于登录过程中绑定两步验证
+	ReadChallenge(mfaToken string) (*UserDetails, error)
+	// 使用mfa_token和动态码完成登录，成功后mfa_token失效
+	VerifyChallenge(ctx context.Context, client *ClientDetails, mfaToken string, code string) (*UserDetails, error)
+	// 校验登录时一并提交的动态码，授权码模式使用
+	VerifyLogin(ctx context.Context, user *UserDetails, code string) error
+
+	Status(ctx context.Context, user *UserDetails) (bool, error)
+	// 生成新密钥，返回密钥和用于生成二维码的otpauth地址
+	Enroll(ctx context.Context, user *UserDetails) (string, string, error)
+	// 校验动态码后启用，返回恢复码明文，只返回这一次
+	Activate(ctx context.Context, user *UserDetails, code string) ([]string, error)
+	// 校验动态码或恢复码后解除绑定
+	Disable(ctx context.Context, user *UserDetails, code string) error
+}
+
+type RemoteMfaService struct {
+	conn       *redis.Client
+	userClient client.UserClient
+	attempts   LoginAttemptService
+}
+
+// 动态码错误同样计入登录失败次数，防止拿到密码后反复申请mfa_token穷举动态码
+func NewRemoteMfaService(conn *redis.Client, attempts LoginAttemptService) MfaService {
+	userClient, _ := client.NewUserClient("user", nil, nil)
+	return &RemoteMfaService{
+		conn:       conn,
+		userClient: userClient,
+		attempts:   attempts,
+	}
+}
+
+func (service *RemoteMfaService) Challenge(ctx context.Context, client *ClientDetails, user *UserDetails) error {
+	if user.IdType != IdTypeAdmin {
+		return nil
+	}
+	enabled, err := service.Status(ctx, user)
+	if err != nil {
+		return err
+	}
+	if !enabled && !conf.OAuth.Mfa.RequireAdmin {
+		return nil
+	}
+
+	mfaToken, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	userDetails := *user
+	userDetails.Password = ""
+	data, _ := json.Marshal(&mfaChallenge{
+		ClientId: client.ClientId,
+		User:     &userDetails,
+	})
+	if err := service.conn.Set(mfaTokenPrefix+mfaToken, data, mfaTokenValidity()).Err(); err != nil {
+		return err
+	}
+	return &MfaRequiredError{MfaToken: mfaToken, EnrollRequired: !enabled}
+}
+
+func (service *RemoteMfaService) ReadChallenge(mfaToken string) (*UserDetails, error) {
+	challenge, err := service.readChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	return challenge.User, nil
+}
+
+func (service *RemoteMfaService) VerifyChallenge(ctx context.Context, client *ClientDetails, mfaToken string, code string) (*UserDetails, error) {
+	challenge, err := service.readChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	// mfa_token只能由申请它的客户端使用
+	if challenge.ClientId != client.ClientId {
+		return nil, ErrInvalidMfaToken
+	}
+
+	// 超过尝试次数后mfa_token失效，需要重新输入密码
+	attempts, err := service.conn.Incr(mfaAttemptsPrefix + mfaToken).Result()
+	if err != nil {
+		return nil, err
+	}
+	service.conn.Expire(mfaAttemptsPrefix+mfaToken, mfaTokenValidity())
+	if attempts > int64(mfaMaxAttempts()) {
+		service.conn.Del(mfaTokenPrefix+mfaToken, mfaAttemptsPrefix+mfaToken)
+		return nil, ErrInvalidMfaToken
+	}
+
+	if err := service.verify(ctx, challenge.User, code); err != nil {
+		return nil, err
+	}
+	// 删除成功的请求才能换取令牌，并发使用同一mfa_token时只有一个请求成功
+	n, err := service.conn.Del(mfaTokenPrefix + mfaToken).Result()
+	if err != nil {
+		return nil, err
+	}
+	service.conn.Del(mfaAttemptsPrefix + mfaToken)
+	if n == 0 {
+		return nil, ErrInvalidMfaToken
+	}
+	return challenge.User, nil
+}
+
+func (service *RemoteMfaService) VerifyLogin(ctx context.Context, user *UserDetails, code string) error {
+	if user.IdType != IdTypeAdmin {
+		return nil
+	}
+	enabled, err := service.Status(ctx, user)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		if conf.OAuth.Mfa.RequireAdmin {
+			return ErrMfaRequired
+		}
+		return nil
+	}
+	if code == "" {
+		return ErrMfaRequired
+	}
+	return service.verify(ctx, user, code)
+}
+
+func (service *RemoteMfaService) Status(ctx context.Context, user *UserDetails) (bool, error) {
+	if user.IdType != IdTypeAdmin {
+		return false, ErrMfaNotPermit
+	}
+	resp, err := service.userClient.MfaStatus(ctx, nil, &pb.MfaRequest{
+		UserId: user.UserId,
+		IdType: int32(user.IdType),
+	})
+	if err != nil {
+		return false, err
+	}
+	if resp.Err != "" {
+		return false, errors.New(resp.Err)
+	}
+	return resp.Enabled, nil
+}
+
+func (service *RemoteMfaService) Enroll(ctx context.Context, user *UserDetails) (string, string, error) {
+	if user.IdType != IdTypeAdmin {
+		return "", "", ErrMfaNotPermit
+	}
+	issuer := conf.OAuth.Mfa.Issuer
+	if issuer == "" {
+		issuer = defaultMfaIssuer
+	}
+	resp, err := service.userClient.MfaEnroll(ctx, nil, &pb.MfaEnrollRequest{
+		UserId:      user.UserId,
+		IdType:      int32(user.IdType),
+		AccountName: user.Username,
+		Issuer:      issuer,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if resp.Err != "" {
+		return "", "", errors.New(resp.Err)
+	}
+	return resp.Secret, resp.Uri, nil
+}
+
+func (service *RemoteMfaService) Activate(ctx context.Context, user *UserDetails, code string) ([]string, error) {
+	if user.IdType != IdTypeAdmin {
+		return nil, ErrMfaNotPermit
+	}
+	resp, err := service.userClient.MfaActivate(ctx, nil, &pb.MfaCodeRequest{
+		UserId: user.UserId,
+		IdType: int32(user.IdType),
+		Code:   code,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != "" {
+		return nil, errors.New(resp.Err)
+	}
+	return resp.RecoveryCodes, nil
+}
+
+func (service *RemoteMfaService) Disable(ctx context.Context, user *UserDetails, code string) error {
+	if user.IdType != IdTypeAdmin {
+		return ErrMfaNotPermit
+	}
+	if conf.OAuth.Mfa.RequireAdmin {
+		// 强制管理员使用两步验证时不允许解除，只能重新绑定
+		return ErrNotSupportOperation
+	}
+	resp, err := service.userClient.MfaDisable(ctx, nil, &pb.MfaCodeRequest{
+		UserId: user.UserId,
+		IdType: int32(user.IdType),
+		Code:   code,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		return errors.New(resp.Err)
+	}
+	return nil
+}
+
+// 校验动态码或恢复码，失败时计入该用户的登录失败次数
+func (service *RemoteMfaService) verify(ctx context.Context, user *UserDetails, code string) error {
+	ip, _ := ctx.Value(ClientIpKey).(string)
+	if err := service.attempts.Check(user.Username, user.IdType, ip); err != nil {
+		return err
+	}
+	resp, err := service.userClient.MfaVerify(ctx, nil, &pb.MfaCodeRequest{
+		UserId: user.UserId,
+		IdType: int32(user.IdType),
+		Code:   code,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		time.Sleep(service.attempts.RecordFailure(user.Username, user.IdType, ip))
+		return ErrInvalidMfaCode
+	}
+	service.attempts.RecordSuccess(user.Username, user.IdType, ip)
+	return nil
+}
+
+func (service *RemoteMfaService) readChallenge(mfaToken string) (*mfaChallenge, error) {
+	if mfaToken == "" {
+		return nil, ErrInvalidMfaToken
+	}
+	data, err := service.conn.Get(mfaTokenPrefix + mfaToken).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidMfaToken
+	} else if err != nil {
+		log.Printf("Read mfa token failed, Error: %v", err)
+		return nil, err
+	}
+	var challenge mfaChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func mfaTokenValidity() time.Duration {
+	validitySeconds := conf.OAuth.Mfa.TokenValiditySeconds
+	if validitySeconds <= 0 {
+		validitySeconds = defaultMfaTokenValiditySeconds
+	}
+	return time.Duration(validitySeconds) * time.Second
+}
+
+func mfaMaxAttempts() int {
+	if conf.OAuth.Mfa.MaxAttempts <= 0 {
+		return defaultMfaMaxAttempts
+	}
+	return conf.OAuth.Mfa.MaxAttempts
+}
+
+type MfaTokenGranter struct {
+	supportGrantType string
+	mfaService       MfaService
+	tokenService     TokenService
+}
+
+func NewMfaTokenGranter(grantType string, mfaService MfaService, tokenService TokenService) TokenGranter {
+	return &MfaTokenGranter{
+		supportGrantType: grantType,
+		mfaService:       mfaService,
+		tokenService:     tokenService,
+	}
+}
+
+// 密码模式返回mfa_token后，客户端提交mfa_token和动态码(或恢复码)换取令牌
+func (tokenGranter *MfaTokenGranter) Grant(ctx context.Context, grantType string, client *ClientDetails, reader *http.Request) (*OAuth2Token, error) {
+	if grantType != tokenGranter.supportGrantType {
+		return nil, ErrNotSupportGrantType
+	}
+	mfaToken, code := reader.FormValue("mfa_token"), reader.FormValue("code")
+	if mfaToken == "" || code == "" {
+		return nil, ErrInvalidMfaCode
+	}
+	userDetails, err := tokenGranter.mfaService.VerifyChallenge(ctx, client, mfaToken, code)
+	if err != nil {
+		return nil, err
+	}
+	return tokenGranter.tokenService.CreateAccessToken(&OAuth2Details{
+		Client: client,
+		User:   userDetails,
+	})
+}
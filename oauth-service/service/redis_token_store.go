@@ -0,0 +1,229 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	. "final-design/oauth-service/model"
+	"final-design/pkg/verifier"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	ErrRevokedToken       = verifier.ErrRevokedToken
+	ErrRefreshTokenReused = errors.New("refresh token is reused")
+)
+
+// 在redis中记录已签发的令牌，支持吊销；刷新令牌只能使用一次，
+// 重复使用时吊销该客户端和用户下的全部令牌
+type RedisTokenStore struct {
+	conn             *redis.Client
+	jwtTokenEnhancer *JwtTokenEnhancer
+}
+
+func NewRedisTokenStore(conn *redis.Client, jwtTokenEnhancer *JwtTokenEnhancer) TokenStore {
+	return &RedisTokenStore{
+		conn:             conn,
+		jwtTokenEnhancer: jwtTokenEnhancer,
+	}
+}
+
+func authKey(oauth2Details *OAuth2Details) string {
+	if oauth2Details.IsClientOnly() {
+		return oauth2Details.Client.ClientId
+	}
+	return oauth2Details.Client.ClientId + ":" + strconv.FormatInt(oauth2Details.User.UserId, 10)
+}
+
+// 存储访问令牌
+func (tokenStore *RedisTokenStore) StoreAccessToken(oauth2Token *OAuth2Token, oauth2Details *OAuth2Details) {
+	ttl := time.Until(*oauth2Token.ExpiresTime)
+	if ttl <= 0 {
+		return
+	}
+	record := verifier.TokenRecord{
+		AuthKey:     authKey(oauth2Details),
+		ExpiresTime: *oauth2Token.ExpiresTime,
+	}
+	if oauth2Token.RefreshToken != nil {
+		record.RefreshToken = oauth2Token.RefreshToken.TokenValue
+	}
+	data, _ := json.Marshal(record)
+
+	pipe := tokenStore.conn.TxPipeline()
+	pipe.Set(verifier.AccessTokenPrefix+verifier.TokenId(oauth2Token.TokenValue), data, ttl)
+	pipe.Set(verifier.AuthenticationPrefix+record.AuthKey, oauth2Token.TokenValue, ttl)
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("StoreAccessToken failed, Error: %v", err)
+	}
+	tokenStore.storeUserAuth(oauth2Details, ttl)
+}
+
+// 根据令牌值获取访问令牌结构体，签名有效但redis中没有记录的令牌已被吊销
+func (tokenStore *RedisTokenStore) ReadAccessToken(tokenValue string) (*OAuth2Token, error) {
+	oauth2Token, _, err := tokenStore.jwtTokenEnhancer.Extract(tokenValue)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tokenStore.readRecord(verifier.AccessTokenPrefix, tokenValue); err != nil {
+		return nil, err
+	}
+	return oauth2Token, nil
+}
+
+// 根据令牌值获取令牌对应的客户端和用户信息
+func (tokenStore *RedisTokenStore) ReadOAuth2Details(tokenValue string) (*OAuth2Details, error) {
+	if _, err := tokenStore.readRecord(verifier.AccessTokenPrefix, tokenValue); err != nil {
+		return nil, err
+	}
+	_, oauth2Details, err := tokenStore.jwtTokenEnhancer.Extract(tokenValue)
+	return oauth2Details, err
+}
+
+// 根据客户端信息和用户信息获取访问令牌
+func (tokenStore *RedisTokenStore) GetAccessToken(oauth2Details *OAuth2Details) (*OAuth2Token, error) {
+	tokenValue, err := tokenStore.conn.Get(verifier.AuthenticationPrefix + authKey(oauth2Details)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return tokenStore.ReadAccessToken(tokenValue)
+}
+
+// 移除存储的访问令牌，并加入黑名单，使网关等本地校验令牌的服务同样拒绝该令牌
+func (tokenStore *RedisTokenStore) RemoveAccessToken(tokenValue string) {
+	verifier.RemoveAccessToken(tokenStore.conn, tokenValue)
+}
+
+// 存储刷新令牌
+func (tokenStore *RedisTokenStore) StoreRefreshToken(oauth2Token *OAuth2Token, oauth2Details *OAuth2Details) {
+	ttl := time.Until(*oauth2Token.ExpiresTime)
+	if ttl <= 0 {
+		return
+	}
+	record := verifier.TokenRecord{
+		AuthKey:     authKey(oauth2Details),
+		ExpiresTime: *oauth2Token.ExpiresTime,
+	}
+	data, _ := json.Marshal(record)
+
+	pipe := tokenStore.conn.TxPipeline()
+	pipe.Set(verifier.RefreshTokenPrefix+verifier.TokenId(oauth2Token.TokenValue), data, ttl)
+	pipe.SAdd(verifier.AuthRefreshPrefix+record.AuthKey, verifier.TokenId(oauth2Token.TokenValue))
+	pipe.Expire(verifier.AuthRefreshPrefix+record.AuthKey, ttl)
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("StoreRefreshToken failed, Error: %v", err)
+	}
+	tokenStore.storeUserAuth(oauth2Details, ttl)
+}
+
+// 记录用户在哪些客户端下有令牌，集合保留到其中最晚过期的令牌过期
+func (tokenStore *RedisTokenStore) storeUserAuth(oauth2Details *OAuth2Details, ttl time.Duration) {
+	if oauth2Details.IsClientOnly() {
+		return
+	}
+	key := verifier.UserAuthPrefix + strconv.FormatInt(oauth2Details.User.UserId, 10)
+	if err := tokenStore.conn.SAdd(key, authKey(oauth2Details)).Err(); err != nil {
+		log.Printf("storeUserAuth failed, Error: %v", err)
+		return
+	}
+	if current, err := tokenStore.conn.TTL(key).Result(); err != nil || current < ttl {
+		tokenStore.conn.Expire(key, ttl)
+	}
+}
+
+// 移除存储的刷新令牌
+func (tokenStore *RedisTokenStore) RemoveRefreshToken(tokenValue string) {
+	record, err := tokenStore.readRecord(verifier.RefreshTokenPrefix, tokenValue)
+	if err != nil {
+		return
+	}
+	tokenId := verifier.TokenId(tokenValue)
+	tokenStore.conn.Del(verifier.RefreshTokenPrefix + tokenId)
+	tokenStore.conn.SRem(verifier.AuthRefreshPrefix+record.AuthKey, tokenId)
+}
+
+// 根据令牌值获取刷新令牌，已使用过的刷新令牌再次出现时视为被盗用
+func (tokenStore *RedisTokenStore) ReadRefreshToken(tokenValue string) (*OAuth2Token, error) {
+	oauth2Token, oauth2Details, err := tokenStore.jwtTokenEnhancer.Extract(tokenValue)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tokenStore.readRecord(verifier.RefreshTokenPrefix, tokenValue); err == ErrRevokedToken {
+		return nil, tokenStore.checkReuse(tokenValue, oauth2Details)
+	} else if err != nil {
+		return nil, err
+	}
+	return oauth2Token, nil
+}
+
+// 根据令牌值获取刷新令牌对应的客户端和用户信息
+func (tokenStore *RedisTokenStore) ReadOAuth2DetailsForRefreshToken(tokenValue string) (*OAuth2Details, error) {
+	if _, err := tokenStore.readRecord(verifier.RefreshTokenPrefix, tokenValue); err != nil {
+		return nil, err
+	}
+	_, oauth2Details, err := tokenStore.jwtTokenEnhancer.Extract(tokenValue)
+	return oauth2Details, err
+}
+
+// 使用刷新令牌，删除成功的请求才能换取新令牌，并发使用同一刷新令牌时只有一个请求成功
+func (tokenStore *RedisTokenStore) UseRefreshToken(tokenValue string) error {
+	oauth2Token, oauth2Details, err := tokenStore.jwtTokenEnhancer.Extract(tokenValue)
+	if err != nil {
+		return err
+	}
+	tokenId := verifier.TokenId(tokenValue)
+	n, err := tokenStore.conn.Del(verifier.RefreshTokenPrefix + tokenId).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		tokenStore.revokeAuthentication(authKey(oauth2Details))
+		return ErrRefreshTokenReused
+	}
+	tokenStore.conn.SRem(verifier.AuthRefreshPrefix+authKey(oauth2Details), tokenId)
+	// 记录已使用的刷新令牌直到它过期，用于检测重用
+	if ttl := time.Until(*oauth2Token.ExpiresTime); ttl > 0 {
+		tokenStore.conn.Set(verifier.UsedRefreshPrefix+tokenId, authKey(oauth2Details), ttl)
+	}
+	return nil
+}
+
+// 吊销访问令牌及其对应的刷新令牌
+func (tokenStore *RedisTokenStore) RevokeAccessToken(tokenValue string) error {
+	record, err := tokenStore.readRecord(verifier.AccessTokenPrefix, tokenValue)
+	if err == ErrRevokedToken {
+		return nil // 已吊销
+	} else if err != nil {
+		return err
+	}
+	tokenStore.RemoveAccessToken(tokenValue)
+	if record.RefreshToken != "" {
+		tokenStore.RemoveRefreshToken(record.RefreshToken)
+	}
+	return nil
+}
+
+func (tokenStore *RedisTokenStore) readRecord(prefix string, tokenValue string) (*verifier.TokenRecord, error) {
+	return verifier.ReadTokenRecord(tokenStore.conn, prefix, tokenValue)
+}
+
+// 刷新令牌不存在时，若它曾被使用过则吊销同一客户端和用户下的全部令牌
+func (tokenStore *RedisTokenStore) checkReuse(tokenValue string, oauth2Details *OAuth2Details) error {
+	n, err := tokenStore.conn.Exists(verifier.UsedRefreshPrefix + verifier.TokenId(tokenValue)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRevokedToken
+	}
+	log.Printf("refresh token reused, revoke tokens of [%s]", authKey(oauth2Details))
+	tokenStore.revokeAuthentication(authKey(oauth2Details))
+	return ErrRefreshTokenReused
+}
+
+func (tokenStore *RedisTokenStore) revokeAuthentication(authKey string) {
+	verifier.RevokeAuthentication(tokenStore.conn, authKey)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	. "final-design/oauth-service/model"
+	"final-design/pkg/redistest"
+	"final-design/pkg/verifier"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func newTestTokenService(t *testing.T) (TokenService, *redis.Client) {
+	conn, _ := redistest.New(t)
+	enhancer := NewJwtTokenEnhancer("test-secret").(*JwtTokenEnhancer)
+	return NewTokenService(NewRedisTokenStore(conn, enhancer), enhancer), conn
+}
+
+// 每个用例使用不同的客户端和用户，避免互相影响
+func testDetails(name string, userId int64) *OAuth2Details {
+	return &OAuth2Details{
+		Client: &ClientDetails{
+			ClientId:                    fmt.Sprintf("test-%s-%d", name, time.Now().UnixNano()),
+			AccessTokenValiditySeconds:  60,
+			RefreshTokenValiditySeconds: 120,
+		},
+		User: &UserDetails{UserId: userId, Username: name},
+	}
+}
+
+func TestRedisTokenStoreRefresh(t *testing.T) {
+	tokenService, _ := newTestTokenService(t)
+
+	tests := []struct {
+		name         string
+		reuse        bool // 刷新后再次使用旧的刷新令牌
+		wantReuseErr error
+	}{
+		{"正常刷新", false, nil},
+		{"刷新令牌重用", true, ErrRefreshTokenReused},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details := testDetails("refresh", time.Now().UnixNano()+int64(i))
+			token, err := tokenService.CreateAccessToken(details)
+			if err != nil {
+				t.Fatal(err)
+			}
+			refreshed, err := tokenService.RefreshAccessToken(token.RefreshToken.TokenValue)
+			if err != nil {
+				t.Fatalf("RefreshAccessToken() error = %v", err)
+			}
+			if _, err := tokenService.ReadAccessToken(token.TokenValue); err != ErrRevokedToken {
+				t.Errorf("old access token err = %v, want %v", err, ErrRevokedToken)
+			}
+			if _, err := tokenService.ReadAccessToken(refreshed.TokenValue); err != nil {
+				t.Errorf("new access token err = %v", err)
+			}
+			if !tt.reuse {
+				return
+			}
+
+			if _, err := tokenService.RefreshAccessToken(token.RefreshToken.TokenValue); err != tt.wantReuseErr {
+				t.Fatalf("reuse refresh token err = %v, want %v", err, tt.wantReuseErr)
+			}
+			// 重用后吊销该客户端和用户下的全部令牌
+			if _, err := tokenService.ReadAccessToken(refreshed.TokenValue); err != ErrRevokedToken {
+				t.Errorf("access token after reuse err = %v, want %v", err, ErrRevokedToken)
+			}
+			if _, err := tokenService.RefreshAccessToken(refreshed.RefreshToken.TokenValue); err == nil {
+				t.Errorf("refresh token after reuse is still valid")
+			}
+		})
+	}
+}
+
+func TestRedisTokenStoreRevoke(t *testing.T) {
+	tokenService, conn := newTestTokenService(t)
+	userId := time.Now().UnixNano()
+
+	tests := []struct {
+		name   string
+		revoke func(token *OAuth2Token) error
+	}{
+		{"注销访问令牌", func(token *OAuth2Token) error {
+			return tokenService.RevokeAccessToken(token.TokenValue)
+		}},
+		{"吊销用户全部令牌", func(token *OAuth2Token) error {
+			return verifier.RevokeUserTokens(conn, userId)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tokenService.CreateAccessToken(testDetails("revoke", userId))
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := tokenService.CreateAccessToken(testDetails("other", userId+1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.revoke(token); err != nil {
+				t.Fatalf("revoke error = %v", err)
+			}
+			if _, err := tokenService.ReadAccessToken(token.TokenValue); err != ErrRevokedToken {
+				t.Errorf("access token err = %v, want %v", err, ErrRevokedToken)
+			}
+			if _, err := tokenService.RefreshAccessToken(token.RefreshToken.TokenValue); err == nil {
+				t.Errorf("refresh token is still valid")
+			}
+			// 其它用户的令牌不受影响
+			if _, err := tokenService.ReadAccessToken(other.TokenValue); err != nil {
+				t.Errorf("other user's access token err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	conf "final-design/pkg/config"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrInvalidSigningKey  = errors.New("invalid signing key")
+)
+
+// 令牌签名密钥
+type SigningKey struct {
+	Kid        string            // 密钥标识
+	Method     jwt.SigningMethod // 签名算法
+	PrivateKey interface{}       // 签名使用的密钥，只用于校验的密钥为nil
+	PublicKey  interface{}       // 校验使用的密钥，HS256时与PrivateKey相同
+}
+
+// 根据配置加载签名密钥，PEM内容可以来自配置中心或文件
+func LoadSigningKey(keyConf conf.SigningKeyConf) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(keyConf.Alg)
+	if method == nil {
+		return nil, fmt.Errorf("kid [%s]: unsupported alg [%s]", keyConf.Kid, keyConf.Alg)
+	}
+	key := &SigningKey{Kid: keyConf.Kid, Method: method}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if keyConf.Secret == "" {
+			return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, ErrInvalidSigningKey)
+		}
+		key.PrivateKey = []byte(keyConf.Secret)
+		key.PublicKey = key.PrivateKey
+		return key, nil
+	}
+
+	privatePem, err := readPem(keyConf.PrivateKey, keyConf.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, err)
+	}
+	publicPem, err := readPem(keyConf.PublicKey, keyConf.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, err)
+	}
+
+	switch method.(type) {
+	case *jwt.SigningMethodRSA:
+		if privatePem != nil {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePem)
+			if err != nil {
+				return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, err)
+			}
+			key.PrivateKey, key.PublicKey = privateKey, &privateKey.PublicKey
+		} else if publicPem != nil {
+			if key.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicPem); err != nil {
+				return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, err)
+			}
+		}
+	case *jwt.SigningMethodECDSA:
+		if privatePem != nil {
+			privateKey, err := jwt.ParseECPrivateKeyFromPEM(privatePem)
+			if err != nil {
+				return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, err)
+			}
+			key.PrivateKey, key.PublicKey = privateKey, &privateKey.PublicKey
+		} else if publicPem != nil {
+			if key.PublicKey, err = jwt.ParseECPublicKeyFromPEM(publicPem); err != nil {
+				return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("kid [%s]: unsupported alg [%s]", keyConf.Kid, keyConf.Alg)
+	}
+
+	if key.PublicKey == nil {
+		return nil, fmt.Errorf("kid [%s]: %w", keyConf.Kid, ErrInvalidSigningKey)
+	}
+	return key, nil
+}
+
+// 加载全部密钥，activeKid对应的密钥必须包含私钥
+func LoadSigningKeys(activeKid string, keyConfs []conf.SigningKeyConf) (*SigningKey, []*SigningKey, error) {
+	var active *SigningKey
+	keys := make([]*SigningKey, 0, len(keyConfs))
+	for _, keyConf := range keyConfs {
+		key, err := LoadSigningKey(keyConf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if key.Kid == activeKid {
+			active = key
+		}
+		keys = append(keys, key)
+	}
+	if active == nil || active.PrivateKey == nil {
+		return nil, nil, fmt.Errorf("active kid [%s]: %w", activeKid, ErrSigningKeyNotFound)
+	}
+	return active, keys, nil
+}
+
+func readPem(content string, file string) ([]byte, error) {
+	if content != "" {
+		return []byte(content), nil
+	}
+	if file != "" {
+		return ioutil.ReadFile(file)
+	}
+	return nil, nil
+}
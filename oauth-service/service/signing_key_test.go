@@ -0,0 +1,192 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	. "final-design/oauth-service/model"
+	conf "final-design/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type testKeys struct {
+	rsaKey    *rsa.PrivateKey
+	rsaPem    string
+	rsaPubPem string
+	ecKey     *ecdsa.PrivateKey
+	ecPem     string
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	keys := &testKeys{
+		rsaKey:    rsaKey,
+		rsaPem:    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})),
+		rsaPubPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPub})),
+	}
+	keys.ecKey, keys.ecPem = newEcPem(t)
+	return keys
+}
+
+func newEcPem(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalECPrivateKey(key)
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+// 只要求返回错误，不关心具体是哪个错误
+var errAny = errors.New("any error")
+
+func TestLoadSigningKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	tests := []struct {
+		name      string
+		activeKid string
+		confs     []conf.SigningKeyConf
+		wantErr   error // nil表示成功，errAny表示任意错误
+		wantKeys  int
+	}{
+		{"RS256", "rs", []conf.SigningKeyConf{{Kid: "rs", Alg: "RS256", PrivateKey: keys.rsaPem}}, nil, 1},
+		{"ES256", "ec", []conf.SigningKeyConf{{Kid: "ec", Alg: "ES256", PrivateKey: keys.ecPem}}, nil, 1},
+		{"HS256", "hs", []conf.SigningKeyConf{{Kid: "hs", Alg: "HS256", Secret: "secret"}}, nil, 1},
+		{"轮换后旧密钥只保留公钥", "ec", []conf.SigningKeyConf{
+			{Kid: "rs", Alg: "RS256", PublicKey: keys.rsaPubPem},
+			{Kid: "ec", Alg: "ES256", PrivateKey: keys.ecPem}}, nil, 2},
+		{"当前密钥只有公钥", "rs", []conf.SigningKeyConf{{Kid: "rs", Alg: "RS256", PublicKey: keys.rsaPubPem}}, ErrSigningKeyNotFound, 0},
+		{"当前kid不存在", "new", []conf.SigningKeyConf{{Kid: "rs", Alg: "RS256", PrivateKey: keys.rsaPem}}, ErrSigningKeyNotFound, 0},
+		{"HS256缺少密钥", "hs", []conf.SigningKeyConf{{Kid: "hs", Alg: "HS256"}}, ErrInvalidSigningKey, 0},
+		{"没有私钥和公钥", "rs", []conf.SigningKeyConf{{Kid: "rs", Alg: "RS256"}}, ErrInvalidSigningKey, 0},
+		{"不支持的算法", "x", []conf.SigningKeyConf{{Kid: "x", Alg: "none"}}, errAny, 0},
+		{"算法与密钥类型不一致", "rs", []conf.SigningKeyConf{{Kid: "rs", Alg: "ES256", PrivateKey: keys.rsaPem}}, errAny, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, all, err := LoadSigningKeys(tt.activeKid, tt.confs)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("LoadSigningKeys() error = %v", err)
+			case tt.wantErr == errAny && err == nil, tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("LoadSigningKeys() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if active.Kid != tt.activeKid || active.PrivateKey == nil || len(all) != tt.wantKeys {
+				t.Errorf("LoadSigningKeys() = %s, %d keys", active.Kid, len(all))
+			}
+		})
+	}
+}
+
+// 按kid选择校验密钥，令牌头中的alg必须与密钥一致
+func TestJwtTokenEnhancerExtract(t *testing.T) {
+	keys := newTestKeys(t)
+	active, all, err := LoadSigningKeys("ec-2", []conf.SigningKeyConf{
+		{Kid: "rs-1", Alg: "RS256", PublicKey: keys.rsaPubPem},
+		{Kid: "ec-2", Alg: "ES256", PrivateKey: keys.ecPem},
+		{Kid: "hs", Alg: "HS256", Secret: "test-secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enhancer := NewJwtTokenEnhancerWithKeys(active, all)
+	otherEc, _ := newEcPem(t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	forge := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		claims := OAuth2TokenCustomClaims{
+			UserDetails:    &UserDetails{UserId: 1, Username: "alice"},
+			ClientDetails:  ClientDetails{ClientId: "app"},
+			StandardClaims: jwt.StandardClaims{ExpiresAt: expiresAt.Unix()},
+		}
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		tokenValue, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenValue
+	}
+	issued, err := enhancer.Enhance(&OAuth2Token{ExpiresTime: &expiresAt},
+		&OAuth2Details{Client: &ClientDetails{ClientId: "app"}, User: &UserDetails{UserId: 1, Username: "alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"当前密钥签发", issued.TokenValue, false},
+		{"轮换前的密钥签发", forge(jwt.SigningMethodRS256, "rs-1", keys.rsaKey), false},
+		{"对称密钥签发", forge(jwt.SigningMethodHS256, "hs", []byte("test-secret")), false},
+		{"kid不存在", forge(jwt.SigningMethodES256, "ec-3", keys.ecKey), true},
+		{"没有kid", forge(jwt.SigningMethodES256, "", keys.ecKey), true},
+		{"kid与签名密钥不一致", forge(jwt.SigningMethodES256, "ec-2", otherEc), true},
+		{"用公钥作为HS256密钥伪造", forge(jwt.SigningMethodHS256, "rs-1", []byte(keys.rsaPubPem)), true},
+		{"RS384冒充RS256", forge(jwt.SigningMethodRS384, "rs-1", keys.rsaKey), true},
+		{"HS512冒充HS256", forge(jwt.SigningMethodHS512, "hs", []byte("test-secret")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, details, err := enhancer.Extract(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Extract() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if details.User.Username != "alice" || details.Client.ClientId != "app" || token.ExpiresTime.Unix() != expiresAt.Unix() {
+				t.Errorf("Extract() = %+v, %+v", details.User, details.Client)
+			}
+		})
+	}
+}
+
+// 对称密钥不能出现在公开发布的JWKS中
+func TestJwtTokenEnhancerTokenKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	active, all, err := LoadSigningKeys("ec", []conf.SigningKeyConf{
+		{Kid: "ec", Alg: "ES256", PrivateKey: keys.ecPem},
+		{Kid: "rs", Alg: "RS256", PrivateKey: keys.rsaPem},
+		{Kid: "hs", Alg: "HS256", Secret: "test-secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet := NewJwtTokenEnhancerWithKeys(active, all).TokenKeys()
+	algs := map[string]string{}
+	for _, key := range keySet.Keys {
+		algs[key.Kid] = key.Alg
+	}
+	public := map[string]string{}
+	for _, key := range keySet.PublicKeys().Keys {
+		public[key.Kid] = key.Alg
+		if key.K != "" {
+			t.Errorf("public key %s contains private material", key.Kid)
+		}
+	}
+	if len(algs) != 3 || algs["hs"] != "HS256" {
+		t.Errorf("TokenKeys() = %v", algs)
+	}
+	if len(public) != 2 || public["ec"] != "ES256" || public["rs"] != "RS256" {
+		t.Errorf("PublicKeys() = %v", public)
+	}
+}
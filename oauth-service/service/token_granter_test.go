@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	. "final-design/oauth-service/model"
+	"net/http"
+	"testing"
+)
+
+// 只记录是否被调用
+type stubTokenGranter struct {
+	called bool
+}
+
+func (granter *stubTokenGranter) Grant(ctx context.Context, grantType string, client *ClientDetails, reader *http.Request) (*OAuth2Token, error) {
+	granter.called = true
+	return &OAuth2Token{TokenValue: grantType}, nil
+}
+
+// 只实现CreateAccessToken，其它方法不会被调用
+type stubTokenService struct {
+	TokenService
+	details *OAuth2Details
+}
+
+func (service *stubTokenService) CreateAccessToken(oauth2Details *OAuth2Details) (*OAuth2Token, error) {
+	service.details = oauth2Details
+	return &OAuth2Token{TokenValue: "token"}, nil
+}
+
+func TestComposeTokenGranter(t *testing.T) {
+	tests := []struct {
+		name       string
+		grantType  string
+		authorized []string
+		wantErr    error
+	}{
+		{"已授权", "password", []string{"password", "refresh_token"}, nil},
+		{"客户端凭证", "client_credentials", []string{"client_credentials"}, nil},
+		{"未授权的类型", "client_credentials", []string{"password", "refresh_token"}, ErrUnauthorizedClient},
+		{"没有授权类型", "password", nil, ErrUnauthorizedClient},
+		{"不支持的类型", "implicit", []string{"implicit"}, ErrNotSupportGrantType},
+		{"空类型", "", []string{""}, ErrNotSupportGrantType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granters := map[string]TokenGranter{
+				"password":           &stubTokenGranter{},
+				"refresh_token":      &stubTokenGranter{},
+				"client_credentials": &stubTokenGranter{},
+			}
+			client := &ClientDetails{ClientId: "app", AuthorizedGrantTypes: tt.authorized}
+			token, err := NewComposeTokenGranter(granters).Grant(context.Background(), tt.grantType, client, &http.Request{})
+			if err != tt.wantErr {
+				t.Fatalf("Grant() error = %v, want %v", err, tt.wantErr)
+			}
+			for grantType, granter := range granters {
+				want := err == nil && grantType == tt.grantType
+				if called := granter.(*stubTokenGranter).called; called != want {
+					t.Errorf("granter %s called = %v, want %v", grantType, called, want)
+				}
+			}
+			if err == nil && token.TokenValue != tt.grantType {
+				t.Errorf("token = %q, want %q", token.TokenValue, tt.grantType)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsTokenGranter(t *testing.T) {
+	tests := []struct {
+		name      string
+		grantType string
+		secret    string
+		wantErr   error
+	}{
+		{"成功", "client_credentials", "$2a$10$hash", nil},
+		{"公开客户端", "client_credentials", "", ErrUnauthorizedClient},
+		{"授权类型错误", "password", "$2a$10$hash", ErrNotSupportGrantType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenService := &stubTokenService{}
+			granter := NewClientCredentialsTokenGranter("client_credentials", tokenService)
+			client := &ClientDetails{ClientId: "gateway", ClientSecret: tt.secret, Scope: []string{"order.read"}}
+			_, err := granter.Grant(context.Background(), tt.grantType, client, &http.Request{})
+			if err != tt.wantErr {
+				t.Fatalf("Grant() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if tokenService.details != nil {
+					t.Error("token created for rejected request")
+				}
+				return
+			}
+			// 令牌只代表客户端自身
+			if tokenService.details.User != nil || tokenService.details.Client != client {
+				t.Errorf("token details = %+v, want client only", tokenService.details)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	. "final-design/oauth-service/model"
+	"final-design/pkg/verifier"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -37,25 +38,31 @@ func NewComposeTokenGranter(tokenGrantDict map[string]TokenGranter) TokenGranter
 	}
 }
 
-// 根据grantType选择一个TokenGranter使用
+// 根据grantType选择一个TokenGranter使用，客户端只能使用client_details中授权的类型
 func (tokenGranter *ComposeTokenGranter) Grant(ctx context.Context, grantType string, client *ClientDetails, reader *http.Request) (*OAuth2Token, error) {
 	dispatchGranter := tokenGranter.TokenGrantDict[grantType]
 	if dispatchGranter == nil {
 		return nil, ErrNotSupportGrantType
 	}
+	if !client.IsAuthorizedGrantType(grantType) {
+		return nil, ErrUnauthorizedClient
+	}
 	return dispatchGranter.Grant(ctx, grantType, client, reader)
 }
 
 type UsernamePasswordTokenGranter struct {
 	supportGrantType   string
 	userDetailsService UserDetailsService
+	mfaService         MfaService
 	tokenService       TokenService
 }
 
-func NewUsernamePasswordTokenGranter(grantType string, userDetailsService UserDetailsService, tokenService TokenService) TokenGranter {
+// mfaService为nil时不校验第二因素
+func NewUsernamePasswordTokenGranter(grantType string, userDetailsService UserDetailsService, mfaService MfaService, tokenService TokenService) TokenGranter {
 	return &UsernamePasswordTokenGranter{
 		supportGrantType:   grantType,
 		userDetailsService: userDetailsService,
+		mfaService:         mfaService,
 		tokenService:       tokenService,
 	}
 }
@@ -71,7 +78,6 @@ func (tokenGranter *UsernamePasswordTokenGranter) Grant(ctx context.Context, gra
 	}
 	username, password, idType := user.Username, user.Password, user.IdType
 	fmt.Println("username=", username)
-	fmt.Println("password=", password)
 	if idType == 0 {
 		fmt.Println("id_type=", "普通用户")
 	} else {
@@ -83,10 +89,18 @@ func (tokenGranter *UsernamePasswordTokenGranter) Grant(ctx context.Context, gra
 
 	// 验证用户名密码是否正确
 	userDetails, err := tokenGranter.userDetailsService.GetUserDetailByUsername(ctx, username, password, idType)
-	if err != nil {
+	if err == ErrLoginLocked {
+		return nil, err
+	} else if err != nil {
 		fmt.Println("token_service.go ==> err:", err)
 		return nil, ErrInvalidUsernameAndPasswordRequest
 	}
+	// 启用了两步验证的管理员先返回mfa_token，提交动态码后才签发令牌
+	if tokenGranter.mfaService != nil {
+		if err := tokenGranter.mfaService.Challenge(ctx, client, userDetails); err != nil {
+			return nil, err
+		}
+	}
 	// 根据用户信息和客户端信息生成访问令牌
 	return tokenGranter.tokenService.CreateAccessToken(&OAuth2Details{
 		Client: client,
@@ -95,14 +109,17 @@ func (tokenGranter *UsernamePasswordTokenGranter) Grant(ctx context.Context, gra
 }
 
 type RefreshTokenGranter struct {
-	supportGrantType string
-	tokenService     TokenService
+	supportGrantType   string
+	userDetailsService UserDetailsService
+	tokenService       TokenService
 }
 
+// 刷新前检查账号状态，禁用或删除的账号不能再换取新令牌
 func NewRefreshTokenGranter(grantType string, userDetailsService UserDetailsService, tokenService TokenService) TokenGranter {
 	return &RefreshTokenGranter{
-		supportGrantType: grantType,
-		tokenService:     tokenService,
+		supportGrantType:   grantType,
+		userDetailsService: userDetailsService,
+		tokenService:       tokenService,
 	}
 }
 
@@ -115,20 +132,59 @@ func (tokenGranter *RefreshTokenGranter) Grant(ctx context.Context, grantType st
 	if refreshTokenValue == "" {
 		return nil, ErrInvalidTokenRequest
 	}
+	oauth2Details, err := tokenGranter.tokenService.GetOAuth2DetailsByRefreshToken(refreshTokenValue)
+	if err != nil {
+		return nil, err
+	}
+	if !oauth2Details.IsClientOnly() {
+		if err := tokenGranter.userDetailsService.CheckUserStatus(ctx, oauth2Details.User.UserId); err != nil {
+			return nil, err
+		}
+	}
 	return tokenGranter.tokenService.RefreshAccessToken(refreshTokenValue)
 }
 
+type ClientCredentialsTokenGranter struct {
+	supportGrantType string
+	tokenService     TokenService
+}
+
+func NewClientCredentialsTokenGranter(grantType string, tokenService TokenService) TokenGranter {
+	return &ClientCredentialsTokenGranter{
+		supportGrantType: grantType,
+		tokenService:     tokenService,
+	}
+}
+
+// 服务间调用使用，令牌只代表客户端自身，不包含用户信息，也不签发刷新令牌
+func (tokenGranter *ClientCredentialsTokenGranter) Grant(ctx context.Context, grantType string, client *ClientDetails, reader *http.Request) (*OAuth2Token, error) {
+	if grantType != tokenGranter.supportGrantType {
+		return nil, ErrNotSupportGrantType
+	}
+	// 没有密钥的公开客户端无法证明自己的身份
+	if client.ClientSecret == "" {
+		return nil, ErrUnauthorizedClient
+	}
+	return tokenGranter.tokenService.CreateAccessToken(&OAuth2Details{
+		Client: client,
+	})
+}
+
 type TokenService interface {
 	// 根据访问令牌获取对应的用户信息和客户端信息
 	GetOAuth2DetailsByAccessToken(tokenValue string) (*OAuth2Details, error)
 	// 根据用户信息和客户端信息生成访问令牌
 	CreateAccessToken(oauth2Details *OAuth2Details) (*OAuth2Token, error)
+	// 根据刷新令牌获取对应的用户信息和客户端信息
+	GetOAuth2DetailsByRefreshToken(refreshTokenValue string) (*OAuth2Details, error)
 	// 根据刷新令牌获取访问令牌
 	RefreshAccessToken(refreshTokenValue string) (*OAuth2Token, error)
 	// 根据用户信息和客户端信息获取已生成访问令牌
 	GetAccessToken(details *OAuth2Details) (*OAuth2Token, error)
 	// 根据访问令牌值获取访问令牌结构体
 	ReadAccessToken(tokenValue string) (*OAuth2Token, error)
+	// 吊销访问令牌及其刷新令牌
+	RevokeAccessToken(tokenValue string) error
 }
 
 type DefaultTokenService struct {
@@ -146,10 +202,12 @@ func NewTokenService(tokenStore TokenStore, tokenEnhancer TokenEnhancer) TokenSe
 func (tokenService *DefaultTokenService) createAccessToken(refreshToken *OAuth2Token, oauth2Details *OAuth2Details) (*OAuth2Token, error) {
 	validitySeconds := oauth2Details.Client.AccessTokenValiditySeconds
 	s, _ := time.ParseDuration(strconv.Itoa(validitySeconds) + "s")
-	expiredTime := time.Now().Add(s)
+	issuedTime := time.Now()
+	expiredTime := issuedTime.Add(s)
 	accessToken := &OAuth2Token{
 		RefreshToken: refreshToken,
 		ExpiresTime:  &expiredTime,
+		IssuedTime:   &issuedTime,
 		TokenValue:   uuid.NewV4().String(),
 	}
 
@@ -162,9 +220,11 @@ func (tokenService *DefaultTokenService) createAccessToken(refreshToken *OAuth2T
 func (tokenService *DefaultTokenService) createRefreshToken(oauth2Details *OAuth2Details) (*OAuth2Token, error) {
 	validitySeconds := oauth2Details.Client.RefreshTokenValiditySeconds
 	s, _ := time.ParseDuration(strconv.Itoa(validitySeconds) + "s")
-	expiredTime := time.Now().Add(s)
+	issuedTime := time.Now()
+	expiredTime := issuedTime.Add(s)
 	refreshToken := &OAuth2Token{
 		ExpiresTime: &expiredTime,
+		IssuedTime:  &issuedTime,
 		TokenValue:  uuid.NewV4().String(),
 	}
 
@@ -186,6 +246,18 @@ func (tokenService *DefaultTokenService) GetOAuth2DetailsByAccessToken(tokenValu
 	return nil, err
 }
 
+// 根据刷新令牌获取对应的用户信息和客户端信息，已使用过的刷新令牌同样触发重用检测
+func (tokenService *DefaultTokenService) GetOAuth2DetailsByRefreshToken(refreshTokenValue string) (*OAuth2Details, error) {
+	refreshToken, err := tokenService.tokenStore.ReadRefreshToken(refreshTokenValue)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken.IsExpired() {
+		return nil, ErrExpiredToken
+	}
+	return tokenService.tokenStore.ReadOAuth2DetailsForRefreshToken(refreshTokenValue)
+}
+
 // 根据用户信息和客户端信息生成访问令牌
 func (tokenService *DefaultTokenService) CreateAccessToken(oauth2Details *OAuth2Details) (*OAuth2Token, error) {
 	existToken, err := tokenService.tokenStore.GetAccessToken(oauth2Details)
@@ -202,11 +274,14 @@ func (tokenService *DefaultTokenService) CreateAccessToken(oauth2Details *OAuth2
 		tokenService.tokenStore.RemoveAccessToken(existToken.TokenValue)
 		if existToken.RefreshToken != nil {
 			refreshToken = existToken.RefreshToken
-			tokenService.tokenStore.RemoveRefreshToken(refreshToken.TokenType)
+			tokenService.tokenStore.RemoveRefreshToken(refreshToken.TokenValue)
 		}
 	}
 
-	if refreshToken == nil || refreshToken.IsExpired() {
+	// 只代表客户端的令牌不需要刷新令牌，过期后重新申请
+	if oauth2Details.IsClientOnly() {
+		refreshToken = nil
+	} else if refreshToken == nil || refreshToken.IsExpired() {
 		refreshToken, err = tokenService.createRefreshToken(oauth2Details)
 		if err != nil {
 			return nil, err
@@ -218,41 +293,46 @@ func (tokenService *DefaultTokenService) CreateAccessToken(oauth2Details *OAuth2
 	if err == nil {
 		// 保存新生成令牌
 		tokenService.tokenStore.StoreAccessToken(accessToken, oauth2Details)
-		tokenService.tokenStore.StoreRefreshToken(refreshToken, oauth2Details)
+		if refreshToken != nil {
+			tokenService.tokenStore.StoreRefreshToken(refreshToken, oauth2Details)
+		}
 	}
 	return accessToken, err
 }
 
-// 根据刷新令牌获取访问令牌
+// 根据刷新令牌获取访问令牌，刷新令牌只能使用一次
 func (tokenService *DefaultTokenService) RefreshAccessToken(refreshTokenValue string) (*OAuth2Token, error) {
 	refreshToken, err := tokenService.tokenStore.ReadRefreshToken(refreshTokenValue)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken.IsExpired() {
+		return nil, ErrExpiredToken
+	}
+	oauth2Details, err := tokenService.tokenStore.ReadOAuth2DetailsForRefreshToken(refreshTokenValue)
+	if err != nil {
+		return nil, err
+	}
 
-	if err == nil {
-		if refreshToken.IsExpired() {
-			return nil, ErrExpiredToken
-		}
-		oauth2Details, err := tokenService.tokenStore.ReadOAuth2DetailsForRefreshToken(refreshTokenValue)
-		if err == nil {
-			oauth2Token, err := tokenService.tokenStore.GetAccessToken(oauth2Details)
-			// 移除原有的访问令牌
-			if err == nil {
-				tokenService.tokenStore.RemoveAccessToken(oauth2Token.TokenValue)
-			}
+	// 使用刷新令牌，失败说明刷新令牌已被其他请求使用
+	if err = tokenService.tokenStore.UseRefreshToken(refreshTokenValue); err != nil {
+		return nil, err
+	}
+	// 移除原有的访问令牌
+	if oauth2Token, err := tokenService.tokenStore.GetAccessToken(oauth2Details); err == nil {
+		tokenService.tokenStore.RemoveAccessToken(oauth2Token.TokenValue)
+	}
 
-			// 移除已使用的刷新令牌
-			tokenService.tokenStore.RemoveRefreshToken(refreshTokenValue)
-			refreshToken, err = tokenService.createRefreshToken(oauth2Details)
-			if err == nil {
-				accessToken, err := tokenService.createAccessToken(refreshToken, oauth2Details)
-				if err == nil {
-					tokenService.tokenStore.StoreAccessToken(accessToken, oauth2Details)
-					tokenService.tokenStore.StoreRefreshToken(refreshToken, oauth2Details)
-				}
-				return accessToken, err
-			}
-		}
+	refreshToken, err = tokenService.createRefreshToken(oauth2Details)
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+	accessToken, err := tokenService.createAccessToken(refreshToken, oauth2Details)
+	if err == nil {
+		tokenService.tokenStore.StoreAccessToken(accessToken, oauth2Details)
+		tokenService.tokenStore.StoreRefreshToken(refreshToken, oauth2Details)
+	}
+	return accessToken, err
 }
 
 // 根据用户信息和客户端信息获取已生成访问令牌
@@ -265,6 +345,11 @@ func (tokenService *DefaultTokenService) ReadAccessToken(tokenValue string) (*OA
 	return tokenService.tokenStore.ReadAccessToken(tokenValue)
 }
 
+// 吊销访问令牌及其刷新令牌
+func (tokenService *DefaultTokenService) RevokeAccessToken(tokenValue string) error {
+	return tokenService.tokenStore.RevokeAccessToken(tokenValue)
+}
+
 type TokenStore interface {
 	// 存储访问令牌
 	StoreAccessToken(oauth2Token *OAuth2Token, oauth2Details *OAuth2Details)
@@ -284,6 +369,10 @@ type TokenStore interface {
 	ReadRefreshToken(tokenValue string) (*OAuth2Token, error)
 	// 根据令牌值获取刷新令牌对应的客户端和用户信息
 	ReadOAuth2DetailsForRefreshToken(tokenValue string) (*OAuth2Details, error)
+	// 使用刷新令牌，刷新令牌重复使用时返回ErrRefreshTokenReused
+	UseRefreshToken(tokenValue string) error
+	// 吊销访问令牌及其刷新令牌
+	RevokeAccessToken(tokenValue string) error
 }
 
 type JwtTokenStore struct {
@@ -341,25 +430,55 @@ func (tokenStore *JwtTokenStore) ReadOAuth2DetailsForRefreshToken(tokenValue str
 	return oauth2Details, err
 }
 
+// jwt令牌无状态，无法检测刷新令牌重用
+func (tokenStore *JwtTokenStore) UseRefreshToken(tokenValue string) error {
+	return nil
+}
+
+// jwt令牌无状态，无法吊销
+func (tokenStore *JwtTokenStore) RevokeAccessToken(tokenValue string) error {
+	return ErrNotSupportOperation
+}
+
 type TokenEnhancer interface {
 	// 组装Token信息
 	Enhance(oauth2Token *OAuth2Token, oauth2Details *OAuth2Details) (*OAuth2Token, error)
 	// 从Token中还原信息
 	Extract(tokenValue string) (*OAuth2Token, *OAuth2Details, error)
+	// 校验Token使用的密钥
+	TokenKeys() *verifier.KeySet
 }
 
 type JwtTokenEnhancer struct {
-	secretKey []byte
+	signingKey *SigningKey            // 当前用于签名的密钥
+	keys       map[string]*SigningKey // kid -> 校验密钥，轮换时旧密钥继续用于校验
 }
 
+// 使用HS256对称密钥签名
 func NewJwtTokenEnhancer(secretKey string) TokenEnhancer {
+	key := &SigningKey{
+		Method:     jwt.SigningMethodHS256,
+		PrivateKey: []byte(secretKey),
+		PublicKey:  []byte(secretKey),
+	}
+	return NewJwtTokenEnhancerWithKeys(key, []*SigningKey{key})
+}
+
+// 使用signingKey签名，keys中的全部密钥都可用于校验
+func NewJwtTokenEnhancerWithKeys(signingKey *SigningKey, keys []*SigningKey) TokenEnhancer {
+	keyMap := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		keyMap[key.Kid] = key
+	}
+	keyMap[signingKey.Kid] = signingKey
 	return &JwtTokenEnhancer{
-		secretKey: []byte(secretKey),
+		signingKey: signingKey,
+		keys:       keyMap,
 	}
 }
 
 type OAuth2TokenCustomClaims struct {
-	UserDetails   UserDetails
+	UserDetails   *UserDetails // client_credentials签发的令牌为nil
 	ClientDetails ClientDetails
 	RefreshToken  OAuth2Token
 	jwt.StandardClaims
@@ -371,48 +490,88 @@ func (enhancer *JwtTokenEnhancer) Enhance(oauth2Token *OAuth2Token, oauth2Detail
 
 func (enhancer *JwtTokenEnhancer) Extract(tokenValue string) (*OAuth2Token, *OAuth2Details, error) {
 	token, err := jwt.ParseWithClaims(tokenValue, &OAuth2TokenCustomClaims{},
-		func(token *jwt.Token) (i interface{}, e error) { return enhancer.secretKey, nil },
+		func(token *jwt.Token) (i interface{}, e error) {
+			kid, _ := token.Header["kid"].(string)
+			key, ok := enhancer.keys[kid]
+			if !ok {
+				return nil, ErrSigningKeyNotFound
+			}
+			// 签名算法必须与密钥一致，防止篡改alg头部
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, ErrInvalidSigningKey
+			}
+			return key.PublicKey, nil
+		},
 	)
 
 	if err == nil {
 		claims := token.Claims.(*OAuth2TokenCustomClaims)
 		expiresTime := time.Unix(claims.ExpiresAt, 0)
+		issuedTime := time.Unix(claims.IssuedAt, 0)
 
 		return &OAuth2Token{
 				RefreshToken: &claims.RefreshToken,
 				TokenValue:   tokenValue,
 				ExpiresTime:  &expiresTime,
+				IssuedTime:   &issuedTime,
 			}, &OAuth2Details{
-				User:   &claims.UserDetails,
+				User:   claims.UserDetails,
 				Client: &claims.ClientDetails,
 			}, nil
 	}
 	return nil, nil, err
 }
 
+// 全部校验密钥，其中的对称密钥只能发布给受信任的客户端，公钥通过KeySet.PublicKeys公开发布
+func (enhancer *JwtTokenEnhancer) TokenKeys() *verifier.KeySet {
+	keySet := &verifier.KeySet{Keys: make([]verifier.JsonWebKey, 0, len(enhancer.keys))}
+	for _, key := range enhancer.keys {
+		jwk, err := verifier.NewJsonWebKey(key.Kid, key.Method.Alg(), key.PublicKey)
+		if err != nil {
+			continue
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+	return keySet
+}
+
 func (enhancer *JwtTokenEnhancer) sign(oauth2Token *OAuth2Token, oauth2Details *OAuth2Details) (*OAuth2Token, error) {
 	expireTime := oauth2Token.ExpiresTime
 	clientDetails := *oauth2Details.Client
-	userDetails := *oauth2Details.User
 	clientDetails.ClientSecret = ""
-	userDetails.Password = ""
 
+	// 每个令牌使用随机的jti，同一秒内为同一客户端和用户签发的令牌也不相同，刷新后旧令牌不会与新令牌重复
+	jti, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
 	claims := OAuth2TokenCustomClaims{
-		UserDetails:   userDetails,
 		ClientDetails: clientDetails,
 		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
 			ExpiresAt: expireTime.Unix(),
 			Issuer:    "System",
 		},
 	}
+	if oauth2Details.User != nil {
+		userDetails := *oauth2Details.User
+		userDetails.Password = ""
+		claims.UserDetails = &userDetails
+	}
+	if oauth2Token.IssuedTime != nil {
+		claims.IssuedAt = oauth2Token.IssuedTime.Unix()
+	}
 
 	if oauth2Token.RefreshToken != nil {
 		claims.RefreshToken = *oauth2Token.RefreshToken
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(enhancer.signingKey.Method, claims)
+	if enhancer.signingKey.Kid != "" {
+		token.Header["kid"] = enhancer.signingKey.Kid
+	}
 
-	tokenValue, err := token.SignedString(enhancer.secretKey)
+	tokenValue, err := token.SignedString(enhancer.signingKey.PrivateKey)
 	if err == nil {
 		oauth2Token.TokenValue = tokenValue
 		oauth2Token.TokenType = "jwt"
@@ -11,12 +11,15 @@ import (
 var (
 	ErrInvalidAuthentication = errors.New("invalid auth")
 	ErrInvalidUserInfo       = errors.New("invalid user info")
+	ErrUserNotActive         = errors.New("user is disabled or deleted")
 )
 
 // Service Define a service interface
 type UserDetailsService interface {
 	// Get UserDetails By Username
 	GetUserDetailByUsername(ctx context.Context, username, password string, idType int) (*model.UserDetails, error)
+	// 检查账号是否仍可使用，禁用、删除的账号返回ErrUserNotActive
+	CheckUserStatus(ctx context.Context, userId int64) error
 }
 
 // UserService implement Service interface
@@ -43,10 +46,23 @@ func (service *RemoteUserService) GetUserDetailByUsername(ctx context.Context, u
 
 	if err == nil {
 		if response.UserId != 0 {
+			// 角色和权限写入令牌，sk-admin等服务据此鉴权
+			authorities, err := service.userClient.GetAuthorities(ctx, nil, &pb.AuthoritiesRequest{
+				UserId: response.UserId,
+				IdType: int32(idType),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if authorities.Err != "" {
+				return nil, errors.New(authorities.Err)
+			}
 			return &model.UserDetails{
-				UserId:   response.UserId,
-				Username: username,
-				Password: password,
+				UserId:      response.UserId,
+				Username:    username,
+				IdType:      idType,
+				Password:    password,
+				Authorities: authorities.Authorities,
 			}, nil
 		} else {
 			return nil, ErrInvalidUserInfo
@@ -55,6 +71,18 @@ func (service *RemoteUserService) GetUserDetailByUsername(ctx context.Context, u
 	return nil, err
 }
 
+func (service *RemoteUserService) CheckUserStatus(ctx context.Context, userId int64) error {
+	response, err := service.userClient.GetUser(ctx, nil, &pb.UserIdRequest{UserId: userId})
+	if err != nil {
+		return err
+	}
+	// 已删除的账号查询不到，status为0表示正常
+	if response.Err != "" || response.Status != 0 {
+		return ErrUserNotActive
+	}
+	return nil
+}
+
 func NewRemoteUserDetailService() *RemoteUserService {
 	userClient, _ := client.NewUserClient("user", nil, nil)
 	return &RemoteUserService{
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"final-design/oauth-service/endpoint"
+	"html/template"
+	"net/http"
+)
+
+// 授权页面，表单提交到当前路径(直接访问或经过网关转发都提交回oauth-service)，授权参数放在隐藏字段中
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>登录并授权</title>
+<style>
+body { font-family: sans-serif; max-width: 360px; margin: 60px auto; padding: 0 16px; }
+label { display: block; margin-top: 12px; }
+input, select { width: 100%; padding: 6px; box-sizing: border-box; }
+.actions { margin-top: 20px; display: flex; gap: 12px; }
+.actions button { flex: 1; padding: 8px; }
+</style>
+</head>
+<body>
+<h2>登录并授权</h2>
+<p>应用 <strong>{{.ClientId}}</strong> 请求访问你的账号，登录后将跳转到：</p>
+<p><code>{{.RedirectUri}}</code></p>
+<form method="post" action="authorize" autocomplete="off">
+<input type="hidden" name="response_type" value="{{.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.ClientId}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectUri}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.CodeChallengeMethod}}">
+<label>用户名<input type="text" name="username" autocomplete="username"></label>
+<label>密码<input type="password" name="password" autocomplete="current-password"></label>
+<label>账号类型<select name="id_type"><option value="0">普通用户</option><option value="1">管理员</option></select></label>
+<label>动态码(已启用两步验证时填写)<input type="text" name="mfa_code" inputmode="numeric" autocomplete="one-time-code"></label>
+<div class="actions">
+<button type="submit" name="approve" value="1">同意并登录</button>
+<button type="submit" name="deny" value="1" formnovalidate>拒绝</button>
+</div>
+</form>
+</body>
+</html>
+`))
+
+// 显示授权页面；客户端或重定向地址无效时不能重定向，直接返回错误
+func encodeAuthorizePageResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(endpoint.AuthorizePageResponse)
+	if resp.Error != "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		return json.NewEncoder(w).Encode(endpoint.AuthorizeResponse{Error: resp.Error})
+	}
+	// 页面包含登录表单，禁止被其它站点嵌入，也不缓存
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	return authorizePage.Execute(w, resp)
+}
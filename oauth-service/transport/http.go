@@ -5,9 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"final-design/oauth-service/endpoint"
+	"final-design/oauth-service/model"
 	"final-design/oauth-service/service"
+	"final-design/pkg/common"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/kit/tracing/zipkin"
 	"github.com/go-kit/kit/transport"
@@ -27,11 +32,12 @@ var (
 
 // MakeHttpHandler make http handler use mux
 func MakeHttpHandler(ctx context.Context, endpoints endpoint.OAuth2Endpoints, tokenService service.TokenService,
-	clientService service.ClientDetailsService, zipkinTracer *gozipkin.Tracer, logger log.Logger) http.Handler {
+	clientService service.ClientDetailsService, mfaService service.MfaService, zipkinTracer *gozipkin.Tracer, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
 	zipkinServer := zipkin.HTTPServerTrace(zipkinTracer, zipkin.Name("http-transport"))
 
 	options := []kithttp.ServerOption{
+		kithttp.ServerBefore(makeClientIpContext),
 		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		kithttp.ServerErrorEncoder(encodeError),
 		zipkinServer,
@@ -39,7 +45,7 @@ func MakeHttpHandler(ctx context.Context, endpoints endpoint.OAuth2Endpoints, to
 	r.Path("/metrics").Handler(promhttp.Handler())
 
 	clientAuthorizationOptions := []kithttp.ServerOption{
-		kithttp.ServerBefore(makeClientAuthorizationContext(clientService, logger)),
+		kithttp.ServerBefore(makeClientIpContext, makeClientAuthorizationContext(clientService, logger)),
 		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		kithttp.ServerErrorEncoder(encodeError),
 		zipkinServer,
@@ -59,6 +65,141 @@ func MakeHttpHandler(ctx context.Context, endpoints endpoint.OAuth2Endpoints, to
 		clientAuthorizationOptions...,
 	))
 
+	r.Methods("GET").Path("/oauth/authorize").Handler(kithttp.NewServer(
+		endpoints.AuthorizePageEndpoint,
+		decodeAuthorizeRequest,
+		encodeAuthorizePageResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/oauth/authorize").Handler(kithttp.NewServer(
+		endpoints.AuthorizeEndpoint,
+		decodeAuthorizeRequest,
+		encodeAuthorizeResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/oauth/logout").Handler(kithttp.NewServer(
+		endpoints.LogoutEndpoint,
+		decodeLogoutRequest,
+		encodeJsonResponse,
+		clientAuthorizationOptions...,
+	))
+
+	r.Methods("GET").Path("/oauth/token_key").Handler(kithttp.NewServer(
+		endpoints.TokenKeyEndpoint,
+		decodeTokenKeyRequest,
+		encodeJsonResponse,
+		clientAuthorizationOptions...,
+	))
+
+	r.Methods("GET").Path("/.well-known/jwks.json").Handler(kithttp.NewServer(
+		endpoints.JwksEndpoint,
+		decodeTokenKeyRequest,
+		encodeJsonResponse,
+		options...,
+	))
+
+	// 客户端管理，请求头Authorization中携带具有ROLE_ADMIN角色的访问令牌
+	oauth2AuthorizationOptions := []kithttp.ServerOption{
+		kithttp.ServerBefore(makeOAuth2AuthorizationContext(tokenService, logger)),
+		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encodeError),
+		zipkinServer,
+	}
+
+	r.Methods("GET").Path("/client/list").Handler(kithttp.NewServer(
+		endpoints.GetClientListEndpoint,
+		decodeGetClientListRequest,
+		encodeJsonResponse,
+		oauth2AuthorizationOptions...,
+	))
+
+	r.Methods("POST").Path("/client/create").Handler(kithttp.NewServer(
+		endpoints.CreateClientEndpoint,
+		decodeClientInfoRequest,
+		encodeJsonResponse,
+		oauth2AuthorizationOptions...,
+	))
+
+	r.Methods("POST").Path("/client/update").Handler(kithttp.NewServer(
+		endpoints.UpdateClientEndpoint,
+		decodeClientInfoRequest,
+		encodeJsonResponse,
+		oauth2AuthorizationOptions...,
+	))
+
+	r.Methods("POST").Path("/client/rotate_secret").Handler(kithttp.NewServer(
+		endpoints.RotateClientSecretEndpoint,
+		decodeClientRequest,
+		encodeJsonResponse,
+		oauth2AuthorizationOptions...,
+	))
+
+	r.Methods("POST").Path("/client/disable").Handler(kithttp.NewServer(
+		endpoints.DisableClientEndpoint,
+		decodeClientRequest,
+		encodeJsonResponse,
+		oauth2AuthorizationOptions...,
+	))
+
+	r.Methods("POST").Path("/client/delete").Handler(kithttp.NewServer(
+		endpoints.DeleteClientEndpoint,
+		decodeClientRequest,
+		encodeJsonResponse,
+		oauth2AuthorizationOptions...,
+	))
+
+	// 解除登录锁定，需要管理员令牌
+	r.Methods("POST").Path("/login/unlock").Handler(kithttp.NewServer(
+		endpoints.UnlockLoginEndpoint,
+		decodeUnlockLoginRequest,
+		encodeJsonResponse,
+		oauth2AuthorizationOptions...,
+	))
+
+	// 两步验证：登录时返回的mfa_token只能用于查询、绑定和启用，解除绑定需要访问令牌
+	mfaOptions := []kithttp.ServerOption{
+		kithttp.ServerBefore(makeClientIpContext, makeMfaAuthorizationContext(tokenService, mfaService, true, logger)),
+		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encodeError),
+		zipkinServer,
+	}
+	mfaAccessTokenOptions := []kithttp.ServerOption{
+		kithttp.ServerBefore(makeClientIpContext, makeMfaAuthorizationContext(tokenService, mfaService, false, logger)),
+		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encodeError),
+		zipkinServer,
+	}
+
+	r.Methods("GET").Path("/oauth/mfa/status").Handler(kithttp.NewServer(
+		endpoints.MfaStatusEndpoint,
+		decodeSimpleRequest,
+		encodeJsonResponse,
+		mfaOptions...,
+	))
+
+	r.Methods("POST").Path("/oauth/mfa/enroll").Handler(kithttp.NewServer(
+		endpoints.MfaEnrollEndpoint,
+		decodeSimpleRequest,
+		encodeJsonResponse,
+		mfaOptions...,
+	))
+
+	r.Methods("POST").Path("/oauth/mfa/activate").Handler(kithttp.NewServer(
+		endpoints.MfaActivateEndpoint,
+		decodeMfaCodeRequest,
+		encodeJsonResponse,
+		mfaOptions...,
+	))
+
+	r.Methods("POST").Path("/oauth/mfa/disable").Handler(kithttp.NewServer(
+		endpoints.MfaDisableEndpoint,
+		decodeMfaCodeRequest,
+		encodeJsonResponse,
+		mfaAccessTokenOptions...,
+	))
+
 	// create health check handler
 	r.Methods("GET").Path("/health").Handler(kithttp.NewServer(
 		endpoints.HealthCheckEndpoint,
@@ -73,10 +214,7 @@ func MakeHttpHandler(ctx context.Context, endpoints endpoint.OAuth2Endpoints, to
 func makeClientAuthorizationContext(clientDetailsService service.ClientDetailsService, logger log.Logger) kithttp.RequestFunc {
 	return func(ctx context.Context, r *http.Request) context.Context {
 		if clientId, clientSecret, ok := r.BasicAuth(); ok {
-			fmt.Println("clientId=", clientId)
-			fmt.Println("clientSreret=", clientSecret)
 			clientDetails, err := clientDetailsService.GetClientDetailByClientId(ctx, clientId, clientSecret)
-			fmt.Println("http.go ===> clientDetails:", clientDetails)
 			if err == nil {
 				return context.WithValue(ctx, endpoint.OAuth2ClientDetailsKey, clientDetails)
 			}
@@ -85,10 +223,57 @@ func makeClientAuthorizationContext(clientDetailsService service.ClientDetailsSe
 	}
 }
 
+// 客户端IP写入context，用于登录失败计数；经过网关转发时只信任网关添加的最后一个地址
+func makeClientIpContext(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, service.ClientIpKey, common.ClientIp(r))
+}
+
+// 校验请求头中的访问令牌，令牌对应的用户和客户端信息放入context
+func makeOAuth2AuthorizationContext(tokenService service.TokenService, logger log.Logger) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		tokenValue := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tokenValue != "" {
+			oauth2Details, err := tokenService.GetOAuth2DetailsByAccessToken(tokenValue)
+			if err == nil {
+				return context.WithValue(ctx, endpoint.OAuth2DetailsKey, oauth2Details)
+			}
+			logger.Log("oauth2Authorization", err)
+		}
+		return context.WithValue(ctx, endpoint.OAuth2ErrorKey, endpoint.ErrInvalidUserRequest)
+	}
+}
+
+// 两步验证接口的当前用户：优先使用请求头中的访问令牌，allowMfaToken为true时也可以使用登录时返回的mfa_token
+func makeMfaAuthorizationContext(tokenService service.TokenService, mfaService service.MfaService,
+	allowMfaToken bool, logger log.Logger) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if tokenValue := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); tokenValue != "" {
+			oauth2Details, err := tokenService.GetOAuth2DetailsByAccessToken(tokenValue)
+			if err == nil && !oauth2Details.IsClientOnly() {
+				return context.WithValue(ctx, endpoint.MfaUserKey, oauth2Details.User)
+			}
+			logger.Log("mfaAuthorization", err)
+		} else if mfaToken := r.FormValue("mfa_token"); allowMfaToken && mfaToken != "" {
+			userDetails, err := mfaService.ReadChallenge(mfaToken)
+			if err == nil {
+				return context.WithValue(ctx, endpoint.MfaUserKey, userDetails)
+			}
+			logger.Log("mfaAuthorization", err)
+		}
+		return context.WithValue(ctx, endpoint.OAuth2ErrorKey, endpoint.ErrInvalidUserRequest)
+	}
+}
+
 // encode errors from bussiness-logic
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	switch err {
+	case ErrInvalidClientRequest, endpoint.ErrInvalidClientRequest, endpoint.ErrInvalidUserRequest:
+		w.WriteHeader(http.StatusUnauthorized)
+	case endpoint.ErrNotPermit:
+		w.WriteHeader(http.StatusForbidden)
+	case ErrorBadRequest, ErrorGrantTypeRequest, ErrTokenRequest:
+		w.WriteHeader(http.StatusBadRequest)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -126,6 +311,133 @@ func decodeCheckTokenRequest(ctx context.Context, r *http.Request) (interface{},
 	}, nil
 }
 
+// 授权参数可以放在查询参数或表单中，用户名密码只从表单中读取
+func decodeAuthorizeRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, ErrorBadRequest
+	}
+	idType, _ := strconv.Atoi(r.PostForm.Get("id_type"))
+
+	return &endpoint.AuthorizeRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientId:            r.Form.Get("client_id"),
+		RedirectUri:         r.Form.Get("redirect_uri"),
+		State:               r.Form.Get("state"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+		User: model.UserInfo{
+			Username: r.PostForm.Get("username"),
+			Password: r.PostForm.Get("password"),
+			IdType:   idType,
+		},
+		MfaCode: r.PostForm.Get("mfa_code"),
+		Denied:  r.PostForm.Get("deny") != "",
+	}, nil
+}
+
+// 重定向到客户端，授权码或错误信息放在查询参数中
+func encodeAuthorizeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(endpoint.AuthorizeResponse)
+	if resp.RedirectUri == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		return json.NewEncoder(w).Encode(resp)
+	}
+
+	redirectUrl, err := url.Parse(resp.RedirectUri)
+	if err != nil {
+		return err
+	}
+	query := redirectUrl.Query()
+	if resp.Error != "" {
+		query.Set("error", resp.Error)
+	} else {
+		query.Set("code", resp.Code)
+	}
+	if resp.State != "" {
+		query.Set("state", resp.State)
+	}
+	redirectUrl.RawQuery = query.Encode()
+	w.Header().Set("Location", redirectUrl.String())
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+// 令牌放在表单请求体中(同RFC 7009)，不从查询参数读取，避免令牌出现在访问日志和链路追踪中；
+// Authorization请求头用于客户端Basic Auth
+func decodeLogoutRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	tokenValue := r.PostFormValue("token")
+	if tokenValue == "" {
+		return nil, ErrTokenRequest
+	}
+
+	return &endpoint.LogoutRequest{
+		Token: tokenValue,
+	}, nil
+}
+
+func decodeTokenKeyRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return endpoint.TokenKeyRequest{}, nil
+}
+
+func decodeUnlockLoginRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	idType, _ := strconv.Atoi(query.Get("id_type"))
+	req := &endpoint.UnlockLoginRequest{
+		Username: query.Get("username"),
+		IdType:   idType,
+		Ip:       query.Get("ip"),
+	}
+	if req.Username == "" && req.Ip == "" {
+		return nil, ErrorBadRequest
+	}
+	return req, nil
+}
+
+func decodeSimpleRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return endpoint.SimpleRequest{}, nil
+}
+
+func decodeMfaCodeRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	code := r.FormValue("code")
+	if code == "" {
+		return nil, ErrorBadRequest
+	}
+	return &endpoint.MfaCodeRequest{Code: code}, nil
+}
+
+func decodeGetClientListRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return endpoint.SimpleRequest{}, nil
+}
+
+func decodeClientInfoRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var client endpoint.ClientInfo
+	if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
+		return nil, ErrorBadRequest
+	}
+	return &client, nil
+}
+
+func decodeClientRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	clientId := r.URL.Query().Get("client_id")
+	if clientId == "" {
+		return nil, ErrorBadRequest
+	}
+	// 禁用接口默认禁用，disabled=false时重新启用
+	disabled := true
+	if value := r.URL.Query().Get("disabled"); value != "" {
+		var err error
+		if disabled, err = strconv.ParseBool(value); err != nil {
+			return nil, ErrorBadRequest
+		}
+	}
+
+	return &endpoint.ClientRequest{
+		ClientId: clientId,
+		Disabled: disabled,
+	}, nil
+}
+
 // decodeHealthCheckRequest decode request
 func decodeHealthCheckRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	return endpoint.HealthRequest{}, nil
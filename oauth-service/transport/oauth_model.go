@@ -29,21 +29,28 @@ func EncodeGRPCCheckTokenResponse(_ context.Context, r interface{}) (interface{}
 			Err:          resp.Error,
 		}, nil
 	} else {
-		return &pb.CheckTokenResponse{
-			UserDetails: &pb.UserDetails{
-				UserId:      resp.OAuthDetails.User.UserId,
-				Username:    resp.OAuthDetails.User.Username,
-				Authorities: resp.OAuthDetails.User.Authorities,
-			},
+		pbResp := &pb.CheckTokenResponse{
 			ClientDetails: &pb.ClientDetails{
 				ClientId:                    resp.OAuthDetails.Client.ClientId,
 				AccessTokenValiditySeconds:  int32(resp.OAuthDetails.Client.AccessTokenValiditySeconds),
 				RefreshTokenValiditySeconds: int32(resp.OAuthDetails.Client.RefreshTokenValiditySeconds),
 				AuthorizedGrantTypes:        resp.OAuthDetails.Client.AuthorizedGrantTypes,
+				Scope:                       resp.OAuthDetails.Client.Scope,
 			},
 			IsValidToken: true,
+			IssuedAt:     resp.IssuedAt,
+			ClientOnly:   resp.ClientOnly,
 			Err:          "",
-		}, nil
+		}
+		// 只代表客户端的令牌没有用户信息
+		if !resp.ClientOnly {
+			pbResp.UserDetails = &pb.UserDetails{
+				UserId:      resp.OAuthDetails.User.UserId,
+				Username:    resp.OAuthDetails.User.Username,
+				Authorities: resp.OAuthDetails.User.Authorities,
+			}
+		}
+		return pbResp, nil
 	}
 }
 
@@ -54,20 +61,26 @@ func DecodeGRPCCheckTokenResponse(_ context.Context, r interface{}) (interface{}
 			Error: resp.Err,
 		}, nil
 	} else {
-		return endpoint.CheckTokenResponse{
-			OAuthDetails: &model.OAuth2Details{
-				User: &model.UserDetails{
-					UserId:      resp.UserDetails.UserId,
-					Username:    resp.UserDetails.Username,
-					Authorities: resp.UserDetails.Authorities,
-				},
-				Client: &model.ClientDetails{
-					ClientId:                    resp.ClientDetails.ClientId,
-					AccessTokenValiditySeconds:  int(resp.ClientDetails.AccessTokenValiditySeconds),
-					RefreshTokenValiditySeconds: int(resp.ClientDetails.RefreshTokenValiditySeconds),
-					AuthorizedGrantTypes:        resp.ClientDetails.AuthorizedGrantTypes,
-				},
+		oauth2Details := &model.OAuth2Details{
+			Client: &model.ClientDetails{
+				ClientId:                    resp.ClientDetails.ClientId,
+				AccessTokenValiditySeconds:  int(resp.ClientDetails.AccessTokenValiditySeconds),
+				RefreshTokenValiditySeconds: int(resp.ClientDetails.RefreshTokenValiditySeconds),
+				AuthorizedGrantTypes:        resp.ClientDetails.AuthorizedGrantTypes,
+				Scope:                       resp.ClientDetails.Scope,
 			},
+		}
+		if resp.UserDetails != nil {
+			oauth2Details.User = &model.UserDetails{
+				UserId:      resp.UserDetails.UserId,
+				Username:    resp.UserDetails.Username,
+				Authorities: resp.UserDetails.Authorities,
+			}
+		}
+		return endpoint.CheckTokenResponse{
+			OAuthDetails: oauth2Details,
+			IssuedAt:     resp.IssuedAt,
+			ClientOnly:   resp.ClientOnly,
 		}, nil
 	}
 }
@@ -19,9 +19,20 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	UserService_Check_FullMethodName      = "/pb.UserService/Check"
-	UserService_AdminCheck_FullMethodName = "/pb.UserService/AdminCheck"
-	UserService_Create_FullMethodName     = "/pb.UserService/Create"
+	UserService_Check_FullMethodName          = "/pb.UserService/Check"
+	UserService_AdminCheck_FullMethodName     = "/pb.UserService/AdminCheck"
+	UserService_Create_FullMethodName         = "/pb.UserService/Create"
+	UserService_Authorities_FullMethodName    = "/pb.UserService/Authorities"
+	UserService_GetUser_FullMethodName        = "/pb.UserService/GetUser"
+	UserService_UpdateUser_FullMethodName     = "/pb.UserService/UpdateUser"
+	UserService_ChangePassword_FullMethodName = "/pb.UserService/ChangePassword"
+	UserService_DisableUser_FullMethodName    = "/pb.UserService/DisableUser"
+	UserService_DeleteUser_FullMethodName     = "/pb.UserService/DeleteUser"
+	UserService_MfaStatus_FullMethodName      = "/pb.UserService/MfaStatus"
+	UserService_MfaEnroll_FullMethodName      = "/pb.UserService/MfaEnroll"
+	UserService_MfaActivate_FullMethodName    = "/pb.UserService/MfaActivate"
+	UserService_MfaVerify_FullMethodName      = "/pb.UserService/MfaVerify"
+	UserService_MfaDisable_FullMethodName     = "/pb.UserService/MfaDisable"
 )
 
 // UserServiceClient is the client API for UserService service.
@@ -31,6 +42,18 @@ type UserServiceClient interface {
 	Check(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 	AdminCheck(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 	Create(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserResponse, error)
+	// 获取用户的角色和权限
+	Authorities(ctx context.Context, in *AuthoritiesRequest, opts ...grpc.CallOption) (*AuthoritiesResponse, error)
+	GetUser(ctx context.Context, in *UserIdRequest, opts ...grpc.CallOption) (*GetUserResponse, error)
+	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*UserOperationResponse, error)
+	ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*UserOperationResponse, error)
+	DisableUser(ctx context.Context, in *DisableUserRequest, opts ...grpc.CallOption) (*UserOperationResponse, error)
+	DeleteUser(ctx context.Context, in *UserIdRequest, opts ...grpc.CallOption) (*UserOperationResponse, error)
+	MfaStatus(ctx context.Context, in *MfaRequest, opts ...grpc.CallOption) (*MfaStatusResponse, error)
+	MfaEnroll(ctx context.Context, in *MfaEnrollRequest, opts ...grpc.CallOption) (*MfaEnrollResponse, error)
+	MfaActivate(ctx context.Context, in *MfaCodeRequest, opts ...grpc.CallOption) (*MfaActivateResponse, error)
+	MfaVerify(ctx context.Context, in *MfaCodeRequest, opts ...grpc.CallOption) (*UserOperationResponse, error)
+	MfaDisable(ctx context.Context, in *MfaCodeRequest, opts ...grpc.CallOption) (*UserOperationResponse, error)
 }
 
 type userServiceClient struct {
@@ -68,6 +91,105 @@ func (c *userServiceClient) Create(ctx context.Context, in *CreateUserRequest, o
 	return out, nil
 }
 
+func (c *userServiceClient) Authorities(ctx context.Context, in *AuthoritiesRequest, opts ...grpc.CallOption) (*AuthoritiesResponse, error) {
+	out := new(AuthoritiesResponse)
+	err := c.cc.Invoke(ctx, UserService_Authorities_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) GetUser(ctx context.Context, in *UserIdRequest, opts ...grpc.CallOption) (*GetUserResponse, error) {
+	out := new(GetUserResponse)
+	err := c.cc.Invoke(ctx, UserService_GetUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*UserOperationResponse, error) {
+	out := new(UserOperationResponse)
+	err := c.cc.Invoke(ctx, UserService_UpdateUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ChangePassword(ctx context.Context, in *ChangePasswordRequest, opts ...grpc.CallOption) (*UserOperationResponse, error) {
+	out := new(UserOperationResponse)
+	err := c.cc.Invoke(ctx, UserService_ChangePassword_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) DisableUser(ctx context.Context, in *DisableUserRequest, opts ...grpc.CallOption) (*UserOperationResponse, error) {
+	out := new(UserOperationResponse)
+	err := c.cc.Invoke(ctx, UserService_DisableUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) DeleteUser(ctx context.Context, in *UserIdRequest, opts ...grpc.CallOption) (*UserOperationResponse, error) {
+	out := new(UserOperationResponse)
+	err := c.cc.Invoke(ctx, UserService_DeleteUser_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) MfaStatus(ctx context.Context, in *MfaRequest, opts ...grpc.CallOption) (*MfaStatusResponse, error) {
+	out := new(MfaStatusResponse)
+	err := c.cc.Invoke(ctx, UserService_MfaStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) MfaEnroll(ctx context.Context, in *MfaEnrollRequest, opts ...grpc.CallOption) (*MfaEnrollResponse, error) {
+	out := new(MfaEnrollResponse)
+	err := c.cc.Invoke(ctx, UserService_MfaEnroll_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) MfaActivate(ctx context.Context, in *MfaCodeRequest, opts ...grpc.CallOption) (*MfaActivateResponse, error) {
+	out := new(MfaActivateResponse)
+	err := c.cc.Invoke(ctx, UserService_MfaActivate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) MfaVerify(ctx context.Context, in *MfaCodeRequest, opts ...grpc.CallOption) (*UserOperationResponse, error) {
+	out := new(UserOperationResponse)
+	err := c.cc.Invoke(ctx, UserService_MfaVerify_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) MfaDisable(ctx context.Context, in *MfaCodeRequest, opts ...grpc.CallOption) (*UserOperationResponse, error) {
+	out := new(UserOperationResponse)
+	err := c.cc.Invoke(ctx, UserService_MfaDisable_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServiceServer is the server API for UserService service.
 // All implementations must embed UnimplementedUserServiceServer
 // for forward compatibility
@@ -75,6 +197,18 @@ type UserServiceServer interface {
 	Check(context.Context, *UserRequest) (*UserResponse, error)
 	AdminCheck(context.Context, *UserRequest) (*UserResponse, error)
 	Create(context.Context, *CreateUserRequest) (*CreateUserResponse, error)
+	// 获取用户的角色和权限
+	Authorities(context.Context, *AuthoritiesRequest) (*AuthoritiesResponse, error)
+	GetUser(context.Context, *UserIdRequest) (*GetUserResponse, error)
+	UpdateUser(context.Context, *UpdateUserRequest) (*UserOperationResponse, error)
+	ChangePassword(context.Context, *ChangePasswordRequest) (*UserOperationResponse, error)
+	DisableUser(context.Context, *DisableUserRequest) (*UserOperationResponse, error)
+	DeleteUser(context.Context, *UserIdRequest) (*UserOperationResponse, error)
+	MfaStatus(context.Context, *MfaRequest) (*MfaStatusResponse, error)
+	MfaEnroll(context.Context, *MfaEnrollRequest) (*MfaEnrollResponse, error)
+	MfaActivate(context.Context, *MfaCodeRequest) (*MfaActivateResponse, error)
+	MfaVerify(context.Context, *MfaCodeRequest) (*UserOperationResponse, error)
+	MfaDisable(context.Context, *MfaCodeRequest) (*UserOperationResponse, error)
 	// mustEmbedUnimplementedUserServiceServer()
 }
 
@@ -91,6 +225,39 @@ func (UnimplementedUserServiceServer) AdminCheck(context.Context, *UserRequest)
 func (UnimplementedUserServiceServer) Create(context.Context, *CreateUserRequest) (*CreateUserResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
 }
+func (UnimplementedUserServiceServer) Authorities(context.Context, *AuthoritiesRequest) (*AuthoritiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Authorities not implemented")
+}
+func (UnimplementedUserServiceServer) GetUser(context.Context, *UserIdRequest) (*GetUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedUserServiceServer) UpdateUser(context.Context, *UpdateUserRequest) (*UserOperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedUserServiceServer) ChangePassword(context.Context, *ChangePasswordRequest) (*UserOperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangePassword not implemented")
+}
+func (UnimplementedUserServiceServer) DisableUser(context.Context, *DisableUserRequest) (*UserOperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableUser not implemented")
+}
+func (UnimplementedUserServiceServer) DeleteUser(context.Context, *UserIdRequest) (*UserOperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedUserServiceServer) MfaStatus(context.Context, *MfaRequest) (*MfaStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MfaStatus not implemented")
+}
+func (UnimplementedUserServiceServer) MfaEnroll(context.Context, *MfaEnrollRequest) (*MfaEnrollResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MfaEnroll not implemented")
+}
+func (UnimplementedUserServiceServer) MfaActivate(context.Context, *MfaCodeRequest) (*MfaActivateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MfaActivate not implemented")
+}
+func (UnimplementedUserServiceServer) MfaVerify(context.Context, *MfaCodeRequest) (*UserOperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MfaVerify not implemented")
+}
+func (UnimplementedUserServiceServer) MfaDisable(context.Context, *MfaCodeRequest) (*UserOperationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MfaDisable not implemented")
+}
 func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
 
 // UnsafeUserServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -158,6 +325,204 @@ func _UserService_Create_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_Authorities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthoritiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).Authorities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_Authorities_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).Authorities(ctx, req.(*AuthoritiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).GetUser(ctx, req.(*UserIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_UpdateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).UpdateUser(ctx, req.(*UpdateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ChangePassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangePasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ChangePassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_ChangePassword_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ChangePassword(ctx, req.(*ChangePasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_DisableUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisableUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).DisableUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_DisableUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).DisableUser(ctx, req.(*DisableUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_DeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).DeleteUser(ctx, req.(*UserIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_MfaStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MfaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).MfaStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_MfaStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).MfaStatus(ctx, req.(*MfaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_MfaEnroll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MfaEnrollRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).MfaEnroll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_MfaEnroll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).MfaEnroll(ctx, req.(*MfaEnrollRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_MfaActivate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MfaCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).MfaActivate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_MfaActivate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).MfaActivate(ctx, req.(*MfaCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_MfaVerify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MfaCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).MfaVerify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_MfaVerify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).MfaVerify(ctx, req.(*MfaCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_MfaDisable_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MfaCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).MfaDisable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_MfaDisable_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).MfaDisable(ctx, req.(*MfaCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -177,6 +542,50 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Create",
 			Handler:    _UserService_Create_Handler,
 		},
+		{
+			MethodName: "Authorities",
+			Handler:    _UserService_Authorities_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _UserService_GetUser_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _UserService_UpdateUser_Handler,
+		},
+		{
+			MethodName: "ChangePassword",
+			Handler:    _UserService_ChangePassword_Handler,
+		},
+		{
+			MethodName: "DisableUser",
+			Handler:    _UserService_DisableUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _UserService_DeleteUser_Handler,
+		},
+		{
+			MethodName: "MfaStatus",
+			Handler:    _UserService_MfaStatus_Handler,
+		},
+		{
+			MethodName: "MfaEnroll",
+			Handler:    _UserService_MfaEnroll_Handler,
+		},
+		{
+			MethodName: "MfaActivate",
+			Handler:    _UserService_MfaActivate_Handler,
+		},
+		{
+			MethodName: "MfaVerify",
+			Handler:    _UserService_MfaVerify_Handler,
+		},
+		{
+			MethodName: "MfaDisable",
+			Handler:    _UserService_MfaDisable_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "user.proto",
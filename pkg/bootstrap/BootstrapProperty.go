@@ -5,12 +5,19 @@ var (
 	DiscoverConfig     DiscoverConf
 	ConfigServerConfig ConfigServerConf
 	RpcConfig          RpcConf
+	MonitorConfig      MonitorConf
+	ShutdownConfig     = ShutdownConf{Timeout: 30, DeregisterDelay: 5}
+
+	// 单元测试没有bootstrap.yaml和配置中心，为true时缺少的配置不退出
+	UnitTest bool
 )
 
 // Http 配置
 type HttpConf struct {
 	Host string
 	Port string
+	// 可信代理(网关)的IP或网段，请求来自这些地址时才使用X-Forwarded-For中的客户端IP，为空时不信任任何代理
+	TrustedProxies []string
 }
 
 // RPC配置
@@ -18,6 +25,11 @@ type RpcConf struct {
 	Port string
 }
 
+// 监控端口配置，hystrix实时监控和prometheus指标使用单独的端口，为空时不启动
+type MonitorConf struct {
+	Port string
+}
+
 // 服务注册与发现配置
 type DiscoverConf struct {
 	Host        string
@@ -25,6 +37,8 @@ type DiscoverConf struct {
 	ServiceName string
 	Weight      int
 	InstanceId  string
+	Version     string   // 实例版本，注册到consul的meta.version，网关按版本灰度转发
+	Tags        []string // 注册到consul的标签
 }
 
 // 配置中心
@@ -33,3 +47,9 @@ type ConfigServerConf struct {
 	Profile string
 	Label   string
 }
+
+// 优雅退出配置，单位秒
+type ShutdownConf struct {
+	Timeout         int // 收到退出信号后最多等待多久，超时后直接退出
+	DeregisterDelay int // 从consul注销后等待网关和其它服务更新实例列表的时间
+}
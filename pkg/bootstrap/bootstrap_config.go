@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -16,6 +18,11 @@ func init() {
 
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Printf("err:%s\n", err)
+		// go test在包目录下运行，没有bootstrap.yaml时使用空配置，只用于单元测试
+		if strings.HasSuffix(os.Args[0], ".test") {
+			UnitTest = true
+			return
+		}
 	}
 	if err := subParse("http", &HttpConfig); err != nil {
 		log.Fatal("Fail to parse Http config", err)
@@ -26,8 +33,25 @@ func init() {
 	if err := subParse("config", &ConfigServerConfig); err != nil {
 		log.Fatal("Fail to parse config server", err)
 	}
-	if err := subParse("rpc", &RpcConfig); err != nil {
-		log.Fatal("Fail to parse rpc server", err)
+	// 没有gRPC服务时可以不配置
+	if viper.IsSet("rpc") {
+		if err := subParse("rpc", &RpcConfig); err != nil {
+			log.Fatal("Fail to parse rpc server", err)
+		}
+	}
+	if viper.IsSet("monitor") {
+		if err := subParse("monitor", &MonitorConfig); err != nil {
+			log.Fatal("Fail to parse monitor config", err)
+		}
+	}
+	// 没有配置时使用默认值
+	if viper.IsSet("shutdown") {
+		if err := subParse("shutdown", &ShutdownConfig); err != nil {
+			log.Fatal("Fail to parse shutdown config", err)
+		}
+	}
+	if err := validate(); err != nil {
+		log.Fatalf("Invalid bootstrap config: %v", err)
 	}
 }
 
@@ -0,0 +1,72 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// 启动时校验bootstrap配置，配置项可以用 前缀_字段名 的环境变量覆盖，如HTTP_PORT、DISCOVER_HOST、CONFIG_PROFILE；
+// 同一台机器上运行多套环境时，每套环境通过环境变量使用不同的端口和配置中心profile
+func validate() error {
+	if err := requirePort("http.port", HttpConfig.Port); err != nil {
+		return err
+	}
+	for _, proxy := range HttpConfig.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("http.trustedProxies must be IP addresses or CIDRs, got %q (env HTTP_TRUSTEDPROXIES)", proxy)
+		}
+	}
+	if RpcConfig.Port != "" {
+		if err := requirePort("rpc.port", RpcConfig.Port); err != nil {
+			return err
+		}
+	}
+	if MonitorConfig.Port != "" {
+		if err := requirePort("monitor.port", MonitorConfig.Port); err != nil {
+			return err
+		}
+	}
+	if MonitorConfig.Port != "" && MonitorConfig.Port == HttpConfig.Port {
+		return fmt.Errorf("monitor.port %s conflicts with http.port", MonitorConfig.Port)
+	}
+
+	if DiscoverConfig.Host == "" {
+		return fmt.Errorf("discover.host is required (env DISCOVER_HOST)")
+	}
+	if err := requirePort("discover.port", DiscoverConfig.Port); err != nil {
+		return err
+	}
+	if DiscoverConfig.ServiceName == "" {
+		return fmt.Errorf("discover.serviceName is required (env DISCOVER_SERVICENAME)")
+	}
+	if ConfigServerConfig.Id == "" || ConfigServerConfig.Profile == "" || ConfigServerConfig.Label == "" {
+		return fmt.Errorf("config.id, config.profile and config.label are required (env CONFIG_ID, CONFIG_PROFILE, CONFIG_LABEL)")
+	}
+	if ShutdownConfig.Timeout <= 0 || ShutdownConfig.DeregisterDelay < 0 {
+		return fmt.Errorf("shutdown.timeout must be positive and shutdown.deregisterDelay must not be negative")
+	}
+	return nil
+}
+
+// 端口必须是1-65535之间的数字，key用于错误信息和对应的环境变量名
+func requirePort(key, port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("%s must be a port number between 1 and 65535, got %q (env %s)", key, port, envName(key))
+	}
+	return nil
+}
+
+// 配置项对应的环境变量名，如http.port -> HTTP_PORT
+func envName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		switch {
+		case c == '.':
+			name[i] = '_'
+		case c >= 'a' && c <= 'z':
+			name[i] = c - 'a' + 'A'
+		}
+	}
+	return string(name)
+}
@@ -0,0 +1,106 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// 设置一套合法的bootstrap配置，用例结束后恢复
+func setValidConfig(t *testing.T) {
+	savedHttp, savedRpc, savedMonitor := HttpConfig, RpcConfig, MonitorConfig
+	savedDiscover, savedConfig, savedShutdown := DiscoverConfig, ConfigServerConfig, ShutdownConfig
+	HttpConfig = HttpConf{Port: "9000", TrustedProxies: []string{"10.0.0.2", "192.168.0.0/16", "::1"}}
+	RpcConfig = RpcConf{Port: "9001"}
+	MonitorConfig = MonitorConf{Port: "9002"}
+	DiscoverConfig = DiscoverConf{Host: "127.0.0.1", Port: "8500", ServiceName: "sk-app"}
+	ConfigServerConfig = ConfigServerConf{Id: "config-service", Profile: "dev", Label: "master"}
+	ShutdownConfig = ShutdownConf{Timeout: 30, DeregisterDelay: 5}
+	t.Cleanup(func() {
+		HttpConfig, RpcConfig, MonitorConfig = savedHttp, savedRpc, savedMonitor
+		DiscoverConfig, ConfigServerConfig, ShutdownConfig = savedDiscover, savedConfig, savedShutdown
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func()
+		wantErr string // 为空时校验通过
+	}{
+		{"合法配置", func() {}, ""},
+		{"没有rpc和监控端口", func() { RpcConfig.Port, MonitorConfig.Port = "", "" }, ""},
+		{"没有可信代理", func() { HttpConfig.TrustedProxies = nil }, ""},
+		{"http端口不是数字", func() { HttpConfig.Port = "http" }, "env HTTP_PORT"},
+		{"http端口超出范围", func() { HttpConfig.Port = "65536" }, "env HTTP_PORT"},
+		{"可信代理不是IP或网段", func() { HttpConfig.TrustedProxies = []string{"10.0.0.2", "gateway"} }, "env HTTP_TRUSTEDPROXIES"},
+		{"可信代理网段不合法", func() { HttpConfig.TrustedProxies = []string{"10.0.0.0/33"} }, "env HTTP_TRUSTEDPROXIES"},
+		{"rpc端口不合法", func() { RpcConfig.Port = "0" }, "env RPC_PORT"},
+		{"监控端口与http端口相同", func() { MonitorConfig.Port = "9000" }, "conflicts with http.port"},
+		{"缺少consul地址", func() { DiscoverConfig.Host = "" }, "env DISCOVER_HOST"},
+		{"consul端口不合法", func() { DiscoverConfig.Port = "" }, "env DISCOVER_PORT"},
+		{"缺少服务名", func() { DiscoverConfig.ServiceName = "" }, "env DISCOVER_SERVICENAME"},
+		{"缺少配置中心profile", func() { ConfigServerConfig.Profile = "" }, "env CONFIG_ID, CONFIG_PROFILE, CONFIG_LABEL"},
+		{"退出超时时间不是正数", func() { ShutdownConfig.Timeout = 0 }, "shutdown.timeout"},
+		{"注销等待时间为负数", func() { ShutdownConfig.DeregisterDelay = -1 }, "shutdown.deregisterDelay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setValidConfig(t)
+			tt.modify()
+			err := validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 环境变量覆盖bootstrap.yaml中已有的配置项，多个值用逗号分隔
+func TestSubParseEnvOverride(t *testing.T) {
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(`
+http:
+  port: 9000
+  trustedProxies:
+    - 10.0.0.2
+discover:
+  host: 127.0.0.1
+  port: 8500
+  serviceName: sk-app
+`)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+	t.Setenv("HTTP_PORT", "9100")
+	t.Setenv("HTTP_TRUSTEDPROXIES", "10.0.0.0/8,127.0.0.1")
+	t.Setenv("DISCOVER_HOST", "consul")
+	// 不是本配置项前缀的环境变量不生效
+	t.Setenv("PORT", "9200")
+
+	var httpConf HttpConf
+	if err := subParse("http", &httpConf); err != nil {
+		t.Fatal(err)
+	}
+	if httpConf.Port != "9100" {
+		t.Errorf("http.port = %q, want %q", httpConf.Port, "9100")
+	}
+	if got := strings.Join(httpConf.TrustedProxies, " "); got != "10.0.0.0/8 127.0.0.1" {
+		t.Errorf("http.trustedProxies = %v, want [10.0.0.0/8 127.0.0.1]", httpConf.TrustedProxies)
+	}
+
+	var discoverConf DiscoverConf
+	if err := subParse("discover", &discoverConf); err != nil {
+		t.Fatal(err)
+	}
+	if discoverConf.Host != "consul" || discoverConf.Port != "8500" || discoverConf.ServiceName != "sk-app" {
+		t.Errorf("discover = %+v, want host consul from env and the rest from yaml", discoverConf)
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 网关响应缓存的清除通知，sk-admin修改数据后发布，网关订阅后清除带有对应标签的缓存
+const PurgeChannel = "gateway:cache:purge"
+
+// 缓存标签，与网关cache.rules中的tags对应
+const (
+	TagActivity = "activity" // 秒杀活动
+	TagProduct  = "product"  // 商品
+)
+
+// 缓存的响应
+type Entry struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	ETag     string
+	Tags     []string
+	StoredAt time.Time
+	Expires  time.Time
+}
+
+// 缓存存储，Get在缓存不存在或已过期时返回nil
+type Store interface {
+	Get(key string) (*Entry, error)
+	Set(key string, entry *Entry) error
+	// 清除带有任一标签的缓存
+	Purge(tags ...string) error
+}
+
+// 通知所有网关清除带有任一标签的缓存
+func Publish(conn *redis.Client, tags ...string) error {
+	return conn.Publish(PurgeChannel, strings.Join(tags, ",")).Err()
+}
+
+// 订阅清除通知，收到通知时调用onPurge；连接断开后go-redis会自动重新订阅
+func Subscribe(conn *redis.Client, onPurge func(tags []string)) {
+	pubsub := conn.Subscribe(PurgeChannel)
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			if msg.Payload == "" {
+				continue
+			}
+			onPurge(strings.Split(msg.Payload, ","))
+		}
+	}()
+}
+
+func hasAnyTag(entry *Entry, tags []string) bool {
+	for _, tag := range tags {
+		for _, t := range entry.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
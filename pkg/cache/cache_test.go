@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"final-design/pkg/redistest"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testEntry(body string, ttl time.Duration, tags ...string) *Entry {
+	now := time.Now()
+	return &Entry{Status: 200, Body: []byte(body), ETag: `"` + body + `"`, Tags: tags, StoredAt: now, Expires: now.Add(ttl)}
+}
+
+// 两种存储的共同行为
+func testStore(t *testing.T, store Store) {
+	tests := []struct {
+		name      string
+		set       map[string]*Entry
+		overwrite map[string]*Entry // 再次写入同一key
+		purge     []string
+		wantHits  map[string]string // key -> body，不在其中的key应该不存在
+	}{
+		{"读取", map[string]*Entry{"a": testEntry("a", time.Minute)}, nil, nil,
+			map[string]string{"a": "a"}},
+		{"覆盖", map[string]*Entry{"b": testEntry("b1", time.Minute)}, map[string]*Entry{"b": testEntry("b2", time.Minute)}, nil,
+			map[string]string{"b": "b2"}},
+		{"已过期", map[string]*Entry{"c": testEntry("c", -time.Second)}, nil, nil,
+			map[string]string{}},
+		{"按标签清除", map[string]*Entry{
+			"d": testEntry("d", time.Minute, TagProduct),
+			"e": testEntry("e", time.Minute, TagActivity, TagProduct),
+			"f": testEntry("f", time.Minute, TagActivity),
+			"g": testEntry("g", time.Minute),
+		}, nil, []string{TagProduct}, map[string]string{"f": "f", "g": "g"}},
+		{"清除多个标签", map[string]*Entry{
+			"h": testEntry("h", time.Minute, TagProduct),
+			"i": testEntry("i", time.Minute, TagActivity),
+			"j": testEntry("j", time.Minute, "other"),
+		}, nil, []string{TagProduct, TagActivity}, map[string]string{"j": "j"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suffix := fmt.Sprintf(":%d", time.Now().UnixNano())
+			for key, entry := range tt.set {
+				if err := store.Set(key+suffix, entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for key, entry := range tt.overwrite {
+				if err := store.Set(key+suffix, entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(tt.purge) > 0 {
+				if err := store.Purge(tt.purge...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for key := range tt.set {
+				entry, err := store.Get(key + suffix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, hit := tt.wantHits[key]
+				if (entry != nil) != hit {
+					t.Fatalf("Get(%s) = %v, want hit %v", key, entry, hit)
+				}
+				if hit && string(entry.Body) != want {
+					t.Errorf("Get(%s) body = %s, want %s", key, entry.Body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUStore(t *testing.T) {
+	testStore(t, NewLRUStore(0))
+}
+
+func TestRedisStore(t *testing.T) {
+	conn, _ := redistest.New(t)
+	testStore(t, NewRedisStore(conn, fmt.Sprintf("test:cache:%d:", time.Now().UnixNano())))
+}
+
+func TestLRUStoreEviction(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		ops        []string // "set x" 或 "get x"
+		want       []string // 最后仍在缓存中的key
+	}{
+		{"不超过上限", 3, []string{"set a", "set b", "set c"}, []string{"a", "b", "c"}},
+		{"淘汰最早的", 2, []string{"set a", "set b", "set c"}, []string{"b", "c"}},
+		{"访问后不被淘汰", 2, []string{"set a", "set b", "get a", "set c"}, []string{"a", "c"}},
+		{"覆盖后不被淘汰", 2, []string{"set a", "set b", "set a", "set c"}, []string{"a", "c"}},
+		{"不限制数量", 0, []string{"set a", "set b", "set c", "set d"}, []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewLRUStore(tt.maxEntries)
+			for _, op := range tt.ops {
+				key := op[4:]
+				if op[:3] == "set" {
+					store.Set(key, testEntry(key, time.Minute))
+				} else {
+					store.Get(key)
+				}
+			}
+			if len(store.entries) != len(tt.want) {
+				t.Fatalf("entries = %d, want %v", len(store.entries), tt.want)
+			}
+			for _, key := range tt.want {
+				if _, ok := store.entries[key]; !ok {
+					t.Errorf("%s is evicted", key)
+				}
+			}
+		})
+	}
+}
+
+// 过期的缓存在读取时删除
+func TestLRUStoreExpiredRemoved(t *testing.T) {
+	store := NewLRUStore(0)
+	store.Set("a", testEntry("a", -time.Second))
+	if entry, _ := store.Get("a"); entry != nil {
+		t.Fatal("expired entry is returned")
+	}
+	if len(store.entries) != 0 || store.order.Len() != 0 {
+		t.Errorf("expired entry is kept: %d entries", len(store.entries))
+	}
+}
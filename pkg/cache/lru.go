@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// 进程内LRU缓存，超过maxEntries时淘汰最久未访问的缓存；每个网关实例单独缓存
+type LRUStore struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List               // 最近访问的在前
+	entries map[string]*list.Element // key -> order中的元素
+}
+
+type lruItem struct {
+	key   string
+	entry *Entry
+}
+
+// maxEntries小于等于0时不限制数量
+func NewLRUStore(maxEntries int) *LRUStore {
+	return &LRUStore{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (store *LRUStore) Get(key string) (*Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	element, ok := store.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	item := element.Value.(*lruItem)
+	if !time.Now().Before(item.entry.Expires) {
+		store.remove(element)
+		return nil, nil
+	}
+	store.order.MoveToFront(element)
+	return item.entry, nil
+}
+
+func (store *LRUStore) Set(key string, entry *Entry) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if element, ok := store.entries[key]; ok {
+		element.Value.(*lruItem).entry = entry
+		store.order.MoveToFront(element)
+		return nil
+	}
+	store.entries[key] = store.order.PushFront(&lruItem{key: key, entry: entry})
+	if store.maxEntries > 0 && store.order.Len() > store.maxEntries {
+		store.remove(store.order.Back())
+	}
+	return nil
+}
+
+func (store *LRUStore) Purge(tags ...string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for element := store.order.Front(); element != nil; {
+		next := element.Next()
+		if hasAnyTag(element.Value.(*lruItem).entry, tags) {
+			store.remove(element)
+		}
+		element = next
+	}
+	return nil
+}
+
+func (store *LRUStore) remove(element *list.Element) {
+	store.order.Remove(element)
+	delete(store.entries, element.Value.(*lruItem).key)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 标签索引的过期时间，索引中的缓存过期后只留下无效的key，清除时一起删除
+const tagIndexTtl = 24 * time.Hour
+
+// 基于redis的缓存，多个网关实例共享；每个标签用一个set记录带有该标签的缓存key
+type RedisStore struct {
+	conn   *redis.Client
+	prefix string
+}
+
+func NewRedisStore(conn *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{conn: conn, prefix: prefix}
+}
+
+func (store *RedisStore) Get(key string) (*Entry, error) {
+	data, err := store.conn.Get(store.prefix + key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (store *RedisStore) Set(key string, entry *Entry) error {
+	ttl := time.Until(entry.Expires)
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	pipe := store.conn.TxPipeline()
+	pipe.Set(store.prefix+key, data, ttl)
+	for _, tag := range entry.Tags {
+		pipe.SAdd(store.tagKey(tag), store.prefix+key)
+		pipe.Expire(store.tagKey(tag), tagIndexTtl)
+	}
+	_, err = pipe.Exec()
+	return err
+}
+
+func (store *RedisStore) Purge(tags ...string) error {
+	for _, tag := range tags {
+		keys, err := store.conn.SMembers(store.tagKey(tag)).Result()
+		if err != nil {
+			return err
+		}
+		if err := store.conn.Del(append(keys, store.tagKey(tag))...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *RedisStore) tagKey(tag string) string {
+	return store.prefix + "tag:" + tag
+}
@@ -12,6 +12,13 @@ import (
 type UserClient interface {
 	CheckUser(ctx context.Context, tracer opentracing.Tracer, request *pb.UserRequest) (*pb.UserResponse, error)
 	CheckAdminUser(ctx context.Context, tracer opentracing.Tracer, request *pb.UserRequest) (*pb.UserResponse, error)
+	GetAuthorities(ctx context.Context, tracer opentracing.Tracer, request *pb.AuthoritiesRequest) (*pb.AuthoritiesResponse, error)
+	GetUser(ctx context.Context, tracer opentracing.Tracer, request *pb.UserIdRequest) (*pb.GetUserResponse, error)
+	MfaStatus(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaRequest) (*pb.MfaStatusResponse, error)
+	MfaEnroll(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaEnrollRequest) (*pb.MfaEnrollResponse, error)
+	MfaActivate(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaCodeRequest) (*pb.MfaActivateResponse, error)
+	MfaVerify(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaCodeRequest) (*pb.UserOperationResponse, error)
+	MfaDisable(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaCodeRequest) (*pb.UserOperationResponse, error)
 }
 
 type UserClientImpl struct {
@@ -42,6 +49,69 @@ func (impl *UserClientImpl) CheckAdminUser(ctx context.Context, tracer opentraci
 	}
 }
 
+func (impl *UserClientImpl) GetAuthorities(ctx context.Context, tracer opentracing.Tracer, request *pb.AuthoritiesRequest) (*pb.AuthoritiesResponse, error) {
+	response := new(pb.AuthoritiesResponse)
+	if err := impl.manager.DecoratorInvoke("/pb.UserService/Authorities", "user_authorities", tracer, ctx, request, response); err == nil {
+		return response, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (impl *UserClientImpl) GetUser(ctx context.Context, tracer opentracing.Tracer, request *pb.UserIdRequest) (*pb.GetUserResponse, error) {
+	response := new(pb.GetUserResponse)
+	if err := impl.manager.DecoratorInvoke("/pb.UserService/GetUser", "get_user", tracer, ctx, request, response); err == nil {
+		return response, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (impl *UserClientImpl) MfaStatus(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaRequest) (*pb.MfaStatusResponse, error) {
+	response := new(pb.MfaStatusResponse)
+	if err := impl.manager.DecoratorInvoke("/pb.UserService/MfaStatus", "mfa_status", tracer, ctx, request, response); err == nil {
+		return response, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (impl *UserClientImpl) MfaEnroll(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaEnrollRequest) (*pb.MfaEnrollResponse, error) {
+	response := new(pb.MfaEnrollResponse)
+	if err := impl.manager.DecoratorInvoke("/pb.UserService/MfaEnroll", "mfa_enroll", tracer, ctx, request, response); err == nil {
+		return response, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (impl *UserClientImpl) MfaActivate(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaCodeRequest) (*pb.MfaActivateResponse, error) {
+	response := new(pb.MfaActivateResponse)
+	if err := impl.manager.DecoratorInvoke("/pb.UserService/MfaActivate", "mfa_activate", tracer, ctx, request, response); err == nil {
+		return response, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (impl *UserClientImpl) MfaVerify(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaCodeRequest) (*pb.UserOperationResponse, error) {
+	response := new(pb.UserOperationResponse)
+	if err := impl.manager.DecoratorInvoke("/pb.UserService/MfaVerify", "mfa_verify", tracer, ctx, request, response); err == nil {
+		return response, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (impl *UserClientImpl) MfaDisable(ctx context.Context, tracer opentracing.Tracer, request *pb.MfaCodeRequest) (*pb.UserOperationResponse, error) {
+	response := new(pb.UserOperationResponse)
+	if err := impl.manager.DecoratorInvoke("/pb.UserService/MfaDisable", "mfa_disable", tracer, ctx, request, response); err == nil {
+		return response, nil
+	} else {
+		return nil, err
+	}
+}
+
 func NewUserClient(serviceName string, lb loadbalance.LoadBalance, tracer opentracing.Tracer) (UserClient, error) {
 	if serviceName == "" {
 		serviceName = "user"
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"final-design/pkg/bootstrap"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 获取客户端IP：请求来自可信代理(bootstrap.yaml中的http.trustedProxies，即网关)时取X-Forwarded-For中最后一个地址，
+// 即网关看到的对端地址，前面的地址由客户端自己填写；直接访问服务时X-Forwarded-For可以伪造，只使用对端地址
+func ClientIp(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !IsTrustedProxy(remote, bootstrap.HttpConfig.TrustedProxies) {
+		return remote
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+			return ip
+		}
+	}
+	return remote
+}
+
+// ip是否属于proxies中的某个地址或网段，proxies的格式在启动时已经校验
+func IsTrustedProxy(ip string, proxies []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if proxyAddr := net.ParseIP(proxy); proxyAddr != nil && proxyAddr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"final-design/pkg/bootstrap"
+	"net/http"
+	"testing"
+)
+
+func TestClientIp(t *testing.T) {
+	saved := bootstrap.HttpConfig.TrustedProxies
+	bootstrap.HttpConfig.TrustedProxies = []string{"10.0.0.2", "192.168.0.0/16"}
+	defer func() { bootstrap.HttpConfig.TrustedProxies = saved }()
+
+	tests := []struct {
+		name       string
+		forwarded  string
+		remoteAddr string
+		want       string
+	}{
+		{"直接访问", "", "10.0.0.1:5555", "10.0.0.1"},
+		{"IPv6", "", "[::1]:5555", "::1"},
+		{"没有端口", "", "10.0.0.1", "10.0.0.1"},
+		{"经过网关", "203.0.113.7", "10.0.0.2:80", "203.0.113.7"},
+		{"经过网段内的网关", "203.0.113.7", "192.168.3.4:80", "203.0.113.7"},
+		{"客户端伪造的地址被忽略", "1.1.1.1, 2.2.2.2, 203.0.113.7", "10.0.0.2:80", "203.0.113.7"},
+		{"最后一个地址为空", "1.1.1.1, ", "10.0.0.2:80", "10.0.0.2"},
+		{"直接访问时伪造X-Forwarded-For", "203.0.113.7", "10.0.0.1:5555", "10.0.0.1"},
+		{"非法对端地址", "203.0.113.7", "gateway:80", "gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}, RemoteAddr: tt.remoteAddr}
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIp(r); got != tt.want {
+				t.Errorf("ClientIp() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 没有配置可信代理时不读取X-Forwarded-For
+func TestClientIpWithoutTrustedProxies(t *testing.T) {
+	saved := bootstrap.HttpConfig.TrustedProxies
+	bootstrap.HttpConfig.TrustedProxies = nil
+	defer func() { bootstrap.HttpConfig.TrustedProxies = saved }()
+
+	r := &http.Request{Header: http.Header{"X-Forwarded-For": {"203.0.113.7"}}, RemoteAddr: "127.0.0.1:5555"}
+	if got := ClientIp(r); got != "127.0.0.1" {
+		t.Errorf("ClientIp() = %q, want %q", got, "127.0.0.1")
+	}
+}
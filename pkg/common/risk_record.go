@@ -0,0 +1,19 @@
+package common
+
+const (
+	RiskDecisionAllow     = "allow"     // 放行
+	RiskDecisionChallenge = "challenge" // 需要人机验证
+	RiskDecisionDeny      = "deny"      // 拒绝
+)
+
+// 秒杀请求的行为评分记录，由sk-app写入redis，sk-admin读取用于人工复核
+type RiskRecord struct {
+	UserId     int                `json:"user_id"`     // 用户ID
+	Username   string             `json:"username"`    // 用户名
+	ClientAddr string             `json:"client_addr"` // 客户端IP
+	ProductId  int                `json:"product_id"`  // 商品ID
+	Signals    map[string]float64 `json:"signals"`     // 各项信号得分(0-1)
+	Score      float64            `json:"score"`       // 总分(0-100)
+	Decision   string             `json:"decision"`    // 决策结果
+	AccessTime int64              `json:"access_time"` // 访问时间：毫秒
+}
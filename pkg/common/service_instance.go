@@ -1,10 +1,20 @@
 package common
 
+import (
+	"net"
+	"strconv"
+)
+
 // ServiceInstance 服务实例，拥有以下属性
 type ServiceInstance struct {
-	Host      string
-	Port      int
-	Weight    int
-	CurWeight int
-	GrpcPort  int
+	Host     string
+	Port     int
+	Weight   int // consul中注册的权重(Weights.Passing)
+	GrpcPort int
+	Version  string // consul中注册的meta.version，没有时为空
+}
+
+// 实例的http地址，负载均衡器以此区分实例
+func (instance *ServiceInstance) Address() string {
+	return net.JoinHostPort(instance.Host, strconv.Itoa(instance.Port))
 }
@@ -14,11 +14,87 @@ var (
 	MysqlConfig MysqlConf
 	TraceConfig TraceConf
 	Zk          ZookeeperConf
+	Jwt         JwtConf
+	OAuth       OAuthConf
+	Snowflake   SnowflakeConf
+	Register    RegisterConf
 )
 
+// zookeeper配置，hosts为集群全部节点的host:port
 type ZookeeperConf struct {
-	ZkConn        *zk.Conn
-	SecProductKey string // 商品键
+	Hosts          []string
+	SessionTimeout int // 会话超时：秒
+	ZkConn         *zk.Conn
+	SecProductKey  string // 商品键
+}
+
+// 令牌校验配置
+type JwtConf struct {
+	LocalVerify        bool     // 是否使用oauth-service发布的密钥在本地校验令牌
+	ClientId           string   // 拉取校验密钥时使用的客户端
+	ClientSecret       string   // 拉取校验密钥时使用的客户端密钥
+	KeyRefreshInterval int      // 校验密钥刷新间隔：秒
+	CacheSize          int      // 校验结果缓存条数
+	CacheTtl           int      // 校验结果缓存时间：秒
+	KeyClients         []string // oauth-service中允许拉取对称密钥的客户端
+
+	ActiveKid   string           // oauth-service当前用于签名的密钥
+	SigningKeys []SigningKeyConf // oauth-service的全部密钥，轮换时旧密钥保留用于校验
+	Secret      string           // oauth-service没有配置signingKeys时使用的HS256密钥
+}
+
+// 令牌签名密钥配置，私钥和公钥既可以直接写在配置中心，也可以指定文件
+type SigningKeyConf struct {
+	Kid            string // 密钥标识，写入jwt头部的kid
+	Alg            string // 签名算法：RS256、ES256、HS256
+	PrivateKey     string // PEM格式私钥
+	PrivateKeyFile string // PEM格式私钥文件
+	PublicKey      string // PEM格式公钥，只有公钥的密钥只用于校验
+	PublicKeyFile  string // PEM格式公钥文件
+	Secret         string // HS256密钥
+}
+
+// oauth-service配置
+type OAuthConf struct {
+	TokenStore          string // 令牌存储：jwt(默认，无状态)、redis(记录已签发令牌，支持吊销)
+	CodeValiditySeconds int    // 授权码有效时间：秒
+
+	LoginProtect LoginProtectConf // 登录防暴力破解
+	Mfa          MfaConf          // 两步验证
+}
+
+// 两步验证配置，管理员通过密码校验后还需要提交TOTP动态码或恢复码才能获得令牌
+type MfaConf struct {
+	Issuer               string // 认证器App中显示的签发方名称
+	RequireAdmin         bool   // 为true时未绑定两步验证的管理员必须先绑定才能登录
+	TokenValiditySeconds int    // mfa_token有效时间：秒
+	MaxAttempts          int    // 每个mfa_token最多可以尝试的次数
+}
+
+// 登录失败计数保存在redis中，计数在最后一次失败windowSeconds秒后清零
+type LoginProtectConf struct {
+	MaxUserFailures int // 同一用户名连续失败多少次后锁定，0表示不限制
+	MaxIpFailures   int // 同一IP失败多少次后锁定，0表示不限制
+	WindowSeconds   int // 失败计数的有效时间：秒
+	LockSeconds     int // 锁定时间：秒
+	BaseDelayMillis int // 失败后的延迟，每多失败一次翻倍
+	MaxDelayMillis  int // 最大延迟
+}
+
+// 雪花算法id生成配置，同一服务的每个实例需要不同的节点号
+type SnowflakeConf struct {
+	NodeId int64 // 节点号0-1023，未配置时根据服务注册的instanceId计算
+}
+
+// 自助注册配置，验证码保存在redis中，验证通过前账号不能登录
+type RegisterConf struct {
+	Sender                string // 验证码发送方式：log(打印到日志，默认)、file(追加到senderFile)，仅用于开发环境
+	SenderFile            string // sender为file时写入的文件
+	CodeTtlSeconds        int    // 验证码有效时间：秒
+	ResendIntervalSeconds int    // 同一邮箱/手机号两次发送的最小间隔：秒
+	MaxCodesPerTarget     int    // 同一邮箱/手机号每天最多发送次数，0表示不限制
+	MaxCodesPerIp         int    // 同一IP每天最多发送次数，0表示不限制
+	MaxVerifyAttempts     int    // 每个验证码最多可以尝试的次数
 }
 
 type TraceConf struct {
@@ -27,6 +103,14 @@ type TraceConf struct {
 	Url  string
 }
 
+// zipkin上报地址，没有配置trace时为空，不上报
+func (c TraceConf) ZipkinUrl() string {
+	if c.Host == "" {
+		return ""
+	}
+	return "http://" + c.Host + ":" + c.Port + c.Url
+}
+
 type MysqlConf struct {
 	Host string
 	Port string
@@ -45,6 +129,7 @@ type RedisConf struct {
 	IpBlackListHash      string        // IP黑名单hash表
 	IdBlackListQueue     string        // 用户黑名单队伍
 	IpBlackListQueue     string        // IP黑名单队伍
+	RiskLogQueue         string        // 风控评分记录队列
 	Host                 string
 	Password             string
 	Db                   int
@@ -56,6 +141,7 @@ type SecKillConf struct {
 	CookieSecretKey string
 	ReferWhiteList  []string // 白名单
 	AccessLimitConf AccessLimitConf
+	RiskConf        RiskConf
 
 	RWBlackLock                  sync.RWMutex
 	WriteProxy2LayerGoroutineNum int
@@ -106,3 +192,25 @@ type AccessLimitConf struct {
 	IPMinAccessLimit   int // IP每分钟访问限制
 	UserMinAccessLimit int // 用户每分钟访问限制
 }
+
+// 行为风控配置
+type RiskConf struct {
+	Enable          bool    // 是否开启行为评分
+	WindowSeconds   int64   // 统计窗口：秒
+	IntervalSamples int     // 计算访问间隔规律性所需的最少间隔数
+	IntervalCv      float64 // 访问间隔变异系数低于该值时，规律性一项得分大于0
+	MaxIpPerUser    int     // 窗口内单用户使用的IP数达到该值时，该项得满分
+	MaxUserPerIp    int     // 窗口内单IP出现的用户数达到该值时，该项得满分
+	MinTokenAge     int64   // 令牌签发不足该秒数时，令牌年龄一项得分大于0
+	EarlyWindowMs   int64   // 活动开始后该毫秒数内到达的请求，时机一项得分大于0
+
+	IntervalWeight    float64 // 访问间隔规律性权重
+	IpFanOutWeight    float64 // 单用户多IP权重
+	UserFanOutWeight  float64 // 单IP多用户权重
+	TokenAgeWeight    float64 // 令牌年龄权重
+	StartTimingWeight float64 // 请求时机权重
+
+	ChallengeScore float64 // 总分(0-100)达到该值时需要人机验证
+	DenyScore      float64 // 总分(0-100)达到该值时直接拒绝
+	LogMaxLen      int64   // redis中最多保留的评分记录数
+}
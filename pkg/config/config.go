@@ -12,6 +12,8 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 
 	_log "log"
 
@@ -56,7 +58,7 @@ func init() {
 		Logger.Log("Fail to parse trace", err)
 		return // add by myself
 	}
-	zipkinUrl := "http://" + TraceConfig.Host + ":" + TraceConfig.Port + TraceConfig.Url
+	zipkinUrl := TraceConfig.ZipkinUrl()
 	Logger.Log("zipkin url", zipkinUrl)
 	initTracer(zipkinUrl)
 }
@@ -80,11 +82,69 @@ func initTracer(zipkinURL string) {
 	}
 }
 
+var (
+	// 最近一次从配置中心加载的配置内容，用于判断配置是否变化
+	remoteContent []byte
+	// 查询配置中心实例的consul客户端，客户端会缓存并监听实例列表，重新加载配置时复用
+	configDiscoverOnce   sync.Once
+	configDiscoverClient discover.DiscoveryClient
+)
+
 func LoadRemoteConfig() (err error) {
+	content, confAddr, err := fetchRemoteConfig()
+	if err != nil {
+		return
+	}
+	err = viper.ReadConfig(bytes.NewBuffer(content))
+	if err != nil {
+		return
+	}
+	remoteContent = content
+	Logger.Log("Load config from: ", confAddr)
+	return
+}
+
+// 每隔interval重新从配置中心加载配置，内容变化时解析到新的viper实例并调用onChange，
+// 全局viper只在启动时读取一次，不与处理请求的goroutine并发修改；
+// onChange中使用SubOf从新配置中解析需要热更新的配置项，并整体替换当前配置；只应在一个goroutine中调用
+func WatchRemoteConfig(interval time.Duration, onChange func(v *viper.Viper)) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			content, confAddr, err := fetchRemoteConfig()
+			if err != nil {
+				Logger.Log("Fail to reload remote config", err)
+				continue
+			}
+			if bytes.Equal(content, remoteContent) {
+				continue
+			}
+			v := viper.New()
+			v.SetConfigType(viper.GetString(kConfigType))
+			if err := v.ReadConfig(bytes.NewBuffer(content)); err != nil {
+				Logger.Log("Fail to parse remote config", err)
+				continue
+			}
+			remoteContent = content
+			Logger.Log("Reload config from: ", confAddr)
+			onChange(v)
+		}
+	}()
+}
+
+// 从配置中心获取配置文件的内容
+func fetchRemoteConfig() (content []byte, confAddr string, err error) {
+	if bootstrap.ConfigServerConfig.Id == "" {
+		err = errors.New("config server is not configured")
+		return
+	}
 	// 声明consul实例
-	discoverClientInstance := discover.New(bootstrap.DiscoverConfig.Host, bootstrap.DiscoverConfig.Port)
+	configDiscoverOnce.Do(func() {
+		configDiscoverClient = discover.New(bootstrap.DiscoverConfig.Host, bootstrap.DiscoverConfig.Port)
+	})
 	// 服务实例发现
-	serviceInstances := discoverClientInstance.DiscoverServices(bootstrap.ConfigServerConfig.Id, logger)
+	serviceInstances := configDiscoverClient.DiscoverServices(bootstrap.ConfigServerConfig.Id, logger)
 	// 负载均衡算法寻找最合适的实例
 	serviceInstance, err := LoadBalance.SelectService(serviceInstances)
 	if err != nil {
@@ -92,7 +152,7 @@ func LoadRemoteConfig() (err error) {
 		return
 	}
 	configServer := "http://" + serviceInstance.Host + ":" + strconv.Itoa(serviceInstance.Port)
-	confAddr := fmt.Sprintf("%v/%v/%v-%v.%v", configServer, bootstrap.ConfigServerConfig.Label,
+	confAddr = fmt.Sprintf("%v/%v/%v-%v.%v", configServer, bootstrap.ConfigServerConfig.Label,
 		bootstrap.DiscoverConfig.ServiceName, bootstrap.ConfigServerConfig.Profile, viper.Get(kConfigType))
 
 	fmt.Println("confAddr=", confAddr)
@@ -107,26 +167,32 @@ func LoadRemoteConfig() (err error) {
 	if err != nil {
 		return
 	}
-	// 将响应的内容解析为viper配置
+	// 响应外层使用单独的viper解析，不覆盖当前配置
 	viper.SetConfigType(viper.GetString(kConfigType)) // 默认yaml
-	err = viper.ReadConfig(bytes.NewBuffer(body))
+	wrapper := viper.New()
+	wrapper.SetConfigType(viper.GetString(kConfigType))
+	err = wrapper.ReadConfig(bytes.NewBuffer(body))
 	if err != nil {
 		return
 	}
 	// 先读出content的具体内容，再将其解析为viper配置
-	decodeStr, _ := base64.StdEncoding.DecodeString(viper.Get("content").(string))
-	content := []byte(decodeStr)
-	err = viper.ReadConfig(bytes.NewBuffer(content))
-	if err != nil {
+	encoded, ok := wrapper.Get("content").(string)
+	if !ok {
+		err = errors.New("config content is empty")
 		return
 	}
-	Logger.Log("Load config from: ", confAddr)
+	content, err = base64.StdEncoding.DecodeString(encoded)
 	return
 }
 
 func Sub(key string, value interface{}) error {
+	return SubOf(viper.GetViper(), key, value)
+}
+
+// 从指定的viper实例中解析配置项，配置项同样可以被环境变量覆盖
+func SubOf(v *viper.Viper, key string, value interface{}) error {
 	Logger.Log("配置文件的前缀：", key)
-	sub := viper.Sub(key)
+	sub := v.Sub(key)
 	if sub == nil {
 		fmt.Println("./pkg/config/config.go 的Sub函数出错")
 		return errors.New("sub is nil")
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"final-design/pkg/bootstrap"
+)
+
+// 启动必需的配置项，解析后校验
+type validator interface {
+	Validate() error
+}
+
+// 解析启动必需的配置项并校验，配置中心没有该配置项或校验失败时打印原因后退出；
+// 配置项可以用 前缀_字段名 的环境变量覆盖，如MYSQL_HOST、REDIS_PASSWORD、ZOOKEEPER_HOSTS(多个用逗号分隔)，
+// 环境变量只覆盖配置中心中已有的字段
+func MustSub(key string, value validator) {
+	if err := Sub(key, value); err != nil {
+		fail(key, fmt.Errorf("not found in %s-%s.yaml of config server: %v",
+			bootstrap.DiscoverConfig.ServiceName, bootstrap.ConfigServerConfig.Profile, err))
+	}
+	if err := value.Validate(); err != nil {
+		fail(key, err)
+	}
+}
+
+func fail(key string, err error) {
+	Logger.Log("Invalid config", key, "err", err)
+	if bootstrap.UnitTest {
+		return
+	}
+	os.Exit(1)
+}
+
+func (c *MysqlConf) Validate() error {
+	if c.Host == "" || c.User == "" || c.Db == "" {
+		return errors.New("mysql.host, mysql.user and mysql.db are required (env MYSQL_HOST, MYSQL_USER, MYSQL_DB)")
+	}
+	if n, err := strconv.Atoi(c.Port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("mysql.port must be a port number, got %q (env MYSQL_PORT)", c.Port)
+	}
+	return nil
+}
+
+func (c *RedisConf) Validate() error {
+	if err := validAddr(c.Host); err != nil {
+		return fmt.Errorf("redis.host must be host:port (env REDIS_HOST): %v", err)
+	}
+	return nil
+}
+
+func (c *ZookeeperConf) Validate() error {
+	if len(c.Hosts) == 0 {
+		return errors.New("zookeeper.hosts is required (env ZOOKEEPER_HOSTS)")
+	}
+	for _, host := range c.Hosts {
+		if err := validAddr(host); err != nil {
+			return fmt.Errorf("zookeeper.hosts must be host:port (env ZOOKEEPER_HOSTS): %v", err)
+		}
+	}
+	if !strings.HasPrefix(c.SecProductKey, "/") {
+		return errors.New("zookeeper.secProductKey must be an absolute path like /product (env ZOOKEEPER_SECPRODUCTKEY)")
+	}
+	if c.SessionTimeout <= 0 {
+		return errors.New("zookeeper.sessionTimeout must be positive (env ZOOKEEPER_SESSIONTIMEOUT)")
+	}
+	return nil
+}
+
+func validAddr(addr string) error {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); host == "" || err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+	return nil
+}
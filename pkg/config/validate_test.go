@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidate(t *testing.T) {
+	validZk := func() *ZookeeperConf {
+		return &ZookeeperConf{Hosts: []string{"127.0.0.1:2181", "zk-2:2181"}, SecProductKey: "/product", SessionTimeout: 5}
+	}
+	tests := []struct {
+		name    string
+		value   validator
+		wantErr string // 为空时校验通过
+	}{
+		{"mysql合法配置", &MysqlConf{Host: "127.0.0.1", Port: "3306", User: "root", Db: "sec_kill"}, ""},
+		{"mysql缺少数据库名", &MysqlConf{Host: "127.0.0.1", Port: "3306", User: "root"}, "env MYSQL_HOST, MYSQL_USER, MYSQL_DB"},
+		{"mysql端口不合法", &MysqlConf{Host: "127.0.0.1", Port: "mysql", User: "root", Db: "sec_kill"}, "env MYSQL_PORT"},
+		{"redis合法配置", &RedisConf{Host: "127.0.0.1:6379"}, ""},
+		{"redis缺少端口", &RedisConf{Host: "127.0.0.1"}, "env REDIS_HOST"},
+		{"redis缺少主机", &RedisConf{Host: ":6379"}, "env REDIS_HOST"},
+		{"zookeeper合法配置", validZk(), ""},
+		{"zookeeper缺少地址", func() validator { c := validZk(); c.Hosts = nil; return c }(), "zookeeper.hosts is required"},
+		{"zookeeper地址不合法", func() validator { c := validZk(); c.Hosts = append(c.Hosts, "zk-3"); return c }(), "env ZOOKEEPER_HOSTS"},
+		{"zookeeper商品键不是绝对路径", func() validator { c := validZk(); c.SecProductKey = "product"; return c }(), "env ZOOKEEPER_SECPRODUCTKEY"},
+		{"zookeeper会话超时不是正数", func() validator { c := validZk(); c.SessionTimeout = 0; return c }(), "env ZOOKEEPER_SESSIONTIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.value.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 环境变量只覆盖配置中心中已有的字段，多个值用逗号分隔
+func TestSubOfEnvOverride(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(`
+mysql:
+  host: 127.0.0.1
+  port: 3306
+  user: root
+  db: sec_kill
+zookeeper:
+  hosts:
+    - 127.0.0.1:2181
+  secProductKey: /product
+  sessionTimeout: 5
+`)); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MYSQL_HOST", "mysql")
+	t.Setenv("MYSQL_PWD", "secret")
+	t.Setenv("ZOOKEEPER_HOSTS", "zk-1:2181,zk-2:2181")
+
+	var mysqlConf MysqlConf
+	if err := SubOf(v, "mysql", &mysqlConf); err != nil {
+		t.Fatal(err)
+	}
+	if mysqlConf.Host != "mysql" || mysqlConf.Port != "3306" {
+		t.Errorf("mysql = %+v, want host mysql from env and port from config", mysqlConf)
+	}
+	if mysqlConf.Pwd != "" {
+		t.Errorf("mysql.pwd = %q, want empty because it is not in the config", mysqlConf.Pwd)
+	}
+
+	var zkConf ZookeeperConf
+	if err := SubOf(v, "zookeeper", &zkConf); err != nil {
+		t.Fatal(err)
+	}
+	if err := zkConf.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := strings.Join(zkConf.Hosts, " "); got != "zk-1:2181 zk-2:2181" {
+		t.Errorf("zookeeper.hosts = %v, want [zk-1:2181 zk-2:2181]", zkConf.Hosts)
+	}
+
+	if err := SubOf(v, "redis", &RedisConf{}); err == nil {
+		t.Error("SubOf() for a missing key should fail")
+	}
+}
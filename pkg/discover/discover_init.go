@@ -20,6 +20,9 @@ var (
 	ErrNoInstanceExited = errors.New("no available client")
 )
 
+// Register注册的实例ID，Deregister使用同一个ID注销
+var registeredId string
+
 func init() {
 	// 实例化一个Consul客户端，此处实例化了原生态实现版本
 	ConsulService = New(bootstrap.DiscoverConfig.Host, bootstrap.DiscoverConfig.Port)
@@ -55,12 +58,13 @@ func Register() {
 	if instanceId == "" {
 		instanceId = bootstrap.DiscoverConfig.ServiceName + uuid.NewV4().String()
 	}
+	registeredId = instanceId
 
 	if !ConsulService.Register(instanceId, bootstrap.HttpConfig.Host, "/health", bootstrap.HttpConfig.Port,
 		bootstrap.DiscoverConfig.ServiceName, bootstrap.DiscoverConfig.Weight,
-		map[string]string{
+		InstanceMeta(map[string]string{
 			"rpcPort": bootstrap.RpcConfig.Port,
-		}, nil, Logger) {
+		}), InstanceTags(), Logger) {
 		Logger.Printf("register service %s failed.", bootstrap.DiscoverConfig.ServiceName)
 		// 注册失败，服务启动失败
 		panic(0)
@@ -68,19 +72,33 @@ func Register() {
 	Logger.Printf(bootstrap.DiscoverConfig.ServiceName+"-service for service %s success.", bootstrap.DiscoverConfig.ServiceName)
 }
 
-func Deregister() {
-	// 实例失败，停止服务
-	if ConsulService == nil {
-		panic(0)
+// 在meta中加入bootstrap中配置的实例版本，meta为nil时创建
+func InstanceMeta(meta map[string]string) map[string]string {
+	if bootstrap.DiscoverConfig.Version == "" {
+		return meta
 	}
-	// 判空 instanceId 通过go.uuid获取一个服务实例Id
-	instanceId := bootstrap.DiscoverConfig.InstanceId
-	if instanceId == "" {
-		instanceId = bootstrap.DiscoverConfig.InstanceId
+	if meta == nil {
+		meta = make(map[string]string)
 	}
+	meta["version"] = bootstrap.DiscoverConfig.Version
+	return meta
+}
+
+// bootstrap中配置的标签，配置了版本时加上version=版本
+func InstanceTags() []string {
+	tags := append([]string(nil), bootstrap.DiscoverConfig.Tags...)
+	if bootstrap.DiscoverConfig.Version != "" {
+		tags = append(tags, "version="+bootstrap.DiscoverConfig.Version)
+	}
+	return tags
+}
 
-	if !ConsulService.DeRegister(instanceId, Logger) {
+// 注销Register注册的实例，注销失败时只记录日志，不影响退出流程
+func Deregister() {
+	if ConsulService == nil || registeredId == "" {
+		return
+	}
+	if !ConsulService.DeRegister(registeredId, Logger) {
 		Logger.Printf("deregister for service %s failed.", bootstrap.DiscoverConfig.ServiceName)
-		panic(0)
 	}
 }
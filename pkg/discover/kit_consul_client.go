@@ -106,7 +106,13 @@ func (consulClient *DiscoveryClientInstance) DiscoverServices(serviceName string
 			params := make(map[string]interface{})
 			params["type"] = "service"
 			params["service"] = serviceName
-			plan, _ := watch.Parse(params)
+			plan, err := watch.Parse(params)
+			if err != nil {
+				if logger != nil {
+					logger.Println("Watch Service Error:", err)
+				}
+				return
+			}
 
 			plan.Handler = func(u uint64, i interface{}) {
 				if i == nil {
@@ -168,5 +174,6 @@ func newServiceInstance(service *api.AgentService) *common.ServiceInstance {
 		Port:     service.Port,
 		GrpcPort: rpcPort,
 		Weight:   service.Weights.Passing,
+		Version:  service.Meta["version"],
 	}
 }
@@ -0,0 +1,105 @@
+package loadbalance
+
+import (
+	"final-design/pkg/common"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 每单位权重对应的虚拟节点数
+const defaultReplicas = 100
+
+// 一致性哈希，相同的key总是选择同一个实例；实例上下线时只有少部分key会换到其他实例。
+// 虚拟节点数与实例权重成正比。没有key时退化为按权重随机
+type ConsistentHashLoadBalance struct {
+	replicas int
+	fallback RandomLoadBalance
+
+	mu        sync.RWMutex
+	signature string // 生成哈希环的实例列表，列表变化时重新生成
+	ring      []uint32
+	nodes     map[uint32]*common.ServiceInstance
+}
+
+// replicas为每单位权重的虚拟节点数，小于等于0时使用默认值
+func NewConsistentHashLoadBalance(replicas int) *ConsistentHashLoadBalance {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &ConsistentHashLoadBalance{replicas: replicas}
+}
+
+func (loadbalance *ConsistentHashLoadBalance) SelectService(services []*common.ServiceInstance) (*common.ServiceInstance, error) {
+	return loadbalance.fallback.SelectService(services)
+}
+
+func (loadbalance *ConsistentHashLoadBalance) SelectServiceByKey(services []*common.ServiceInstance, key string) (*common.ServiceInstance, error) {
+	if len(services) == 0 {
+		return nil, ErrServiceInstanceNotExist
+	}
+	if key == "" {
+		return loadbalance.SelectService(services)
+	}
+
+	ring, nodes := loadbalance.ringOf(services)
+	if len(ring) == 0 {
+		return nil, ErrServiceInstanceNotExist
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(ring), func(i int) bool { return ring[i] >= hash })
+	if i == len(ring) {
+		i = 0
+	}
+	return nodes[ring[i]], nil
+}
+
+// 实例列表没有变化时复用已生成的哈希环
+func (loadbalance *ConsistentHashLoadBalance) ringOf(services []*common.ServiceInstance) ([]uint32, map[uint32]*common.ServiceInstance) {
+	signature := signatureOf(services)
+
+	loadbalance.mu.RLock()
+	if loadbalance.signature == signature {
+		ring, nodes := loadbalance.ring, loadbalance.nodes
+		loadbalance.mu.RUnlock()
+		return ring, nodes
+	}
+	loadbalance.mu.RUnlock()
+
+	ring := make([]uint32, 0, len(services)*loadbalance.replicas)
+	nodes := make(map[uint32]*common.ServiceInstance, cap(ring))
+	for _, service := range services {
+		if service == nil {
+			continue
+		}
+		address := service.Address()
+		for i := 0; i < weightOf(service)*loadbalance.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(address + "#" + strconv.Itoa(i)))
+			if _, ok := nodes[hash]; ok {
+				continue // 哈希冲突，保留先加入的节点
+			}
+			nodes[hash] = service
+			ring = append(ring, hash)
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i] < ring[j] })
+
+	loadbalance.mu.Lock()
+	loadbalance.signature, loadbalance.ring, loadbalance.nodes = signature, ring, nodes
+	loadbalance.mu.Unlock()
+	return ring, nodes
+}
+
+// 实例地址和权重组成的签名，与实例顺序无关
+func signatureOf(services []*common.ServiceInstance) string {
+	parts := make([]string, 0, len(services))
+	for _, service := range services {
+		if service != nil {
+			parts = append(parts, service.Address()+"/"+strconv.Itoa(service.Weight))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,121 @@
+package loadbalance
+
+import (
+	"final-design/pkg/common"
+	"math/rand"
+	"sync"
+)
+
+// 各实例正在处理的请求数，按实例地址区分
+type connCounter struct {
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+func newConnCounter() connCounter {
+	return connCounter{conns: make(map[string]int)}
+}
+
+// 负载 = 正在处理的请求数 / 权重，使用交叉相乘比较避免浮点数
+func (counter *connCounter) less(a, b *common.ServiceInstance) bool {
+	return (counter.conns[a.Address()]+1)*weightOf(b) < (counter.conns[b.Address()]+1)*weightOf(a)
+}
+
+func (counter *connCounter) acquire(service *common.ServiceInstance) {
+	counter.conns[service.Address()]++
+}
+
+func (counter *connCounter) Release(service *common.ServiceInstance) {
+	if service == nil {
+		return
+	}
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	address := service.Address()
+	if counter.conns[address] <= 1 {
+		// 计数为0时删除，下线实例不会一直留在map中
+		delete(counter.conns, address)
+		return
+	}
+	counter.conns[address]--
+}
+
+// 加权最少连接，选择负载最小的实例，负载相同时随机选择
+type LeastConnLoadBalance struct {
+	connCounter
+}
+
+func NewLeastConnLoadBalance() *LeastConnLoadBalance {
+	return &LeastConnLoadBalance{connCounter: newConnCounter()}
+}
+
+func (loadbalance *LeastConnLoadBalance) SelectService(services []*common.ServiceInstance) (*common.ServiceInstance, error) {
+	if len(services) == 0 {
+		return nil, ErrServiceInstanceNotExist
+	}
+
+	loadbalance.mu.Lock()
+	defer loadbalance.mu.Unlock()
+
+	var best *common.ServiceInstance
+	ties := 0
+	// 从随机位置开始遍历，负载相同的实例被选中的机会均等
+	offset := rand.Intn(len(services))
+	for i := range services {
+		service := services[(offset+i)%len(services)]
+		if service == nil {
+			continue
+		}
+		if best == nil || loadbalance.less(service, best) {
+			best, ties = service, 1
+		} else if !loadbalance.less(best, service) {
+			// 负载相同，蓄水池抽样
+			ties++
+			if rand.Intn(ties) == 0 {
+				best = service
+			}
+		}
+	}
+	if best == nil {
+		return nil, ErrServiceInstanceNotExist
+	}
+	loadbalance.acquire(best)
+	return best, nil
+}
+
+// power of two choices：随机选两个实例，取负载较小的一个，
+// 实例很多时比最少连接开销小，也不会让所有请求同时涌向刚上线的实例
+type P2CLoadBalance struct {
+	connCounter
+}
+
+func NewP2CLoadBalance() *P2CLoadBalance {
+	return &P2CLoadBalance{connCounter: newConnCounter()}
+}
+
+func (loadbalance *P2CLoadBalance) SelectService(services []*common.ServiceInstance) (*common.ServiceInstance, error) {
+	if len(services) == 0 {
+		return nil, ErrServiceInstanceNotExist
+	}
+
+	loadbalance.mu.Lock()
+	defer loadbalance.mu.Unlock()
+
+	first := rand.Intn(len(services))
+	best := services[first]
+	if len(services) > 1 {
+		// 第二个实例从其余实例中选择，保证两个实例不同
+		second := rand.Intn(len(services) - 1)
+		if second >= first {
+			second++
+		}
+		if other := services[second]; other != nil && (best == nil || loadbalance.less(other, best)) {
+			best = other
+		}
+	}
+	if best == nil {
+		return nil, ErrServiceInstanceNotExist
+	}
+	loadbalance.acquire(best)
+	return best, nil
+}
@@ -4,53 +4,125 @@ import (
 	"errors"
 	"final-design/pkg/common"
 	"math/rand"
+	"sync"
 )
 
 var (
 	ErrServiceInstanceNotExist = errors.New("service instances are not exist")
+	ErrUnknownStrategy         = errors.New("unknown load balance strategy")
 )
 
-// 负载均衡器
+// 负载均衡策略名称，用于配置
+const (
+	StrategyRandom           = "random"
+	StrategyWeightRoundRobin = "weight_round_robin"
+	StrategyLeastConn        = "least_conn"
+	StrategyP2C              = "p2c"
+	StrategyConsistentHash   = "consistent_hash"
+)
+
+// 负载均衡器，实现必须是并发安全的
 type LoadBalance interface {
 	SelectService(services []*common.ServiceInstance) (*common.ServiceInstance, error)
 }
 
+// 按key选择实例的负载均衡器，相同的key在实例列表不变时总是选择同一个实例
+type KeyedLoadBalance interface {
+	LoadBalance
+	SelectServiceByKey(services []*common.ServiceInstance, key string) (*common.ServiceInstance, error)
+}
+
+// 需要知道请求何时结束的负载均衡器，SelectService选出的实例处理完请求后必须调用Release
+type ReleasableLoadBalance interface {
+	LoadBalance
+	Release(service *common.ServiceInstance)
+}
+
+// 根据策略名称创建负载均衡器，名称为空时使用随机策略；有状态的策略每次调用都返回新的实例
+func New(strategy string) (LoadBalance, error) {
+	switch strategy {
+	case "", StrategyRandom:
+		return &RandomLoadBalance{}, nil
+	case StrategyWeightRoundRobin:
+		return &WeightRoundRobinLoadBalance{}, nil
+	case StrategyLeastConn:
+		return NewLeastConnLoadBalance(), nil
+	case StrategyP2C:
+		return NewP2CLoadBalance(), nil
+	case StrategyConsistentHash:
+		return NewConsistentHashLoadBalance(0), nil
+	}
+	return nil, ErrUnknownStrategy
+}
+
+// 权重小于等于0的实例按1计算，未配置权重的实例仍能被选中
+func weightOf(service *common.ServiceInstance) int {
+	if service.Weight <= 0 {
+		return 1
+	}
+	return service.Weight
+}
+
 type RandomLoadBalance struct {
 }
 
-// 随机负载均衡
+// 按权重随机负载均衡，权重都相同时等同于随机选择
 func (loadbalance *RandomLoadBalance) SelectService(services []*common.ServiceInstance) (*common.ServiceInstance, error) {
 	if len(services) == 0 { // services 等于nil时，len(services)也等于0
 		return nil, ErrServiceInstanceNotExist
 	}
 
-	return services[rand.Intn(len(services))], nil
+	total := 0
+	for _, service := range services {
+		total += weightOf(service)
+	}
+	n := rand.Intn(total)
+	for _, service := range services {
+		if n -= weightOf(service); n < 0 {
+			return service, nil
+		}
+	}
+	return services[len(services)-1], nil
 }
 
+// 平滑加权轮询，当前权重由负载均衡器保存，不修改共享的服务实例
 type WeightRoundRobinLoadBalance struct {
+	mu         sync.Mutex
+	curWeights map[string]int // 实例地址 -> 当前权重
 }
 
 // 权重平滑负载均衡
-func (loadbalance *WeightRoundRobinLoadBalance) SelectService(services []*common.ServiceInstance) (best *common.ServiceInstance, err error) {
+func (loadbalance *WeightRoundRobinLoadBalance) SelectService(services []*common.ServiceInstance) (*common.ServiceInstance, error) {
 	if len(services) == 0 {
 		return nil, ErrServiceInstanceNotExist
 	}
-	total := 0
-	for i := 0; i < len(services); i++ {
-		w := services[i]
-		if w == nil {
+
+	loadbalance.mu.Lock()
+	defer loadbalance.mu.Unlock()
+
+	// 只保留当前实例列表中的实例，下线实例的权重不再累计
+	curWeights := make(map[string]int, len(services))
+	var (
+		best       *common.ServiceInstance
+		bestWeight int
+		total      int
+	)
+	for _, service := range services {
+		if service == nil {
 			continue
 		}
-		w.CurWeight += w.Weight
-		total += w.Weight
-		if best == nil || w.CurWeight > best.CurWeight {
-			best = w
+		address := service.Address()
+		weight := loadbalance.curWeights[address] + weightOf(service)
+		curWeights[address] = weight
+		total += weightOf(service)
+		if best == nil || weight > bestWeight {
+			best, bestWeight = service, weight
 		}
 	}
-
 	if best == nil {
-		return nil, nil
+		return nil, ErrServiceInstanceNotExist
 	}
-	best.CurWeight -= total
+	curWeights[best.Address()] -= total
+	loadbalance.curWeights = curWeights
 	return best, nil
 }
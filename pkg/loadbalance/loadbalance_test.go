@@ -0,0 +1,339 @@
+package loadbalance
+
+import (
+	"final-design/pkg/common"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func instances(weights ...int) []*common.ServiceInstance {
+	services := make([]*common.ServiceInstance, 0, len(weights))
+	for i, weight := range weights {
+		services = append(services, &common.ServiceInstance{Host: "10.0.0.1", Port: 9000 + i, Weight: weight})
+	}
+	return services
+}
+
+// 选择n次，返回每个实例被选中的次数，按实例下标
+func selectCounts(t *testing.T, loadbalance LoadBalance, services []*common.ServiceInstance, n int) []int {
+	index := make(map[*common.ServiceInstance]int, len(services))
+	for i, service := range services {
+		index[service] = i
+	}
+	counts := make([]int, len(services))
+	for i := 0; i < n; i++ {
+		service, err := loadbalance.SelectService(services)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[index[service]]++
+	}
+	return counts
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     string
+		wantErr  error
+	}{
+		{"", "*loadbalance.RandomLoadBalance", nil},
+		{StrategyRandom, "*loadbalance.RandomLoadBalance", nil},
+		{StrategyWeightRoundRobin, "*loadbalance.WeightRoundRobinLoadBalance", nil},
+		{StrategyLeastConn, "*loadbalance.LeastConnLoadBalance", nil},
+		{StrategyP2C, "*loadbalance.P2CLoadBalance", nil},
+		{StrategyConsistentHash, "*loadbalance.ConsistentHashLoadBalance", nil},
+		{"round_robin", "", ErrUnknownStrategy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			loadbalance, err := New(tt.strategy)
+			if err != tt.wantErr {
+				t.Fatalf("New() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && fmt.Sprintf("%T", loadbalance) != tt.want {
+				t.Errorf("New() = %T, want %s", loadbalance, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectServiceEmpty(t *testing.T) {
+	for _, strategy := range []string{StrategyRandom, StrategyWeightRoundRobin, StrategyLeastConn, StrategyP2C, StrategyConsistentHash} {
+		t.Run(strategy, func(t *testing.T) {
+			loadbalance, _ := New(strategy)
+			if _, err := loadbalance.SelectService(nil); err != ErrServiceInstanceNotExist {
+				t.Errorf("SelectService(nil) error = %v, want %v", err, ErrServiceInstanceNotExist)
+			}
+			if _, err := loadbalance.SelectService([]*common.ServiceInstance{}); err != ErrServiceInstanceNotExist {
+				t.Errorf("SelectService([]) error = %v, want %v", err, ErrServiceInstanceNotExist)
+			}
+		})
+	}
+}
+
+func TestRandomLoadBalance(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		want    []float64 // 期望的选中比例
+	}{
+		{"单个实例", []int{1}, []float64{1}},
+		{"权重相同", []int{1, 1}, []float64{0.5, 0.5}},
+		{"按权重", []int{1, 3}, []float64{0.25, 0.75}},
+		{"未配置权重按1计算", []int{0, -1, 2}, []float64{0.25, 0.25, 0.5}},
+	}
+	const n = 20000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := selectCounts(t, &RandomLoadBalance{}, instances(tt.weights...), n)
+			for i, count := range counts {
+				if got := float64(count) / n; math.Abs(got-tt.want[i]) > 0.03 {
+					t.Errorf("instance %d ratio = %.3f, want %.3f", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWeightRoundRobinLoadBalance(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		want    []int // 一轮内依次选中的实例下标
+	}{
+		{"单个实例", []int{3}, []int{0, 0, 0}},
+		{"权重相同", []int{1, 1, 1}, []int{0, 1, 2}},
+		{"平滑加权", []int{5, 1, 1}, []int{0, 0, 1, 0, 2, 0, 0}},
+		{"未配置权重按1计算", []int{0, 2}, []int{1, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := instances(tt.weights...)
+			loadbalance := &WeightRoundRobinLoadBalance{}
+			// 连续两轮的顺序相同
+			for round := 0; round < 2; round++ {
+				for i, want := range tt.want {
+					service, err := loadbalance.SelectService(services)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if service != services[want] {
+						t.Fatalf("round %d pick %d = %s, want %s", round, i, service.Address(), services[want].Address())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWeightRoundRobinInstanceChange(t *testing.T) {
+	services := instances(5, 1, 1)
+	loadbalance := &WeightRoundRobinLoadBalance{}
+	for i := 0; i < 3; i++ {
+		loadbalance.SelectService(services)
+	}
+	// 下线实例后不再保留它的当前权重，新加入的实例从0开始累计
+	loadbalance.SelectService(services[1:])
+	if _, ok := loadbalance.curWeights[services[0].Address()]; ok {
+		t.Error("weight of removed instance is kept")
+	}
+	counts := selectCounts(t, loadbalance, services, 7*10)
+	for i, want := range []int{50, 10, 10} {
+		if math.Abs(float64(counts[i]-want)) > 1 {
+			t.Errorf("instance %d count = %d, want %d", i, counts[i], want)
+		}
+	}
+}
+
+func TestLeastConnLoadBalance(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		n       int
+		want    []int
+	}{
+		{"权重相同时轮流", []int{1, 1, 1}, 6, []int{2, 2, 2}},
+		{"按权重分配", []int{2, 1}, 6, []int{4, 2}},
+		{"未配置权重按1计算", []int{0, 3}, 8, []int{2, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 不释放连接，每次选择后负载增加
+			counts := selectCounts(t, NewLeastConnLoadBalance(), instances(tt.weights...), tt.n)
+			for i := range counts {
+				if counts[i] != tt.want[i] {
+					t.Fatalf("counts = %v, want %v", counts, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLeastConnRelease(t *testing.T) {
+	services := instances(1, 1)
+	loadbalance := NewLeastConnLoadBalance()
+	first, _ := loadbalance.SelectService(services)
+	second, _ := loadbalance.SelectService(services)
+	if first == second {
+		t.Fatal("second request went to the busy instance")
+	}
+	// 第一个实例的请求结束后负载最小
+	loadbalance.Release(first)
+	if got, _ := loadbalance.SelectService(services); got != first {
+		t.Errorf("SelectService() = %s, want released %s", got.Address(), first.Address())
+	}
+	loadbalance.Release(first)
+	loadbalance.Release(second)
+	loadbalance.Release(second) // 重复释放不会出现负数
+	loadbalance.Release(nil)
+	if len(loadbalance.conns) != 0 {
+		t.Errorf("conns = %v, want empty", loadbalance.conns)
+	}
+}
+
+func TestP2CLoadBalance(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		busy    []int // 各实例正在处理的请求数
+		n       int
+		want    []int
+	}{
+		{"单个实例", []int{1}, []int{0}, 3, []int{3}},
+		{"两个实例时总是选择负载较小的", []int{1, 1}, []int{0, 0}, 10, []int{5, 5}},
+		{"繁忙的实例", []int{1, 1}, []int{10, 0}, 10, []int{0, 10}},
+		{"按权重计算负载", []int{4, 1}, []int{2, 0}, 1, []int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := instances(tt.weights...)
+			loadbalance := NewP2CLoadBalance()
+			for i, busy := range tt.busy {
+				if busy > 0 {
+					loadbalance.conns[services[i].Address()] = busy
+				}
+			}
+			counts := selectCounts(t, loadbalance, services, tt.n)
+			for i := range counts {
+				if counts[i] != tt.want[i] {
+					t.Fatalf("counts = %v, want %v", counts, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// 多个实例时负载最大的实例只有在两次都被抽中时才会被选择，这里不会发生
+func TestP2CNeverPicksTheBusiest(t *testing.T) {
+	services := instances(1, 1, 1, 1)
+	loadbalance := NewP2CLoadBalance()
+	loadbalance.conns[services[0].Address()] = 100
+	for i := 0; i < 1000; i++ {
+		service, _ := loadbalance.SelectService(services)
+		if service == services[0] {
+			t.Fatal("picked the busiest instance")
+		}
+		loadbalance.Release(service)
+	}
+}
+
+func TestConsistentHashLoadBalance(t *testing.T) {
+	services := instances(1, 1, 1, 1)
+	loadbalance := NewConsistentHashLoadBalance(0)
+	keys := make([]string, 2000)
+	owners := make(map[string]*common.ServiceInstance, len(keys))
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+		service, err := loadbalance.SelectServiceByKey(services, keys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		owners[keys[i]] = service
+	}
+
+	tests := []struct {
+		name     string
+		services []*common.ServiceInstance
+		maxMoved float64 // 最多有多少比例的key换到其他实例
+	}{
+		{"实例不变", services, 0},
+		{"顺序变化", []*common.ServiceInstance{services[3], services[1], services[0], services[2]}, 0},
+		{"新的负载均衡器", services, 0},
+		{"下线一个实例", services[:3], 0.35},
+		{"新增一个实例", instances(1, 1, 1, 1, 1), 0.3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := loadbalance
+			if tt.name == "新的负载均衡器" {
+				lb = NewConsistentHashLoadBalance(0)
+			}
+			moved := 0
+			for _, key := range keys {
+				service, err := lb.SelectServiceByKey(tt.services, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if service.Address() != owners[key].Address() {
+					moved++
+					// 只有下线实例上的key会换到其他实例
+					if len(tt.services) < len(services) && owners[key] != services[3] {
+						t.Fatalf("key %s moved from a remaining instance", key)
+					}
+				}
+			}
+			if ratio := float64(moved) / float64(len(keys)); ratio > tt.maxMoved {
+				t.Errorf("moved ratio = %.3f, want <= %.3f", ratio, tt.maxMoved)
+			}
+		})
+	}
+}
+
+func TestConsistentHashDistribution(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		want    []float64
+	}{
+		{"权重相同", []int{1, 1, 1}, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{"按权重", []int{1, 3}, []float64{0.25, 0.75}},
+	}
+	const n = 20000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := instances(tt.weights...)
+			loadbalance := NewConsistentHashLoadBalance(0)
+			counts := make(map[*common.ServiceInstance]int)
+			for i := 0; i < n; i++ {
+				service, _ := loadbalance.SelectServiceByKey(services, fmt.Sprintf("key-%d", i))
+				counts[service]++
+			}
+			for i, service := range services {
+				if got := float64(counts[service]) / n; math.Abs(got-tt.want[i]) > 0.08 {
+					t.Errorf("instance %d ratio = %.3f, want %.3f", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashWithoutKey(t *testing.T) {
+	services := instances(1, 1)
+	loadbalance := NewConsistentHashLoadBalance(10)
+	seen := make(map[*common.ServiceInstance]bool)
+	for i := 0; i < 100; i++ {
+		service, err := loadbalance.SelectServiceByKey(services, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[service] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("empty key picked %d instances, want random among 2", len(seen))
+	}
+	if _, err := loadbalance.SelectServiceByKey(nil, "user-1"); err != ErrServiceInstanceNotExist {
+		t.Errorf("SelectServiceByKey(nil) error = %v, want %v", err, ErrServiceInstanceNotExist)
+	}
+}
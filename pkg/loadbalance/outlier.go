@@ -0,0 +1,103 @@
+package loadbalance
+
+import (
+	"final-design/pkg/common"
+	"sync"
+	"time"
+)
+
+// 剔除时间最多为baseEjection的倍数
+const maxEjectionMultiplier = 10
+
+// 被动异常检测：实例连续失败(5xx或连接错误)达到阈值后暂时从候选列表中剔除，
+// 每次剔除的时间为baseEjection乘以累计剔除次数(最多10倍)，剔除结束后第一次成功时清零
+type OutlierDetector struct {
+	consecutiveFailures int
+	baseEjection        time.Duration
+	maxEjectionPercent  int
+	onEject             func(service *common.ServiceInstance)
+
+	mu    sync.Mutex
+	hosts map[string]*hostState // 实例地址 -> 状态，只记录失败过的实例
+}
+
+type hostState struct {
+	failures     int       // 连续失败次数
+	ejections    int       // 累计剔除次数
+	ejectedUntil time.Time // 剔除结束时间
+}
+
+// consecutiveFailures小于等于0时不剔除实例；maxEjectionPercent限制一个服务最多剔除的实例比例，
+// 避免全部实例被剔除；onEject在剔除实例时调用，可以为nil
+func NewOutlierDetector(consecutiveFailures int, baseEjection time.Duration, maxEjectionPercent int,
+	onEject func(service *common.ServiceInstance)) *OutlierDetector {
+	return &OutlierDetector{
+		consecutiveFailures: consecutiveFailures,
+		baseEjection:        baseEjection,
+		maxEjectionPercent:  maxEjectionPercent,
+		onEject:             onEject,
+		hosts:               make(map[string]*hostState),
+	}
+}
+
+// 过滤掉被剔除的实例，剔除的数量不超过maxEjectionPercent
+func (detector *OutlierDetector) Filter(services []*common.ServiceInstance) []*common.ServiceInstance {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	if len(detector.hosts) == 0 {
+		return services
+	}
+
+	now := time.Now()
+	allowed := len(services) * detector.maxEjectionPercent / 100
+	available := make([]*common.ServiceInstance, 0, len(services))
+	for _, service := range services {
+		if state, ok := detector.hosts[service.Address()]; ok && now.Before(state.ejectedUntil) && allowed > 0 {
+			allowed--
+			continue
+		}
+		available = append(available, service)
+	}
+	return available
+}
+
+func (detector *OutlierDetector) ReportSuccess(service *common.ServiceInstance) {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	address := service.Address()
+	if state, ok := detector.hosts[address]; ok && !time.Now().Before(state.ejectedUntil) {
+		delete(detector.hosts, address)
+	}
+}
+
+func (detector *OutlierDetector) ReportFailure(service *common.ServiceInstance) {
+	if detector.consecutiveFailures <= 0 {
+		return
+	}
+	detector.mu.Lock()
+	address := service.Address()
+	state, ok := detector.hosts[address]
+	if !ok {
+		state = &hostState{}
+		detector.hosts[address] = state
+	}
+	now := time.Now()
+	if now.Before(state.ejectedUntil) { // 已被剔除，剔除前发出的请求不再计数
+		detector.mu.Unlock()
+		return
+	}
+	state.failures++
+	ejected := state.failures >= detector.consecutiveFailures
+	if ejected {
+		state.failures = 0
+		if state.ejections < maxEjectionMultiplier {
+			state.ejections++
+		}
+		state.ejectedUntil = now.Add(detector.baseEjection * time.Duration(state.ejections))
+	}
+	detector.mu.Unlock()
+
+	if ejected && detector.onEject != nil {
+		detector.onEject(service)
+	}
+}
@@ -0,0 +1,120 @@
+package loadbalance
+
+import (
+	"final-design/pkg/common"
+	"testing"
+	"time"
+)
+
+func TestOutlierDetectorEject(t *testing.T) {
+	tests := []struct {
+		name                string
+		consecutiveFailures int
+		failures            int
+		successBetween      bool // 失败中间有一次成功
+		wantEjected         bool
+	}{
+		{"未达到阈值", 3, 2, false, false},
+		{"达到阈值", 3, 3, false, true},
+		{"成功后重新计数", 3, 4, true, false},
+		{"阈值为0不剔除", 0, 100, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := instances(1, 1, 1, 1)
+			ejected := 0
+			detector := NewOutlierDetector(tt.consecutiveFailures, time.Minute, 50,
+				func(service *common.ServiceInstance) { ejected++ })
+			for i := 0; i < tt.failures; i++ {
+				if tt.successBetween && i == tt.failures/2 {
+					detector.ReportSuccess(services[0])
+				}
+				detector.ReportFailure(services[0])
+			}
+			available := detector.Filter(services)
+			if gotEjected := len(available) == len(services)-1; gotEjected != tt.wantEjected {
+				t.Fatalf("available = %d instances, want ejected %v", len(available), tt.wantEjected)
+			}
+			if tt.wantEjected {
+				for _, service := range available {
+					if service == services[0] {
+						t.Error("ejected instance is still available")
+					}
+				}
+			}
+			if wantCalls := map[bool]int{true: 1, false: 0}[tt.wantEjected]; ejected != wantCalls {
+				t.Errorf("onEject called %d times, want %d", ejected, wantCalls)
+			}
+		})
+	}
+}
+
+func TestOutlierDetectorMaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		name               string
+		instances          int
+		failing            int
+		maxEjectionPercent int
+		wantAvailable      int
+	}{
+		{"不超过比例", 4, 1, 50, 3},
+		{"最多剔除一半", 4, 4, 50, 2},
+		{"比例不足一个实例", 1, 1, 50, 1},
+		{"比例为0不剔除", 4, 2, 0, 4},
+		{"全部剔除", 3, 3, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights := make([]int, tt.instances)
+			services := instances(weights...)
+			detector := NewOutlierDetector(1, time.Minute, tt.maxEjectionPercent, nil)
+			for i := 0; i < tt.failing; i++ {
+				detector.ReportFailure(services[i])
+			}
+			if got := len(detector.Filter(services)); got != tt.wantAvailable {
+				t.Errorf("available = %d, want %d", got, tt.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestOutlierDetectorEjectionTime(t *testing.T) {
+	service := instances(1)[0]
+	base := time.Minute
+	detector := NewOutlierDetector(2, base, 100, nil)
+	state := func() *hostState { return detector.hosts[service.Address()] }
+	// 模拟剔除时间已过
+	expire := func() { state().ejectedUntil = time.Now().Add(-time.Millisecond) }
+
+	for i := 1; i <= maxEjectionMultiplier+2; i++ {
+		before := time.Now()
+		detector.ReportFailure(service)
+		detector.ReportFailure(service)
+		multiplier := i
+		if multiplier > maxEjectionMultiplier {
+			multiplier = maxEjectionMultiplier
+		}
+		if got := state().ejectedUntil.Sub(before); got < base*time.Duration(multiplier) ||
+			got > base*time.Duration(multiplier)+time.Second {
+			t.Fatalf("ejection %d lasts %v, want %v", i, got, base*time.Duration(multiplier))
+		}
+
+		// 剔除期间的失败和成功都不改变状态
+		until := state().ejectedUntil
+		detector.ReportFailure(service)
+		detector.ReportSuccess(service)
+		if state() == nil || state().ejectedUntil != until || state().failures != 0 {
+			t.Fatalf("state changed while ejected: %+v", state())
+		}
+		expire()
+	}
+
+	// 剔除结束后第一次成功时清零
+	detector.ReportSuccess(service)
+	if state() != nil {
+		t.Fatalf("state = %+v after success, want cleared", state())
+	}
+	if got := len(detector.Filter([]*common.ServiceInstance{service})); got != 1 {
+		t.Errorf("available = %d after recovery, want 1", got)
+	}
+}
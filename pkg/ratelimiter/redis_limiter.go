@@ -0,0 +1,89 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// GCRA(通用信元速率算法)，效果等同于令牌桶：每个key只保存一个时间戳，多个实例共享配额；
+// 使用redis服务器的时间，避免各实例时钟不一致
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+
+local emission_interval = period / rate
+local burst_offset = emission_interval * burst
+
+local now = redis.call("TIME")
+now = (now[1] - 1704067200) + now[2] / 1000000
+
+local tat = redis.call("GET", key)
+if not tat then
+  tat = now
+else
+  tat = math.max(tonumber(tat), now)
+end
+
+local new_tat = tat + emission_interval
+local diff = now - (new_tat - burst_offset)
+if diff < 0 then
+  return {0, 0, tostring(-diff), tostring(tat - now)}
+end
+
+local reset_after = new_tat - now
+redis.call("SET", key, new_tat, "EX", math.ceil(reset_after))
+return {1, math.floor(diff / emission_interval), "-1", tostring(reset_after)}
+`)
+
+// 每period最多rate个请求，允许突发burst个请求，burst小于等于0时等于rate
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// 限流结果
+type Result struct {
+	Allowed    bool
+	Limit      Limit
+	Remaining  int           // 剩余可用的请求数
+	RetryAfter time.Duration // 被拒绝时多久后可以重试
+	ResetAfter time.Duration // 多久后配额完全恢复
+}
+
+// 基于redis的分布式限流器
+type RedisLimiter struct {
+	conn *redis.Client
+}
+
+func NewRedisLimiter(conn *redis.Client) *RedisLimiter {
+	return &RedisLimiter{conn: conn}
+}
+
+// 消耗key的一个请求配额
+func (limiter *RedisLimiter) Allow(key string, limit Limit) (*Result, error) {
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Rate
+	}
+	values, err := gcraScript.Run(limiter.conn, []string{key},
+		limit.Burst, limit.Rate, limit.Period.Seconds()).Result()
+	if err != nil {
+		return nil, err
+	}
+	v := values.([]interface{})
+	retryAfter, _ := strconv.ParseFloat(v[2].(string), 64)
+	resetAfter, _ := strconv.ParseFloat(v[3].(string), 64)
+	return &Result{
+		Allowed:    v[0].(int64) == 1,
+		Limit:      limit,
+		Remaining:  int(v[1].(int64)),
+		RetryAfter: time.Duration(retryAfter * float64(time.Second)),
+		ResetAfter: time.Duration(resetAfter * float64(time.Second)),
+	}, nil
+}
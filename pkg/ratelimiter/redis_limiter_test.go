@@ -0,0 +1,121 @@
+package ratelimiter
+
+import (
+	"final-design/pkg/redistest"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testKey(name string) string {
+	return fmt.Sprintf("test:ratelimit:%s:%d", name, time.Now().UnixNano())
+}
+
+func TestRedisLimiterBurst(t *testing.T) {
+	conn, _ := redistest.New(t)
+	limiter := NewRedisLimiter(conn)
+	tests := []struct {
+		name           string
+		limit          Limit
+		wantAllowed    int
+		wantRetryAfter time.Duration // 第一个被拒绝的请求的重试时间上限
+	}{
+		{"突发等于速率", Limit{Rate: 5, Period: time.Second, Burst: 5}, 5, 200 * time.Millisecond},
+		{"未配置突发时等于速率", Limit{Rate: 3, Period: time.Second}, 3, 334 * time.Millisecond},
+		{"突发小于速率", Limit{Rate: 10, Period: time.Second, Burst: 2}, 2, 100 * time.Millisecond},
+		{"突发大于速率", Limit{Rate: 1, Period: time.Minute, Burst: 3}, 3, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := testKey("burst")
+			lastRemaining := tt.wantAllowed
+			for i := 0; i < tt.wantAllowed; i++ {
+				result, err := limiter.Allow(key, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Allowed {
+					t.Fatalf("request %d is rejected", i)
+				}
+				// 剩余配额逐个减少，浮点误差可能少算一个
+				want := tt.wantAllowed - 1 - i
+				if result.Remaining > want || result.Remaining < want-1 || result.Remaining > lastRemaining {
+					t.Errorf("request %d remaining = %d, want %d", i, result.Remaining, want)
+				}
+				lastRemaining = result.Remaining
+			}
+
+			result, err := limiter.Allow(key, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed || result.Remaining != 0 {
+				t.Fatalf("request over burst = %+v, want rejected", result)
+			}
+			if result.RetryAfter <= 0 || result.RetryAfter > tt.wantRetryAfter {
+				t.Errorf("RetryAfter = %v, want (0, %v]", result.RetryAfter, tt.wantRetryAfter)
+			}
+			if result.Limit.Burst != tt.wantAllowed {
+				t.Errorf("Limit.Burst = %d, want %d", result.Limit.Burst, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestRedisLimiterRecover(t *testing.T) {
+	conn, _ := redistest.New(t)
+	limiter := NewRedisLimiter(conn)
+	limit := Limit{Rate: 10, Period: time.Second, Burst: 1}
+	key := testKey("recover")
+
+	tests := []struct {
+		name        string
+		wait        time.Duration
+		wantAllowed bool
+	}{
+		{"第一次", 0, true},
+		{"立即重试", 0, false},
+		{"等待一个间隔后恢复", 110 * time.Millisecond, true},
+		{"再次超过", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time.Sleep(tt.wait)
+			result, err := limiter.Allow(key, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %v, want %v", result.Allowed, tt.wantAllowed)
+			}
+			if result.Allowed && (result.ResetAfter <= 0 || result.ResetAfter > 100*time.Millisecond) {
+				t.Errorf("ResetAfter = %v, want (0, 100ms]", result.ResetAfter)
+			}
+		})
+	}
+}
+
+// 不同key的配额互不影响
+func TestRedisLimiterKeys(t *testing.T) {
+	conn, _ := redistest.New(t)
+	limiter := NewRedisLimiter(conn)
+	limit := Limit{Rate: 1, Period: time.Minute}
+	first, second := testKey("a"), testKey("b")
+	for _, tt := range []struct {
+		key         string
+		wantAllowed bool
+	}{
+		{first, true},
+		{first, false},
+		{second, true},
+		{second, false},
+	} {
+		result, err := limiter.Allow(tt.key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != tt.wantAllowed {
+			t.Errorf("Allow(%s) = %v, want %v", tt.key, result.Allowed, tt.wantAllowed)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package redis
+
+import (
+	conf "final-design/pkg/config"
+	"log"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// 初始化redis，连接保存在conf.Redis.RedisConn
+func InitRedis() {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     conf.Redis.Host,
+		Password: conf.Redis.Password,
+		DB:       conf.Redis.Db,
+	})
+
+	_, err := client.Ping().Result()
+	if err != nil {
+		log.Printf("Connect redis failed, Error: %v", err)
+	}
+	conf.Redis.RedisConn = client
+	log.Printf("init redis success")
+}
@@ -0,0 +1,17 @@
+// 单元测试使用的redis：在进程内启动miniredis，不依赖外部redis，测试结束时关闭
+package redistest
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+// 启动一个空的miniredis并返回连接，返回的*miniredis.Miniredis用于推进过期时间(FastForward)和检查数据
+func New(t testing.TB) (*redis.Client, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	conn := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { conn.Close() })
+	return conn, server
+}
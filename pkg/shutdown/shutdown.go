@@ -0,0 +1,169 @@
+package shutdown
+
+import (
+	"context"
+	"final-design/pkg/bootstrap"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+var Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+// 退出时执行的清理函数，如排空内存队列、同步内存数据，ctx到期后应尽快返回
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// 优雅退出，收到SIGINT/SIGTERM或服务运行出错后按顺序：
+//  1. 从consul注销，等待deregisterDelay让网关和其它服务不再转发请求过来
+//  2. 停止接收新请求，等待处理中的HTTP请求和gRPC调用完成
+//  3. 按注册顺序执行清理函数
+//
+// 整个过程不超过bootstrap中的shutdown.timeout，超时后不再等待直接退出
+type Graceful struct {
+	deregister  func()
+	servers     []*http.Server
+	grpcServers []*grpc.Server
+	hooks       []namedHook
+}
+
+// deregister为从consul注销的函数，没有注册到consul的服务传nil
+func New(deregister func()) *Graceful {
+	return &Graceful{deregister: deregister}
+}
+
+// 退出时关闭的HTTP服务
+func (g *Graceful) HTTP(server *http.Server) *Graceful {
+	g.servers = append(g.servers, server)
+	return g
+}
+
+// 退出时关闭的gRPC服务
+func (g *Graceful) GRPC(server *grpc.Server) *Graceful {
+	g.grpcServers = append(g.grpcServers, server)
+	return g
+}
+
+// 添加清理函数，在所有服务关闭后执行
+func (g *Graceful) OnShutdown(name string, hook Hook) *Graceful {
+	g.hooks = append(g.hooks, namedHook{name: name, hook: hook})
+	return g
+}
+
+// 阻塞直到收到退出信号或errChan中有错误，然后执行退出流程；
+// 退出流程开始后不再读取errChan，服务关闭时Serve返回的错误被忽略；没有服务时errChan传nil
+func (g *Graceful) Wait(errChan <-chan error) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-c:
+		Logger.Printf("receive signal %v, shutting down", sig)
+	case err := <-errChan:
+		Logger.Printf("server exited: %v, shutting down", err)
+	}
+	signal.Stop(c)
+
+	timeout := time.Duration(bootstrap.ShutdownConfig.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := g.Shutdown(ctx); err != nil {
+		Logger.Printf("shutdown not completed in %v: %v", timeout, err)
+		return
+	}
+	Logger.Printf("shutdown completed")
+}
+
+// 执行退出流程，返回第一个没有按时完成的步骤的错误
+func (g *Graceful) Shutdown(ctx context.Context) error {
+	if g.deregister != nil {
+		g.deregister()
+		if len(g.servers) > 0 || len(g.grpcServers) > 0 {
+			delay := time.Duration(bootstrap.ShutdownConfig.DeregisterDelay) * time.Second
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(g.servers)+len(g.grpcServers))
+	for _, server := range g.servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				// 超时后关闭剩余的连接
+				server.Close()
+				errs <- fmt.Errorf("http server %s: %w", server.Addr, err)
+			}
+		}(server)
+	}
+	for _, server := range g.grpcServers {
+		wg.Add(1)
+		go func(server *grpc.Server) {
+			defer wg.Done()
+			if err := stopGrpc(ctx, server); err != nil {
+				errs <- fmt.Errorf("grpc server: %w", err)
+			}
+		}(server)
+	}
+	wg.Wait()
+	close(errs)
+
+	err := <-errs
+
+	// 服务没有按时关闭也要执行清理函数，尽量把内存中的数据写回
+	for _, h := range g.hooks {
+		Logger.Printf("shutdown: %s", h.name)
+		if hookErr := h.hook(ctx); hookErr != nil {
+			Logger.Printf("shutdown: %s failed: %v", h.name, hookErr)
+			if err == nil {
+				err = fmt.Errorf("%s: %w", h.name, hookErr)
+			}
+		}
+	}
+	return err
+}
+
+// 等待gRPC调用完成，ctx到期后强制关闭
+func stopGrpc(ctx context.Context, server *grpc.Server) error {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
+
+// 等待wg完成，ctx到期时返回ctx.Err()
+func WaitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,210 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"final-design/pkg/bootstrap"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// 按发生顺序记录退出流程中的事件
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (rec *recorder) add(event string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.events = append(rec.events, event)
+}
+
+func (rec *recorder) get() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]string(nil), rec.events...)
+}
+
+// 启动HTTP服务，请求处理requestTime后返回
+func startServer(t *testing.T, rec *recorder, requestTime time.Duration) (*http.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.add("request start")
+		select {
+		case <-time.After(requestTime):
+			rec.add("request done")
+		case <-r.Context().Done():
+		}
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return server, "http://" + listener.Addr().String()
+}
+
+func setShutdownConfig(t *testing.T, deregisterDelay int) {
+	saved := bootstrap.ShutdownConfig
+	bootstrap.ShutdownConfig.DeregisterDelay = deregisterDelay
+	t.Cleanup(func() { bootstrap.ShutdownConfig = saved })
+}
+
+func TestShutdownOrder(t *testing.T) {
+	Logger = log.New(io.Discard, "", 0)
+	errHook := errors.New("flush failed")
+
+	tests := []struct {
+		name        string
+		deregister  bool
+		requestTime time.Duration
+		timeout     time.Duration
+		hookErr     error
+		want        []string
+		wantErr     error
+	}{
+		{"注销后等待处理中的请求完成再执行清理函数", true, 100 * time.Millisecond, 5 * time.Second, nil,
+			[]string{"request start", "deregister", "request done", "hook 1", "hook 2"}, nil},
+		{"没有注册到consul", false, 100 * time.Millisecond, 5 * time.Second, nil,
+			[]string{"request start", "request done", "hook 1", "hook 2"}, nil},
+		{"请求超时后仍执行清理函数", true, time.Minute, 200 * time.Millisecond, nil,
+			[]string{"request start", "deregister", "hook 1", "hook 2"}, context.DeadlineExceeded},
+		{"清理函数出错后继续执行", true, 0, 5 * time.Second, errHook,
+			[]string{"request start", "request done", "deregister", "hook 1", "hook 2"}, errHook},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setShutdownConfig(t, 0)
+			rec := &recorder{}
+			server, url := startServer(t, rec, tt.requestTime)
+
+			var deregister func()
+			if tt.deregister {
+				deregister = func() { rec.add("deregister") }
+			}
+			hookErr := tt.hookErr
+			graceful := New(deregister).HTTP(server).
+				OnShutdown("hook 1", func(ctx context.Context) error {
+					// 执行清理函数时已经停止接收新的请求
+					if _, err := http.Get(url); err == nil {
+						t.Error("server still accepts requests when running hooks")
+					}
+					rec.add("hook 1")
+					return hookErr
+				}).
+				OnShutdown("hook 2", func(ctx context.Context) error { rec.add("hook 2"); return nil })
+
+			// 退出前发出一个请求
+			go http.Get(url)
+			for len(rec.get()) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			if tt.requestTime == 0 {
+				for len(rec.get()) < 2 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err := graceful.Shutdown(ctx)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Shutdown() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := rec.get(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 注销后等待deregisterDelay，期间仍然处理新的请求
+func TestShutdownDeregisterDelay(t *testing.T) {
+	Logger = log.New(io.Discard, "", 0)
+	setShutdownConfig(t, 1)
+	rec := &recorder{}
+	server, url := startServer(t, rec, 0)
+	deregistered := make(chan struct{})
+	graceful := New(func() { close(deregistered) }).HTTP(server)
+
+	start := time.Now()
+	done := make(chan error)
+	go func() { done <- graceful.Shutdown(context.Background()) }()
+	<-deregistered
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request during deregister delay failed: %v", err)
+	}
+	resp.Body.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Shutdown() returned after %v, want at least the deregister delay", elapsed)
+	}
+}
+
+func TestShutdownGrpc(t *testing.T) {
+	Logger = log.New(io.Discard, "", 0)
+	setShutdownConfig(t, 0)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	served := make(chan error)
+	go func() { served <- server.Serve(listener) }()
+
+	hookRan := false
+	graceful := New(nil).GRPC(server).OnShutdown("hook", func(ctx context.Context) error {
+		hookRan = true
+		return nil
+	})
+	if err := graceful.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("grpc server is still serving")
+	}
+	if !hookRan {
+		t.Error("hook is not run")
+	}
+}
+
+func TestWaitGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		work    time.Duration
+		timeout time.Duration
+		wantErr error
+	}{
+		{"按时完成", 10 * time.Millisecond, time.Second, nil},
+		{"超时", time.Second, 20 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(tt.work)
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := WaitGroup(ctx, &wg); err != tt.wantErr {
+				t.Errorf("WaitGroup() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
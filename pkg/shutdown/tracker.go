@@ -0,0 +1,65 @@
+package shutdown
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// 跟踪处理中的请求。h2c连接由h2c.Handler接管后不再受http.Server管理，
+// Server.Shutdown不会等待其中的请求(如网关代理的gRPC调用)，需要用Tracker包装handler，
+// 并把Wait注册为退出时的清理函数
+type Tracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{} // active降为0时关闭
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+func (t *Tracker) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.start()
+		defer t.done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *Tracker) start() {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+	t.mu.Unlock()
+}
+
+func (t *Tracker) done() {
+	t.mu.Lock()
+	t.active--
+	if t.active == 0 {
+		close(t.idle)
+	}
+	t.mu.Unlock()
+}
+
+// 等待处理中的请求完成，ctx到期时返回ctx.Err()；
+// 等待期间已接管的连接上仍可能有新的请求，直到没有处理中的请求才返回
+func (t *Tracker) Wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		if t.active == 0 {
+			t.mu.Unlock()
+			return nil
+		}
+		idle := t.idle
+		t.mu.Unlock()
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
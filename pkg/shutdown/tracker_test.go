@@ -0,0 +1,110 @@
+package shutdown
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// 使用HTTP/2明文(prior knowledge)的客户端，与gRPC客户端连接网关的方式相同
+func newH2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+}
+
+func TestShutdownWaitsH2cRequests(t *testing.T) {
+	Logger = log.New(io.Discard, "", 0)
+	setShutdownConfig(t, 0)
+	const requestTime = 300 * time.Millisecond
+
+	tests := []struct {
+		name       string
+		track      bool
+		timeout    time.Duration
+		wantErr    error
+		wantWaited bool // Shutdown是否等到请求完成才返回
+	}{
+		{"不跟踪时不等待h2c连接上的请求", false, 2 * time.Second, nil, false},
+		{"等待h2c请求完成", true, 2 * time.Second, nil, true},
+		{"超时后不再等待", true, 50 * time.Millisecond, context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			started := make(chan struct{})
+			var finished int32
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(requestTime)
+				io.WriteString(w, "ok")
+				atomic.StoreInt32(&finished, 1)
+			})
+			tracker := NewTracker()
+			if tt.track {
+				handler = tracker.Handler(handler)
+			}
+			server := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+			go server.Serve(listener)
+			t.Cleanup(func() { server.Close() })
+
+			type result struct {
+				proto string
+				err   error
+			}
+			done := make(chan result, 1)
+			go func() {
+				resp, err := newH2cClient().Get("http://" + listener.Addr().String())
+				if err != nil {
+					done <- result{err: err}
+					return
+				}
+				defer resp.Body.Close()
+				_, err = io.ReadAll(resp.Body)
+				done <- result{proto: resp.Proto, err: err}
+			}()
+			<-started
+
+			graceful := New(nil).HTTP(server)
+			if tt.track {
+				graceful.OnShutdown("wait h2c requests", tracker.Wait)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := graceful.Shutdown(ctx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Shutdown() error = %v, want %v", err, tt.wantErr)
+			}
+			if waited := atomic.LoadInt32(&finished) == 1; waited != tt.wantWaited {
+				t.Fatalf("request finished before Shutdown() returned = %v, want %v", waited, tt.wantWaited)
+			}
+			if !tt.wantWaited {
+				return
+			}
+			// 等到的请求正常返回给客户端
+			select {
+			case res := <-done:
+				if res.err != nil || res.proto != "HTTP/2.0" {
+					t.Errorf("request = %s, %v, want HTTP/2.0 without error", res.proto, res.err)
+				}
+			case <-time.After(time.Second):
+				t.Error("response is not delivered after shutdown")
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package snowflake
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// id结构：1位符号位(0) + 41位毫秒时间戳 + 10位节点号 + 12位序列号，
+// 时间戳从Epoch开始计算，可以使用约69年；每个节点每毫秒最多生成4096个id
+const (
+	Epoch int64 = 1704067200000 // 2024-01-01 00:00:00 UTC
+
+	nodeBits     = 10
+	sequenceBits = 12
+
+	MaxNodeId   int64 = -1 ^ (-1 << nodeBits)
+	maxSequence int64 = -1 ^ (-1 << sequenceBits)
+
+	timeShift = nodeBits + sequenceBits
+	nodeShift = sequenceBits
+)
+
+var ErrInvalidNodeId = errors.New("snowflake node id must be between 0 and 1023")
+
+// 同一服务的多个实例必须使用不同的节点号，否则可能生成重复的id
+type Node struct {
+	mu       sync.Mutex
+	nodeId   int64
+	lastTime int64
+	sequence int64
+}
+
+func NewNode(nodeId int64) (*Node, error) {
+	if nodeId < 0 || nodeId > MaxNodeId {
+		return nil, ErrInvalidNodeId
+	}
+	return &Node{nodeId: nodeId}, nil
+}
+
+// 根据实例id计算节点号，用于没有单独配置节点号的情况；不同实例id仍可能冲突，生产环境应显式配置
+func NodeIdOf(instanceId string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(instanceId))
+	return int64(h.Sum32()) & MaxNodeId
+}
+
+// 生成id，同一节点生成的id单调递增；时钟回拨时沿用上一次的时间戳，直到序列号用完再等待
+func (n *Node) Generate() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	if now < n.lastTime {
+		now = n.lastTime
+	}
+	if now == n.lastTime {
+		n.sequence = (n.sequence + 1) & maxSequence
+		if n.sequence == 0 {
+			// 当前毫秒的序列号已用完，等待下一毫秒
+			for now <= n.lastTime {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		n.sequence = 0
+	}
+	n.lastTime = now
+	return (now-Epoch)<<timeShift | n.nodeId<<nodeShift | n.sequence
+}
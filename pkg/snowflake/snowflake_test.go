@@ -0,0 +1,105 @@
+package snowflake
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewNode(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodeId  int64
+		wantErr error
+	}{
+		{"最小节点号", 0, nil},
+		{"最大节点号", MaxNodeId, nil},
+		{"负数", -1, ErrInvalidNodeId},
+		{"超出范围", MaxNodeId + 1, ErrInvalidNodeId},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewNode(tt.nodeId); err != tt.wantErr {
+				t.Errorf("NewNode(%d) error = %v, want %v", tt.nodeId, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodeIdOf(t *testing.T) {
+	tests := []string{"", "sk-app-1", "sk-app-2", "user-service-10.0.0.1-9009"}
+	for _, instanceId := range tests {
+		t.Run(instanceId, func(t *testing.T) {
+			nodeId := NodeIdOf(instanceId)
+			if nodeId < 0 || nodeId > MaxNodeId {
+				t.Errorf("NodeIdOf(%q) = %d, out of range", instanceId, nodeId)
+			}
+			if NodeIdOf(instanceId) != nodeId {
+				t.Errorf("NodeIdOf(%q) is not stable", instanceId)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodeId   int64
+		count    int
+		rollback time.Duration // 生成前将上一次的时间戳设置到未来，模拟时钟回拨
+	}{
+		{"单个id", 1, 1, 0},
+		{"超过每毫秒序列号上限", MaxNodeId, int(maxSequence) * 3, 0},
+		{"时钟回拨", 7, 100, 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, _ := NewNode(tt.nodeId)
+			start := time.Now().UnixMilli()
+			if tt.rollback > 0 {
+				node.lastTime = start + tt.rollback.Milliseconds()
+			}
+			var last int64
+			for i := 0; i < tt.count; i++ {
+				id := node.Generate()
+				if id <= last {
+					t.Fatalf("id #%d = %d, not greater than %d", i, id, last)
+				}
+				last = id
+				if nodeId := id >> nodeShift & MaxNodeId; nodeId != tt.nodeId {
+					t.Fatalf("node id of %d = %d, want %d", id, nodeId, tt.nodeId)
+				}
+				ms := id>>timeShift + Epoch
+				if ms < start || ms > time.Now().UnixMilli()+tt.rollback.Milliseconds() {
+					t.Fatalf("timestamp of %d = %d, want from %d", id, ms, start)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateConcurrent(t *testing.T) {
+	node, _ := NewNode(3)
+	const workers, perWorker = 8, 2000
+	ids := make(chan int64, workers*perWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				ids <- node.Generate()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int64]bool, workers*perWorker)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate id %d", id)
+		}
+		seen[id] = true
+	}
+}
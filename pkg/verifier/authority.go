@@ -0,0 +1,110 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"final-design/pb"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	RoleUser  = "ROLE_USER"  // 普通用户角色
+	RoleAdmin = "ROLE_ADMIN" // 管理员角色
+)
+
+var (
+	ErrUnauthorized = errors.New("token is invalid")
+	ErrNotPermit    = errors.New("not permit")
+)
+
+// context中的key使用私有类型，避免与其它包放入context的值冲突
+type contextKey int
+
+const (
+	tokenKey contextKey = iota // 校验通过的令牌信息
+)
+
+// 校验请求头Authorization中的访问令牌，校验通过时把令牌信息放入context，
+// 由MakeAuthorityMiddleware等endpoint中间件按角色或scope鉴权；供oauth-service以外的服务使用
+func HttpTokenContext(tokenVerifier TokenVerifier) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		tokenValue := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tokenValue == "" {
+			return ctx
+		}
+		resp, err := tokenVerifier.Verify(ctx, tokenValue)
+		if err != nil || resp == nil || !resp.IsValidToken {
+			return ctx
+		}
+		return context.WithValue(ctx, tokenKey, resp)
+	}
+}
+
+// 从context中获取校验通过的令牌信息
+func TokenFromContext(ctx context.Context) (*pb.CheckTokenResponse, bool) {
+	token, ok := ctx.Value(tokenKey).(*pb.CheckTokenResponse)
+	return token, ok
+}
+
+// 当前令牌对应的用户id，没有令牌或client_credentials签发的令牌返回0
+func UserIdFromContext(ctx context.Context) int64 {
+	if token, ok := TokenFromContext(ctx); ok && !isClientOnly(token) {
+		return token.UserDetails.UserId
+	}
+	return 0
+}
+
+// 需要用户令牌具有authority角色或权限
+func MakeAuthorityMiddleware(authority string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			token, ok := TokenFromContext(ctx)
+			if !ok {
+				return nil, ErrUnauthorized
+			}
+			if isClientOnly(token) || !contains(token.UserDetails.Authorities, authority) {
+				return nil, ErrNotPermit
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// 用户令牌需要具有authority角色，client_credentials签发的令牌需要客户端具有scope
+func MakeAuthorityOrScopeMiddleware(authority, scope string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			token, ok := TokenFromContext(ctx)
+			if !ok {
+				return nil, ErrUnauthorized
+			}
+			if !isClientOnly(token) {
+				ok = contains(token.UserDetails.Authorities, authority)
+			} else {
+				ok = contains(token.ClientDetails.GetScope(), scope)
+			}
+			if !ok {
+				return nil, ErrNotPermit
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// client_credentials签发的令牌，不包含用户信息
+func isClientOnly(token *pb.CheckTokenResponse) bool {
+	return token.ClientOnly || token.UserDetails == nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
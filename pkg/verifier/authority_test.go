@@ -0,0 +1,79 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"final-design/pb"
+	"net/http"
+	"testing"
+)
+
+// 按令牌值返回固定结果的校验器
+type staticVerifier map[string]*pb.CheckTokenResponse
+
+func (v staticVerifier) Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error) {
+	if resp, ok := v[tokenValue]; ok {
+		return resp, nil
+	}
+	return nil, errors.New("oauth-service unavailable")
+}
+
+// 从请求头到endpoint中间件的完整鉴权过程
+func TestAuthorityMiddleware(t *testing.T) {
+	tokens := staticVerifier{
+		"admin": {IsValidToken: true, ClientDetails: &pb.ClientDetails{ClientId: "app"},
+			UserDetails: &pb.UserDetails{UserId: 1, Authorities: []string{RoleUser, RoleAdmin}}},
+		"user": {IsValidToken: true, ClientDetails: &pb.ClientDetails{ClientId: "app", Scope: []string{"order.read"}},
+			UserDetails: &pb.UserDetails{UserId: 2, Authorities: []string{RoleUser}}},
+		"report": {IsValidToken: true, ClientOnly: true,
+			ClientDetails: &pb.ClientDetails{ClientId: "report", Scope: []string{"order.read"}}},
+		"scope-as-role": {IsValidToken: true, ClientOnly: true,
+			ClientDetails: &pb.ClientDetails{ClientId: "app", Scope: []string{RoleAdmin}}},
+		"expired": {IsValidToken: false, Err: "token is expired"},
+	}
+	adminOnly := MakeAuthorityMiddleware(RoleAdmin)
+	adminOrScope := MakeAuthorityOrScopeMiddleware(RoleAdmin, "order.read")
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantAdmin     error
+		wantOrScope   error
+		wantUserId    int64
+	}{
+		{"管理员", "Bearer admin", nil, nil, 1},
+		{"普通用户", "Bearer user", ErrNotPermit, ErrNotPermit, 2},
+		{"具有scope的客户端令牌", "Bearer report", ErrNotPermit, nil, 0},
+		{"客户端scope不能代替角色", "Bearer scope-as-role", ErrNotPermit, ErrNotPermit, 0},
+		{"令牌过期", "Bearer expired", ErrUnauthorized, ErrUnauthorized, 0},
+		{"校验失败", "Bearer unknown", ErrUnauthorized, ErrUnauthorized, 0},
+		{"没有令牌", "", ErrUnauthorized, ErrUnauthorized, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/product/list", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			ctx := HttpTokenContext(tokens)(context.Background(), r)
+			if got := UserIdFromContext(ctx); got != tt.wantUserId {
+				t.Errorf("UserIdFromContext() = %d, want %d", got, tt.wantUserId)
+			}
+
+			var gotUserId int64
+			next := func(ctx context.Context, request interface{}) (interface{}, error) {
+				gotUserId = UserIdFromContext(ctx)
+				return "ok", nil
+			}
+			if _, err := adminOnly(next)(ctx, nil); err != tt.wantAdmin {
+				t.Errorf("MakeAuthorityMiddleware() error = %v, want %v", err, tt.wantAdmin)
+			}
+			if resp, err := adminOrScope(next)(ctx, nil); err != tt.wantOrScope || (err == nil && resp != "ok") {
+				t.Errorf("MakeAuthorityOrScopeMiddleware() = %v, %v, want %v", resp, err, tt.wantOrScope)
+			}
+			if tt.wantAdmin == nil && gotUserId != tt.wantUserId {
+				t.Errorf("next got user %d, want %d", gotUserId, tt.wantUserId)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package verifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// 被吊销令牌在redis中的key前缀
+	denyListPrefix = "token:deny:"
+)
+
+// 令牌标识，使用令牌的sha256摘要，避免在redis和缓存中保存完整令牌
+func TokenId(tokenValue string) string {
+	sum := sha256.Sum256([]byte(tokenValue))
+	return hex.EncodeToString(sum[:])
+}
+
+// 将令牌加入黑名单，令牌过期后黑名单记录自动删除
+func Deny(conn *redis.Client, tokenValue string, expiresTime time.Time) error {
+	ttl := time.Until(expiresTime)
+	if ttl <= 0 {
+		return nil // 令牌已过期，无需吊销
+	}
+	return conn.Set(denyListPrefix+TokenId(tokenValue), 1, ttl).Err()
+}
+
+// 判断令牌是否已被吊销
+func IsDenied(conn *redis.Client, tokenValue string) (bool, error) {
+	n, err := conn.Exists(denyListPrefix + TokenId(tokenValue)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,310 @@
+package verifier
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"final-design/pkg/discover"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound        = errors.New("verification key not found")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+	ErrAlgMismatch        = errors.New("signing method does not match the key")
+)
+
+// JWKS格式的密钥，字段含义见RFC 7517、RFC 7518
+type JsonWebKey struct {
+	Kty string `json:"kty"`           // 密钥类型：oct、RSA、EC
+	Kid string `json:"kid,omitempty"` // 密钥标识
+	Alg string `json:"alg,omitempty"` // 签名算法
+	Use string `json:"use,omitempty"` // 用途
+	K   string `json:"k,omitempty"`   // 对称密钥
+	N   string `json:"n,omitempty"`   // RSA模数
+	E   string `json:"e,omitempty"`   // RSA指数
+	Crv string `json:"crv,omitempty"` // EC曲线
+	X   string `json:"x,omitempty"`   // EC坐标x
+	Y   string `json:"y,omitempty"`   // EC坐标y
+}
+
+// JWKS格式的密钥集合
+type KeySet struct {
+	Keys []JsonWebKey `json:"keys"`
+}
+
+// 只包含公钥的密钥集合，可以公开发布
+func (keySet *KeySet) PublicKeys() *KeySet {
+	keys := make([]JsonWebKey, 0, len(keySet.Keys))
+	for _, v := range keySet.Keys {
+		if v.Kty != "oct" {
+			keys = append(keys, v)
+		}
+	}
+	return &KeySet{Keys: keys}
+}
+
+// 根据公钥生成JWKS格式的密钥，publicKey为[]byte时生成对称密钥
+func NewJsonWebKey(kid string, alg string, publicKey interface{}) (JsonWebKey, error) {
+	key := JsonWebKey{Kid: kid, Alg: alg, Use: "sig"}
+	switch k := publicKey.(type) {
+	case []byte:
+		key.Kty = "oct"
+		key.K = base64.RawURLEncoding.EncodeToString(k)
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		key.Kty = "EC"
+		key.Crv = k.Curve.Params().Name
+		key.X = base64.RawURLEncoding.EncodeToString(padBytes(k.X.Bytes(), size))
+		key.Y = base64.RawURLEncoding.EncodeToString(padBytes(k.Y.Bytes(), size))
+	default:
+		return key, ErrUnsupportedKeyType
+	}
+	return key, nil
+}
+
+// 转换为jwt校验时使用的密钥
+func (key *JsonWebKey) VerificationKey() (interface{}, error) {
+	switch key.Kty {
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(key.K)
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedKeyType
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+}
+
+// EC坐标按曲线长度左侧补零
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// 校验密钥和它只能用于的签名算法
+type verificationKey struct {
+	alg string
+	key interface{}
+}
+
+const (
+	minFetchInterval = time.Second // 两次拉取的最小间隔，找不到kid时也不会频繁拉取
+	maxFetchBackoff  = time.Minute // 拉取连续失败时的最长退避时间
+)
+
+// 从oauth-service获取校验密钥并缓存，按kid查找；
+// 拉取在锁外进行，同一时间只有一个拉取，拉取期间和拉取失败后继续使用旧密钥
+type keyStore struct {
+	lock            sync.RWMutex
+	keys            map[string]verificationKey // kid -> 校验密钥
+	fetchedAt       time.Time                  // 最近一次拉取成功的时间
+	nextFetch       time.Time                  // 下一次允许拉取的时间，失败后按次数退避
+	failures        int                        // 连续拉取失败的次数
+	lastErr         error                      // 最近一次拉取失败的原因
+	fetching        chan struct{}              // 正在拉取时不为nil，拉取结束后关闭
+	refreshInterval time.Duration
+	fetch           func() (*KeySet, error)
+}
+
+func newKeyStore(refreshInterval time.Duration, fetch func() (*KeySet, error)) *keyStore {
+	return &keyStore{
+		keys:            make(map[string]verificationKey),
+		refreshInterval: refreshInterval,
+		fetch:           fetch,
+	}
+}
+
+// 根据kid获取校验密钥，令牌头中的alg必须与密钥发布时的alg一致；
+// 密钥过期时在后台拉取并继续使用旧密钥，找不到kid时等待正在进行的拉取，退避期间直接返回
+func (s *keyStore) Key(kid string, alg string) (interface{}, error) {
+	s.lock.RLock()
+	key, ok := s.keys[kid]
+	stale := time.Since(s.fetchedAt) > s.refreshInterval
+	s.lock.RUnlock()
+	if ok {
+		if stale {
+			s.refresh()
+		}
+		return key.match(alg)
+	}
+
+	done := s.refresh()
+	if done == nil {
+		return nil, s.notFound()
+	}
+	<-done
+	s.lock.RLock()
+	key, ok = s.keys[kid]
+	s.lock.RUnlock()
+	if !ok {
+		return nil, s.notFound()
+	}
+	return key.match(alg)
+}
+
+func (key verificationKey) match(alg string) (interface{}, error) {
+	if alg != key.alg {
+		return nil, ErrAlgMismatch
+	}
+	return key.key, nil
+}
+
+// 找不到kid时，最近一次拉取失败则返回失败原因
+func (s *keyStore) notFound() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.lastErr != nil {
+		return s.lastErr
+	}
+	return ErrKeyNotFound
+}
+
+// 开始在后台拉取密钥，返回拉取结束时关闭的channel，已经在拉取时返回同一个channel；
+// 距离上次拉取不到minFetchInterval或处于失败退避期间时不拉取，返回nil
+func (s *keyStore) refresh() <-chan struct{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fetching != nil {
+		return s.fetching
+	}
+	if time.Now().Before(s.nextFetch) {
+		return nil
+	}
+	done := make(chan struct{})
+	s.fetching = done
+	go s.doFetch(done)
+	return done
+}
+
+func (s *keyStore) doFetch(done chan struct{}) {
+	keys, err := s.fetchKeys()
+
+	s.lock.Lock()
+	now := time.Now()
+	if err != nil {
+		// 失败后的退避时间从minFetchInterval开始逐次翻倍，最长maxFetchBackoff
+		backoff := maxFetchBackoff
+		if s.failures < 6 {
+			backoff = minFetchInterval << s.failures
+		}
+		s.failures++
+		s.lastErr = err
+		s.nextFetch = now.Add(backoff)
+		log.Printf("refresh verification keys failed, retry after %v, err: %v", backoff, err)
+	} else {
+		s.keys = keys
+		s.fetchedAt = now
+		s.failures = 0
+		s.lastErr = nil
+		s.nextFetch = now.Add(minFetchInterval)
+	}
+	s.fetching = nil
+	s.lock.Unlock()
+	close(done)
+}
+
+func (s *keyStore) fetchKeys() (map[string]verificationKey, error) {
+	keySet, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]verificationKey, len(keySet.Keys))
+	for _, v := range keySet.Keys {
+		// 没有alg的密钥无法确定允许的签名算法，不使用
+		if v.Alg == "" {
+			log.Printf("skip verification key [%s], err: missing alg", v.Kid)
+			continue
+		}
+		key, err := v.VerificationKey()
+		if err != nil {
+			log.Printf("skip verification key [%s], err: %v", v.Kid, err)
+			continue
+		}
+		keys[v.Kid] = verificationKey{alg: v.Alg, key: key}
+	}
+	return keys, nil
+}
+
+// 通过consul找到oauth-service，使用客户端凭证拉取密钥
+func fetchTokenKey(serviceName, path, clientId, clientSecret string) func() (*KeySet, error) {
+	httpClient := &http.Client{Timeout: time.Second * 3}
+	return func() (*KeySet, error) {
+		instance, err := discover.DiscoverService(serviceName)
+		if err != nil {
+			return nil, err
+		}
+		url := fmt.Sprintf("http://%s:%d%s", instance.Host, instance.Port, path)
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if clientId != "" {
+			req.SetBasicAuth(clientId, clientSecret)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch %s failed, status: %d", url, resp.StatusCode)
+		}
+		var keySet KeySet
+		if err = json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+			return nil, err
+		}
+		return &keySet, nil
+	}
+}
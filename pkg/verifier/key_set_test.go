@@ -0,0 +1,176 @@
+package verifier
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 可以控制返回结果和阻塞的密钥拉取
+type fakeKeySource struct {
+	calls   int32
+	release chan struct{} // 不为nil时拉取阻塞到关闭
+	err     error
+	keys    []JsonWebKey
+}
+
+func (f *fakeKeySource) fetch() (*KeySet, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.release != nil {
+		<-f.release
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &KeySet{Keys: f.keys}, nil
+}
+
+func hsKey(t *testing.T, kid string) JsonWebKey {
+	key, err := NewJsonWebKey(kid, "HS256", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// 并发查找不存在的kid时只拉取一次，所有请求共用拉取结果
+func TestKeyStoreSingleFetch(t *testing.T) {
+	source := &fakeKeySource{release: make(chan struct{}), keys: []JsonWebKey{hsKey(t, "hs")}}
+	store := newKeyStore(time.Minute, source.fetch)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Key("hs", "HS256")
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(source.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Key() error = %v", err)
+		}
+	}
+	if calls := atomic.LoadInt32(&source.calls); calls != 1 {
+		t.Errorf("fetch called %d times, want 1", calls)
+	}
+}
+
+// 密钥过期时不等待拉取，继续使用旧密钥
+func TestKeyStoreStaleKeyDoesNotBlock(t *testing.T) {
+	source := &fakeKeySource{keys: []JsonWebKey{hsKey(t, "hs")}}
+	store := newKeyStore(time.Minute, source.fetch)
+	if _, err := store.Key("hs", "HS256"); err != nil {
+		t.Fatal(err)
+	}
+
+	source.release = make(chan struct{})
+	defer close(source.release)
+	store.lock.Lock()
+	store.fetchedAt = time.Now().Add(-2 * time.Minute)
+	store.nextFetch = time.Time{}
+	store.lock.Unlock()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := store.Key("hs", "HS256"); err != nil {
+			t.Fatalf("Key() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Key() waited %v for the refresh", elapsed)
+	}
+	// 后台只有一个拉取
+	time.Sleep(20 * time.Millisecond)
+	if calls := atomic.LoadInt32(&source.calls); calls != 2 {
+		t.Errorf("fetch called %d times, want 2", calls)
+	}
+}
+
+// 拉取失败后在退避期间不再拉取，直接返回失败原因；退避结束后恢复
+func TestKeyStoreFailureBackoff(t *testing.T) {
+	errUnavailable := errors.New("oauth-service unavailable")
+	source := &fakeKeySource{err: errUnavailable, keys: []JsonWebKey{hsKey(t, "hs")}}
+	store := newKeyStore(time.Minute, source.fetch)
+
+	tests := []struct {
+		name      string
+		expire    bool // 结束退避
+		recover   bool
+		wantErr   error
+		wantCalls int32
+		wantDelay time.Duration
+	}{
+		{"第一次失败", false, false, errUnavailable, 1, time.Second},
+		{"退避期间不拉取", false, false, errUnavailable, 1, time.Second},
+		{"再次失败后退避翻倍", true, false, errUnavailable, 2, 2 * time.Second},
+		{"第三次失败", true, false, errUnavailable, 3, 4 * time.Second},
+		{"恢复", true, true, nil, 4, minFetchInterval},
+		{"恢复后使用缓存", false, true, nil, 4, minFetchInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.recover {
+				source.err = nil
+			}
+			if tt.expire {
+				store.lock.Lock()
+				store.nextFetch = time.Now()
+				store.lock.Unlock()
+			}
+			before := time.Now()
+			if _, err := store.Key("hs", "HS256"); err != tt.wantErr {
+				t.Fatalf("Key() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls := atomic.LoadInt32(&source.calls); calls != tt.wantCalls {
+				t.Errorf("fetch called %d times, want %d", calls, tt.wantCalls)
+			}
+			store.lock.RLock()
+			delay := store.nextFetch.Sub(before)
+			store.lock.RUnlock()
+			if tt.wantCalls > 0 && (delay < tt.wantDelay-time.Second || delay > tt.wantDelay+100*time.Millisecond) {
+				t.Errorf("next fetch after %v, want about %v", delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+// 拉取失败时已有的密钥继续可用，不存在的kid不等待
+func TestKeyStoreServeOldKeysOnFailure(t *testing.T) {
+	source := &fakeKeySource{keys: []JsonWebKey{hsKey(t, "hs")}}
+	store := newKeyStore(time.Minute, source.fetch)
+	if _, err := store.Key("hs", "HS256"); err != nil {
+		t.Fatal(err)
+	}
+	source.err = errors.New("oauth-service unavailable")
+	store.lock.Lock()
+	store.fetchedAt = time.Now().Add(-2 * time.Minute)
+	store.nextFetch = time.Time{}
+	store.lock.Unlock()
+
+	tests := []struct {
+		name    string
+		kid     string
+		alg     string
+		wantErr bool
+	}{
+		{"旧密钥", "hs", "HS256", false},
+		{"算法不一致", "hs", "HS384", true},
+		{"不存在的kid", "unknown", "HS256", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Key(tt.kid, tt.alg); (err != nil) != tt.wantErr {
+				t.Errorf("Key() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// oauth-service签发的令牌在redis中的记录，user-service等服务通过共用的redis吊销令牌
+const (
+	AccessTokenPrefix    = "oauth:access:"       // 访问令牌id -> 访问令牌记录
+	RefreshTokenPrefix   = "oauth:refresh:"      // 刷新令牌id -> 刷新令牌记录
+	UsedRefreshPrefix    = "oauth:refresh_used:" // 已使用的刷新令牌id，用于检测重用
+	AuthenticationPrefix = "oauth:auth:"         // clientId:userId(只代表客户端的令牌为clientId) -> 当前访问令牌
+	AuthRefreshPrefix    = "oauth:auth_refresh:" // clientId:userId -> 刷新令牌id集合
+	UserAuthPrefix       = "oauth:user_auth:"    // userId -> 该用户在各客户端的clientId:userId集合，用于吊销用户的全部令牌
+)
+
+var ErrRevokedToken = errors.New("token is revoked")
+
+// redis中保存的令牌记录，令牌本身仍是jwt，记录只用于判断令牌是否已被吊销
+type TokenRecord struct {
+	RefreshToken string    `json:"refresh_token,omitempty"` // 访问令牌对应的刷新令牌
+	AuthKey      string    `json:"auth_key"`                // 所属客户端和用户
+	ExpiresTime  time.Time `json:"expires_time"`
+}
+
+// 读取令牌记录，记录不存在时返回ErrRevokedToken
+func ReadTokenRecord(conn *redis.Client, prefix string, tokenValue string) (*TokenRecord, error) {
+	data, err := conn.Get(prefix + TokenId(tokenValue)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrRevokedToken
+	} else if err != nil {
+		return nil, err
+	}
+	var record TokenRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// 移除访问令牌记录，并加入黑名单，使网关等本地校验令牌的服务同样拒绝该令牌
+func RemoveAccessToken(conn *redis.Client, tokenValue string) {
+	record, err := ReadTokenRecord(conn, AccessTokenPrefix, tokenValue)
+	if err != nil {
+		return
+	}
+	conn.Del(AccessTokenPrefix + TokenId(tokenValue))
+	// 只有当前访问令牌仍是该令牌时才删除，避免误删新签发的令牌
+	if current, err := conn.Get(AuthenticationPrefix + record.AuthKey).Result(); err == nil && current == tokenValue {
+		conn.Del(AuthenticationPrefix + record.AuthKey)
+	}
+	if err := Deny(conn, tokenValue, record.ExpiresTime); err != nil {
+		log.Printf("Deny access token failed, Error: %v", err)
+	}
+}
+
+// 吊销同一客户端和用户下的访问令牌和全部刷新令牌
+func RevokeAuthentication(conn *redis.Client, authKey string) {
+	if tokenValue, err := conn.Get(AuthenticationPrefix + authKey).Result(); err == nil {
+		RemoveAccessToken(conn, tokenValue)
+	}
+	tokenIds, err := conn.SMembers(AuthRefreshPrefix + authKey).Result()
+	if err != nil {
+		log.Printf("RevokeAuthentication failed, Error: %v", err)
+		return
+	}
+	keys := make([]string, 0, len(tokenIds)+1)
+	for _, tokenId := range tokenIds {
+		keys = append(keys, RefreshTokenPrefix+tokenId)
+	}
+	keys = append(keys, AuthRefreshPrefix+authKey)
+	conn.Del(keys...)
+}
+
+// 吊销用户在所有客户端下的访问令牌和刷新令牌，user-service在修改密码、禁用、删除账号后调用；
+// 访问令牌同时加入黑名单，本地校验令牌的服务也会拒绝
+func RevokeUserTokens(conn *redis.Client, userId int64) error {
+	key := UserAuthPrefix + strconv.FormatInt(userId, 10)
+	authKeys, err := conn.SMembers(key).Result()
+	if err != nil {
+		return err
+	}
+	for _, authKey := range authKeys {
+		RevokeAuthentication(conn, authKey)
+	}
+	return conn.Del(key).Err()
+}
@@ -0,0 +1,63 @@
+package verifier
+
+import (
+	"encoding/json"
+	"final-design/pkg/redistest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 按oauth-service的布局写入一个客户端和用户下的访问令牌和刷新令牌
+func storeTestTokens(t *testing.T, conn *redis.Client, userId, authKey, accessToken, refreshToken string) {
+	t.Helper()
+	expires := time.Now().Add(time.Hour)
+	access, _ := json.Marshal(TokenRecord{RefreshToken: refreshToken, AuthKey: authKey, ExpiresTime: expires})
+	refresh, _ := json.Marshal(TokenRecord{AuthKey: authKey, ExpiresTime: expires})
+	pipe := conn.TxPipeline()
+	pipe.Set(AccessTokenPrefix+TokenId(accessToken), access, time.Hour)
+	pipe.Set(AuthenticationPrefix+authKey, accessToken, time.Hour)
+	pipe.Set(RefreshTokenPrefix+TokenId(refreshToken), refresh, time.Hour)
+	pipe.SAdd(AuthRefreshPrefix+authKey, TokenId(refreshToken))
+	pipe.SAdd(UserAuthPrefix+userId, authKey)
+	if _, err := pipe.Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	conn, _ := redistest.New(t)
+	storeTestTokens(t, conn, "1", "web:1", "access-web", "refresh-web")
+	storeTestTokens(t, conn, "1", "app:1", "access-app", "refresh-app")
+	storeTestTokens(t, conn, "2", "web:2", "access-other", "refresh-other")
+
+	if err := RevokeUserTokens(conn, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"access-web", "access-app"} {
+		if _, err := ReadTokenRecord(conn, AccessTokenPrefix, token); err != ErrRevokedToken {
+			t.Errorf("%s record err = %v, want %v", token, err, ErrRevokedToken)
+		}
+		if denied, _ := IsDenied(conn, token); !denied {
+			t.Errorf("%s is not in the deny list", token)
+		}
+	}
+	for _, token := range []string{"refresh-web", "refresh-app"} {
+		if _, err := ReadTokenRecord(conn, RefreshTokenPrefix, token); err != ErrRevokedToken {
+			t.Errorf("%s record err = %v, want %v", token, err, ErrRevokedToken)
+		}
+	}
+	if n, _ := conn.Exists(UserAuthPrefix+"1", AuthRefreshPrefix+"web:1", AuthenticationPrefix+"app:1").Result(); n != 0 {
+		t.Errorf("%d index keys of user 1 remain", n)
+	}
+
+	// 其它用户的令牌不受影响
+	if _, err := ReadTokenRecord(conn, AccessTokenPrefix, "access-other"); err != nil {
+		t.Errorf("other user's access token err = %v", err)
+	}
+	if denied, _ := IsDenied(conn, "access-other"); denied {
+		t.Errorf("other user's access token is denied")
+	}
+}
@@ -0,0 +1,201 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"final-design/pb"
+	"final-design/pkg/client"
+	conf "final-design/pkg/config"
+	"log"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+var (
+	ErrTokenRevoked = errors.New("token is revoked")
+)
+
+// 令牌校验
+type TokenVerifier interface {
+	// 校验令牌，令牌无效时返回IsValidToken为false的结果，err只表示校验过程出错
+	Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error)
+}
+
+// 根据conf.Jwt创建令牌校验器：
+// 开启本地校验时使用oauth-service发布的密钥在本地校验，否则调用oauth-service的CheckToken；
+// 配置了客户端时从/oauth/token_key拉取密钥(包含对称密钥)，否则从/.well-known/jwks.json拉取公钥；
+// 校验结果最多缓存conf.Jwt.CacheTtl秒，每次校验先查询redis黑名单
+func NewTokenVerifier() TokenVerifier {
+	var next TokenVerifier
+	if conf.Jwt.LocalVerify {
+		refreshInterval := time.Duration(conf.Jwt.KeyRefreshInterval) * time.Second
+		if refreshInterval <= 0 {
+			refreshInterval = time.Minute * 5
+		}
+		keyPath := "/.well-known/jwks.json"
+		if conf.Jwt.ClientId != "" {
+			keyPath = "/oauth/token_key"
+		}
+		next = NewLocalVerifier(newKeyStore(refreshInterval,
+			fetchTokenKey("oauth", keyPath, conf.Jwt.ClientId, conf.Jwt.ClientSecret)))
+	} else {
+		next = NewRemoteVerifier()
+	}
+	if conf.Redis.RedisConn == nil {
+		log.Printf("redis is not initialized, revoked tokens will not be checked")
+	}
+	return NewCachedVerifier(next, conf.Jwt.CacheSize, time.Duration(conf.Jwt.CacheTtl)*time.Second)
+}
+
+// ==============================================远程校验=======================================================
+
+type remoteVerifier struct {
+	oauthClient client.OAuthClient
+}
+
+// 调用oauth-service的CheckToken校验令牌
+func NewRemoteVerifier() TokenVerifier {
+	oauthClient, _ := client.NewOAuthClient("oauth", nil, nil)
+	return &remoteVerifier{
+		oauthClient: oauthClient,
+	}
+}
+
+func (v *remoteVerifier) Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error) {
+	return v.oauthClient.CheckToken(ctx, nil, &pb.CheckTokenRequest{
+		Token: tokenValue,
+	})
+}
+
+// ==============================================本地校验=======================================================
+
+// 与oauth-service签发令牌时的claims保持一致，只解析需要的字段
+type tokenClaims struct {
+	UserDetails *struct { // client_credentials签发的令牌为nil
+		UserId      int64
+		Username    string
+		Authorities []string
+	}
+	ClientDetails struct {
+		ClientId                    string
+		AccessTokenValiditySeconds  int
+		RefreshTokenValiditySeconds int
+		AuthorizedGrantTypes        []string
+		Scope                       []string
+	}
+	jwt.StandardClaims
+}
+
+type localVerifier struct {
+	keys *keyStore
+}
+
+func NewLocalVerifier(keys *keyStore) TokenVerifier {
+	return &localVerifier{
+		keys: keys,
+	}
+}
+
+func (v *localVerifier) Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error) {
+	token, err := jwt.ParseWithClaims(tokenValue, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		// 签名算法固定为密钥发布时的alg，不接受令牌头中指定的其它算法
+		return v.keys.Key(kid, token.Method.Alg())
+	})
+	if err != nil {
+		return &pb.CheckTokenResponse{IsValidToken: false, Err: err.Error()}, nil
+	}
+	claims := token.Claims.(*tokenClaims)
+	resp := &pb.CheckTokenResponse{
+		ClientDetails: &pb.ClientDetails{
+			ClientId:                    claims.ClientDetails.ClientId,
+			AccessTokenValiditySeconds:  int32(claims.ClientDetails.AccessTokenValiditySeconds),
+			RefreshTokenValiditySeconds: int32(claims.ClientDetails.RefreshTokenValiditySeconds),
+			AuthorizedGrantTypes:        claims.ClientDetails.AuthorizedGrantTypes,
+			Scope:                       claims.ClientDetails.Scope,
+		},
+		IsValidToken: true,
+		IssuedAt:     claims.IssuedAt,
+		ClientOnly:   claims.UserDetails == nil,
+	}
+	if claims.UserDetails != nil {
+		resp.UserDetails = &pb.UserDetails{
+			UserId:      claims.UserDetails.UserId,
+			Username:    claims.UserDetails.Username,
+			Authorities: claims.UserDetails.Authorities,
+		}
+	}
+	return resp, nil
+}
+
+// ==============================================缓存校验结果=======================================================
+
+type cacheEntry struct {
+	resp     *pb.CheckTokenResponse
+	expireAt time.Time
+}
+
+type cachedVerifier struct {
+	next  TokenVerifier
+	cache *lru.Cache
+	ttl   time.Duration
+}
+
+// 缓存校验结果，缓存时间不超过ttl和令牌的过期时间；每次校验先查询黑名单，被吊销的令牌立即失效
+func NewCachedVerifier(next TokenVerifier, size int, ttl time.Duration) TokenVerifier {
+	if size <= 0 || ttl <= 0 {
+		return &cachedVerifier{next: next}
+	}
+	cache, _ := lru.New(size)
+	return &cachedVerifier{
+		next:  next,
+		cache: cache,
+		ttl:   ttl,
+	}
+}
+
+func (v *cachedVerifier) Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error) {
+	tokenId := TokenId(tokenValue)
+	if conn := conf.Redis.RedisConn; conn != nil {
+		denied, err := IsDenied(conn, tokenValue)
+		if err != nil {
+			return nil, err
+		}
+		if denied {
+			if v.cache != nil {
+				v.cache.Remove(tokenId)
+			}
+			return &pb.CheckTokenResponse{IsValidToken: false, Err: ErrTokenRevoked.Error()}, nil
+		}
+	}
+
+	if v.cache != nil {
+		if entry, ok := v.cache.Get(tokenId); ok && time.Now().Before(entry.(*cacheEntry).expireAt) {
+			return entry.(*cacheEntry).resp, nil
+		}
+	}
+
+	resp, err := v.next.Verify(ctx, tokenValue)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	// 只缓存有效的结果，令牌过期后不能再命中缓存
+	if v.cache != nil && resp.IsValidToken {
+		v.cache.Add(tokenId, &cacheEntry{resp: resp, expireAt: cacheExpireAt(tokenValue, time.Now().Add(v.ttl))})
+	}
+	return resp, nil
+}
+
+// 缓存到期时间取expireAt和令牌exp中较早的一个；令牌已经校验通过，这里只读取exp，不再校验签名
+func cacheExpireAt(tokenValue string, expireAt time.Time) time.Time {
+	claims := &jwt.StandardClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenValue, claims); err != nil || claims.ExpiresAt == 0 {
+		return expireAt
+	}
+	if exp := time.Unix(claims.ExpiresAt, 0); exp.Before(expireAt) {
+		return exp
+	}
+	return expireAt
+}
@@ -0,0 +1,191 @@
+package verifier
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"final-design/pb"
+	conf "final-design/pkg/config"
+	"final-design/pkg/redistest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var testSecret = []byte("test-secret")
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, expiresAt time.Time, withUser bool) string {
+	claims := &tokenClaims{StandardClaims: jwt.StandardClaims{ExpiresAt: expiresAt.Unix(), IssuedAt: time.Now().Unix()}}
+	claims.ClientDetails.ClientId = "app"
+	claims.ClientDetails.Scope = []string{"order.read"}
+	if withUser {
+		claims.UserDetails = &struct {
+			UserId      int64
+			Username    string
+			Authorities []string
+		}{UserId: 1, Username: "aoho", Authorities: []string{"ROLE_USER"}}
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	tokenValue, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return tokenValue
+}
+
+func TestLocalVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsKey, _ := NewJsonWebKey("hs", "HS256", testSecret)
+	rsKey, _ := NewJsonWebKey("rs", "RS256", &rsaKey.PublicKey)
+	noAlgKey, _ := NewJsonWebKey("no-alg", "", testSecret)
+	keys := newKeyStore(time.Minute, func() (*KeySet, error) {
+		return &KeySet{Keys: []JsonWebKey{hsKey, rsKey, noAlgKey}}, nil
+	})
+	// 用RSA公钥作为HMAC密钥伪造的令牌
+	publicKeyAsSecret := []byte(rsKey.N)
+	verifier := NewLocalVerifier(keys)
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		token      string
+		valid      bool
+		clientOnly bool
+	}{
+		{"HS256", signToken(t, jwt.SigningMethodHS256, "hs", testSecret, expiresAt, true), true, false},
+		{"RS256", signToken(t, jwt.SigningMethodRS256, "rs", rsaKey, expiresAt, true), true, false},
+		{"客户端令牌", signToken(t, jwt.SigningMethodRS256, "rs", rsaKey, expiresAt, false), true, true},
+		{"已过期", signToken(t, jwt.SigningMethodRS256, "rs", rsaKey, time.Now().Add(-time.Minute), true), false, false},
+		{"签名错误", signToken(t, jwt.SigningMethodHS256, "hs", []byte("other"), expiresAt, true), false, false},
+		{"kid不存在", signToken(t, jwt.SigningMethodHS256, "unknown", testSecret, expiresAt, true), false, false},
+		{"算法与密钥不一致", signToken(t, jwt.SigningMethodHS256, "rs", publicKeyAsSecret, expiresAt, true), false, false},
+		{"HS384冒充HS256", signToken(t, jwt.SigningMethodHS384, "hs", testSecret, expiresAt, true), false, false},
+		{"密钥没有alg", signToken(t, jwt.SigningMethodHS256, "no-alg", testSecret, expiresAt, true), false, false},
+		{"格式错误", "not-a-jwt", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := verifier.Verify(context.Background(), tt.token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if resp.IsValidToken != tt.valid {
+				t.Fatalf("Verify() IsValidToken = %v, want %v, err: %s", resp.IsValidToken, tt.valid, resp.Err)
+			}
+			if !tt.valid {
+				return
+			}
+			if resp.ClientOnly != tt.clientOnly || (resp.UserDetails == nil) != tt.clientOnly {
+				t.Errorf("Verify() ClientOnly = %v, UserDetails = %v", resp.ClientOnly, resp.UserDetails)
+			}
+			if resp.ClientDetails.ClientId != "app" || len(resp.ClientDetails.Scope) != 1 {
+				t.Errorf("Verify() ClientDetails = %v", resp.ClientDetails)
+			}
+		})
+	}
+}
+
+func TestCacheExpireAt(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	ttlExpire := now.Add(5 * time.Second)
+	tests := []struct {
+		name  string
+		token string
+		want  time.Time
+	}{
+		{"令牌先过期", signToken(t, jwt.SigningMethodHS256, "hs", testSecret, now.Add(2*time.Second), true), now.Add(2 * time.Second)},
+		{"缓存先到期", signToken(t, jwt.SigningMethodHS256, "hs", testSecret, now.Add(time.Hour), true), ttlExpire},
+		{"无法解析", "not-a-jwt", ttlExpire},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheExpireAt(tt.token, ttlExpire); !got.Equal(tt.want) {
+				t.Errorf("cacheExpireAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 记录调用次数的校验器
+type countingVerifier struct {
+	calls int
+	valid bool
+}
+
+func (v *countingVerifier) Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error) {
+	v.calls++
+	return &pb.CheckTokenResponse{IsValidToken: v.valid}, nil
+}
+
+func TestCachedVerifier(t *testing.T) {
+	longLived := signToken(t, jwt.SigningMethodHS256, "hs", testSecret, time.Now().Add(time.Hour), true)
+	shortLived := signToken(t, jwt.SigningMethodHS256, "hs", testSecret, time.Now().Add(time.Second), true)
+
+	tests := []struct {
+		name      string
+		token     string
+		valid     bool
+		wait      time.Duration
+		wantCalls int
+	}{
+		{"有效结果命中缓存", longLived, true, 0, 1},
+		{"无效结果不缓存", longLived, false, 0, 2},
+		{"令牌过期后不再命中缓存", shortLived, true, 1100 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &countingVerifier{valid: tt.valid}
+			verifier := NewCachedVerifier(next, 10, time.Minute)
+			verifier.Verify(context.Background(), tt.token)
+			time.Sleep(tt.wait)
+			verifier.Verify(context.Background(), tt.token)
+			if next.calls != tt.wantCalls {
+				t.Errorf("next called %d times, want %d", next.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// 吊销后缓存中的结果立即失效，需要redis，地址通过REDIS_ADDR指定
+func TestCachedVerifierDenyBeforeCache(t *testing.T) {
+	conn, _ := redistest.New(t)
+	old := conf.Redis.RedisConn
+	conf.Redis.RedisConn = conn
+	defer func() { conf.Redis.RedisConn = old }()
+
+	expiresAt := time.Now().Add(time.Minute)
+	tokenValue := signToken(t, jwt.SigningMethodHS256, "hs", testSecret, expiresAt, true)
+	defer conn.Del(denyListPrefix + TokenId(tokenValue))
+
+	next := &countingVerifier{valid: true}
+	verifier := NewCachedVerifier(next, 10, time.Minute)
+	tests := []struct {
+		name  string
+		deny  bool
+		valid bool
+	}{
+		{"未吊销", false, true},
+		{"吊销后", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.deny {
+				if err := Deny(conn, tokenValue, expiresAt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			resp, err := verifier.Verify(context.Background(), tokenValue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IsValidToken != tt.valid {
+				t.Errorf("Verify() IsValidToken = %v, want %v", resp.IsValidToken, tt.valid)
+			}
+		})
+	}
+}
@@ -33,12 +33,15 @@ func init() {
 	if err := conf.LoadRemoteConfig(); err != nil {
 		Logger.Log("Fail to load remote config", err)
 	}
-	if err := conf.Sub("mysql", &conf.MysqlConfig); err != nil {
-		Logger.Log("Fail to parse mysql", err)
-	}
+	conf.MustSub("mysql", &conf.MysqlConfig)
 	if err := conf.Sub("trace", &conf.TraceConfig); err != nil {
 		Logger.Log("Fail to parse trace", err)
 	}
+	conf.MustSub("redis", &conf.Redis)
+	conf.MustSub("zookeeper", &conf.Zk)
+	if err := conf.Sub("jwt", &conf.Jwt); err != nil {
+		Logger.Log("Fail to parse jwt", err)
+	}
 
 	zipkinUrl := "http://" + conf.TraceConfig.Host + ":" + conf.TraceConfig.Port + conf.TraceConfig.Url
 	Logger.Log("zipkin url", zipkinUrl)
@@ -3,6 +3,7 @@ package endpoint
 import (
 	"context"
 	"errors"
+	"final-design/pkg/common"
 	"final-design/sk-admin/model"
 	"final-design/sk-admin/service"
 
@@ -25,6 +26,8 @@ type SkAdminEndpoints struct {
 	GetOrderListEndpoint  endpoint.Endpoint
 	GetBuyerOrderEndpoint endpoint.Endpoint
 
+	GetRiskRecordEndpoint endpoint.Endpoint
+
 	HealthCheckEndpoint endpoint.Endpoint
 }
 
@@ -174,6 +177,29 @@ func MakeGetBuyerOrderEndpoint(svc service.OrderService) endpoint.Endpoint {
 	}
 }
 
+// ========================================================风控Endpoint===============================================
+
+type RiskRecordRequest struct {
+	Decision string `json:"decision"` // 按决策结果过滤，为空时不过滤
+	Num      int64  `json:"num"`      // 读取最近的记录数
+}
+
+type RiskRecordResponse struct {
+	Result []*common.RiskRecord `json:"result"`
+	Error  error                `json:"error"`
+}
+
+func MakeGetRiskRecordEndpoint(svc service.RiskService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RiskRecordRequest)
+		recordList, err := svc.GetRiskRecordList(req.Decision, req.Num)
+		if err != nil {
+			return RiskRecordResponse{Result: nil, Error: err}, nil
+		}
+		return RiskRecordResponse{Result: recordList, Error: err}, nil
+	}
+}
+
 // ========================================================健康检查Endpoint===============================================
 
 // HealthRequest 健康检查请求结构
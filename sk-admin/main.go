@@ -4,6 +4,7 @@ import (
 	"final-design/pkg/bootstrap"
 	conf "final-design/pkg/config"
 	"final-design/pkg/mysql"
+	"final-design/pkg/redis"
 	"final-design/sk-admin/setup"
 )
 
@@ -11,5 +12,6 @@ func main() {
 	mysql.InitMysql(conf.MysqlConfig.Host, conf.MysqlConfig.Port, conf.MysqlConfig.User,
 		conf.MysqlConfig.Pwd, conf.MysqlConfig.Db)
 	setup.InitZk()
+	redis.InitRedis()
 	setup.InitSever(bootstrap.HttpConfig.Host, bootstrap.HttpConfig.Port, bootstrap.DiscoverConfig.Host, bootstrap.DiscoverConfig.Port)
 }
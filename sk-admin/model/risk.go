@@ -0,0 +1,37 @@
+package model
+
+import (
+	"encoding/json"
+	"final-design/pkg/common"
+	conf "final-design/pkg/config"
+	"log"
+)
+
+type RiskModel struct{}
+
+func NewRiskModel() *RiskModel {
+	return &RiskModel{}
+}
+
+// 获取最近的评分记录，decision为空时返回所有决策的记录
+func (r *RiskModel) GetRiskRecordList(decision string, num int64) ([]*common.RiskRecord, error) {
+	conn := conf.Redis.RedisConn
+	list, err := conn.LRange(conf.Redis.RiskLogQueue, 0, num-1).Result()
+	if err != nil {
+		log.Printf("GetRiskRecordList, Error: %v", err)
+		return nil, err
+	}
+	records := make([]*common.RiskRecord, 0, len(list))
+	for _, v := range list {
+		var record common.RiskRecord
+		if err := json.Unmarshal([]byte(v), &record); err != nil {
+			log.Printf("json.Unmarshal risk record failed, Error: %v", err)
+			continue
+		}
+		if decision != "" && record.Decision != decision {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
@@ -3,6 +3,7 @@ package plugins
 import (
 	"context"
 	"errors"
+	"final-design/pkg/common"
 	"final-design/sk-admin/model"
 	"final-design/sk-admin/service"
 	"time"
@@ -66,6 +67,12 @@ type orderMetricMiddleware struct {
 	requestLatency metrics.Histogram
 }
 
+type riskMetricMiddleware struct {
+	service.RiskService
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+}
+
 // Metrics 封装监控方法
 func SkAdminMetrics(requestCount metrics.Counter, requestLatency metrics.Histogram) service.ServiceMiddleware {
 	return func(s service.Service) service.Service {
@@ -109,6 +116,16 @@ func OrderMetrics(requestCount metrics.Counter, requestLatency metrics.Histogram
 	}
 }
 
+func RiskMetrics(requestCount metrics.Counter, requestLatency metrics.Histogram) service.RiskServiceMiddleware {
+	return func(next service.RiskService) service.RiskService {
+		return riskMetricMiddleware{
+			RiskService:    next,
+			requestCount:   requestCount,
+			requestLatency: requestLatency,
+		}
+	}
+}
+
 func (mw skAdminMetricMiddleware) HealthCheck() (result bool) {
 	defer func(begin time.Time) {
 		lvs := []string{"method", "HealthCheck"}
@@ -224,3 +241,16 @@ func (mw orderMetricMiddleware) GetOrderList() (map[string]interface{}, error) {
 	result, err := mw.OrderService.GetOrderList()
 	return result, err
 }
+
+// =========================================风控======================================================
+
+func (mw riskMetricMiddleware) GetRiskRecordList(decision string, num int64) ([]*common.RiskRecord, error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "GetRiskRecordList"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	result, err := mw.RiskService.GetRiskRecordList(decision, num)
+	return result, err
+}
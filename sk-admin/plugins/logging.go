@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"final-design/pkg/common"
 	"final-design/sk-admin/model"
 	"final-design/sk-admin/service"
 	"time"
@@ -180,3 +181,29 @@ func (mw orderLoggingMiddleware) GetOrderList() (map[string]interface{}, error)
 	ret, err := mw.OrderService.GetOrderList()
 	return ret, err
 }
+
+// ==============================================实现RiskService接口和中间件=======================================================
+type riskLoggingMiddleware struct {
+	service.RiskService
+	logger log.Logger
+}
+
+func RiskLoggingMiddleware(logger log.Logger) service.RiskServiceMiddleware {
+	return func(next service.RiskService) service.RiskService {
+		return riskLoggingMiddleware{next, logger}
+	}
+}
+
+func (mw riskLoggingMiddleware) GetRiskRecordList(decision string, num int64) ([]*common.RiskRecord, error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "GetRiskRecordList",
+			"decision", decision,
+			"num", num,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	ret, err := mw.RiskService.GetRiskRecordList(decision, num)
+	return ret, err
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"final-design/pkg/cache"
 	"final-design/sk-admin/model"
 	"fmt"
 	"log"
@@ -67,6 +68,7 @@ func (p ActivityServiceImpl) UpdateActivity(activity *model.Activity) error {
 		log.Printf("ActivityModel.UpdateActivity, err: %v", err)
 		return err
 	}
+	defer purgeGatewayCache(cache.TagActivity)
 	log.Println("updateSyncToZK......")
 	err = p.updateSyncToZK(activity) // 更新ZK的数据
 	if err != nil {
@@ -83,6 +85,7 @@ func (p ActivityServiceImpl) DeleteActivity(activity *model.Activity) error {
 		log.Printf("ActivityModel.DeleteActivity, err: %v", err)
 		return err
 	}
+	defer purgeGatewayCache(cache.TagActivity)
 	log.Println("deleteSyncToZK......")
 	err = p.deleteSyncToZK(activity) // 删除ZK的数据
 	if err != nil {
@@ -100,6 +103,7 @@ func (p ActivityServiceImpl) CreateActivity(activity *model.Activity) error {
 		log.Printf("ActivityModel.CreateActivity, err: %v", err)
 		return err
 	}
+	defer purgeGatewayCache(cache.TagActivity)
 
 	log.Println("createSyncToZK......")
 	err = p.createSyncToZK(activity) // 写入到Zk
@@ -110,6 +114,13 @@ func (p ActivityServiceImpl) CreateActivity(activity *model.Activity) error {
 	return nil
 }
 
+// 通知网关清除相关的响应缓存，失败时只记录日志，缓存在ttl后过期
+func purgeGatewayCache(tags ...string) {
+	if err := cache.Publish(conf.Redis.RedisConn, tags...); err != nil {
+		log.Printf("purge gateway cache failed, err: %v", err)
+	}
+}
+
 func (p ActivityServiceImpl) createSyncToZK(activity *model.Activity) error {
 	zkPath := conf.Zk.SecProductKey
 	secProductInfoList, stat, err := p.LoadProductFromZk(zkPath)
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"final-design/pkg/cache"
 	"final-design/sk-admin/model"
 	"log"
 
@@ -25,6 +26,7 @@ func (p ProductServiceImpl) CreateProduct(product *model.Product) error {
 		log.Printf("ProductEntity.CreateProduct, err: %v", err)
 		return err
 	}
+	purgeGatewayCache(cache.TagProduct)
 	return nil
 }
 
@@ -45,6 +47,7 @@ func (p ProductServiceImpl) UpdateProduct(product *model.Product) error {
 		log.Printf("ProductEntity.UpdateProduct, err: %v", err)
 		return err
 	}
+	purgeGatewayCache(cache.TagProduct)
 	return nil
 }
 
@@ -55,5 +58,6 @@ func (p ProductServiceImpl) DeleteProduct(product *model.Product) error {
 		log.Printf("ProductEntity.DeleteProduct, err: %v", err)
 		return err
 	}
+	purgeGatewayCache(cache.TagProduct)
 	return nil
 }
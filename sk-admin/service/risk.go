@@ -0,0 +1,29 @@
+package service
+
+import (
+	"final-design/pkg/common"
+	"final-design/sk-admin/model"
+	"log"
+)
+
+type RiskService interface {
+	GetRiskRecordList(decision string, num int64) ([]*common.RiskRecord, error)
+}
+
+type RiskServiceMiddleware func(RiskService) RiskService
+
+type RiskServiceImpl struct{}
+
+// 从redis中读取sk-app写入的行为评分记录，供人工复核
+func (r RiskServiceImpl) GetRiskRecordList(decision string, num int64) ([]*common.RiskRecord, error) {
+	if num <= 0 {
+		num = 100
+	}
+	riskEntity := model.NewRiskModel()
+	recordList, err := riskEntity.GetRiskRecordList(decision, num)
+	if err != nil {
+		log.Printf("riskEntity.GetRiskRecordList, err: %v", err)
+		return nil, err
+	}
+	return recordList, nil
+}
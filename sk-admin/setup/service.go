@@ -12,12 +12,12 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"final-design/pkg/bootstrap"
 	"final-design/pkg/discover"
+	"final-design/pkg/shutdown"
+	"final-design/pkg/verifier"
 
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	kitzipkin "github.com/go-kit/kit/tracing/zipkin"
@@ -54,6 +54,7 @@ func InitSever(serviceHost, servicePort, consulHost, consulPort string) {
 		productService  service.ProductService  = service.ProductServiceImpl{}
 		skAdminService  service.Service         = service.SkAdminService{}
 		orderService    service.OrderService    = &service.OrderServiceImpl{}
+		riskService     service.RiskService     = service.RiskServiceImpl{}
 	)
 
 	// add logging middleware
@@ -69,48 +70,71 @@ func InitSever(serviceHost, servicePort, consulHost, consulPort string) {
 	orderService = plugins.OrderLoggingMiddleware(config.Logger)(orderService)
 	orderService = plugins.OrderMetrics(requestCount, requestLatency)(orderService)
 
+	riskService = plugins.RiskLoggingMiddleware(config.Logger)(riskService)
+	riskService = plugins.RiskMetrics(requestCount, requestLatency)(riskService)
+
+	// 除健康检查外的接口都需要管理员角色
+	adminAuthority := verifier.MakeAuthorityMiddleware(verifier.RoleAdmin)
+
 	// ==========================================活动endpoint========================================================
 	createActivityEnd := endpoint.MakeCreateActivityEndpoint(activityService)
+	createActivityEnd = adminAuthority(createActivityEnd)
 	createActivityEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(createActivityEnd)
 	createActivityEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "create-activity")(createActivityEnd)
 
 	GetActivityEnd := endpoint.MakeGetActivityEndpoint(activityService)
+	GetActivityEnd = adminAuthority(GetActivityEnd)
 	GetActivityEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(GetActivityEnd)
 	GetActivityEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "get-activity")(GetActivityEnd)
 
 	updateActivityEnd := endpoint.MakeUpdateActivityEndpoint(activityService)
+	updateActivityEnd = adminAuthority(updateActivityEnd)
 	updateActivityEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(updateActivityEnd)
 	updateActivityEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "update-activity")(updateActivityEnd)
 
 	deleteActivityEnd := endpoint.MakeDeleteActivityEndpoint(activityService)
+	deleteActivityEnd = adminAuthority(deleteActivityEnd)
 	deleteActivityEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(deleteActivityEnd)
 	deleteActivityEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "delete-activity")(deleteActivityEnd)
 
 	// ==========================================商品endpoint========================================================
 	createProductEnd := endpoint.MakeCreateProductEndpoint(productService)
+	createProductEnd = adminAuthority(createProductEnd)
 	createProductEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(createProductEnd)
 	createProductEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "create-product")(createProductEnd)
 
 	GetProductEnd := endpoint.MakeGetProductEndpoint(productService)
+	GetProductEnd = adminAuthority(GetProductEnd)
 	GetProductEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(GetProductEnd)
 	GetProductEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "get-product")(GetProductEnd)
 
 	updateProductEnd := endpoint.MakeUpdateProductEndpoint(productService)
+	updateProductEnd = adminAuthority(updateProductEnd)
 	updateProductEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(updateProductEnd)
 	updateProductEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "update-product")(updateProductEnd)
 
 	deleteProductEnd := endpoint.MakeDeleteProductEndpoint(productService)
+	deleteProductEnd = adminAuthority(deleteProductEnd)
 	deleteProductEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(deleteProductEnd)
 	deleteProductEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "delete-product")(deleteProductEnd)
 	// ==========================================订单endpoint========================================================
 	GetOrderEnd := endpoint.MakeGetOrderEndpoint(orderService)
+	// 对账等服务可使用具有order.read的client_credentials令牌读取订单列表
+	GetOrderEnd = verifier.MakeAuthorityOrScopeMiddleware(verifier.RoleAdmin, "order.read")(GetOrderEnd)
 	GetOrderEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(GetOrderEnd)
 	GetOrderEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "get-order")(GetOrderEnd)
 
 	GetBuyerOrderEnd := endpoint.MakeGetBuyerOrderEndpoint(orderService)
+	GetBuyerOrderEnd = adminAuthority(GetBuyerOrderEnd)
 	GetBuyerOrderEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(GetBuyerOrderEnd)
 	GetBuyerOrderEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "get-buyer-order")(GetBuyerOrderEnd)
 
+	// ==========================================风控endpoint========================================================
+	GetRiskRecordEnd := endpoint.MakeGetRiskRecordEndpoint(riskService)
+	GetRiskRecordEnd = adminAuthority(GetRiskRecordEnd)
+	GetRiskRecordEnd = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(GetRiskRecordEnd)
+	GetRiskRecordEnd = kitzipkin.TraceEndpoint(config.ZipkinTracer, "get-risk-record")(GetRiskRecordEnd)
+
 	// 创建健康检查的Endpoint
 	healthEndpoint := endpoint.MakeHealthCheckEndpoint(skAdminService)
 	healthEndpoint = kitzipkin.TraceEndpoint(config.ZipkinTracer, "health-endpoint")(healthEndpoint)
@@ -129,12 +153,14 @@ func InitSever(serviceHost, servicePort, consulHost, consulPort string) {
 		GetOrderListEndpoint:  GetOrderEnd,
 		GetBuyerOrderEndpoint: GetBuyerOrderEnd,
 
+		GetRiskRecordEndpoint: GetRiskRecordEnd,
+
 		HealthCheckEndpoint: healthEndpoint,
 	}
 
 	ctx := context.Background()
 	// 创建http.Handler
-	r := transport.MakeHttpHandler(ctx, endpts, config.ZipkinTracer, config.Logger)
+	r := transport.MakeHttpHandler(ctx, endpts, verifier.NewTokenVerifier(), config.ZipkinTracer, config.Logger)
 
 	var discoveryClient discover.DiscoveryClient = discover.New(consulHost, consulPort)
 	var (
@@ -142,28 +168,22 @@ func InitSever(serviceHost, servicePort, consulHost, consulPort string) {
 		serviceName = bootstrap.DiscoverConfig.ServiceName
 		weight      = bootstrap.DiscoverConfig.Weight
 	)
+	server := &http.Server{Addr: ":" + servicePort, Handler: r}
 	//http server
 	go func() {
 		fmt.Println("Http Server start at port:", servicePort)
 		//启动前执行注册
-		if !discoveryClient.Register(instanceId, serviceHost, "/health", servicePort, serviceName, weight, nil, nil, config.Log_logger) {
+		if !discoveryClient.Register(instanceId, serviceHost, "/health", servicePort, serviceName, weight,
+			discover.InstanceMeta(nil), discover.InstanceTags(), config.Log_logger) {
 			fmt.Println("discoveryClient.Register 注册失败喽~~")
 			os.Exit(-1)
 		}
 		// fmt.Println("注册成功")
-		handler := r
-		errChan <- http.ListenAndServe(":"+servicePort, handler)
-		fmt.Println("sk-admin 服务启动成功")
-	}()
-
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errChan <- fmt.Errorf("%s", <-c)
+		errChan <- server.ListenAndServe()
 	}()
 
-	error := <-errChan
-	//服务退出取消注册
-	discoveryClient.DeRegister("skAdmin", config.Log_logger)
-	fmt.Println(error)
+	//服务退出先取消注册，再等待处理中的请求完成
+	shutdown.New(func() {
+		discoveryClient.DeRegister(instanceId, config.Log_logger)
+	}).HTTP(server).Wait(errChan)
 }
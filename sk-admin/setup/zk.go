@@ -15,14 +15,12 @@ import (
 
 // 初始化Zk
 func InitZk() {
-	var hosts = []string{"127.0.0.1"}
-	conn, _, err := zk.Connect(hosts, time.Second*5)
+	conn, _, err := zk.Connect(conf.Zk.Hosts, time.Duration(conf.Zk.SessionTimeout)*time.Second)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 	conf.Zk.ZkConn = conn
-	conf.Zk.SecProductKey = "/product"
 	{
 		exists, _, _ := conn.Exists(conf.Zk.SecProductKey)
 		if !exists {
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"strconv"
 
+	"final-design/pkg/verifier"
 	endpts "final-design/sk-admin/endpoint"
 	"final-design/sk-admin/model"
 
@@ -25,11 +27,14 @@ var (
 )
 
 // MakeHttpHandler make http handler use mux
-func MakeHttpHandler(ctx context.Context, endpoints endpts.SkAdminEndpoints, zipkinTracer *gozipkin.Tracer, logger log.Logger) http.Handler {
+func MakeHttpHandler(ctx context.Context, endpoints endpts.SkAdminEndpoints, tokenVerifier verifier.TokenVerifier,
+	zipkinTracer *gozipkin.Tracer, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
 	zipkinServer := zipkin.HTTPServerTrace(zipkinTracer, zipkin.Name("http-transport"))
 
 	options := []kithttp.ServerOption{
+		// 校验令牌，令牌信息放入context，由endpoint层的MakeAuthorityAuthorizationMiddleware鉴权
+		kithttp.ServerBefore(verifier.HttpTokenContext(tokenVerifier)),
 		// kithttp.ServerErrorLogger(logger),
 		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		// kithttp.ServerErrorEncoder(kithttp.DefaultErrorEncoder),
@@ -101,6 +106,13 @@ func MakeHttpHandler(ctx context.Context, endpoints endpts.SkAdminEndpoints, zip
 		encodeResponse,
 		options...,
 	))
+	// ==========================================风控复核====================================================
+	r.Methods("GET").Path("/risk/list").Handler(kithttp.NewServer(
+		endpoints.GetRiskRecordEndpoint,
+		decodeGetRiskRecordRequest,
+		encodeResponse,
+		options...,
+	))
 	// ==========================================健康检查====================================================
 	r.Path("/metrics").Handler(promhttp.Handler())
 
@@ -125,6 +137,10 @@ func decodeGetListRequest(_ context.Context, r *http.Request) (interface{}, erro
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	switch err {
+	case verifier.ErrUnauthorized:
+		w.WriteHeader(http.StatusUnauthorized)
+	case verifier.ErrNotPermit:
+		w.WriteHeader(http.StatusForbidden)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -205,3 +221,18 @@ func decodeGetBuyerOrderRequest(ctx context.Context, r *http.Request) (interface
 	}
 	return orderReq, nil
 }
+
+// =====================================decodeRisk==================================================================
+func decodeGetRiskRecordRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	riskReq := endpts.RiskRecordRequest{
+		Decision: r.URL.Query().Get("decision"),
+	}
+	if num := r.URL.Query().Get("num"); num != "" {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, ErrBadRequest
+		}
+		riskReq.Num = n
+	}
+	return riskReq, nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"final-design/pkg/common"
 	"os"
 	"sync"
 
@@ -34,9 +35,7 @@ func init() {
 		Logger.Log("Fail to load remote config", err)
 	}
 
-	if err := conf.Sub("mysql", &conf.MysqlConfig); err != nil {
-		Logger.Log("Fail to parse mysql", err)
-	}
+	conf.MustSub("mysql", &conf.MysqlConfig)
 	//if err := conf.Sub("trace", &conf.TraceConfig); err != nil {
 	//	Logger.Log("Fail to parse trace", err)
 	//}
@@ -49,8 +48,11 @@ func init() {
 		Logger.Log("Fail to parse service", err)
 	}
 
-	if err := conf.Sub("redis", &conf.Redis); err != nil {
-		Logger.Log("Fail to parse redis", err)
+	conf.MustSub("redis", &conf.Redis)
+	conf.MustSub("zookeeper", &conf.Zk)
+
+	if err := conf.Sub("jwt", &conf.Jwt); err != nil {
+		Logger.Log("Fail to parse jwt", err)
 	}
 
 	//zipkinUrl := "http://" + conf.TraceConfig.Host + ":" + conf.TraceConfig.Port + conf.TraceConfig.Url
@@ -85,6 +87,7 @@ func initTracer(zipkinURL string) {
 var SkAppContext = &SkAppCtx{
 	UserConnMap: make(map[string]chan *model.SecResult, 1024),
 	SecReqChan:  make(chan *model.SecRequest, 1024),
+	RiskLogChan: make(chan *common.RiskRecord, 1024),
 }
 
 type SkAppCtx struct {
@@ -93,6 +96,7 @@ type SkAppCtx struct {
 	RWSecProductLock sync.RWMutex
 	UserConnMap      map[string]chan *model.SecResult // userKey映射发送结果的channel
 	UserConnMapLock  sync.Mutex
+	RiskLogChan      chan *common.RiskRecord // 行为评分记录，异步写入redis
 }
 
 const (
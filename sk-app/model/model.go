@@ -10,9 +10,10 @@ type SecRequest struct {
 	Nance         string          `json:"nance"`
 	UserId        int             `json:"user_id"`
 	Username      string          `json:"username"`
-	UserAuthSign  string          `json:"user_auth_sign"` // 用户授权签名
-	AccessTime    int64           `json:"access_time"`    // 访问时间
-	AccessToken   string          `json:"access_token"`   // 访问令牌
+	UserAuthSign  string          `json:"user_auth_sign"`  // 用户授权签名
+	AccessTime    int64           `json:"access_time"`     // 访问时间
+	AccessToken   string          `json:"access_token"`    // 访问令牌
+	TokenIssuedAt int64           `json:"token_issued_at"` // 访问令牌签发时间
 	ClientAddr    string          `json:"client_addr"`
 	ClientRefence string          `json:"client_refence"`
 	CloseNotify   <-chan bool     `json:"-"`
@@ -4,38 +4,41 @@ import (
 	"context"
 	"errors"
 	"final-design/pb"
-	"final-design/pkg/client"
+	"final-design/pkg/verifier"
 	"final-design/sk-app/model"
 	"log"
 
 	"github.com/go-kit/kit/endpoint"
 )
 
+// context中的key使用私有类型，避免与其它包放入context的值冲突
+type contextKey int
+
+const (
+	// 令牌对应的用户信息在context中的key
+	userDetailsKey contextKey = iota
+)
+
 var (
 	ErrTokenInvalid = errors.New("token is invalid")
+	ErrUserMismatch = errors.New("user does not match token")
 )
 
-type RemoteOAuthService struct {
-	oauthClient client.OAuthClient
+// 从context中获取令牌对应的用户信息
+func UserDetailsFromContext(ctx context.Context) (*pb.UserDetails, bool) {
+	userDetails, ok := ctx.Value(userDetailsKey).(*pb.UserDetails)
+	return userDetails, ok
 }
 
-func NewRemoteOAuthService() *RemoteOAuthService {
-	oauthClient, _ := client.NewOAuthClient("oauth", nil, nil)
-	return &RemoteOAuthService{
-		oauthClient: oauthClient,
-	}
-}
-
-func AuthToken() endpoint.Middleware {
+// 校验令牌，并以令牌中的用户信息作为秒杀请求的用户身份，
+// 在endpoint层完成，http和grpc等传输层共用
+func AuthToken(tokenVerifier verifier.TokenVerifier) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 			req := request.(model.SecRequest)
 
 			// log.Printf("req.token=%v\n", req.AccessToken)
-			oauthService := NewRemoteOAuthService()
-			resp, _ := oauthService.oauthClient.CheckToken(ctx, nil, &pb.CheckTokenRequest{
-				Token: req.AccessToken,
-			})
+			resp, _ := tokenVerifier.Verify(ctx, req.AccessToken)
 			if resp == nil {
 				return nil, ErrTokenInvalid
 			}
@@ -43,8 +46,23 @@ func AuthToken() endpoint.Middleware {
 				log.Printf("resp.Error = %v", resp.Err)
 				return nil, errors.New(resp.Err)
 			}
+			userDetails := resp.UserDetails
+			if userDetails == nil {
+				return nil, ErrTokenInvalid
+			}
+			// 请求体中携带的用户信息必须与令牌一致，未携带时使用令牌中的用户信息
+			if (req.UserId != 0 && int64(req.UserId) != userDetails.UserId) ||
+				(req.Username != "" && req.Username != userDetails.Username) {
+				log.Printf("userId [%d] username [%s] does not match token user [%d] [%s]",
+					req.UserId, req.Username, userDetails.UserId, userDetails.Username)
+				return nil, ErrUserMismatch
+			}
+			req.UserId = int(userDetails.UserId)
+			req.Username = userDetails.Username
 			log.Println("secKill的token鉴权成功")
-			return next(ctx, request)
+			req.TokenIssuedAt = resp.IssuedAt // 令牌签发时间，用于行为评分
+			ctx = context.WithValue(ctx, userDetailsKey, userDetails)
+			return next(ctx, req)
 		}
 	}
 }
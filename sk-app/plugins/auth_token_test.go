@@ -0,0 +1,78 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"final-design/pb"
+	"final-design/sk-app/model"
+	"testing"
+)
+
+type fakeVerifier map[string]*pb.CheckTokenResponse
+
+func (v fakeVerifier) Verify(ctx context.Context, tokenValue string) (*pb.CheckTokenResponse, error) {
+	if resp, ok := v[tokenValue]; ok {
+		return resp, nil
+	}
+	return nil, errors.New("oauth-service unavailable")
+}
+
+func TestAuthToken(t *testing.T) {
+	verifier := fakeVerifier{
+		"alice": {IsValidToken: true, IssuedAt: 1700000000,
+			UserDetails: &pb.UserDetails{UserId: 7, Username: "alice"}},
+		"expired": {IsValidToken: false, Err: "token is expired"},
+		"no-user": {IsValidToken: true},
+	}
+
+	tests := []struct {
+		name     string
+		request  model.SecRequest
+		wantErr  string
+		wantUser string
+	}{
+		{"与令牌一致", model.SecRequest{AccessToken: "alice", UserId: 7, Username: "alice"}, "", "alice"},
+		{"请求体没有用户信息时使用令牌中的用户", model.SecRequest{AccessToken: "alice"}, "", "alice"},
+		{"只携带用户名", model.SecRequest{AccessToken: "alice", Username: "alice"}, "", "alice"},
+		{"用户id不一致", model.SecRequest{AccessToken: "alice", UserId: 8}, ErrUserMismatch.Error(), ""},
+		{"用户名不一致", model.SecRequest{AccessToken: "alice", UserId: 7, Username: "bob"}, ErrUserMismatch.Error(), ""},
+		{"令牌过期", model.SecRequest{AccessToken: "expired", UserId: 7}, "token is expired", ""},
+		{"令牌没有用户", model.SecRequest{AccessToken: "no-user"}, ErrTokenInvalid.Error(), ""},
+		{"校验失败", model.SecRequest{AccessToken: "unknown"}, ErrTokenInvalid.Error(), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got model.SecRequest
+			var gotUser *pb.UserDetails
+			next := func(ctx context.Context, request interface{}) (interface{}, error) {
+				got = request.(model.SecRequest)
+				gotUser, _ = UserDetailsFromContext(ctx)
+				return nil, nil
+			}
+			_, err := AuthToken(verifier)(next)(context.Background(), tt.request)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("AuthToken() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.UserId != 7 || got.Username != tt.wantUser || got.TokenIssuedAt != 1700000000 {
+				t.Errorf("request = %d %q %d, want 7 %q 1700000000", got.UserId, got.Username, got.TokenIssuedAt, tt.wantUser)
+			}
+			if gotUser == nil || gotUser.Username != tt.wantUser {
+				t.Errorf("UserDetailsFromContext() = %v, want %q", gotUser, tt.wantUser)
+			}
+		})
+	}
+}
+
+// 其它包以相同字符串作为key放入的值不会被当作令牌用户
+func TestUserDetailsFromContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "OAuthUserDetails", &pb.UserDetails{UserId: 1})
+	if _, ok := UserDetailsFromContext(ctx); ok {
+		t.Error("UserDetailsFromContext() found a value stored under a string key")
+	}
+}
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"final-design/pkg/common"
 	conf "final-design/pkg/config"
 	"final-design/sk-app/config"
 	"final-design/sk-app/model"
 	"final-design/sk-app/service/srv_err"
 	"final-design/sk-app/service/srv_limit"
+	"final-design/sk-app/service/srv_risk"
 	"fmt"
 	"log"
 	"math/rand"
@@ -63,6 +65,19 @@ func (s SkAppService) SecKill(req *model.SecRequest) (map[string]interface{}, in
 		return nil, code, err
 	}
 
+	// 行为评分，分数过高的请求需要人机验证或直接拒绝
+	risk := srv_risk.Evaluate(req)
+	switch risk.Decision {
+	case common.RiskDecisionDeny:
+		code = srv_err.ErrRiskDenied
+		log.Printf("userId [%d] is denied by risk score [%v]", req.UserId, risk.Score)
+		return nil, code, srv_err.GetErrMsg(code)
+	case common.RiskDecisionChallenge:
+		code = srv_err.ErrRiskChallenge
+		log.Printf("userId [%d] is challenged by risk score [%v]", req.UserId, risk.Score)
+		return nil, code, srv_err.GetErrMsg(code)
+	}
+
 	data, code, err := SecInfoById(req.ProductId) // 判断商品是否因各种原因不再销售
 	if err != nil {
 		log.Printf("userId [%d] secInfoById is failed, err: [%v]", req.UserId, err)
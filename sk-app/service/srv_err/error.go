@@ -12,6 +12,8 @@ const (
 	ErrActiveSaleOut       = 1107
 	ErrProcessTimeout      = 1108
 	ErrClientClosed        = 1109
+	ErrRiskChallenge       = 1110
+	ErrRiskDenied          = 1111
 )
 
 const (
@@ -30,6 +32,8 @@ var errMsg = map[int]string{
 	ErrSoldOut:         "商品售罄",
 	ErrRetry:           "请重试",
 	ErrAlreadyBuy:      "已经抢购",
+	ErrRiskChallenge:   "请完成人机验证后重试",
+	ErrRiskDenied:      "请求存在风险，已被拒绝",
 }
 
 func GetErrMsg(code int) error {
@@ -1,42 +1,102 @@
 package srv_redis
 
 import (
+	"context"
 	"encoding/json"
+	"final-design/pkg/common"
 	conf "final-design/pkg/config"
+	"final-design/pkg/shutdown"
 	skadmin_model "final-design/sk-admin/model"
 	"final-design/sk-app/config"
 	"final-design/sk-app/model"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 )
 
+var (
+	// 关闭后读写协程处理完手上的数据后退出
+	stopProcess = make(chan struct{})
+	processWg   sync.WaitGroup
+)
+
+func RunProcess() {
+	for i := 0; i < conf.SecKill.AppWriteToHandleGoroutineNum; i++ { // 默认开10个goroutine
+		processWg.Add(1)
+		go WriteHandle()
+	}
+
+	for i := 0; i < conf.SecKill.AppReadFromHandleGoroutineNum; i++ { // 默认开10个goroutine
+		processWg.Add(1)
+		go ReadHandle()
+	}
+
+	for i := 0; i < 5; i++ { // 默认开5个goroutine
+		processWg.Add(1)
+		go WriteOrder2DB()
+	}
+
+	processWg.Add(1)
+	go WriteRiskLog()
+}
+
+// http服务关闭后调用：SecReqChan和RiskLogChan中剩余的数据写入redis，正在写入数据库的订单写完后退出；
+// 没有写入数据库的订单留在Layer2DBQueueName中，由其它sk-app实例写入
+func Shutdown(ctx context.Context) error {
+	close(stopProcess)
+	return shutdown.WaitGroup(ctx, &processWg)
+}
+
 // 写数据到redis
 func WriteHandle() {
+	defer processWg.Done()
 	for {
-		fmt.Println("write data to redis.")
-		req := <-config.SkAppContext.SecReqChan //SecKill(*model.SecRequest)放入的请求
-		fmt.Println("accessTime =", req.AccessTime)
-		conn := conf.Redis.RedisConn
-
-		data, err := json.Marshal(req)
-		if err != nil {
-			log.Printf("json.Marshal req failed. Error: %v, req: %v", err, req)
-			continue
-		}
-		fmt.Println("conf.Redis.Proxy2layerQueueName", conf.Redis.Proxy2layerQueueName)
-		err = conn.LPush(conf.Redis.Proxy2layerQueueName, string(data)).Err() //放入redis队列中，让sk-core处理
-		if err != nil {
-			log.Printf("LPush req failed. Error: %v, req: %v", err, req)
-			continue
+		select {
+		case req := <-config.SkAppContext.SecReqChan: //SecKill(*model.SecRequest)放入的请求
+			pushSecRequest(req)
+		case <-stopProcess:
+			for {
+				select {
+				case req := <-config.SkAppContext.SecReqChan:
+					pushSecRequest(req)
+				default:
+					return
+				}
+			}
 		}
-		log.Printf("Lpush req success. req: %v", string(data))
 	}
 }
 
+// 将秒杀请求推入redis队列中，让sk-core处理
+func pushSecRequest(req *model.SecRequest) {
+	fmt.Println("write data to redis.")
+	fmt.Println("accessTime =", req.AccessTime)
+	conn := conf.Redis.RedisConn
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		log.Printf("json.Marshal req failed. Error: %v, req: %v", err, req)
+		return
+	}
+	fmt.Println("conf.Redis.Proxy2layerQueueName", conf.Redis.Proxy2layerQueueName)
+	err = conn.LPush(conf.Redis.Proxy2layerQueueName, string(data)).Err() //放入redis队列中，让sk-core处理
+	if err != nil {
+		log.Printf("LPush req failed. Error: %v, req: %v", err, req)
+		return
+	}
+	log.Printf("Lpush req success. req: %v", string(data))
+}
+
 // 从redis中读数据
 func ReadHandle() {
+	defer processWg.Done()
 	for {
+		select {
+		case <-stopProcess:
+			return
+		default:
+		}
 		conn := conf.Redis.RedisConn
 		// 阻塞弹出
 		// fmt.Println("conf.Redis.Layer2proxyQueueName=", conf.Redis.Layer2proxyQueueName)
@@ -73,11 +133,22 @@ func ReadHandle() {
 
 // 定时从redis中读取订单数据，写入到数据库中
 func WriteOrder2DB() {
+	defer processWg.Done()
 	t := time.NewTicker(time.Second * 30)
+	defer t.Stop()
 	conn := conf.Redis.RedisConn
 	for {
-		<-t.C
+		select {
+		case <-t.C:
+		case <-stopProcess:
+			return
+		}
 		for {
+			select {
+			case <-stopProcess:
+				return
+			default:
+			}
 			data, err := conn.BRPop(time.Second, conf.Redis.Layer2DBQueueName).Result() // 取出sk-core返回的order
 			if err != nil {                                                             // redis为空停止此次同步操作
 				break
@@ -99,3 +170,41 @@ func WriteOrder2DB() {
 		}
 	}
 }
+
+// 将行为评分记录写入redis，只保留最近conf.SecKill.RiskConf.LogMaxLen条
+func WriteRiskLog() {
+	defer processWg.Done()
+	for {
+		select {
+		case record := <-config.SkAppContext.RiskLogChan:
+			pushRiskLog(record)
+		case <-stopProcess:
+			for {
+				select {
+				case record := <-config.SkAppContext.RiskLogChan:
+					pushRiskLog(record)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func pushRiskLog(record *common.RiskRecord) {
+	conn := conf.Redis.RedisConn
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("json.Marshal risk record failed. Error: %v, record: %v", err, record)
+		return
+	}
+	pipe := conn.TxPipeline()
+	pipe.LPush(conf.Redis.RiskLogQueue, string(data))
+	if conf.SecKill.RiskConf.LogMaxLen > 0 {
+		pipe.LTrim(conf.Redis.RiskLogQueue, 0, conf.SecKill.RiskConf.LogMaxLen-1)
+	}
+	if _, err = pipe.Exec(); err != nil {
+		log.Printf("LPush risk record failed. Error: %v, record: %v", err, string(data))
+	}
+}
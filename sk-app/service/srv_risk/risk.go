@@ -0,0 +1,264 @@
+package srv_risk
+
+import (
+	"final-design/pkg/common"
+	conf "final-design/pkg/config"
+	"final-design/sk-app/config"
+	"final-design/sk-app/model"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	SignalInterval    = "interval"     // 访问间隔规律性
+	SignalIpFanOut    = "ip_fan_out"   // 单用户多IP
+	SignalUserFanOut  = "user_fan_out" // 单IP多用户
+	SignalTokenAge    = "token_age"    // 令牌年龄
+	SignalStartTiming = "start_timing" // 请求时机
+)
+
+// 单个用户在窗口内的行为
+type userBehavior struct {
+	accessTimes []int64          // 最近的访问时间：毫秒
+	ips         map[string]int64 // 使用过的IP -> 最后出现时间：秒
+}
+
+// 单个IP在窗口内的行为
+type ipBehavior struct {
+	users map[int]int64 // 出现过的用户 -> 最后出现时间：秒
+}
+
+// 行为评分管理
+type RiskMgr struct {
+	UserBehaviorMap map[int]*userBehavior
+	IpBehaviorMap   map[string]*ipBehavior
+	lastEvict       int64 // 上次清理窗口外数据的时间：秒
+	lock            sync.Mutex
+}
+
+var RiskMgrVars = &RiskMgr{
+	UserBehaviorMap: make(map[int]*userBehavior),
+	IpBehaviorMap:   make(map[string]*ipBehavior),
+}
+
+// 对秒杀请求进行行为评分，返回的记录同时会异步写入redis供sk-admin复核
+func Evaluate(req *model.SecRequest) *common.RiskRecord {
+	riskConf := conf.SecKill.RiskConf
+	if !riskConf.Enable {
+		return &common.RiskRecord{Decision: common.RiskDecisionAllow}
+	}
+
+	now := time.Now()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	signals := make(map[string]float64, 5)
+
+	RiskMgrVars.lock.Lock()
+	{
+		RiskMgrVars.evict(now.Unix(), riskConf.WindowSeconds)
+		user := RiskMgrVars.getUserBehavior(req.UserId)
+		user.record(nowMs, req.ClientAddr, riskConf)
+		ip := RiskMgrVars.getIpBehavior(req.ClientAddr)
+		ip.record(now.Unix(), req.UserId, riskConf)
+
+		signals[SignalInterval] = intervalScore(user.accessTimes, riskConf)
+		signals[SignalIpFanOut] = fanOutScore(len(user.ips), riskConf.MaxIpPerUser)
+		signals[SignalUserFanOut] = fanOutScore(len(ip.users), riskConf.MaxUserPerIp)
+	}
+	RiskMgrVars.lock.Unlock()
+
+	signals[SignalTokenAge] = tokenAgeScore(req.TokenIssuedAt, now.Unix(), riskConf)
+	signals[SignalStartTiming] = startTimingScore(req.ProductId, nowMs, riskConf)
+
+	score := weightedScore(signals, riskConf)
+	record := &common.RiskRecord{
+		UserId:     req.UserId,
+		Username:   req.Username,
+		ClientAddr: req.ClientAddr,
+		ProductId:  req.ProductId,
+		Signals:    signals,
+		Score:      score,
+		Decision:   decide(score, riskConf),
+		AccessTime: nowMs,
+	}
+
+	// 评分记录写入通道，由srv_redis.WriteRiskLog写入redis，通道满时丢弃，不阻塞秒杀请求
+	select {
+	case config.SkAppContext.RiskLogChan <- record:
+	default:
+		log.Printf("risk log chan is full, drop record of userId [%d]", req.UserId)
+	}
+	return record
+}
+
+// 每隔一个窗口清理一次窗口内没有访问的用户和IP，避免秒杀期间两个map无限增长；调用方持有lock
+func (mgr *RiskMgr) evict(nowSec int64, windowSeconds int64) {
+	if windowSeconds <= 0 || nowSec-mgr.lastEvict < windowSeconds {
+		return
+	}
+	mgr.lastEvict = nowSec
+	for userId, user := range mgr.UserBehaviorMap {
+		if n := len(user.accessTimes); n == 0 || nowSec-user.accessTimes[n-1]/1000 > windowSeconds {
+			delete(mgr.UserBehaviorMap, userId)
+		}
+	}
+	for addr, ip := range mgr.IpBehaviorMap {
+		for userId, lastSeen := range ip.users {
+			if nowSec-lastSeen > windowSeconds {
+				delete(ip.users, userId)
+			}
+		}
+		if len(ip.users) == 0 {
+			delete(mgr.IpBehaviorMap, addr)
+		}
+	}
+}
+
+func (mgr *RiskMgr) getUserBehavior(userId int) *userBehavior {
+	user, ok := mgr.UserBehaviorMap[userId]
+	if !ok {
+		user = &userBehavior{ips: make(map[string]int64)}
+		mgr.UserBehaviorMap[userId] = user
+	}
+	return user
+}
+
+func (mgr *RiskMgr) getIpBehavior(clientAddr string) *ipBehavior {
+	ip, ok := mgr.IpBehaviorMap[clientAddr]
+	if !ok {
+		ip = &ipBehavior{users: make(map[int]int64)}
+		mgr.IpBehaviorMap[clientAddr] = ip
+	}
+	return ip
+}
+
+// 记录一次访问，并清理窗口外的数据
+func (u *userBehavior) record(nowMs int64, clientAddr string, riskConf conf.RiskConf) {
+	u.accessTimes = append(u.accessTimes, nowMs)
+	// 只保留计算规律性所需的样本：n个间隔需要n+1个时间点
+	if keep := riskConf.IntervalSamples + 1; keep > 1 && len(u.accessTimes) > keep {
+		u.accessTimes = u.accessTimes[len(u.accessTimes)-keep:]
+	}
+	nowSec := nowMs / 1000
+	u.ips[clientAddr] = nowSec
+	for k, v := range u.ips {
+		if nowSec-v > riskConf.WindowSeconds {
+			delete(u.ips, k)
+		}
+	}
+}
+
+func (ip *ipBehavior) record(nowSec int64, userId int, riskConf conf.RiskConf) {
+	ip.users[userId] = nowSec
+	for k, v := range ip.users {
+		if nowSec-v > riskConf.WindowSeconds {
+			delete(ip.users, k)
+		}
+	}
+}
+
+// 访问间隔越规律(变异系数越小)，得分越高
+func intervalScore(accessTimes []int64, riskConf conf.RiskConf) float64 {
+	n := len(accessTimes) - 1
+	if riskConf.IntervalSamples <= 0 || n < riskConf.IntervalSamples || riskConf.IntervalCv <= 0 {
+		return 0
+	}
+	intervals := make([]float64, n)
+	var sum float64
+	for i := 0; i < n; i++ {
+		intervals[i] = float64(accessTimes[i+1] - accessTimes[i])
+		sum += intervals[i]
+	}
+	// 样本过于久远时不计分
+	if accessTimes[n]-accessTimes[0] > riskConf.WindowSeconds*1000 {
+		return 0
+	}
+	mean := sum / float64(n)
+	if mean == 0 {
+		return 1
+	}
+	var variance float64
+	for _, v := range intervals {
+		variance += (v - mean) * (v - mean)
+	}
+	cv := math.Sqrt(variance/float64(n)) / mean
+	return clamp(1 - cv/riskConf.IntervalCv)
+}
+
+// 窗口内出现的IP数或用户数越多，得分越高，为1时不计分
+func fanOutScore(count int, max int) float64 {
+	if count <= 1 {
+		return 0
+	}
+	if max <= 1 {
+		return 1
+	}
+	return clamp(float64(count-1) / float64(max-1))
+}
+
+// 令牌签发时间越短，得分越高；无法获取签发时间时不计分
+func tokenAgeScore(issuedAt int64, nowSec int64, riskConf conf.RiskConf) float64 {
+	if issuedAt <= 0 || riskConf.MinTokenAge <= 0 {
+		return 0
+	}
+	return clamp(1 - float64(nowSec-issuedAt)/float64(riskConf.MinTokenAge))
+}
+
+// 活动开始前或刚开始时到达的请求得分高
+func startTimingScore(productId int, nowMs int64, riskConf conf.RiskConf) float64 {
+	conf.SecKill.RWBlackLock.RLock()
+	product, ok := conf.SecKill.SecProductInfoMap[productId]
+	conf.SecKill.RWBlackLock.RUnlock()
+	if !ok || riskConf.EarlyWindowMs <= 0 {
+		return 0
+	}
+	delta := nowMs - product.StartTime*1000
+	if delta < 0 {
+		return 1
+	}
+	return clamp(1 - float64(delta)/float64(riskConf.EarlyWindowMs))
+}
+
+// 按权重加权平均，换算为0-100分
+func weightedScore(signals map[string]float64, riskConf conf.RiskConf) float64 {
+	weights := map[string]float64{
+		SignalInterval:    riskConf.IntervalWeight,
+		SignalIpFanOut:    riskConf.IpFanOutWeight,
+		SignalUserFanOut:  riskConf.UserFanOutWeight,
+		SignalTokenAge:    riskConf.TokenAgeWeight,
+		SignalStartTiming: riskConf.StartTimingWeight,
+	}
+	var total, weightSum float64
+	for k, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		total += signals[k] * w
+		weightSum += w
+	}
+	if weightSum == 0 {
+		return 0
+	}
+	return math.Round(total/weightSum*10000) / 100
+}
+
+func decide(score float64, riskConf conf.RiskConf) string {
+	if riskConf.DenyScore > 0 && score >= riskConf.DenyScore {
+		return common.RiskDecisionDeny
+	}
+	if riskConf.ChallengeScore > 0 && score >= riskConf.ChallengeScore {
+		return common.RiskDecisionChallenge
+	}
+	return common.RiskDecisionAllow
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
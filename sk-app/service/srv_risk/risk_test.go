@@ -0,0 +1,185 @@
+package srv_risk
+
+import (
+	"final-design/pkg/common"
+	conf "final-design/pkg/config"
+	"testing"
+)
+
+var testRiskConf = conf.RiskConf{
+	Enable:          true,
+	WindowSeconds:   60,
+	IntervalSamples: 4,
+	IntervalCv:      0.2,
+	MaxIpPerUser:    3,
+	MaxUserPerIp:    5,
+	MinTokenAge:     100,
+	EarlyWindowMs:   1000,
+
+	IntervalWeight:    1,
+	IpFanOutWeight:    1,
+	UserFanOutWeight:  1,
+	TokenAgeWeight:    1,
+	StartTimingWeight: 1,
+
+	ChallengeScore: 50,
+	DenyScore:      80,
+}
+
+func TestIntervalScore(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessTimes []int64
+		want        float64
+	}{
+		{"样本不足", []int64{0, 100, 200}, 0},
+		{"完全规律", []int64{0, 100, 200, 300, 400}, 1},
+		{"间隔为0", []int64{1000, 1000, 1000, 1000, 1000}, 1},
+		// 间隔100、300、100、300，变异系数0.5，超过0.2不计分
+		{"不规律", []int64{0, 100, 400, 500, 800}, 0},
+		// 间隔90、110、90、110，变异系数0.1，得分1-0.1/0.2
+		{"较规律", []int64{0, 90, 200, 290, 400}, 0.5},
+		{"超出窗口", []int64{0, 20000, 40000, 60000, 80000}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intervalScore(tt.accessTimes, testRiskConf); !almostEqual(got, tt.want) {
+				t.Errorf("intervalScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFanOutScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		max   int
+		want  float64
+	}{
+		{"单个", 1, 3, 0},
+		{"一半", 2, 3, 0.5},
+		{"达到上限", 3, 3, 1},
+		{"超过上限", 10, 3, 1},
+		{"上限为1", 2, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fanOutScore(tt.count, tt.max); !almostEqual(got, tt.want) {
+				t.Errorf("fanOutScore(%d, %d) = %v, want %v", tt.count, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenAgeScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuedAt int64
+		nowSec   int64
+		want     float64
+	}{
+		{"没有签发时间", 0, 1000, 0},
+		{"刚签发", 1000, 1000, 1},
+		{"签发一半时间", 1000, 1050, 0.5},
+		{"足够久", 1000, 2000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenAgeScore(tt.issuedAt, tt.nowSec, testRiskConf); !almostEqual(got, tt.want) {
+				t.Errorf("tokenAgeScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartTimingScore(t *testing.T) {
+	conf.SecKill.SecProductInfoMap = map[int]*conf.SecProductInfoConf{
+		1: {ProductId: 1, StartTime: 100},
+	}
+	defer func() { conf.SecKill.SecProductInfoMap = nil }()
+
+	tests := []struct {
+		name      string
+		productId int
+		nowMs     int64
+		want      float64
+	}{
+		{"商品不存在", 2, 100000, 0},
+		{"活动开始前", 1, 99999, 1},
+		{"刚开始", 1, 100000, 1},
+		{"开始后一半", 1, 100500, 0.5},
+		{"开始很久", 1, 200000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := startTimingScore(tt.productId, tt.nowMs, testRiskConf); !almostEqual(got, tt.want) {
+				t.Errorf("startTimingScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedScoreAndDecide(t *testing.T) {
+	tests := []struct {
+		name     string
+		signals  map[string]float64
+		want     float64
+		decision string
+	}{
+		{"全部为0", map[string]float64{}, 0, common.RiskDecisionAllow},
+		{"全部满分", map[string]float64{SignalInterval: 1, SignalIpFanOut: 1, SignalUserFanOut: 1,
+			SignalTokenAge: 1, SignalStartTiming: 1}, 100, common.RiskDecisionDeny},
+		{"需要验证", map[string]float64{SignalInterval: 1, SignalIpFanOut: 1, SignalUserFanOut: 1}, 60,
+			common.RiskDecisionChallenge},
+		{"低于阈值", map[string]float64{SignalInterval: 1, SignalTokenAge: 0.5}, 30, common.RiskDecisionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := weightedScore(tt.signals, testRiskConf)
+			if !almostEqual(got, tt.want) {
+				t.Errorf("weightedScore() = %v, want %v", got, tt.want)
+			}
+			if decision := decide(got, testRiskConf); decision != tt.decision {
+				t.Errorf("decide(%v) = %v, want %v", got, decision, tt.decision)
+			}
+		})
+	}
+}
+
+func TestRiskMgrEvict(t *testing.T) {
+	mgr := &RiskMgr{
+		UserBehaviorMap: make(map[int]*userBehavior),
+		IpBehaviorMap:   make(map[string]*ipBehavior),
+	}
+	mgr.getUserBehavior(1).record(1000*1000, "10.0.0.1", testRiskConf)
+	mgr.getIpBehavior("10.0.0.1").record(1000, 1, testRiskConf)
+	mgr.getUserBehavior(2).record(1100*1000, "10.0.0.2", testRiskConf)
+	mgr.getIpBehavior("10.0.0.2").record(1100, 2, testRiskConf)
+
+	tests := []struct {
+		name   string
+		nowSec int64
+		users  int
+		ips    int
+	}{
+		{"都在窗口内", 1060, 2, 2},
+		{"距上次清理不足一个窗口", 1080, 2, 2},
+		{"用户1超出窗口", 1121, 1, 1},
+		{"全部超出窗口", 1181, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr.evict(tt.nowSec, testRiskConf.WindowSeconds)
+			if len(mgr.UserBehaviorMap) != tt.users || len(mgr.IpBehaviorMap) != tt.ips {
+				t.Errorf("evict(%d) users = %d, ips = %d, want %d, %d", tt.nowSec,
+					len(mgr.UserBehaviorMap), len(mgr.IpBehaviorMap), tt.users, tt.ips)
+			}
+		})
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	d := a - b
+	return d < 1e-6 && d > -1e-6
+}
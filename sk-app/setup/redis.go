@@ -117,18 +117,7 @@ func syncIpBlackList(conn *redis.Client) {
 // 初始化redis进程
 func initRedisProcess() {
 	log.Printf("initRedisProcess %d %d", conf.SecKill.AppWriteToHandleGoroutineNum, conf.SecKill.AppReadFromHandleGoroutineNum)
-
-	for i := 0; i < conf.SecKill.AppWriteToHandleGoroutineNum; i++ { // 默认开10个goroutine
-		go srv_redis.WriteHandle()
-	}
-
-	for i := 0; i < conf.SecKill.AppReadFromHandleGoroutineNum; i++ { // 默认开10个goroutine
-		go srv_redis.ReadHandle()
-	}
-
-	for i := 0; i < 5; i++ { // 默认开5个goroutine
-		go srv_redis.WriteOrder2DB()
-	}
+	srv_redis.RunProcess()
 }
 
 func UpdateSecProductInfoMap() {
@@ -6,15 +6,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"final-design/sk-app/config"
 	"final-design/sk-app/endpoint"
 	"final-design/sk-app/plugins"
 	"final-design/sk-app/service"
+	"final-design/sk-app/service/srv_redis"
 
 	// kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	// stdprometheus "github.com/prometheus/client_golang/prometheus"
@@ -23,6 +21,8 @@ import (
 	"final-design/sk-app/transport"
 
 	register "final-design/pkg/discover"
+	"final-design/pkg/shutdown"
+	"final-design/pkg/verifier"
 
 	kitzipkin "github.com/go-kit/kit/tracing/zipkin"
 	"golang.org/x/time/rate"
@@ -56,7 +56,7 @@ func InitServer(host string, servicePort string) {
 
 	SecKillEnd := endpoint.MakeSecKillEndpoint(skAppService)
 	SecKillEnd = plugins.NewTokenBucketLimitterWithBuildIn(secRatebucket)(SecKillEnd)
-	SecKillEnd = plugins.AuthToken()(SecKillEnd)
+	SecKillEnd = plugins.AuthToken(verifier.NewTokenVerifier())(SecKillEnd)
 	// SecKillEnd = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "sec-kill")(SecKillEnd)
 
 	testEnd := endpoint.MakeTestEndpoint(skAppService)
@@ -73,22 +73,18 @@ func InitServer(host string, servicePort string) {
 	// 创建http handler
 	r := transport.MakeHttpHandler(ctx, endpts, localconfig.ZipkinTracer, localconfig.Logger)
 
+	server := &http.Server{Addr: ":" + servicePort, Handler: r}
 	// http server
 	go func() {
 		fmt.Println("Http Server start at port:" + servicePort)
 		//启动前执行注册
 		register.Register()
-		handler := r
-		errChan <- http.ListenAndServe(":"+servicePort, handler)
+		errChan <- server.ListenAndServe()
 	}()
 
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errChan <- fmt.Errorf("%s", <-c)
-	}()
-
-	<-errChan
-	// 服务退出取消注册
-	register.Deregister()
+	// 先从consul注销并等待处理中的秒杀请求返回结果，再把SecReqChan中剩余的请求写入redis
+	shutdown.New(register.Deregister).
+		HTTP(server).
+		OnShutdown("drain seckill requests", srv_redis.Shutdown).
+		Wait(errChan)
 }
@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"final-design/pkg/common"
 	endpts "final-design/sk-app/endpoint"
 	"final-design/sk-app/model"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/tracing/zipkin"
 	"github.com/go-kit/kit/transport"
@@ -96,8 +98,12 @@ func decodeSecKillRequest(ctx context.Context, r *http.Request) (interface{}, er
 		return nil, err
 	}
 	secRequest.AccessToken = r.Header.Get("Authorization")
+	// 访问时间和客户端地址以服务端为准，不信任请求体中的值
+	secRequest.AccessTime = time.Now().Unix()
+	secRequest.ClientAddr = common.ClientIp(r)
 	return secRequest, nil
 }
+
 func decodeTestRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	return endpts.HealthRequest{}, nil
 }
@@ -34,15 +34,12 @@ func init() {
 	if err := conf.LoadRemoteConfig(); err != nil {
 		Logger.Log("Fail to load remote config", err)
 	}
-	if err := conf.Sub("mysql", &conf.MysqlConfig); err != nil {
-		Logger.Log("Fail to parse mysql", err)
-	}
+	conf.MustSub("mysql", &conf.MysqlConfig)
 	if err := conf.Sub("trace", &conf.TraceConfig); err != nil {
 		Logger.Log("Fail to parse trace", err)
 	}
-	if err := conf.Sub("redis", &conf.Redis); err != nil {
-		Logger.Log("Fail to parse redis", err)
-	}
+	conf.MustSub("redis", &conf.Redis)
+	conf.MustSub("zookeeper", &conf.Zk)
 	if err := conf.Sub("service", &conf.SecKill); err != nil {
 		Logger.Log("Fail to parse service", err)
 	}
@@ -1,75 +1,133 @@
 package srv_redis
 
 import (
+	"context"
 	"encoding/json"
 	conf "final-design/pkg/config"
+	"final-design/pkg/shutdown"
 	"final-design/sk-core/config"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 )
 
+var (
+	// 关闭后读取协程停止从redis读取请求
+	stopReading = make(chan struct{})
+	readerWg    = new(sync.WaitGroup)
+	handlerWg   = new(sync.WaitGroup)
+	writerWg    = new(sync.WaitGroup)
+)
+
 func RunProcess() {
 	for i := 0; i < conf.SecKill.CoreReadRedisGoroutineNum; i++ {
+		readerWg.Add(1)
 		go HandleReader()
 	}
 	for i := 0; i < conf.SecKill.CoreWriteRedisGoroutineNum; i++ {
+		writerWg.Add(1)
 		go HandleWrite()
 	}
 
 	for i := 0; i < conf.SecKill.CoreHandleGoroutineNum; i++ {
+		handlerWg.Add(1)
 		go HandleUser()
 	}
 
 	for i := 0; i < conf.SecKill.CoreHandleGoroutineNum; i++ {
+		writerWg.Add(1)
 		go HandleWriteOrder2Redis()
 	}
 
 	log.Printf("all process goroutine started")
 }
 
+// 按顺序停止处理：停止读取新请求 -> 处理完Read2HandleChan中的请求 -> 将结果和订单写入redis；
+// 到期仍未处理的请求放回Proxy2layerQueueName，由其它sk-core实例或重启后继续处理
+func Shutdown(ctx context.Context) error {
+	close(stopReading)
+	if err := shutdown.WaitGroup(ctx, readerWg); err != nil {
+		return err
+	}
+
+	close(config.SecLayerCtx.Read2HandleChan)
+	if err := shutdown.WaitGroup(ctx, handlerWg); err != nil {
+		// 处理协程还在运行，不能关闭结果和订单通道，只把没处理的请求放回redis
+		for req := range config.SecLayerCtx.Read2HandleChan {
+			requeue(req)
+		}
+		return err
+	}
+
+	close(config.SecLayerCtx.Handle2WriteChan)
+	close(config.SecLayerCtx.WriteOrder2RedisChan)
+	return shutdown.WaitGroup(ctx, writerWg)
+}
+
 func HandleReader() {
+	defer readerWg.Done()
 	log.Printf("read goroutine running %v", conf.Redis.Proxy2layerQueueName)
+	conn := conf.Redis.RedisConn
 	for {
-		conn := conf.Redis.RedisConn
-		for {
-			// 从队列中取出数据
-			data, err := conn.BRPop(time.Second, conf.Redis.Proxy2layerQueueName).Result()
-			if err != nil {
-				continue
-			}
-			log.Printf("BRPop from proxy to layer queue, data: %s\n", data)
-
-			// 转换数据结构
-			var req config.SecRequest
-			err = json.Unmarshal([]byte(data[1]), &req)
-			if err != nil {
-				log.Printf("Unmarshal to secRequest failed, err: %v", err)
-				continue
-			}
-
-			// 判断是否超时
-			nowTime := time.Now().Unix()
-			// fmt.Println(nowTime, " ", req.SecTime, " ", 100)
-			if nowTime-req.SecTime >= int64(conf.SecKill.MaxRequestWaitTimeout) {
-				log.Printf("req[%v] is expire", req)
-				continue
-			}
-
-			// 设置超时时间
-			timer := time.NewTicker(time.Millisecond * time.Duration(conf.SecKill.CoreWaitResultTimeout))
-			select {
-			case config.SecLayerCtx.Read2HandleChan <- &req:
-				fmt.Println("req放入到Read2HandleChan")
-			case <-timer.C:
-				log.Printf("send to handle chan timeout, req: %v", req)
-				// break
-			}
+		select {
+		case <-stopReading:
+			return
+		default:
+		}
+		// 从队列中取出数据
+		data, err := conn.BRPop(time.Second, conf.Redis.Proxy2layerQueueName).Result()
+		if err != nil {
+			continue
+		}
+		log.Printf("BRPop from proxy to layer queue, data: %s\n", data)
+
+		// 转换数据结构
+		var req config.SecRequest
+		err = json.Unmarshal([]byte(data[1]), &req)
+		if err != nil {
+			log.Printf("Unmarshal to secRequest failed, err: %v", err)
+			continue
+		}
+
+		// 判断是否超时
+		nowTime := time.Now().Unix()
+		// fmt.Println(nowTime, " ", req.SecTime, " ", 100)
+		if nowTime-req.SecTime >= int64(conf.SecKill.MaxRequestWaitTimeout) {
+			log.Printf("req[%v] is expire", req)
+			continue
+		}
+
+		// 设置超时时间
+		timer := time.NewTicker(time.Millisecond * time.Duration(conf.SecKill.CoreWaitResultTimeout))
+		select {
+		case config.SecLayerCtx.Read2HandleChan <- &req:
+			fmt.Println("req放入到Read2HandleChan")
+		case <-stopReading:
+			requeue(&req)
+		case <-timer.C:
+			log.Printf("send to handle chan timeout, req: %v", req)
+			// break
 		}
+		timer.Stop()
+	}
+}
+
+// 将没有处理的请求放回队列的读取端，下次BRPop最先取出
+func requeue(req *config.SecRequest) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		log.Printf("marshal failed, err: %v", err)
+		return
+	}
+	conn := conf.Redis.RedisConn
+	if err := conn.RPush(conf.Redis.Proxy2layerQueueName, string(data)).Err(); err != nil {
+		log.Printf("RPush proxy to layer queue failed, err: %v, req: %v", err, string(data))
 	}
 }
 
 func HandleWrite() {
+	defer writerWg.Done()
 	log.Println("handle write running")
 
 	for res := range config.SecLayerCtx.Handle2WriteChan {
@@ -104,6 +162,7 @@ func sendToRedis(res *config.SecResult) (err error) {
 }
 
 func HandleWriteOrder2Redis() {
+	defer writerWg.Done()
 	for order := range config.SecLayerCtx.WriteOrder2RedisChan {
 		err := sendOrder2Redis(order)
 		if err != nil {
@@ -0,0 +1,156 @@
+package srv_redis
+
+import (
+	"context"
+	"encoding/json"
+	conf "final-design/pkg/config"
+	"final-design/pkg/redistest"
+	"final-design/sk-core/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 每个用例使用新的redis、通道和协程计数，Shutdown只能执行一次；
+// 上一个用例超时后仍在等待的协程计数不能再使用
+func resetPipeline(t *testing.T, read2HandleSize int) *redis.Client {
+	conn, _ := redistest.New(t)
+	savedRedis := conf.Redis
+	savedWait, savedResult := conf.SecKill.MaxRequestWaitTimeout, conf.SecKill.CoreWaitResultTimeout
+	read2Handle, handle2Write, writeOrder := config.SecLayerCtx.Read2HandleChan,
+		config.SecLayerCtx.Handle2WriteChan, config.SecLayerCtx.WriteOrder2RedisChan
+	conf.Redis.RedisConn = conn
+	conf.Redis.Proxy2layerQueueName = "proxy2layer"
+	conf.Redis.Layer2proxyQueueName = "layer2proxy"
+	conf.Redis.Layer2DBQueueName = "layer2db"
+	conf.SecKill.MaxRequestWaitTimeout = 60
+	conf.SecKill.CoreWaitResultTimeout = 10000
+	config.SecLayerCtx.Read2HandleChan = make(chan *config.SecRequest, read2HandleSize)
+	config.SecLayerCtx.Handle2WriteChan = make(chan *config.SecResult, 16)
+	config.SecLayerCtx.WriteOrder2RedisChan = make(chan *config.Order, 16)
+	stopReading = make(chan struct{})
+	readerWg, handlerWg, writerWg = new(sync.WaitGroup), new(sync.WaitGroup), new(sync.WaitGroup)
+	t.Cleanup(func() {
+		conf.Redis = savedRedis
+		conf.SecKill.MaxRequestWaitTimeout, conf.SecKill.CoreWaitResultTimeout = savedWait, savedResult
+		config.SecLayerCtx.Read2HandleChan, config.SecLayerCtx.Handle2WriteChan,
+			config.SecLayerCtx.WriteOrder2RedisChan = read2Handle, handle2Write, writeOrder
+	})
+	return conn
+}
+
+func pushRequest(t *testing.T, conn *redis.Client, productId int) {
+	data, _ := json.Marshal(&config.SecRequest{ProductId: productId, UserId: productId, SecTime: time.Now().Unix()})
+	if err := conn.LPush(conf.Redis.Proxy2layerQueueName, string(data)).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 队列中的请求按BRPop的顺序返回商品id
+func queuedProducts(t *testing.T, conn *redis.Client) []int {
+	items, err := conn.LRange(conf.Redis.Proxy2layerQueueName, 0, -1).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	products := make([]int, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		var req config.SecRequest
+		if err := json.Unmarshal([]byte(items[i]), &req); err != nil {
+			t.Fatal(err)
+		}
+		products = append(products, req.ProductId)
+	}
+	return products
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 读取协程取出请求后处理通道已满，退出时把该请求放回队列的读取端，下次最先处理
+func TestShutdownRequeuesReadRequest(t *testing.T) {
+	conn := resetPipeline(t, 0)
+	for _, productId := range []int{1, 2, 3} {
+		pushRequest(t, conn, productId)
+	}
+	readerWg.Add(1)
+	go HandleReader()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for conn.LLen(conf.Redis.Proxy2layerQueueName).Val() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("reader does not take a request")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if got := queuedProducts(t, conn); !equalInts(got, []int{1, 2, 3}) {
+		t.Errorf("queued products = %v, want [1 2 3]", got)
+	}
+}
+
+// 处理协程没有按时结束时，Read2HandleChan中剩余的请求放回队列
+func TestShutdownRequeuesUnhandledRequests(t *testing.T) {
+	conn := resetPipeline(t, 4)
+	config.SecLayerCtx.Read2HandleChan <- &config.SecRequest{ProductId: 7, SecTime: time.Now().Unix()}
+	config.SecLayerCtx.Read2HandleChan <- &config.SecRequest{ProductId: 8, SecTime: time.Now().Unix()}
+
+	// 一直没有处理完的处理协程
+	release := make(chan struct{})
+	defer close(release)
+	handlerWg.Add(1)
+	go func(wg *sync.WaitGroup) {
+		defer wg.Done()
+		<-release
+	}(handlerWg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := queuedProducts(t, conn); !equalInts(got, []int{8, 7}) && !equalInts(got, []int{7, 8}) {
+		t.Errorf("queued products = %v, want 7 and 8", got)
+	}
+}
+
+// 退出前把已处理的秒杀结果和订单写入redis
+func TestShutdownFlushesResultsAndOrders(t *testing.T) {
+	conn := resetPipeline(t, 4)
+	for i := 0; i < 2; i++ {
+		writerWg.Add(2)
+		go HandleWrite()
+		go HandleWriteOrder2Redis()
+	}
+	for userId := 1; userId <= 3; userId++ {
+		config.SecLayerCtx.Handle2WriteChan <- &config.SecResult{ProductId: 1, UserId: userId}
+	}
+	config.SecLayerCtx.WriteOrder2RedisChan <- &config.Order{OrderId: 100, ProductId: 1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if n := conn.LLen(conf.Redis.Layer2proxyQueueName).Val(); n != 3 {
+		t.Errorf("%d results written to redis, want 3", n)
+	}
+	if n := conn.LLen(conf.Redis.Layer2DBQueueName).Val(); n != 1 {
+		t.Errorf("%d orders written to redis, want 1", n)
+	}
+}
@@ -13,6 +13,7 @@ import (
 )
 
 func HandleUser() {
+	defer handlerWg.Done()
 	log.Println("handle user running")
 
 	for req := range config.SecLayerCtx.Read2HandleChan {
@@ -34,6 +35,7 @@ func HandleUser() {
 			log.Printf("send to response chan timeout, res: %v", res)
 			// break
 		}
+		timer.Stop()
 	}
 }
 
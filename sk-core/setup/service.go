@@ -1,16 +1,15 @@
 package setup
 
 import (
+	"context"
 	"encoding/json"
 	conf "final-design/pkg/config"
 	"final-design/pkg/mysql"
+	"final-design/pkg/shutdown"
 	"final-design/sk-admin/service"
 	"final-design/sk-core/service/srv_redis"
 	"fmt"
 	"log"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 )
 
@@ -19,57 +18,65 @@ func RunService() {
 	srv_redis.RunProcess()
 	go store2Database()
 
-	errChan := make(chan error)
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errChan <- fmt.Errorf("%s", <-c)
-	}()
-
-	error := <-errChan
-	fmt.Println(error)
+	// sk-core不注册到consul，也不对外提供http服务，退出时只需要排空内存队列并同步库存
+	shutdown.New(nil).
+		OnShutdown("drain seckill queues", srv_redis.Shutdown).
+		OnShutdown("sync activity", func(ctx context.Context) error {
+			syncActivity()
+			return nil
+		}).
+		Wait(nil)
 }
 
 // 每隔30s同步内存Activity数据到 数据库 和 zookeeper
 func store2Database() {
-	conn := mysql.DB()
 	t1 := time.NewTicker(30 * time.Second)
 	for {
 		<-t1.C
-		conf.Logger.Log("Activity内存数据持久化到数据库中......")
-		// 将conf.SecKill.SecProductInfoMap持久化到mysql
-		leftNum := make(map[string]int, 20)
-		for _, v := range conf.SecKill.SecProductInfoMap {
-			fmt.Println("activity_name=", v.ActivityName, " left_num=", v.LeftNum)
-			leftNum[v.ActivityName] = v.LeftNum
-			_, err := conn.Execute("update activity set left_num=? where activity_name=?", v.LeftNum, v.ActivityName)
-			// _, err := conn.Table("activity").Data(map[string]interface{}{
-			// 	"left_num": v.LeftNum,
-			// }).Where("activity_name", v.ActivityName).Update()
+		syncActivity()
+	}
+}
+
+// 同步内存Activity数据到 数据库 和 zookeeper
+func syncActivity() {
+	conn := mysql.DB()
+	conf.Logger.Log("Activity内存数据持久化到数据库中......")
+	// 将conf.SecKill.SecProductInfoMap持久化到mysql
+	leftNum := make(map[string]int, 20)
+	for _, v := range conf.SecKill.SecProductInfoMap {
+		fmt.Println("activity_name=", v.ActivityName, " left_num=", v.LeftNum)
+		leftNum[v.ActivityName] = v.LeftNum
+		_, err := conn.Execute("update activity set left_num=? where activity_name=?", v.LeftNum, v.ActivityName)
+		// _, err := conn.Table("activity").Data(map[string]interface{}{
+		// 	"left_num": v.LeftNum,
+		// }).Where("activity_name", v.ActivityName).Update()
 
-			if err != nil {
-				log.Printf("UpdateActivity【%s】, Error: %v\n", v.ActivityName, err)
-			}
-		}
-		conf.Logger.Log("Activity内存数据同步到Zookeeper中......")
-		activityImpl := service.ActivityServiceImpl{}
-		secProductInfoList, stat, _ := activityImpl.LoadProductFromZk(conf.Zk.SecProductKey)
-		for i, item := range secProductInfoList {
-			secProductInfoList[i].LeftNum = leftNum[item.ActivityName]
-		}
-		// 将conf.SecKill.SecProductInfoMap数据同步到zookeeper
-		data, err := json.Marshal(secProductInfoList)
 		if err != nil {
-			log.Printf("json marshal failed, err: %v", err)
-			return
+			log.Printf("UpdateActivity【%s】, Error: %v\n", v.ActivityName, err)
 		}
+	}
+	conf.Logger.Log("Activity内存数据同步到Zookeeper中......")
+	activityImpl := service.ActivityServiceImpl{}
+	secProductInfoList, stat, err := activityImpl.LoadProductFromZk(conf.Zk.SecProductKey)
+	if err != nil {
+		log.Printf("LoadProductFromZk failed, err: %v", err)
+		return
+	}
+	for i, item := range secProductInfoList {
+		secProductInfoList[i].LeftNum = leftNum[item.ActivityName]
+	}
+	// 将conf.SecKill.SecProductInfoMap数据同步到zookeeper
+	data, err := json.Marshal(secProductInfoList)
+	if err != nil {
+		log.Printf("json marshal failed, err: %v", err)
+		return
+	}
 
-		conn := conf.Zk.ZkConn
-		var byteData = []byte(string(data))
+	zkConn := conf.Zk.ZkConn
+	var byteData = []byte(string(data))
 
-		_, err_set := conn.Set(conf.Zk.SecProductKey, byteData, stat.Version)
-		if err_set != nil {
-			fmt.Println("err_set=", err_set)
-		}
+	_, err_set := zkConn.Set(conf.Zk.SecProductKey, byteData, stat.Version)
+	if err_set != nil {
+		fmt.Println("err_set=", err_set)
 	}
 }
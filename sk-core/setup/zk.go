@@ -12,16 +12,14 @@ import (
 
 // 初始化Zookeeper连接
 func InitZk() {
-	var hosts = []string{"127.0.0.1:2181"}
 	option := zk.WithEventCallback(waitSecProductEvent)
-	conn, _, err := zk.Connect(hosts, time.Second*5, option)
+	conn, _, err := zk.Connect(conf.Zk.Hosts, time.Duration(conf.Zk.SessionTimeout)*time.Second, option)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
 	conf.Zk.ZkConn = conn
-	conf.Zk.SecProductKey = "/product"
 	{
 		exists, _, _ := conn.Exists(conf.Zk.SecProductKey)
 		if !exists {
@@ -29,8 +29,16 @@ func init() {
 		Logger.Log("Fail to load remote config", err)
 	}
 
-	if err := conf.Sub("mysql", &conf.MysqlConfig); err != nil {
-		Logger.Log("Fail to parse mysql", err)
+	conf.MustSub("mysql", &conf.MysqlConfig)
+	conf.MustSub("redis", &conf.Redis)
+	if err := conf.Sub("jwt", &conf.Jwt); err != nil {
+		Logger.Log("Fail to parse jwt", err)
+	}
+	if err := conf.Sub("snowflake", &conf.Snowflake); err != nil {
+		Logger.Log("Fail to parse snowflake", err)
+	}
+	if err := conf.Sub("register", &conf.Register); err != nil {
+		Logger.Log("Fail to parse register", err)
 	}
 	zipkinUrl := "http://" + conf.TraceConfig.Host + ":" + conf.TraceConfig.Port + conf.TraceConfig.Url
 	Logger.Log("zipkin url", zipkinUrl)
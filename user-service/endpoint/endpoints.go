@@ -19,6 +19,39 @@ type UserEndpoints struct {
 	CreateAdminUserEndpoint endpoint.Endpoint
 	AdminUserEndpoint       endpoint.Endpoint
 
+	AuthoritiesEndpoint endpoint.Endpoint
+
+	// 账号管理，gRPC供内部服务调用
+	GetUserEndpoint        endpoint.Endpoint
+	UpdateUserEndpoint     endpoint.Endpoint
+	ChangePasswordEndpoint endpoint.Endpoint
+	DisableUserEndpoint    endpoint.Endpoint
+	DeleteUserEndpoint     endpoint.Endpoint
+
+	// http接口：用户管理自己的账号，需要ROLE_USER
+	ProfileEndpoint               endpoint.Endpoint
+	UpdateProfileEndpoint         endpoint.Endpoint
+	ChangeProfilePasswordEndpoint endpoint.Endpoint
+
+	// http接口：管理员管理用户账号，需要ROLE_ADMIN
+	ManageCreateUserEndpoint      endpoint.Endpoint
+	ManageCreateAdminUserEndpoint endpoint.Endpoint
+	ManageGetUserEndpoint         endpoint.Endpoint
+	ManageDisableUserEndpoint     endpoint.Endpoint
+	ManageDeleteUserEndpoint      endpoint.Endpoint
+
+	// 两步验证，只提供gRPC接口，由oauth-service调用
+	MfaStatusEndpoint   endpoint.Endpoint
+	MfaEnrollEndpoint   endpoint.Endpoint
+	MfaActivateEndpoint endpoint.Endpoint
+	MfaVerifyEndpoint   endpoint.Endpoint
+	MfaDisableEndpoint  endpoint.Endpoint
+
+	// 自助注册，http接口不需要令牌
+	RegisterEndpoint         endpoint.Endpoint
+	ResendVerifyCodeEndpoint endpoint.Endpoint
+	VerifyAccountEndpoint    endpoint.Endpoint
+
 	HealthCheckEndpoint endpoint.Endpoint
 }
 
@@ -50,16 +83,15 @@ func (u *UserEndpoints) AdminCheck(ctx context.Context, username, password strin
 	return response.UserId, err
 }
 
-func (u *UserEndpoints) Create(ctx context.Context, username, password string, userId int64, age int) error {
+func (u *UserEndpoints) Create(ctx context.Context, username, password string, age int) (int64, error) {
 	// reflect.TypeOf(UserEndpoints{})
 	resp, _ := u.CreateUserEndpoint(ctx, CreateUserRequest{
 		Username: username,
 		Password: password,
-		UserId:   userId,
 		Age:      age,
 	})
 	response := resp.(CreateUserResponse)
-	return response.Error
+	return response.UserId, response.Error
 }
 
 func (u *UserEndpoints) HealthCheck() bool {
@@ -117,15 +149,16 @@ func MakeAdminUserEndpoint(svc service.Service) endpoint.Endpoint {
 	}
 }
 
+// 用户id由user-service生成，通过CreateUserResponse返回
 type CreateUserRequest struct {
 	Username string `json:"user_name"`
 	Password string `json:"password"`
-	UserId   int64  `json:"user_id"`
 	Age      int    `json:"age"`
 }
 
 type CreateUserResponse struct {
 	Result bool  `json:"result"`
+	UserId int64 `json:"user_id"`
 	Error  error `json:"error"`
 }
 
@@ -133,15 +166,8 @@ type CreateUserResponse struct {
 func MakeCreateUserEndpoint(svc service.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(CreateUserRequest)
-		var (
-			username, password string
-			userId             int64
-			calError           error
-			age                int
-		)
-		username, password, userId, age = req.Username, req.Password, req.UserId, req.Age
-		calError = svc.Create(ctx, username, password, userId, age)
-		return CreateUserResponse{Result: calError == nil, Error: calError}, nil
+		userId, calError := svc.Create(ctx, req.Username, req.Password, req.Age)
+		return CreateUserResponse{Result: calError == nil, UserId: userId, Error: calError}, nil
 	}
 }
 
@@ -149,15 +175,268 @@ func MakeCreateUserEndpoint(svc service.Service) endpoint.Endpoint {
 func MakeCreateAdminUserEndpoint(svc service.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(CreateUserRequest)
-		var (
-			username, password string
-			userId             int64
-			calError           error
-			age                int
-		)
-		username, password, userId, age = req.Username, req.Password, req.UserId, req.Age
-		calError = svc.CreateAdmin(ctx, username, password, userId, age)
-		return CreateUserResponse{Result: calError == nil, Error: calError}, nil
+		userId, calError := svc.CreateAdmin(ctx, req.Username, req.Password, req.Age)
+		return CreateUserResponse{Result: calError == nil, UserId: userId, Error: calError}, nil
+	}
+}
+
+type AuthoritiesRequest struct {
+	UserId int64 `json:"user_id"`
+	IdType int   `json:"id_type"`
+}
+
+type AuthoritiesResponse struct {
+	Authorities []string `json:"authorities"`
+	Error       error    `json:"error"`
+}
+
+// 创建获取用户角色和权限的endpoint
+func MakeAuthoritiesEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(AuthoritiesRequest)
+		authorities, calError := svc.Authorities(ctx, req.UserId, req.IdType)
+		return AuthoritiesResponse{Authorities: authorities, Error: calError}, nil
+	}
+}
+
+type UserIdRequest struct {
+	UserId int64 `json:"user_id"`
+}
+
+// 用户信息，不包含密码
+type GetUserResponse struct {
+	UserId   int64  `json:"user_id"`
+	Username string `json:"user_name"`
+	Age      int    `json:"age"`
+	IdType   int    `json:"id_type"`
+	Status   int    `json:"status"`
+	Error    string `json:"error"`
+}
+
+type UpdateUserRequest struct {
+	UserId   int64  `json:"user_id"`
+	Username string `json:"user_name"`
+	Age      int    `json:"age"`
+}
+
+type ChangePasswordRequest struct {
+	UserId      int64  `json:"user_id"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type DisableUserRequest struct {
+	UserId   int64 `json:"user_id"`
+	Disabled bool  `json:"disabled"`
+}
+
+type UserOperationResponse struct {
+	Result bool   `json:"result"`
+	Error  string `json:"error"`
+}
+
+func newUserOperationResponse(err error) UserOperationResponse {
+	if err != nil {
+		return UserOperationResponse{Result: false, Error: err.Error()}
+	}
+	return UserOperationResponse{Result: true}
+}
+
+// 创建获取用户信息的endpoint
+func MakeGetUserEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(UserIdRequest)
+		user, calError := svc.GetUser(ctx, req.UserId)
+		if calError != nil {
+			return GetUserResponse{Error: calError.Error()}, nil
+		}
+		return GetUserResponse{
+			UserId:   user.UserId,
+			Username: user.Username,
+			Age:      user.Age,
+			IdType:   int(user.Type),
+			Status:   user.Status,
+		}, nil
+	}
+}
+
+// 创建修改用户信息的endpoint
+func MakeUpdateUserEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(UpdateUserRequest)
+		calError := svc.UpdateUser(ctx, req.UserId, req.Username, req.Age)
+		return newUserOperationResponse(calError), nil
+	}
+}
+
+// 创建修改密码的endpoint
+func MakeChangePasswordEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ChangePasswordRequest)
+		calError := svc.ChangePassword(ctx, req.UserId, req.OldPassword, req.NewPassword)
+		return newUserOperationResponse(calError), nil
+	}
+}
+
+// 创建禁用、启用用户的endpoint
+func MakeDisableUserEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(DisableUserRequest)
+		calError := svc.DisableUser(ctx, req.UserId, req.Disabled)
+		return newUserOperationResponse(calError), nil
+	}
+}
+
+// 创建删除用户的endpoint
+func MakeDeleteUserEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(UserIdRequest)
+		calError := svc.DeleteUser(ctx, req.UserId)
+		return newUserOperationResponse(calError), nil
+	}
+}
+
+type MfaRequest struct {
+	UserId int64
+	IdType int
+}
+
+type MfaStatusResponse struct {
+	Enabled bool
+	Error   string
+}
+
+type MfaEnrollRequest struct {
+	UserId      int64
+	IdType      int
+	AccountName string
+	Issuer      string
+}
+
+type MfaEnrollResponse struct {
+	Secret string
+	Uri    string
+	Error  string
+}
+
+type MfaCodeRequest struct {
+	UserId int64
+	IdType int
+	Code   string
+}
+
+type MfaActivateResponse struct {
+	RecoveryCodes []string
+	Error         string
+}
+
+// 创建查询两步验证状态的endpoint
+func MakeMfaStatusEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(MfaRequest)
+		enabled, calError := svc.MfaStatus(ctx, req.UserId, req.IdType)
+		if calError != nil {
+			return MfaStatusResponse{Error: calError.Error()}, nil
+		}
+		return MfaStatusResponse{Enabled: enabled}, nil
+	}
+}
+
+// 创建绑定两步验证的endpoint
+func MakeMfaEnrollEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(MfaEnrollRequest)
+		secret, uri, calError := svc.MfaEnroll(ctx, req.UserId, req.IdType, req.AccountName, req.Issuer)
+		if calError != nil {
+			return MfaEnrollResponse{Error: calError.Error()}, nil
+		}
+		return MfaEnrollResponse{Secret: secret, Uri: uri}, nil
+	}
+}
+
+// 创建启用两步验证的endpoint
+func MakeMfaActivateEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(MfaCodeRequest)
+		recoveryCodes, calError := svc.MfaActivate(ctx, req.UserId, req.IdType, req.Code)
+		if calError != nil {
+			return MfaActivateResponse{Error: calError.Error()}, nil
+		}
+		return MfaActivateResponse{RecoveryCodes: recoveryCodes}, nil
+	}
+}
+
+// 创建校验动态码的endpoint
+func MakeMfaVerifyEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(MfaCodeRequest)
+		calError := svc.MfaVerify(ctx, req.UserId, req.IdType, req.Code)
+		return newUserOperationResponse(calError), nil
+	}
+}
+
+// 创建解除两步验证的endpoint
+func MakeMfaDisableEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(MfaCodeRequest)
+		calError := svc.MfaDisable(ctx, req.UserId, req.IdType, req.Code)
+		return newUserOperationResponse(calError), nil
+	}
+}
+
+// 自助注册请求，channel为email或sms，target为对应的邮箱或手机号
+type RegisterRequest struct {
+	Username string `json:"user_name"`
+	Password string `json:"password"`
+	Age      int    `json:"age"`
+	Channel  string `json:"channel"`
+	Target   string `json:"target"`
+	Ip       string `json:"-"`
+}
+
+type RegisterResponse struct {
+	Result bool   `json:"result"`
+	UserId int64  `json:"user_id"`
+	Error  string `json:"error"`
+}
+
+type ResendVerifyCodeRequest struct {
+	Username string `json:"user_name"`
+	Ip       string `json:"-"`
+}
+
+type VerifyAccountRequest struct {
+	Username string `json:"user_name"`
+	Code     string `json:"code"`
+}
+
+// 创建自助注册的endpoint，账号创建后处于未验证状态
+func MakeRegisterEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(RegisterRequest)
+		userId, calError := svc.Register(ctx, req.Username, req.Password, req.Age, req.Channel, req.Target, req.Ip)
+		if calError != nil {
+			return RegisterResponse{Result: false, Error: calError.Error()}, nil
+		}
+		return RegisterResponse{Result: true, UserId: userId}, nil
+	}
+}
+
+// 创建重新发送验证码的endpoint
+func MakeResendVerifyCodeEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(ResendVerifyCodeRequest)
+		calError := svc.ResendVerifyCode(ctx, req.Username, req.Ip)
+		return newUserOperationResponse(calError), nil
+	}
+}
+
+// 创建校验注册验证码的endpoint
+func MakeVerifyAccountEndpoint(svc service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(VerifyAccountRequest)
+		calError := svc.VerifyAccount(ctx, req.Username, req.Code)
+		return newUserOperationResponse(calError), nil
 	}
 }
 
@@ -5,7 +5,11 @@ import (
 	"final-design/pb"
 	"final-design/pkg/bootstrap"
 	"final-design/pkg/mysql"
+	"final-design/pkg/redis"
+	"final-design/pkg/snowflake"
+	"final-design/pkg/verifier"
 	"final-design/user-service/endpoint"
+	"final-design/user-service/model"
 	"final-design/user-service/plugins"
 	"final-design/user-service/service"
 	"final-design/user-service/transport"
@@ -14,13 +18,12 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	localconfig "final-design/user-service/config"
 
 	register "final-design/pkg/discover"
+	"final-design/pkg/shutdown"
 
 	conf "final-design/pkg/config"
 
@@ -36,7 +39,7 @@ import (
 func main() {
 	var (
 		servicePort = flag.String("service.port", bootstrap.HttpConfig.Port, "service port")
-		grpcAddr    = flag.String("grpc", ":9008", "gRPC listen address")
+		grpcAddr    = flag.String("grpc", bootstrap.RpcConfig.Port, "gRPC listen address")
 	)
 	flag.Parse()
 
@@ -58,8 +61,30 @@ func main() {
 		Help:      "Total duration of requests in microseconds.",
 	}, fieldKeys)
 
+	// 令牌黑名单和oauth-service签发的令牌记录保存在redis中
+	redis.InitRedis()
+
+	// 账号id使用雪花算法生成，未配置节点号时根据instanceId计算
+	nodeId := conf.Snowflake.NodeId
+	if nodeId == 0 {
+		nodeId = snowflake.NodeIdOf(bootstrap.DiscoverConfig.InstanceId)
+	}
+	if err := model.InitIdGenerator(nodeId); err != nil {
+		localconfig.Logger.Log("Fail to init id generator", err)
+		os.Exit(1)
+	}
+
 	ratebucket := rate.NewLimiter(rate.Every(time.Second*1), 5000)
-	var svc service.Service = service.UserService{}
+	// 注册验证码的发送方式由配置决定，开发环境打印到日志或写入文件
+	codeSender, err := service.NewCodeSender(conf.Register.Sender, conf.Register.SenderFile)
+	if err != nil {
+		localconfig.Logger.Log("Fail to init verify code sender", err)
+		os.Exit(1)
+	}
+	var svc service.Service = service.UserService{
+		VerifyCodes: service.NewRedisVerifyCodeService(conf.Redis.RedisConn, codeSender),
+		Tokens:      service.NewRedisTokenRevoker(conf.Redis.RedisConn),
+	}
 
 	// add logging middleware
 	svc = plugins.LoggingMiddleware(localconfig.Logger)(svc)
@@ -81,6 +106,66 @@ func main() {
 	createAdminUserPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(createAdminUserPoint)
 	createAdminUserPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "create-admin-user-endpoint")(createAdminUserPoint)
 
+	authoritiesPoint := endpoint.MakeAuthoritiesEndpoint(svc)
+	authoritiesPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(authoritiesPoint)
+	authoritiesPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "authorities-endpoint")(authoritiesPoint)
+
+	getUserPoint := endpoint.MakeGetUserEndpoint(svc)
+	getUserPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(getUserPoint)
+	getUserPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "get-user-endpoint")(getUserPoint)
+
+	updateUserPoint := endpoint.MakeUpdateUserEndpoint(svc)
+	updateUserPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(updateUserPoint)
+	updateUserPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "update-user-endpoint")(updateUserPoint)
+
+	changePasswordPoint := endpoint.MakeChangePasswordEndpoint(svc)
+	changePasswordPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(changePasswordPoint)
+	changePasswordPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "change-password-endpoint")(changePasswordPoint)
+
+	disableUserPoint := endpoint.MakeDisableUserEndpoint(svc)
+	disableUserPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(disableUserPoint)
+	disableUserPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "disable-user-endpoint")(disableUserPoint)
+
+	deleteUserPoint := endpoint.MakeDeleteUserEndpoint(svc)
+	deleteUserPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(deleteUserPoint)
+	deleteUserPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "delete-user-endpoint")(deleteUserPoint)
+
+	mfaStatusPoint := endpoint.MakeMfaStatusEndpoint(svc)
+	mfaStatusPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(mfaStatusPoint)
+	mfaStatusPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "mfa-status-endpoint")(mfaStatusPoint)
+
+	mfaEnrollPoint := endpoint.MakeMfaEnrollEndpoint(svc)
+	mfaEnrollPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(mfaEnrollPoint)
+	mfaEnrollPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "mfa-enroll-endpoint")(mfaEnrollPoint)
+
+	mfaActivatePoint := endpoint.MakeMfaActivateEndpoint(svc)
+	mfaActivatePoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(mfaActivatePoint)
+	mfaActivatePoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "mfa-activate-endpoint")(mfaActivatePoint)
+
+	mfaVerifyPoint := endpoint.MakeMfaVerifyEndpoint(svc)
+	mfaVerifyPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(mfaVerifyPoint)
+	mfaVerifyPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "mfa-verify-endpoint")(mfaVerifyPoint)
+
+	mfaDisablePoint := endpoint.MakeMfaDisableEndpoint(svc)
+	mfaDisablePoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(mfaDisablePoint)
+	mfaDisablePoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "mfa-disable-endpoint")(mfaDisablePoint)
+
+	registerPoint := endpoint.MakeRegisterEndpoint(svc)
+	registerPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(registerPoint)
+	registerPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "register-endpoint")(registerPoint)
+
+	resendVerifyCodePoint := endpoint.MakeResendVerifyCodeEndpoint(svc)
+	resendVerifyCodePoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(resendVerifyCodePoint)
+	resendVerifyCodePoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "resend-verify-code-endpoint")(resendVerifyCodePoint)
+
+	verifyAccountPoint := endpoint.MakeVerifyAccountEndpoint(svc)
+	verifyAccountPoint = plugins.NewTokenBucketLimitterWithBuildIn(ratebucket)(verifyAccountPoint)
+	verifyAccountPoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "verify-account-endpoint")(verifyAccountPoint)
+
+	// http接口按令牌中的角色鉴权，gRPC接口只供内部服务调用
+	userAuthority := verifier.MakeAuthorityMiddleware(verifier.RoleUser)
+	adminAuthority := verifier.MakeAuthorityMiddleware(verifier.RoleAdmin)
+
 	// 创建健康检查的Endpoint
 	healthEndpoint := endpoint.MakeHealthCheckEndpoint(svc)
 	healthEndpoint = kitzipkin.TraceEndpoint(localconfig.ZipkinTracer, "health-endpoint")(healthEndpoint)
@@ -90,13 +175,42 @@ func main() {
 		UserEndpoint:            userPoint,
 		CreateAdminUserEndpoint: createAdminUserPoint,
 		AdminUserEndpoint:       adminUserPoint,
+		AuthoritiesEndpoint:     authoritiesPoint,
+
+		GetUserEndpoint:        getUserPoint,
+		UpdateUserEndpoint:     updateUserPoint,
+		ChangePasswordEndpoint: changePasswordPoint,
+		DisableUserEndpoint:    disableUserPoint,
+		DeleteUserEndpoint:     deleteUserPoint,
+
+		ProfileEndpoint:               userAuthority(getUserPoint),
+		UpdateProfileEndpoint:         userAuthority(updateUserPoint),
+		ChangeProfilePasswordEndpoint: userAuthority(changePasswordPoint),
+
+		ManageCreateUserEndpoint:      adminAuthority(createUserPoint),
+		ManageCreateAdminUserEndpoint: adminAuthority(createAdminUserPoint),
+		ManageGetUserEndpoint:         adminAuthority(getUserPoint),
+		ManageDisableUserEndpoint:     adminAuthority(disableUserPoint),
+		ManageDeleteUserEndpoint:      adminAuthority(deleteUserPoint),
+
+		MfaStatusEndpoint:   mfaStatusPoint,
+		MfaEnrollEndpoint:   mfaEnrollPoint,
+		MfaActivateEndpoint: mfaActivatePoint,
+		MfaVerifyEndpoint:   mfaVerifyPoint,
+		MfaDisableEndpoint:  mfaDisablePoint,
+
+		RegisterEndpoint:         registerPoint,
+		ResendVerifyCodeEndpoint: resendVerifyCodePoint,
+		VerifyAccountEndpoint:    verifyAccountPoint,
 
 		HealthCheckEndpoint: healthEndpoint,
 	}
 
 	// 创建http.Handler
-	r := transport.MakeHttpHandler(ctx, endpts, localconfig.ZipkinTracer, localconfig.Logger)
+	r := transport.MakeHttpHandler(ctx, endpts, verifier.NewTokenVerifier(), localconfig.ZipkinTracer, localconfig.Logger)
 
+	server := &http.Server{Addr: ":" + *servicePort, Handler: r}
+	gRPCServer := grpc.NewServer()
 	// http server
 	go func() {
 		fmt.Println("Http Server start at port:" + *servicePort)
@@ -105,14 +219,13 @@ func main() {
 
 		//启动前执行注册
 		register.Register()
-		handler := r
-		errChan <- http.ListenAndServe(":"+*servicePort, handler)
+		errChan <- server.ListenAndServe()
 	}()
 
 	// grpc server
 	go func() {
 		fmt.Println("grpc Server start at port:" + *grpcAddr)
-		listener, err := net.Listen("tcp", *grpcAddr)
+		listener, err := net.Listen("tcp", ":"+*grpcAddr)
 		if err != nil {
 			errChan <- err
 			return
@@ -126,19 +239,13 @@ func main() {
 
 		ctx := metadata.NewIncomingContext(context.Background(), md)
 		handler := transport.NewGRPCServer(ctx, endpts, serverTracer)
-		gRPCServer := grpc.NewServer()
 		pb.RegisterUserServiceServer(gRPCServer, handler)
 		errChan <- gRPCServer.Serve(listener)
 	}()
 
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errChan <- fmt.Errorf("%s", <-c)
-	}()
-
-	error := <-errChan
-	//服务退出取消注册
-	register.Deregister()
-	fmt.Println(error)
+	//服务退出取消注册，再等待处理中的HTTP请求和gRPC调用完成
+	shutdown.New(register.Deregister).
+		HTTP(server).
+		GRPC(gRPCServer).
+		Wait(errChan)
 }
@@ -0,0 +1,324 @@
+package model
+
+import (
+	"errors"
+	"final-design/pkg/mysql"
+	"final-design/pkg/snowflake"
+	"log"
+	"time"
+
+	"github.com/gohouse/gorose/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 账号类型，对应登录和令牌中的id_type
+type AccountType int
+
+const (
+	AccountTypeUser  AccountType = 0 // 普通用户
+	AccountTypeAdmin AccountType = 1 // 管理员
+)
+
+const (
+	UserStatusNormal     = 0 // 正常
+	UserStatusDisabled   = 1 // 已禁用，不能登录
+	UserStatusDeleted    = 2 // 已删除(软删除)，用户名仍被占用
+	UserStatusUnverified = 3 // 自助注册后邮箱/手机号未验证，不能登录
+)
+
+var (
+	ErrUserNotFound       = errors.New("用户不存在")
+	ErrUserDisabled       = errors.New("用户已被禁用")
+	ErrUserUnverified     = errors.New("账号未验证，请先完成邮箱或手机号验证")
+	ErrWrongPassword      = errors.New("用户名或密码错误")
+	ErrInvalidAccountType = errors.New("账号类型不合法")
+	ErrIdGeneratorNotInit = errors.New("账号id生成器未初始化")
+)
+
+func (t AccountType) Valid() bool {
+	return t == AccountTypeUser || t == AccountTypeAdmin
+}
+
+// 账号类型默认具有的角色
+func (t AccountType) DefaultRole() string {
+	if t == AccountTypeAdmin {
+		return RoleAdmin
+	}
+	return RoleUser
+}
+
+// 账号表，普通用户和管理员共用，由原来的user表和admin_user表合并而来：
+//
+//	account(user_id, user_name, password, age, id_type, status, email, phone)
+//	user_id由雪花算法生成，(id_type, user_name)唯一，email和phone未绑定时为NULL，绑定后在已验证的账号中唯一；
+//	code_sent_at为未验证账号最近一次发送验证码的时间
+type Account struct {
+	UserId   int64       `json:"user_id"`   // Id
+	Username string      `json:"user_name"` // 用户名称
+	Password string      `json:"password"`  // 密码
+	Age      int         `json:"age"`       // 年龄
+	Type     AccountType `json:"id_type"`   // 账号类型
+	Status   int         `json:"status"`    // 账号状态
+	Email    string      `json:"email"`     // 邮箱，可为空
+	Phone    string      `json:"phone"`     // 手机号，可为空
+}
+
+type AccountModel struct{}
+
+func NewAccountModel() *AccountModel {
+	return &AccountModel{}
+}
+
+// 生成账号id的节点，服务启动时通过InitIdGenerator设置
+var idGenerator *snowflake.Node
+
+func InitIdGenerator(nodeId int64) error {
+	node, err := snowflake.NewNode(nodeId)
+	if err != nil {
+		return err
+	}
+	idGenerator = node
+	return nil
+}
+
+func (p *AccountModel) getTableName() string {
+	return "account"
+}
+
+func (p *AccountModel) GetAccountList(accountType AccountType) ([]gorose.Data, error) {
+	conn := mysql.DB()
+	list, err := conn.Table(p.getTableName()).Where("id_type", int(accountType)).Get()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// 校验用户名和密码，已删除的账号视为不存在，已禁用和未验证的账号不能登录
+func (p *AccountModel) CheckAccount(username string, password string, accountType AccountType) (*Account, error) {
+	conn := mysql.DB()
+	data, err := conn.Table(p.getTableName()).Where("user_name", username).Where("id_type", int(accountType)).
+		Where("status", "<>", UserStatusDeleted).First()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrWrongPassword
+	}
+	account := toAccount(data)
+	if !p.ComparePassword(account, password) {
+		return nil, ErrWrongPassword
+	}
+	switch account.Status {
+	case UserStatusDisabled:
+		return nil, ErrUserDisabled
+	case UserStatusUnverified:
+		return nil, ErrUserUnverified
+	}
+	return account, nil
+}
+
+// 根据id获取未删除的账号
+func (p *AccountModel) GetAccountById(userId int64) (*Account, error) {
+	conn := mysql.DB()
+	data, err := conn.Table(p.getTableName()).Where("user_id", userId).
+		Where("status", "<>", UserStatusDeleted).First()
+	if err != nil {
+		log.Printf("GetAccountById, Error: %v", err)
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrUserNotFound
+	}
+	return toAccount(data), nil
+}
+
+// 根据用户名获取未删除的账号
+func (p *AccountModel) GetAccountByUsername(username string, accountType AccountType) (*Account, error) {
+	conn := mysql.DB()
+	data, err := conn.Table(p.getTableName()).Where("user_name", username).Where("id_type", int(accountType)).
+		Where("status", "<>", UserStatusDeleted).First()
+	if err != nil {
+		log.Printf("GetAccountByUsername, Error: %v", err)
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrUserNotFound
+	}
+	return toAccount(data), nil
+}
+
+// 邮箱或手机号是否已被其他账号绑定，column为email或phone；
+// 未验证的账号只在sentAfter之后发送过验证码时占用邮箱或手机号
+func (p *AccountModel) ExistsContact(column, value string, sentAfter time.Time) (bool, error) {
+	conn := mysql.DB()
+	count, err := conn.Table(p.getTableName()).Where(column, value).
+		Where("status", "<>", UserStatusUnverified).Count()
+	if err == nil && count == 0 {
+		count, err = conn.Table(p.getTableName()).Where(column, value).
+			Where("status", UserStatusUnverified).Where("code_sent_at", ">", sentAfter).Count()
+	}
+	if err != nil {
+		log.Printf("ExistsContact, Error: %v", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// 删除column为value、在sentBefore之前发送验证码后一直未验证的账号，释放其用户名、邮箱和手机号
+func (p *AccountModel) DeleteStaleUnverified(column, value string, sentBefore time.Time) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Where(column, value).
+		Where("status", UserStatusUnverified).Where("code_sent_at", "<=", sentBefore).Delete()
+	if err != nil {
+		log.Printf("DeleteStaleUnverified, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// 删除未验证的账号，注册时验证码发送失败后回滚
+func (p *AccountModel) DeleteUnverified(userId int64) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Where("user_id", userId).
+		Where("status", UserStatusUnverified).Delete()
+	if err != nil {
+		log.Printf("DeleteUnverified, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// 记录重新发送验证码的时间，验证码有效期内账号继续占用邮箱或手机号
+func (p *AccountModel) UpdateCodeSentAt(userId int64) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Data(map[string]interface{}{
+		"code_sent_at": time.Now(),
+	}).Where("user_id", userId).Where("status", UserStatusUnverified).Update()
+	if err != nil {
+		log.Printf("UpdateCodeSentAt, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// 用户名在该账号类型下是否已被使用，已删除账号的用户名同样视为已使用
+func (p *AccountModel) ExistsUsername(username string, accountType AccountType) (bool, error) {
+	conn := mysql.DB()
+	count, err := conn.Table(p.getTableName()).Where("user_name", username).Where("id_type", int(accountType)).Count()
+	if err != nil {
+		log.Printf("ExistsUsername, Error: %v", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// 校验账号的密码
+func (p *AccountModel) ComparePassword(account *Account, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)) == nil
+}
+
+// 创建账号，id由服务端生成，忽略account.UserId，返回新账号的id；account.Status为0时创建正常状态的账号
+func (p *AccountModel) CreateAccount(account *Account) (int64, error) {
+	if !account.Type.Valid() {
+		return 0, ErrInvalidAccountType
+	}
+	if idGenerator == nil {
+		return 0, ErrIdGeneratorNotInit
+	}
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(account.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+	userId := idGenerator.Generate()
+	data := map[string]interface{}{
+		"user_id":   userId,
+		"user_name": account.Username,
+		"password":  string(hashPassword),
+		"age":       account.Age,
+		"id_type":   int(account.Type),
+		"status":    account.Status,
+		"email":     nullableString(account.Email),
+		"phone":     nullableString(account.Phone),
+	}
+	if account.Status == UserStatusUnverified {
+		data["code_sent_at"] = time.Now()
+	}
+	conn := mysql.DB()
+	_, err = conn.Table(p.getTableName()).Data(data).Insert()
+	if err != nil {
+		log.Printf("CreateAccount, Error: %v", err)
+		return 0, err
+	}
+	return userId, nil
+}
+
+// 修改用户名和年龄
+func (p *AccountModel) UpdateAccount(account *Account) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Data(map[string]interface{}{
+		"user_name": account.Username,
+		"age":       account.Age,
+	}).Where("user_id", account.UserId).Update()
+	if err != nil {
+		log.Printf("UpdateAccount, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (p *AccountModel) UpdatePassword(userId int64, password string) error {
+	conn := mysql.DB()
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Table(p.getTableName()).Data(map[string]interface{}{
+		"password": string(hashPassword),
+	}).Where("user_id", userId).Update()
+	if err != nil {
+		log.Printf("UpdatePassword, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (p *AccountModel) UpdateStatus(userId int64, status int) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Data(map[string]interface{}{
+		"status": status,
+	}).Where("user_id", userId).Update()
+	if err != nil {
+		log.Printf("UpdateStatus, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// 空字符串保存为NULL，避免未绑定的账号违反唯一索引
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func toAccount(data gorose.Data) *Account {
+	age, _ := data["age"].(int64)
+	idType, _ := data["id_type"].(int64)
+	status, _ := data["status"].(int64)
+	email, _ := data["email"].(string)
+	phone, _ := data["phone"].(string)
+	return &Account{
+		UserId:   data["user_id"].(int64),
+		Username: data["user_name"].(string),
+		Password: data["password"].(string),
+		Age:      int(age),
+		Type:     AccountType(idType),
+		Status:   int(status),
+		Email:    email,
+		Phone:    phone,
+	}
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"encoding/json"
+	"final-design/pkg/mysql"
+	"log"
+)
+
+// 两步验证表：
+//
+//	user_mfa(user_id, id_type, secret, enabled, recovery_codes, last_step)
+//	recovery_codes为恢复码sha256的json数组，last_step为最近一次使用的TOTP时间步，防止动态码重放
+//	建表语句见user-service/sql/mfa_migration.sql
+type UserMfa struct {
+	UserId        int64
+	IdType        int
+	Secret        string   // base32编码的TOTP密钥
+	Enabled       bool     // 验证过一次动态码后启用
+	RecoveryCodes []string // 未使用的恢复码哈希
+	LastStep      int64
+}
+
+type UserMfaModel struct{}
+
+func NewUserMfaModel() *UserMfaModel {
+	return &UserMfaModel{}
+}
+
+func (p *UserMfaModel) getTableName() string {
+	return "user_mfa"
+}
+
+// 获取用户的两步验证配置，未绑定时返回nil
+func (p *UserMfaModel) GetUserMfa(userId int64, idType int) (*UserMfa, error) {
+	conn := mysql.DB()
+	data, err := conn.Table(p.getTableName()).Where("user_id", userId).Where("id_type", idType).First()
+	if err != nil {
+		log.Printf("GetUserMfa, Error: %v", err)
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var recoveryCodes []string
+	if codes, ok := data["recovery_codes"].(string); ok && codes != "" {
+		_ = json.Unmarshal([]byte(codes), &recoveryCodes)
+	}
+	enabled, _ := data["enabled"].(int64)
+	lastStep, _ := data["last_step"].(int64)
+	return &UserMfa{
+		UserId:        userId,
+		IdType:        idType,
+		Secret:        data["secret"].(string),
+		Enabled:       enabled != 0,
+		RecoveryCodes: recoveryCodes,
+		LastStep:      lastStep,
+	}, nil
+}
+
+func (p *UserMfaModel) CreateUserMfa(mfa *UserMfa) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Data(p.toData(mfa)).Insert()
+	if err != nil {
+		log.Printf("CreateUserMfa, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (p *UserMfaModel) UpdateUserMfa(mfa *UserMfa) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Data(p.toData(mfa)).
+		Where("user_id", mfa.UserId).Where("id_type", mfa.IdType).Update()
+	if err != nil {
+		log.Printf("UpdateUserMfa, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// 记录使用过的时间步，只有比已记录的更新时才成功，并发使用同一动态码时只有一个请求成功
+func (p *UserMfaModel) UseStep(userId int64, idType int, step int64) (bool, error) {
+	conn := mysql.DB()
+	affected, err := conn.Table(p.getTableName()).Data(map[string]interface{}{
+		"last_step": step,
+	}).Where("user_id", userId).Where("id_type", idType).Where("last_step", "<", step).Update()
+	if err != nil {
+		log.Printf("UseStep, Error: %v", err)
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// 更新未使用的恢复码，只有恢复码未被其他请求修改时才成功，保证每个恢复码只能使用一次
+func (p *UserMfaModel) UpdateRecoveryCodes(userId int64, idType int, oldCodes []string, newCodes []string) (bool, error) {
+	oldData, _ := json.Marshal(oldCodes)
+	newData, _ := json.Marshal(newCodes)
+	conn := mysql.DB()
+	affected, err := conn.Table(p.getTableName()).Data(map[string]interface{}{
+		"recovery_codes": string(newData),
+	}).Where("user_id", userId).Where("id_type", idType).Where("recovery_codes", string(oldData)).Update()
+	if err != nil {
+		log.Printf("UpdateRecoveryCodes, Error: %v", err)
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (p *UserMfaModel) DeleteUserMfa(userId int64, idType int) error {
+	conn := mysql.DB()
+	_, err := conn.Table(p.getTableName()).Where("user_id", userId).Where("id_type", idType).Delete()
+	if err != nil {
+		log.Printf("DeleteUserMfa, Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (p *UserMfaModel) toData(mfa *UserMfa) map[string]interface{} {
+	recoveryCodes, _ := json.Marshal(mfa.RecoveryCodes)
+	return map[string]interface{}{
+		"user_id":        mfa.UserId,
+		"id_type":        mfa.IdType,
+		"secret":         mfa.Secret,
+		"enabled":        boolToInt(mfa.Enabled),
+		"recovery_codes": string(recoveryCodes),
+		"last_step":      mfa.LastStep,
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"final-design/pkg/mysql"
+	"log"
+	"strings"
+)
+
+const (
+	RoleUser  = "ROLE_USER"  // 普通用户默认具有的角色
+	RoleAdmin = "ROLE_ADMIN" // 管理员默认具有的角色
+)
+
+// 角色相关的表，建表语句见sql/role_migration.sql：
+//
+//	role(role_id, role_name, description)
+//	permission(permission_id, permission_name, description)
+//	role_permission(role_id, permission_id)
+//	user_role(user_id, id_type, role_id)，id_type为账号类型
+type Role struct {
+	RoleId      int64  `json:"role_id"`     // Id
+	RoleName    string `json:"role_name"`   // 角色名称，如ROLE_ADMIN
+	Description string `json:"description"` // 描述
+}
+
+type RoleModel struct{}
+
+func NewRoleModel() *RoleModel {
+	return &RoleModel{}
+}
+
+// 获取用户的角色和权限，角色以ROLE_开头，权限为permission表中的名称；
+// 用户除了user_role中分配的角色外，还默认具有其账号类型对应的角色
+func (p *RoleModel) GetAuthorities(userId int64, accountType AccountType) ([]string, error) {
+	roles := []string{accountType.DefaultRole()}
+
+	conn := mysql.DB()
+	list, err := conn.Query("SELECT r.role_name FROM user_role ur JOIN role r ON ur.role_id = r.role_id "+
+		"WHERE ur.user_id = ? AND ur.id_type = ?", userId, int(accountType))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, err
+	}
+	for _, data := range list {
+		roles = appendUnique(roles, data["role_name"].(string))
+	}
+
+	args := make([]interface{}, 0, len(roles))
+	for _, role := range roles {
+		args = append(args, role)
+	}
+	list, err = conn.Query("SELECT DISTINCT p.permission_name FROM role r "+
+		"JOIN role_permission rp ON r.role_id = rp.role_id "+
+		"JOIN permission p ON rp.permission_id = p.permission_id "+
+		"WHERE r.role_name IN (?"+strings.Repeat(",?", len(roles)-1)+")", args...)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, err
+	}
+	authorities := roles
+	for _, data := range list {
+		authorities = appendUnique(authorities, data["permission_name"].(string))
+	}
+	return authorities, nil
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
@@ -3,6 +3,7 @@ package plugins
 import (
 	"context"
 	"errors"
+	"final-design/user-service/model"
 	"final-design/user-service/service"
 	"time"
 
@@ -57,15 +58,14 @@ func Metrics(requestCount metrics.Counter, requestLatency metrics.Histogram) ser
 	}
 }
 
-func (mw metricMiddleware) Create(ctx context.Context, username, password string, userId int64, age int) error {
+func (mw metricMiddleware) Create(ctx context.Context, username, password string, age int) (int64, error) {
 	defer func(begin time.Time) {
 		lvs := []string{"method", "Create"}
 		mw.requestCount.With(lvs...).Add(1)
 		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	err := mw.Service.Create(ctx, username, password, userId, age)
-	return err
+	return mw.Service.Create(ctx, username, password, age)
 }
 
 func (mw metricMiddleware) Check(ctx context.Context, a, b string) (ret int64, err error) {
@@ -79,15 +79,14 @@ func (mw metricMiddleware) Check(ctx context.Context, a, b string) (ret int64, e
 	return ret, err
 }
 
-func (mw metricMiddleware) CreateAdmin(ctx context.Context, username, password string, userId int64, age int) error {
+func (mw metricMiddleware) CreateAdmin(ctx context.Context, username, password string, age int) (int64, error) {
 	defer func(begin time.Time) {
 		lvs := []string{"method", "CreateAdmin"}
 		mw.requestCount.With(lvs...).Add(1)
 		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	err := mw.Service.CreateAdmin(ctx, username, password, userId, age)
-	return err
+	return mw.Service.CreateAdmin(ctx, username, password, age)
 }
 
 func (mw metricMiddleware) CheckAdmin(ctx context.Context, a, b string) (ret int64, err error) {
@@ -101,6 +100,160 @@ func (mw metricMiddleware) CheckAdmin(ctx context.Context, a, b string) (ret int
 	return ret, err
 }
 
+func (mw metricMiddleware) Authorities(ctx context.Context, userId int64, idType int) (ret []string, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "Authorities"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ret, err = mw.Service.Authorities(ctx, userId, idType)
+	return ret, err
+}
+
+func (mw metricMiddleware) GetUser(ctx context.Context, userId int64) (ret *model.Account, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "GetUser"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ret, err = mw.Service.GetUser(ctx, userId)
+	return ret, err
+}
+
+func (mw metricMiddleware) UpdateUser(ctx context.Context, userId int64, username string, age int) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "UpdateUser"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.UpdateUser(ctx, userId, username, age)
+	return err
+}
+
+func (mw metricMiddleware) ChangePassword(ctx context.Context, userId int64, oldPassword, newPassword string) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "ChangePassword"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.ChangePassword(ctx, userId, oldPassword, newPassword)
+	return err
+}
+
+func (mw metricMiddleware) DisableUser(ctx context.Context, userId int64, disabled bool) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "DisableUser"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.DisableUser(ctx, userId, disabled)
+	return err
+}
+
+func (mw metricMiddleware) DeleteUser(ctx context.Context, userId int64) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "DeleteUser"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.DeleteUser(ctx, userId)
+	return err
+}
+
+func (mw metricMiddleware) MfaStatus(ctx context.Context, userId int64, idType int) (ret bool, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "MfaStatus"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ret, err = mw.Service.MfaStatus(ctx, userId, idType)
+	return ret, err
+}
+
+func (mw metricMiddleware) MfaEnroll(ctx context.Context, userId int64, idType int, accountName, issuer string) (secret, uri string, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "MfaEnroll"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	secret, uri, err = mw.Service.MfaEnroll(ctx, userId, idType, accountName, issuer)
+	return secret, uri, err
+}
+
+func (mw metricMiddleware) MfaActivate(ctx context.Context, userId int64, idType int, code string) (ret []string, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "MfaActivate"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ret, err = mw.Service.MfaActivate(ctx, userId, idType, code)
+	return ret, err
+}
+
+func (mw metricMiddleware) MfaVerify(ctx context.Context, userId int64, idType int, code string) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "MfaVerify"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.MfaVerify(ctx, userId, idType, code)
+	return err
+}
+
+func (mw metricMiddleware) MfaDisable(ctx context.Context, userId int64, idType int, code string) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "MfaDisable"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.MfaDisable(ctx, userId, idType, code)
+	return err
+}
+
+func (mw metricMiddleware) Register(ctx context.Context, username, password string, age int, channel, target, ip string) (userId int64, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "Register"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	userId, err = mw.Service.Register(ctx, username, password, age, channel, target, ip)
+	return userId, err
+}
+
+func (mw metricMiddleware) ResendVerifyCode(ctx context.Context, username, ip string) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "ResendVerifyCode"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.ResendVerifyCode(ctx, username, ip)
+	return err
+}
+
+func (mw metricMiddleware) VerifyAccount(ctx context.Context, username, code string) (err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "VerifyAccount"}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	err = mw.Service.VerifyAccount(ctx, username, code)
+	return err
+}
+
 func (mw metricMiddleware) HealthCheck() (result bool) {
 	defer func(begin time.Time) {
 		lvs := []string{"method", "HealthCheck"}
@@ -2,7 +2,9 @@ package plugins
 
 import (
 	"context"
+	"final-design/user-service/model"
 	"final-design/user-service/service"
+	"fmt"
 	"time"
 
 	"github.com/go-kit/log"
@@ -22,17 +24,19 @@ func LoggingMiddleware(logger log.Logger) service.ServiceMiddleware {
 	}
 }
 
-func (mw loggingMiddleware) Create(ctx context.Context, username, password string, userId int64, age int) (err error) {
+func (mw loggingMiddleware) Create(ctx context.Context, username, password string, age int) (userId int64, err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log(
 			"function", "Create",
+			"username", username,
+			"userId", userId,
 			"result", err == nil,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
 
-	err = mw.Service.Create(ctx, username, password, userId, age)
-	return
+	userId, err = mw.Service.Create(ctx, username, password, age)
+	return userId, err
 }
 
 func (mw loggingMiddleware) Check(ctx context.Context, a, b string) (ret int64, err error) {
@@ -50,17 +54,19 @@ func (mw loggingMiddleware) Check(ctx context.Context, a, b string) (ret int64,
 	return ret, err
 }
 
-func (mw loggingMiddleware) CreateAdmin(ctx context.Context, username, password string, userId int64, age int) (err error) {
+func (mw loggingMiddleware) CreateAdmin(ctx context.Context, username, password string, age int) (userId int64, err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log(
 			"function", "CreateAdmin",
+			"username", username,
+			"userId", userId,
 			"result", err == nil,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
 
-	err = mw.Service.CreateAdmin(ctx, username, password, userId, age)
-	return
+	userId, err = mw.Service.CreateAdmin(ctx, username, password, age)
+	return userId, err
 }
 
 func (mw loggingMiddleware) CheckAdmin(ctx context.Context, a, b string) (ret int64, err error) {
@@ -78,6 +84,214 @@ func (mw loggingMiddleware) CheckAdmin(ctx context.Context, a, b string) (ret in
 	return ret, err
 }
 
+func (mw loggingMiddleware) Authorities(ctx context.Context, userId int64, idType int) (ret []string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "Authorities",
+			"userId", userId,
+			"idType", idType,
+			"result", fmt.Sprint(ret),
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	ret, err = mw.Service.Authorities(ctx, userId, idType)
+	return ret, err
+}
+
+func (mw loggingMiddleware) GetUser(ctx context.Context, userId int64) (ret *model.Account, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "GetUser",
+			"userId", userId,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	ret, err = mw.Service.GetUser(ctx, userId)
+	return ret, err
+}
+
+func (mw loggingMiddleware) UpdateUser(ctx context.Context, userId int64, username string, age int) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "UpdateUser",
+			"userId", userId,
+			"username", username,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.UpdateUser(ctx, userId, username, age)
+	return
+}
+
+func (mw loggingMiddleware) ChangePassword(ctx context.Context, userId int64, oldPassword, newPassword string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "ChangePassword",
+			"userId", userId,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.ChangePassword(ctx, userId, oldPassword, newPassword)
+	return
+}
+
+func (mw loggingMiddleware) DisableUser(ctx context.Context, userId int64, disabled bool) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "DisableUser",
+			"userId", userId,
+			"disabled", disabled,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.DisableUser(ctx, userId, disabled)
+	return
+}
+
+func (mw loggingMiddleware) DeleteUser(ctx context.Context, userId int64) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "DeleteUser",
+			"userId", userId,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.DeleteUser(ctx, userId)
+	return
+}
+
+func (mw loggingMiddleware) MfaStatus(ctx context.Context, userId int64, idType int) (ret bool, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "MfaStatus",
+			"userId", userId,
+			"idType", idType,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	ret, err = mw.Service.MfaStatus(ctx, userId, idType)
+	return ret, err
+}
+
+func (mw loggingMiddleware) MfaEnroll(ctx context.Context, userId int64, idType int, accountName, issuer string) (secret, uri string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "MfaEnroll",
+			"userId", userId,
+			"idType", idType,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	secret, uri, err = mw.Service.MfaEnroll(ctx, userId, idType, accountName, issuer)
+	return secret, uri, err
+}
+
+func (mw loggingMiddleware) MfaActivate(ctx context.Context, userId int64, idType int, code string) (ret []string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "MfaActivate",
+			"userId", userId,
+			"idType", idType,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	ret, err = mw.Service.MfaActivate(ctx, userId, idType, code)
+	return ret, err
+}
+
+func (mw loggingMiddleware) MfaVerify(ctx context.Context, userId int64, idType int, code string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "MfaVerify",
+			"userId", userId,
+			"idType", idType,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.MfaVerify(ctx, userId, idType, code)
+	return err
+}
+
+func (mw loggingMiddleware) MfaDisable(ctx context.Context, userId int64, idType int, code string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "MfaDisable",
+			"userId", userId,
+			"idType", idType,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.MfaDisable(ctx, userId, idType, code)
+	return err
+}
+
+func (mw loggingMiddleware) Register(ctx context.Context, username, password string, age int, channel, target, ip string) (userId int64, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "Register",
+			"username", username,
+			"channel", channel,
+			"ip", ip,
+			"userId", userId,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	userId, err = mw.Service.Register(ctx, username, password, age, channel, target, ip)
+	return userId, err
+}
+
+func (mw loggingMiddleware) ResendVerifyCode(ctx context.Context, username, ip string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "ResendVerifyCode",
+			"username", username,
+			"ip", ip,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.ResendVerifyCode(ctx, username, ip)
+	return err
+}
+
+func (mw loggingMiddleware) VerifyAccount(ctx context.Context, username, code string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"function", "VerifyAccount",
+			"username", username,
+			"result", err == nil,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	err = mw.Service.VerifyAccount(ctx, username, code)
+	return err
+}
+
 func (mw loggingMiddleware) HealthCheck() (result bool) {
 	defer func(begin time.Time) {
 		mw.logger.Log(
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelSms   = "sms"
+
+	SenderLog  = "log"
+	SenderFile = "file"
+)
+
+var ErrUnknownSender = errors.New("unknown verify code sender")
+
+// 验证码发送接口，接入邮件或短信服务时实现该接口即可
+type CodeSender interface {
+	// channel为email或sms，target为邮箱或手机号
+	Send(ctx context.Context, channel, target, code string) error
+}
+
+// 根据配置创建验证码发送方式，未配置时打印到日志
+func NewCodeSender(sender, file string) (CodeSender, error) {
+	switch sender {
+	case "", SenderLog:
+		return LogCodeSender{}, nil
+	case SenderFile:
+		if file == "" {
+			return nil, errors.New("verify code sender file is empty")
+		}
+		return &FileCodeSender{path: file}, nil
+	}
+	return nil, ErrUnknownSender
+}
+
+// 把验证码打印到日志，仅用于开发环境
+type LogCodeSender struct{}
+
+func (LogCodeSender) Send(ctx context.Context, channel, target, code string) error {
+	log.Printf("verify code, channel: %s, target: %s, code: %s", channel, target, code)
+	return nil
+}
+
+// 把验证码追加到文件中，仅用于开发环境
+type FileCodeSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (s *FileCodeSender) Send(ctx context.Context, channel, target, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), channel, target, code)
+	return err
+}
@@ -2,65 +2,508 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	conf "final-design/pkg/config"
 	"final-design/user-service/model"
 	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 64 // bcrypt只使用前72个字节
+	maxUsernameLength = 32
+)
+
+var (
+	ErrUsernameExists  = errors.New("用户名已存在")
+	ErrInvalidUsername = errors.New("用户名不合法")
+	ErrWeakPassword    = errors.New("密码长度需要在8到64位之间，且同时包含字母和数字")
+	ErrWrongPassword   = errors.New("原密码错误")
+
+	ErrRegisterDisabled    = errors.New("未开启自助注册")
+	ErrInvalidChannel      = errors.New("验证方式只能是email或sms")
+	ErrInvalidEmail        = errors.New("邮箱格式不正确")
+	ErrInvalidPhone        = errors.New("手机号格式不正确")
+	ErrContactExists       = errors.New("邮箱或手机号已被使用")
+	ErrAccountVerified     = errors.New("账号已验证")
+	ErrAccountNotVerifying = errors.New("账号没有待验证的邮箱或手机号")
+
+	ErrMfaNotEnrolled    = errors.New("未绑定两步验证")
+	ErrMfaAlreadyEnabled = errors.New("已启用两步验证")
+	ErrInvalidMfaCode    = errors.New("验证码错误")
 )
 
 // Service define a service interface
 type Service interface {
-	Create(ctx context.Context, username, password string, userId int64, age int) error
+	// 创建账号，返回服务端生成的用户id
+	Create(ctx context.Context, username, password string, age int) (int64, error)
 	Check(ctx context.Context, username, password string) (int64, error)
 
-	CreateAdmin(ctx context.Context, username, password string, userId int64, age int) error
+	CreateAdmin(ctx context.Context, username, password string, age int) (int64, error)
 	CheckAdmin(ctx context.Context, username string, password string) (int64, error)
 
+	// 获取用户的角色和权限，idType：0是普通用户、1是管理员
+	Authorities(ctx context.Context, userId int64, idType int) ([]string, error)
+
+	// 账号管理，普通用户和管理员的id不会重复，已删除的账号不能再查询和修改
+	GetUser(ctx context.Context, userId int64) (*model.Account, error)
+	UpdateUser(ctx context.Context, userId int64, username string, age int) error
+	ChangePassword(ctx context.Context, userId int64, oldPassword, newPassword string) error
+	// 禁用后不能登录，disabled为false时重新启用
+	DisableUser(ctx context.Context, userId int64, disabled bool) error
+	DeleteUser(ctx context.Context, userId int64) error
+
+	// 两步验证(TOTP)，idType：0是普通用户、1是管理员
+	MfaStatus(ctx context.Context, userId int64, idType int) (bool, error)
+	// 生成密钥和otpauth地址，验证一次动态码后才启用
+	MfaEnroll(ctx context.Context, userId int64, idType int, accountName, issuer string) (string, string, error)
+	// 校验动态码并启用，返回恢复码明文，只返回这一次
+	MfaActivate(ctx context.Context, userId int64, idType int, code string) ([]string, error)
+	// 校验动态码或恢复码，恢复码只能使用一次
+	MfaVerify(ctx context.Context, userId int64, idType int, code string) error
+	// 校验动态码或恢复码后解除绑定
+	MfaDisable(ctx context.Context, userId int64, idType int, code string) error
+
+	// 自助注册：发送验证码并创建未验证的普通用户，channel为email或sms，target为邮箱或手机号，ip用于发送次数限制
+	Register(ctx context.Context, username, password string, age int, channel, target, ip string) (int64, error)
+	// 重新向注册时填写的邮箱或手机号发送验证码
+	ResendVerifyCode(ctx context.Context, username, ip string) error
+	// 校验验证码，通过后账号才能登录
+	VerifyAccount(ctx context.Context, username, code string) error
+
 	// HealthCheck check service health status
 	HealthCheck() bool
 }
 
 // UserService implement Service interface
-type UserService struct{}
+type UserService struct {
+	VerifyCodes VerifyCodeService // 为nil时不能自助注册
+	Tokens      TokenRevoker      // 修改密码、禁用、删除账号后吊销该用户的令牌，为nil时不吊销
+}
+
+// 账号状态或密码变化后吊销已签发的令牌，失败时只记录日志，账号的修改已经生效
+func (s UserService) revokeTokens(userId int64) {
+	if s.Tokens == nil {
+		return
+	}
+	if err := s.Tokens.RevokeUser(userId); err != nil {
+		log.Printf("RevokeUser %d failed, Error: %v", userId, err)
+	}
+}
 
-func (s UserService) Create(ctx context.Context, username, password string, userId int64, age int) error {
-	userEntity := model.NewUserModel()
-	err := userEntity.CreateUser(&model.User{
+// 普通用户和管理员共用account表，id由雪花算法生成
+func (s UserService) createAccount(username, password string, age int, accountType model.AccountType) (int64, error) {
+	if err := s.validateAccount(username, password, accountType); err != nil {
+		return 0, err
+	}
+	return model.NewAccountModel().CreateAccount(&model.Account{
 		Username: username,
 		Password: password,
-		UserId:   userId,
 		Age:      age,
+		Type:     accountType,
 	})
-	return err
 }
 
-func (s UserService) Check(ctx context.Context, username string, password string) (int64, error) {
-	userEntity := model.NewUserModel()
-	res, err := userEntity.CheckUser(username, password)
+func (s UserService) validateAccount(username, password string, accountType model.AccountType) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	if exists, err := model.NewAccountModel().ExistsUsername(username, accountType); err != nil {
+		return err
+	} else if exists {
+		return ErrUsernameExists
+	}
+	return nil
+}
+
+func (s UserService) checkAccount(username, password string, accountType model.AccountType) (int64, error) {
+	account, err := model.NewAccountModel().CheckAccount(username, password, accountType)
 	if err != nil {
-		log.Printf("UserEntity.CheckUser, err: %v", err)
+		log.Printf("AccountEntity.CheckAccount, err: %v", err)
 		return 0, err
 	}
-	return res.UserId, nil
+	return account.UserId, nil
+}
+
+func (s UserService) Create(ctx context.Context, username, password string, age int) (int64, error) {
+	return s.createAccount(username, password, age, model.AccountTypeUser)
+}
+
+func (s UserService) Check(ctx context.Context, username string, password string) (int64, error) {
+	return s.checkAccount(username, password, model.AccountTypeUser)
+}
+
+func (s UserService) CreateAdmin(ctx context.Context, username, password string, age int) (int64, error) {
+	return s.createAccount(username, password, age, model.AccountTypeAdmin)
+}
+
+func (s UserService) CheckAdmin(ctx context.Context, username string, password string) (int64, error) {
+	return s.checkAccount(username, password, model.AccountTypeAdmin)
+}
+
+func (s UserService) Authorities(ctx context.Context, userId int64, idType int) ([]string, error) {
+	accountType := model.AccountType(idType)
+	if !accountType.Valid() {
+		return nil, model.ErrInvalidAccountType
+	}
+	roleEntity := model.NewRoleModel()
+	authorities, err := roleEntity.GetAuthorities(userId, accountType)
+	if err != nil {
+		log.Printf("RoleEntity.GetAuthorities, err: %v", err)
+		return nil, err
+	}
+	return authorities, nil
+}
+
+func (s UserService) GetUser(ctx context.Context, userId int64) (*model.Account, error) {
+	userEntity := model.NewAccountModel()
+	user, err := userEntity.GetAccountById(userId)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+func (s UserService) UpdateUser(ctx context.Context, userId int64, username string, age int) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	userEntity := model.NewAccountModel()
+	user, err := userEntity.GetAccountById(userId)
+	if err != nil {
+		return err
+	}
+	if username != user.Username {
+		if exists, err := userEntity.ExistsUsername(username, user.Type); err != nil {
+			return err
+		} else if exists {
+			return ErrUsernameExists
+		}
+	}
+	user.Username, user.Age = username, age
+	return userEntity.UpdateAccount(user)
+}
+
+func (s UserService) ChangePassword(ctx context.Context, userId int64, oldPassword, newPassword string) error {
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+	userEntity := model.NewAccountModel()
+	user, err := userEntity.GetAccountById(userId)
+	if err != nil {
+		return err
+	}
+	if !userEntity.ComparePassword(user, oldPassword) {
+		return ErrWrongPassword
+	}
+	if err := userEntity.UpdatePassword(userId, newPassword); err != nil {
+		return err
+	}
+	s.revokeTokens(userId)
+	return nil
+}
+
+func (s UserService) DisableUser(ctx context.Context, userId int64, disabled bool) error {
+	userEntity := model.NewAccountModel()
+	if _, err := userEntity.GetAccountById(userId); err != nil {
+		return err
+	}
+	status := model.UserStatusNormal
+	if disabled {
+		status = model.UserStatusDisabled
+	}
+	if err := userEntity.UpdateStatus(userId, status); err != nil {
+		return err
+	}
+	if disabled {
+		s.revokeTokens(userId)
+	}
+	return nil
+}
+
+func (s UserService) DeleteUser(ctx context.Context, userId int64) error {
+	userEntity := model.NewAccountModel()
+	if _, err := userEntity.GetAccountById(userId); err != nil {
+		return err
+	}
+	if err := userEntity.UpdateStatus(userId, model.UserStatusDeleted); err != nil {
+		return err
+	}
+	s.revokeTokens(userId)
+	return nil
+}
+
+func (s UserService) MfaStatus(ctx context.Context, userId int64, idType int) (bool, error) {
+	mfa, err := model.NewUserMfaModel().GetUserMfa(userId, idType)
+	if err != nil {
+		return false, err
+	}
+	return mfa != nil && mfa.Enabled, nil
+}
+
+func (s UserService) MfaEnroll(ctx context.Context, userId int64, idType int, accountName, issuer string) (string, string, error) {
+	mfaEntity := model.NewUserMfaModel()
+	mfa, err := mfaEntity.GetUserMfa(userId, idType)
+	if err != nil {
+		return "", "", err
+	}
+	if mfa != nil && mfa.Enabled {
+		return "", "", ErrMfaAlreadyEnabled
+	}
+
+	secret, err := generateTotpSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if mfa == nil {
+		err = mfaEntity.CreateUserMfa(&model.UserMfa{UserId: userId, IdType: idType, Secret: secret})
+	} else {
+		// 重新绑定未启用的密钥
+		mfa.Secret, mfa.LastStep = secret, 0
+		err = mfaEntity.UpdateUserMfa(mfa)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totpUri(issuer, accountName, secret), nil
+}
+
+func (s UserService) MfaActivate(ctx context.Context, userId int64, idType int, code string) ([]string, error) {
+	mfaEntity := model.NewUserMfaModel()
+	mfa, err := mfaEntity.GetUserMfa(userId, idType)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrMfaNotEnrolled
+	}
+	if mfa.Enabled {
+		return nil, ErrMfaAlreadyEnabled
+	}
+	step, ok := verifyTotp(mfa.Secret, code, time.Now(), mfa.LastStep)
+	if !ok {
+		return nil, ErrInvalidMfaCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	mfa.Enabled, mfa.RecoveryCodes, mfa.LastStep = true, hashes, step
+	if err := mfaEntity.UpdateUserMfa(mfa); err != nil {
+		return nil, err
+	}
+	return codes, nil
 }
 
-func (s UserService) CreateAdmin(ctx context.Context, username, password string, userId int64, age int) error {
-	userEntity := model.NewAdminUserModel()
-	err := userEntity.CreateUser(&model.AdminUser{
+func (s UserService) MfaVerify(ctx context.Context, userId int64, idType int, code string) error {
+	mfaEntity := model.NewUserMfaModel()
+	mfa, err := mfaEntity.GetUserMfa(userId, idType)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return ErrMfaNotEnrolled
+	}
+
+	if isTotpCode(code) {
+		step, ok := verifyTotp(mfa.Secret, code, time.Now(), mfa.LastStep)
+		if !ok {
+			return ErrInvalidMfaCode
+		}
+		if used, err := mfaEntity.UseStep(userId, idType, step); err != nil {
+			return err
+		} else if !used {
+			return ErrInvalidMfaCode
+		}
+		return nil
+	}
+
+	// 恢复码
+	hash := hashRecoveryCode(code)
+	for i, recoveryCode := range mfa.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recoveryCode), []byte(hash)) == 1 {
+			remaining := append(append([]string{}, mfa.RecoveryCodes[:i]...), mfa.RecoveryCodes[i+1:]...)
+			if used, err := mfaEntity.UpdateRecoveryCodes(userId, idType, mfa.RecoveryCodes, remaining); err != nil {
+				return err
+			} else if !used {
+				return ErrInvalidMfaCode
+			}
+			return nil
+		}
+	}
+	return ErrInvalidMfaCode
+}
+
+func (s UserService) MfaDisable(ctx context.Context, userId int64, idType int, code string) error {
+	if err := s.MfaVerify(ctx, userId, idType, code); err != nil {
+		return err
+	}
+	return model.NewUserMfaModel().DeleteUserMfa(userId, idType)
+}
+
+func (s UserService) Register(ctx context.Context, username, password string, age int, channel, target, ip string) (int64, error) {
+	if s.VerifyCodes == nil {
+		return 0, ErrRegisterDisabled
+	}
+	column, target, err := normalizeContact(channel, target)
+	if err != nil {
+		return 0, err
+	}
+	// 验证码过期后仍未验证的账号不再占用用户名和邮箱/手机号
+	accountEntity := model.NewAccountModel()
+	codeSentAfter := time.Now().Add(-secondsOrDefault(conf.Register.CodeTtlSeconds, 600))
+	if err := accountEntity.DeleteStaleUnverified("user_name", username, codeSentAfter); err != nil {
+		return 0, err
+	}
+	if err := accountEntity.DeleteStaleUnverified(column, target, codeSentAfter); err != nil {
+		return 0, err
+	}
+	if err := s.validateAccount(username, password, model.AccountTypeUser); err != nil {
+		return 0, err
+	}
+	if exists, err := accountEntity.ExistsContact(column, target, codeSentAfter); err != nil {
+		return 0, err
+	} else if exists {
+		return 0, ErrContactExists
+	}
+
+	account := &model.Account{
 		Username: username,
 		Password: password,
-		UserId:   userId,
 		Age:      age,
-	})
-	return err
+		Type:     model.AccountTypeUser,
+		Status:   model.UserStatusUnverified,
+	}
+	if channel == ChannelEmail {
+		account.Email = target
+	} else {
+		account.Phone = target
+	}
+	userId, err := accountEntity.CreateAccount(account)
+	if err != nil {
+		return 0, err
+	}
+	// 先创建账号再发送验证码，超过发送限制或发送失败时删除刚创建的账号
+	if err := s.VerifyCodes.Issue(ctx, channel, target, ip); err != nil {
+		if err := accountEntity.DeleteUnverified(userId); err != nil {
+			log.Printf("Rollback register of [%s] failed, Error: %v", username, err)
+		}
+		return 0, err
+	}
+	return userId, nil
 }
 
-func (s UserService) CheckAdmin(ctx context.Context, username string, password string) (int64, error) {
-	userEntity := model.NewAdminUserModel()
-	res, err := userEntity.CheckUser(username, password) 
+func (s UserService) ResendVerifyCode(ctx context.Context, username, ip string) error {
+	if s.VerifyCodes == nil {
+		return ErrRegisterDisabled
+	}
+	account, channel, target, err := s.verifyingContact(username)
 	if err != nil {
-		log.Printf("UserEntity.CheckUser, err: %v", err)
-		return 0, err
+		return err
+	}
+	if err := s.VerifyCodes.Issue(ctx, channel, target, ip); err != nil {
+		return err
+	}
+	return model.NewAccountModel().UpdateCodeSentAt(account.UserId)
+}
+
+func (s UserService) VerifyAccount(ctx context.Context, username, code string) error {
+	if s.VerifyCodes == nil {
+		return ErrRegisterDisabled
+	}
+	account, channel, target, err := s.verifyingContact(username)
+	if err != nil {
+		return err
+	}
+	if err := s.VerifyCodes.Verify(ctx, channel, target, code); err != nil {
+		return err
+	}
+	return model.NewAccountModel().UpdateStatus(account.UserId, model.UserStatusNormal)
+}
+
+// 未验证账号及其注册时填写的邮箱或手机号
+func (s UserService) verifyingContact(username string) (*model.Account, string, string, error) {
+	account, err := model.NewAccountModel().GetAccountByUsername(username, model.AccountTypeUser)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if account.Status != model.UserStatusUnverified {
+		return nil, "", "", ErrAccountVerified
+	}
+	switch {
+	case account.Email != "":
+		return account, ChannelEmail, account.Email, nil
+	case account.Phone != "":
+		return account, ChannelSms, account.Phone, nil
+	}
+	return nil, "", "", ErrAccountNotVerifying
+}
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	phonePattern = regexp.MustCompile(`^\+?[0-9]{6,15}$`)
+)
+
+// 校验邮箱或手机号，返回account表中对应的列名和规范化后的值，邮箱统一转为小写
+func normalizeContact(channel, target string) (string, string, error) {
+	target = strings.TrimSpace(target)
+	switch channel {
+	case ChannelEmail:
+		target = strings.ToLower(target)
+		if len(target) > 128 || !emailPattern.MatchString(target) {
+			return "", "", ErrInvalidEmail
+		}
+		return "email", target, nil
+	case ChannelSms:
+		if !phonePattern.MatchString(target) {
+			return "", "", ErrInvalidPhone
+		}
+		return "phone", target, nil
+	}
+	return "", "", ErrInvalidChannel
+}
+
+// 密码策略：8到64位，同时包含字母和数字
+func ValidatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+func validateUsername(username string) error {
+	if username == "" || utf8.RuneCountInString(username) > maxUsernameLength {
+		return ErrInvalidUsername
+	}
+	for _, r := range username {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return ErrInvalidUsername
+		}
 	}
-	return res.UserId, nil
+	return nil
 }
 
 // HealthCheck implement Service method
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"final-design/pkg/verifier"
+
+	"github.com/go-redis/redis"
+)
+
+// 吊销用户已签发的令牌，令牌由oauth-service保存在共用的redis中
+type TokenRevoker interface {
+	RevokeUser(userId int64) error
+}
+
+type RedisTokenRevoker struct {
+	conn *redis.Client
+}
+
+func NewRedisTokenRevoker(conn *redis.Client) TokenRevoker {
+	return &RedisTokenRevoker{conn: conn}
+}
+
+func (r *RedisTokenRevoker) RevokeUser(userId int64) error {
+	return verifier.RevokeUserTokens(r.conn, userId)
+}
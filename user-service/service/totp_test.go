@@ -0,0 +1,143 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的测试密钥"12345678901234567890"
+const rfcTotpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCode(t *testing.T) {
+	// RFC 6238 附录B中SHA1的8位结果，取后6位
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			if got := totpCode([]byte("12345678901234567890"), tt.unix/totpPeriod); got != tt.want {
+				t.Errorf("totpCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTotp(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	key := []byte("12345678901234567890")
+	codeAt := func(step int64) string { return totpCode(key, step) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOk   bool
+	}{
+		{"当前时间步", rfcTotpSecret, codeAt(current), 0, current, true},
+		{"上一个时间步", rfcTotpSecret, codeAt(current - 1), 0, current - 1, true},
+		{"下一个时间步", rfcTotpSecret, codeAt(current + 1), 0, current + 1, true},
+		{"超出前偏差", rfcTotpSecret, codeAt(current - 2), 0, 0, false},
+		{"超出后偏差", rfcTotpSecret, codeAt(current + 2), 0, 0, false},
+		{"小写密钥", strings.ToLower(rfcTotpSecret), codeAt(current), 0, current, true},
+		{"重放当前时间步", rfcTotpSecret, codeAt(current), current, 0, false},
+		{"重放更早的时间步", rfcTotpSecret, codeAt(current - 1), current, 0, false},
+		{"使用后仍可用后续时间步", rfcTotpSecret, codeAt(current + 1), current, current + 1, true},
+		{"错误动态码", rfcTotpSecret, "000000", 0, 0, false},
+		{"长度错误", rfcTotpSecret, codeAt(current)[:5], 0, 0, false},
+		{"密钥错误", "not-base32!", codeAt(current), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := verifyTotp(tt.secret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOk || step != tt.wantStep {
+				t.Errorf("verifyTotp() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestIsTotpCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"123456", true},
+		{"000000", true},
+		{"12345", false},
+		{"1234567", false},
+		{"12345a", false},
+		{"abcd-efgh", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := isTotpCode(tt.code); got != tt.want {
+				t.Errorf("isTotpCode(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTotpSecretAndUri(t *testing.T) {
+	secret, err := generateTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := base32NoPadding.DecodeString(secret); err != nil || len(key) != totpSecretSize {
+		t.Fatalf("generateTotpSecret() = %q, decoded %d bytes, err %v", secret, len(key), err)
+	}
+
+	uri, err := url.Parse(totpUri("Seckill Admin", "alice@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Seckill Admin:alice@example.com" {
+		t.Errorf("totpUri() = %s", uri)
+	}
+	if strings.Contains(uri.RawQuery, "+") {
+		t.Errorf("totpUri() query %q contains +", uri.RawQuery)
+	}
+	query := uri.Query()
+	if query.Get("secret") != secret || query.Get("issuer") != "Seckill Admin" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("totpUri() query = %v", query)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("generateRecoveryCodes() returned %d codes, %d hashes", len(codes), len(hashes))
+	}
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 9 || code[4] != '-' {
+			t.Errorf("recovery code %q, want xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+		// 忽略大小写和分隔符
+		for _, input := range []string{code, strings.ToUpper(code), strings.Replace(code, "-", "", 1), strings.Replace(code, "-", " ", 1)} {
+			if hashRecoveryCode(input) != hashes[i] {
+				t.Errorf("hashRecoveryCode(%q) does not match %q", input, code)
+			}
+		}
+	}
+}
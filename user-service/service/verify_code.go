@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	conf "final-design/pkg/config"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	verifyCodePrefix     = "user:verify_code:"     // channel:target -> 验证码的sha256
+	verifyAttemptsPrefix = "user:verify_attempts:" // channel:target -> 已尝试次数
+	verifyCooldownPrefix = "user:verify_cooldown:" // channel:target，存在时不能重新发送
+	verifyDailyPrefix    = "user:verify_daily:"    // channel:target -> 当天发送次数
+	verifyDailyIpPrefix  = "user:verify_daily_ip:" // ip -> 当天发送次数
+
+	verifyCodeDigits = 6
+)
+
+var (
+	ErrVerifyCodeTooFrequent = errors.New("验证码发送过于频繁，请稍后再试")
+	ErrVerifyCodeLimit       = errors.New("今日验证码发送次数已达上限")
+	ErrVerifyCodeExpired     = errors.New("验证码已过期，请重新获取")
+	ErrInvalidVerifyCode     = errors.New("验证码错误")
+)
+
+// 注册验证码的签发和校验，验证码按邮箱/手机号保存，同一目标只有最后一次发送的验证码有效
+type VerifyCodeService interface {
+	// 生成并发送验证码，超过发送频率或次数限制时返回错误
+	Issue(ctx context.Context, channel, target, ip string) error
+	// 校验验证码，成功后验证码失效；尝试次数超过上限时验证码同样失效
+	Verify(ctx context.Context, channel, target, code string) error
+}
+
+type RedisVerifyCodeService struct {
+	conn   *redis.Client
+	sender CodeSender
+}
+
+func NewRedisVerifyCodeService(conn *redis.Client, sender CodeSender) VerifyCodeService {
+	return &RedisVerifyCodeService{conn: conn, sender: sender}
+}
+
+func verifyTargetKey(channel, target string) string {
+	return fmt.Sprintf("%s:%s", channel, target)
+}
+
+func (s *RedisVerifyCodeService) Issue(ctx context.Context, channel, target, ip string) error {
+	registerConf := conf.Register
+	key := verifyTargetKey(channel, target)
+
+	// 先检查IP的发送次数，超过限制的IP不能占用目标的发送间隔和次数
+	if ip != "" {
+		if err := s.countDaily(verifyDailyIpPrefix+ip, registerConf.MaxCodesPerIp); err != nil {
+			return err
+		}
+	}
+	// 发送间隔，SETNX成功才允许发送
+	ok, err := s.conn.SetNX(verifyCooldownPrefix+key, time.Now().Unix(),
+		secondsOrDefault(registerConf.ResendIntervalSeconds, 60)).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVerifyCodeTooFrequent
+	}
+	if err := s.countDaily(verifyDailyPrefix+key, registerConf.MaxCodesPerTarget); err != nil {
+		return err
+	}
+
+	code, err := generateVerifyCode()
+	if err != nil {
+		return err
+	}
+	ttl := secondsOrDefault(registerConf.CodeTtlSeconds, 600)
+	pipe := s.conn.TxPipeline()
+	pipe.Set(verifyCodePrefix+key, hashVerifyCode(code), ttl)
+	pipe.Del(verifyAttemptsPrefix + key)
+	if _, err := pipe.Exec(); err != nil {
+		return err
+	}
+	if err := s.sender.Send(ctx, channel, target, code); err != nil {
+		// 发送失败时允许立即重试
+		s.conn.Del(verifyCodePrefix+key, verifyCooldownPrefix+key)
+		log.Printf("Send verify code failed, channel: %s, Error: %v", channel, err)
+		return err
+	}
+	return nil
+}
+
+func (s *RedisVerifyCodeService) Verify(ctx context.Context, channel, target, code string) error {
+	key := verifyTargetKey(channel, target)
+	hash, err := s.conn.Get(verifyCodePrefix + key).Result()
+	if err == redis.Nil {
+		return ErrVerifyCodeExpired
+	} else if err != nil {
+		return err
+	}
+
+	maxAttempts := conf.Register.MaxVerifyAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	pipe := s.conn.TxPipeline()
+	attempts := pipe.Incr(verifyAttemptsPrefix + key)
+	pipe.Expire(verifyAttemptsPrefix+key, secondsOrDefault(conf.Register.CodeTtlSeconds, 600))
+	if _, err := pipe.Exec(); err != nil {
+		return err
+	}
+	if attempts.Val() > int64(maxAttempts) {
+		s.conn.Del(verifyCodePrefix+key, verifyAttemptsPrefix+key)
+		return ErrVerifyCodeExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashVerifyCode(code))) != 1 {
+		return ErrInvalidVerifyCode
+	}
+	s.conn.Del(verifyCodePrefix+key, verifyAttemptsPrefix+key)
+	return nil
+}
+
+// 当天发送次数加一，超过上限时返回ErrVerifyCodeLimit；limit为0表示不限制
+func (s *RedisVerifyCodeService) countDaily(key string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	count, err := s.conn.Incr(key).Result()
+	if err != nil {
+		return err
+	}
+	if count == 1 {
+		s.conn.Expire(key, 24*time.Hour)
+	}
+	if count > int64(limit) {
+		return ErrVerifyCodeLimit
+	}
+	return nil
+}
+
+func secondsOrDefault(seconds, defaultSeconds int) time.Duration {
+	if seconds <= 0 {
+		seconds = defaultSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// 生成6位数字验证码
+func generateVerifyCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", verifyCodeDigits, n.Int64()), nil
+}
+
+func hashVerifyCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	conf "final-design/pkg/config"
+	"final-design/pkg/redistest"
+	"testing"
+	"time"
+)
+
+// 记录最后一次发送的验证码，err不为nil时发送失败
+type recordSender struct {
+	codes map[string]string
+	err   error
+}
+
+func (s *recordSender) Send(_ context.Context, channel, target, code string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.codes[verifyTargetKey(channel, target)] = code
+	return nil
+}
+
+func setRegisterConf(t *testing.T, registerConf conf.RegisterConf) {
+	old := conf.Register
+	conf.Register = registerConf
+	t.Cleanup(func() { conf.Register = old })
+}
+
+func TestVerifyCodeIssueLimits(t *testing.T) {
+	type step struct {
+		target  string
+		ip      string
+		wait    time.Duration // 发送前经过的时间
+		wantErr error
+	}
+	tests := []struct {
+		name  string
+		conf  conf.RegisterConf
+		steps []step
+	}{
+		{"发送间隔内不能重发", conf.RegisterConf{ResendIntervalSeconds: 60}, []step{
+			{"a@example.com", "10.0.0.1", 0, nil},
+			{"a@example.com", "10.0.0.2", 30 * time.Second, ErrVerifyCodeTooFrequent},
+			{"a@example.com", "10.0.0.2", 31 * time.Second, nil},
+		}},
+		{"同一目标每天的发送次数", conf.RegisterConf{ResendIntervalSeconds: 60, MaxCodesPerTarget: 2}, []step{
+			{"a@example.com", "10.0.0.1", 0, nil},
+			{"a@example.com", "10.0.0.1", time.Minute, nil},
+			{"a@example.com", "10.0.0.1", time.Minute, ErrVerifyCodeLimit},
+			{"b@example.com", "10.0.0.1", 0, nil},
+		}},
+		{"IP超过限制时不占用目标的发送间隔和次数", conf.RegisterConf{ResendIntervalSeconds: 60, MaxCodesPerTarget: 1, MaxCodesPerIp: 1}, []step{
+			{"a@example.com", "10.0.0.1", 0, nil},
+			{"b@example.com", "10.0.0.1", 0, ErrVerifyCodeLimit},
+			{"b@example.com", "10.0.0.2", 0, nil},
+		}},
+		{"IP的发送次数过一天后重置", conf.RegisterConf{ResendIntervalSeconds: 60, MaxCodesPerIp: 1}, []step{
+			{"a@example.com", "10.0.0.1", 0, nil},
+			{"b@example.com", "10.0.0.1", 0, ErrVerifyCodeLimit},
+			{"b@example.com", "10.0.0.1", 24 * time.Hour, nil},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRegisterConf(t, tt.conf)
+			conn, mr := redistest.New(t)
+			sender := &recordSender{codes: map[string]string{}}
+			verifyCodes := NewRedisVerifyCodeService(conn, sender)
+			for i, s := range tt.steps {
+				mr.FastForward(s.wait)
+				if err := verifyCodes.Issue(context.Background(), ChannelEmail, s.target, s.ip); err != s.wantErr {
+					t.Fatalf("step %d: Issue() error = %v, want %v", i, err, s.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCodeSendFailure(t *testing.T) {
+	setRegisterConf(t, conf.RegisterConf{ResendIntervalSeconds: 60})
+	conn, _ := redistest.New(t)
+	sender := &recordSender{codes: map[string]string{}, err: errors.New("smtp unavailable")}
+	verifyCodes := NewRedisVerifyCodeService(conn, sender)
+
+	if err := verifyCodes.Issue(context.Background(), ChannelEmail, "a@example.com", ""); err != sender.err {
+		t.Fatalf("Issue() error = %v, want %v", err, sender.err)
+	}
+	if err := verifyCodes.Verify(context.Background(), ChannelEmail, "a@example.com", "000000"); err != ErrVerifyCodeExpired {
+		t.Errorf("Verify() after failed send error = %v, want %v", err, ErrVerifyCodeExpired)
+	}
+	// 发送失败时不占用发送间隔
+	sender.err = nil
+	if err := verifyCodes.Issue(context.Background(), ChannelEmail, "a@example.com", ""); err != nil {
+		t.Errorf("retry Issue() error = %v", err)
+	}
+}
+
+func TestVerifyCodeVerify(t *testing.T) {
+	setRegisterConf(t, conf.RegisterConf{CodeTtlSeconds: 600, MaxVerifyAttempts: 3})
+	const target = "a@example.com"
+	tests := []struct {
+		name  string
+		codes func(code string) []string // 依次提交的验证码
+		wait  time.Duration              // 发送后经过的时间
+		want  []error
+	}{
+		{"正确的验证码只能使用一次", func(code string) []string { return []string{code, code} }, 0,
+			[]error{nil, ErrVerifyCodeExpired}},
+		{"错误后仍可使用正确的验证码", func(code string) []string { return []string{wrongCode(code), code} }, 0,
+			[]error{ErrInvalidVerifyCode, nil}},
+		{"超过尝试次数后验证码失效", func(code string) []string {
+			return []string{wrongCode(code), wrongCode(code), wrongCode(code), code}
+		}, 0, []error{ErrInvalidVerifyCode, ErrInvalidVerifyCode, ErrInvalidVerifyCode, ErrVerifyCodeExpired}},
+		{"验证码过期", func(code string) []string { return []string{code} }, 601 * time.Second,
+			[]error{ErrVerifyCodeExpired}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, mr := redistest.New(t)
+			sender := &recordSender{codes: map[string]string{}}
+			verifyCodes := NewRedisVerifyCodeService(conn, sender)
+			if err := verifyCodes.Issue(context.Background(), ChannelEmail, target, ""); err != nil {
+				t.Fatal(err)
+			}
+			mr.FastForward(tt.wait)
+			code := sender.codes[verifyTargetKey(ChannelEmail, target)]
+			for i, submitted := range tt.codes(code) {
+				if err := verifyCodes.Verify(context.Background(), ChannelEmail, target, submitted); err != tt.want[i] {
+					t.Errorf("attempt %d: Verify() error = %v, want %v", i, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// 与code不同的6位验证码
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
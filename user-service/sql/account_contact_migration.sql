@@ -0,0 +1,15 @@
+-- 自助注册：account表增加邮箱和手机号，未绑定时为NULL，绑定后在已验证的账号中唯一；
+-- status增加3(未验证)，自助注册的账号验证邮箱或手机号之前不能登录。已有账号不受影响。
+-- 未验证的账号不受唯一索引约束，code_sent_at为最近一次发送验证码的时间，
+-- 验证码过期后仍未验证的账号在其他人使用相同的用户名、邮箱或手机号注册时被删除。
+
+ALTER TABLE account
+    ADD COLUMN email          VARCHAR(128) NULL,
+    ADD COLUMN phone          VARCHAR(32)  NULL,
+    ADD COLUMN code_sent_at   DATETIME     NULL,
+    ADD COLUMN verified_email VARCHAR(128) AS (IF(status = 3, NULL, email)) STORED,
+    ADD COLUMN verified_phone VARCHAR(32)  AS (IF(status = 3, NULL, phone)) STORED,
+    ADD KEY idx_account_email (email),
+    ADD KEY idx_account_phone (phone),
+    ADD UNIQUE KEY uk_account_email (verified_email),
+    ADD UNIQUE KEY uk_account_phone (verified_phone);
@@ -0,0 +1,32 @@
+-- 合并user表和admin_user表为account表
+-- 普通用户保留原id，sk-app中的订单等数据不受影响；管理员的id加上1000000000000，避免与普通用户冲突，
+-- 同时修改user_role和user_mfa中管理员的id。新账号的id由雪花算法生成，远大于以上两个范围。
+-- 执行前先停止user-service和oauth-service，执行后已签发的管理员令牌中的user_id失效，需要重新登录。
+
+CREATE TABLE account (
+    user_id   BIGINT       NOT NULL,
+    user_name VARCHAR(64)  NOT NULL,
+    password  VARCHAR(255) NOT NULL,
+    age       INT          NOT NULL DEFAULT 0,
+    id_type   TINYINT      NOT NULL DEFAULT 0, -- 0普通用户、1管理员
+    status    TINYINT      NOT NULL DEFAULT 0, -- 0正常、1禁用、2删除
+    PRIMARY KEY (user_id),
+    UNIQUE KEY uk_account_type_name (id_type, user_name)
+);
+
+START TRANSACTION;
+
+INSERT INTO account (user_id, user_name, password, age, id_type, status)
+SELECT user_id, user_name, password, age, 0, status FROM user;
+
+INSERT INTO account (user_id, user_name, password, age, id_type, status)
+SELECT user_id + 1000000000000, user_name, password, age, 1, 0 FROM admin_user;
+
+UPDATE user_role SET user_id = user_id + 1000000000000 WHERE id_type = 1;
+UPDATE user_mfa SET user_id = user_id + 1000000000000 WHERE id_type = 1;
+
+COMMIT;
+
+-- 确认数据无误后再删除旧表
+-- DROP TABLE user;
+-- DROP TABLE admin_user;
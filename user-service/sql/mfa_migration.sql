@@ -0,0 +1,11 @@
+-- 两步验证：每个账号一条记录，验证过一次动态码后enabled为1
+
+CREATE TABLE user_mfa (
+    user_id        BIGINT      NOT NULL,
+    id_type        TINYINT     NOT NULL,           -- 0普通用户、1管理员
+    secret         VARCHAR(64) NOT NULL,           -- base32编码的TOTP密钥
+    enabled        TINYINT     NOT NULL DEFAULT 0,
+    recovery_codes TEXT,                           -- 未使用的恢复码sha256的json数组
+    last_step      BIGINT      NOT NULL DEFAULT 0, -- 最近一次使用的TOTP时间步，防止动态码重放
+    PRIMARY KEY (user_id, id_type)
+);
@@ -0,0 +1,36 @@
+-- 角色和权限：令牌中的UserDetails.Authorities由用户的角色和角色具有的权限组成
+-- 普通用户默认具有ROLE_USER、管理员默认具有ROLE_ADMIN，不需要写入user_role；其它角色通过user_role分配
+
+CREATE TABLE role (
+    role_id     BIGINT       NOT NULL AUTO_INCREMENT,
+    role_name   VARCHAR(64)  NOT NULL, -- 以ROLE_开头，如ROLE_ADMIN
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (role_id),
+    UNIQUE KEY uk_role_name (role_name)
+);
+
+CREATE TABLE permission (
+    permission_id   BIGINT       NOT NULL AUTO_INCREMENT,
+    permission_name VARCHAR(64)  NOT NULL, -- 如order.read
+    description     VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (permission_id),
+    UNIQUE KEY uk_permission_name (permission_name)
+);
+
+CREATE TABLE role_permission (
+    role_id       BIGINT NOT NULL,
+    permission_id BIGINT NOT NULL,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_role (
+    user_id BIGINT  NOT NULL,
+    id_type TINYINT NOT NULL, -- 0普通用户、1管理员
+    role_id BIGINT  NOT NULL,
+    PRIMARY KEY (user_id, id_type, role_id)
+);
+
+-- 默认角色，给默认角色分配权限后所有该类型的账号都具有这些权限
+INSERT INTO role (role_name, description) VALUES
+    ('ROLE_USER', '普通用户'),
+    ('ROLE_ADMIN', '管理员');
@@ -0,0 +1,4 @@
+-- 用户状态：禁用的用户不能登录和刷新令牌，删除为软删除，已删除用户的用户名仍被占用
+-- 在合并为account表(account_migration.sql)之前执行
+
+ALTER TABLE user ADD COLUMN status TINYINT NOT NULL DEFAULT 0; -- 0正常、1禁用、2删除
@@ -10,9 +10,22 @@ import (
 )
 
 type grpcServer struct {
-	check      grpc.Handler
-	create     grpc.Handler
-	adminCheck grpc.Handler
+	check       grpc.Handler
+	create      grpc.Handler
+	adminCheck  grpc.Handler
+	authorities grpc.Handler
+
+	getUser        grpc.Handler
+	updateUser     grpc.Handler
+	changePassword grpc.Handler
+	disableUser    grpc.Handler
+	deleteUser     grpc.Handler
+
+	mfaStatus   grpc.Handler
+	mfaEnroll   grpc.Handler
+	mfaActivate grpc.Handler
+	mfaVerify   grpc.Handler
+	mfaDisable  grpc.Handler
 }
 
 func (s *grpcServer) Check(ctx context.Context, r *pb.UserRequest) (*pb.UserResponse, error) {
@@ -39,6 +52,94 @@ func (s *grpcServer) Create(ctx context.Context, r *pb.CreateUserRequest) (*pb.C
 	return resp.(*pb.CreateUserResponse), nil
 }
 
+func (s *grpcServer) Authorities(ctx context.Context, r *pb.AuthoritiesRequest) (*pb.AuthoritiesResponse, error) {
+	_, resp, err := s.authorities.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.AuthoritiesResponse), nil
+}
+
+func (s *grpcServer) GetUser(ctx context.Context, r *pb.UserIdRequest) (*pb.GetUserResponse, error) {
+	_, resp, err := s.getUser.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetUserResponse), nil
+}
+
+func (s *grpcServer) UpdateUser(ctx context.Context, r *pb.UpdateUserRequest) (*pb.UserOperationResponse, error) {
+	_, resp, err := s.updateUser.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.UserOperationResponse), nil
+}
+
+func (s *grpcServer) ChangePassword(ctx context.Context, r *pb.ChangePasswordRequest) (*pb.UserOperationResponse, error) {
+	_, resp, err := s.changePassword.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.UserOperationResponse), nil
+}
+
+func (s *grpcServer) DisableUser(ctx context.Context, r *pb.DisableUserRequest) (*pb.UserOperationResponse, error) {
+	_, resp, err := s.disableUser.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.UserOperationResponse), nil
+}
+
+func (s *grpcServer) DeleteUser(ctx context.Context, r *pb.UserIdRequest) (*pb.UserOperationResponse, error) {
+	_, resp, err := s.deleteUser.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.UserOperationResponse), nil
+}
+
+func (s *grpcServer) MfaStatus(ctx context.Context, r *pb.MfaRequest) (*pb.MfaStatusResponse, error) {
+	_, resp, err := s.mfaStatus.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.MfaStatusResponse), nil
+}
+
+func (s *grpcServer) MfaEnroll(ctx context.Context, r *pb.MfaEnrollRequest) (*pb.MfaEnrollResponse, error) {
+	_, resp, err := s.mfaEnroll.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.MfaEnrollResponse), nil
+}
+
+func (s *grpcServer) MfaActivate(ctx context.Context, r *pb.MfaCodeRequest) (*pb.MfaActivateResponse, error) {
+	_, resp, err := s.mfaActivate.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.MfaActivateResponse), nil
+}
+
+func (s *grpcServer) MfaVerify(ctx context.Context, r *pb.MfaCodeRequest) (*pb.UserOperationResponse, error) {
+	_, resp, err := s.mfaVerify.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.UserOperationResponse), nil
+}
+
+func (s *grpcServer) MfaDisable(ctx context.Context, r *pb.MfaCodeRequest) (*pb.UserOperationResponse, error) {
+	_, resp, err := s.mfaDisable.ServeGRPC(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.UserOperationResponse), nil
+}
+
 func NewGRPCServer(ctx context.Context, endpoints endpts.UserEndpoints, serverTracer grpc.ServerOption) pb.UserServiceServer {
 	return &grpcServer{
 		check: grpc.NewServer(
@@ -59,5 +160,71 @@ func NewGRPCServer(ctx context.Context, endpoints endpts.UserEndpoints, serverTr
 			EncodeGRPCUserResponse,
 			serverTracer,
 		),
+		authorities: grpc.NewServer(
+			endpoints.AuthoritiesEndpoint,
+			DecodeGRPCAuthoritiesRequest,
+			EncodeGRPCAuthoritiesResponse,
+			serverTracer,
+		),
+		getUser: grpc.NewServer(
+			endpoints.GetUserEndpoint,
+			DecodeGRPCUserIdRequest,
+			EncodeGRPCGetUserResponse,
+			serverTracer,
+		),
+		updateUser: grpc.NewServer(
+			endpoints.UpdateUserEndpoint,
+			DecodeGRPCUpdateUserRequest,
+			EncodeGRPCUserOperationResponse,
+			serverTracer,
+		),
+		changePassword: grpc.NewServer(
+			endpoints.ChangePasswordEndpoint,
+			DecodeGRPCChangePasswordRequest,
+			EncodeGRPCUserOperationResponse,
+			serverTracer,
+		),
+		disableUser: grpc.NewServer(
+			endpoints.DisableUserEndpoint,
+			DecodeGRPCDisableUserRequest,
+			EncodeGRPCUserOperationResponse,
+			serverTracer,
+		),
+		deleteUser: grpc.NewServer(
+			endpoints.DeleteUserEndpoint,
+			DecodeGRPCUserIdRequest,
+			EncodeGRPCUserOperationResponse,
+			serverTracer,
+		),
+		mfaStatus: grpc.NewServer(
+			endpoints.MfaStatusEndpoint,
+			DecodeGRPCMfaRequest,
+			EncodeGRPCMfaStatusResponse,
+			serverTracer,
+		),
+		mfaEnroll: grpc.NewServer(
+			endpoints.MfaEnrollEndpoint,
+			DecodeGRPCMfaEnrollRequest,
+			EncodeGRPCMfaEnrollResponse,
+			serverTracer,
+		),
+		mfaActivate: grpc.NewServer(
+			endpoints.MfaActivateEndpoint,
+			DecodeGRPCMfaCodeRequest,
+			EncodeGRPCMfaActivateResponse,
+			serverTracer,
+		),
+		mfaVerify: grpc.NewServer(
+			endpoints.MfaVerifyEndpoint,
+			DecodeGRPCMfaCodeRequest,
+			EncodeGRPCUserOperationResponse,
+			serverTracer,
+		),
+		mfaDisable: grpc.NewServer(
+			endpoints.MfaDisableEndpoint,
+			DecodeGRPCMfaCodeRequest,
+			EncodeGRPCUserOperationResponse,
+			serverTracer,
+		),
 	}
 }
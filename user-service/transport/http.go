@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"final-design/pkg/common"
+	"final-design/pkg/verifier"
 	endpts "final-design/user-service/endpoint"
 	"net/http"
+	"strconv"
 
 	"github.com/go-kit/kit/tracing/zipkin"
 	"github.com/go-kit/kit/transport"
@@ -21,7 +24,8 @@ var (
 )
 
 // MakeHttpHandler make http handler use mux
-func MakeHttpHandler(ctx context.Context, endpoints endpts.UserEndpoints, zipkinTracer *gozipkin.Tracer, logger log.Logger) http.Handler {
+func MakeHttpHandler(ctx context.Context, endpoints endpts.UserEndpoints, tokenVerifier verifier.TokenVerifier,
+	zipkinTracer *gozipkin.Tracer, logger log.Logger) http.Handler {
 	r := mux.NewRouter()
 	zipkinSever := zipkin.HTTPServerTrace(zipkinTracer, zipkin.Name("http-transport"))
 
@@ -32,13 +36,8 @@ func MakeHttpHandler(ctx context.Context, endpoints endpts.UserEndpoints, zipkin
 		kithttp.ServerErrorEncoder(encodeError),
 		zipkinSever,
 	}
-	// ===============================普通用户注册和检查=======================================================
-	r.Methods("POST").Path("/user/create").Handler(kithttp.NewServer(
-		endpoints.CreateUserEndpoint,
-		decodeCreateUserRequest,
-		encodeUserResponse,
-		options...,
-	))
+	// ===============================普通用户检查=======================================================
+	// 普通用户通过自助注册创建，管理员通过/user/manage/create直接创建
 	r.Methods("POST").Path("/user/check").Handler(kithttp.NewServer(
 		endpoints.UserEndpoint,
 		decodeUserRequest,
@@ -46,13 +45,27 @@ func MakeHttpHandler(ctx context.Context, endpoints endpts.UserEndpoints, zipkin
 		options...,
 	))
 
-	// ==============================Admin用户注册和检查=======================================================
-	r.Methods("POST").Path("/user/admin/create").Handler(kithttp.NewServer(
-		endpoints.CreateAdminUserEndpoint,
-		decodeCreateAdminUserRequest,
+	// ==============================自助注册，验证邮箱或手机号后才能登录==================================
+	r.Methods("POST").Path("/user/register").Handler(kithttp.NewServer(
+		endpoints.RegisterEndpoint,
+		decodeRegisterRequest,
+		encodeUserResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/user/register/resend").Handler(kithttp.NewServer(
+		endpoints.ResendVerifyCodeEndpoint,
+		decodeResendVerifyCodeRequest,
 		encodeUserResponse,
 		options...,
 	))
+	r.Methods("POST").Path("/user/register/verify").Handler(kithttp.NewServer(
+		endpoints.VerifyAccountEndpoint,
+		decodeVerifyAccountRequest,
+		encodeUserResponse,
+		options...,
+	))
+
+	// ==============================Admin用户检查=======================================================
 	r.Methods("POST").Path("/user/admin/check").Handler(kithttp.NewServer(
 		endpoints.AdminUserEndpoint,
 		decodeAdminUserRequest,
@@ -60,6 +73,63 @@ func MakeHttpHandler(ctx context.Context, endpoints endpts.UserEndpoints, zipkin
 		options...,
 	))
 
+	// ==============================账号管理=============================================================
+	// 请求头Authorization中携带访问令牌，用户操作自己的账号，管理员可以操作任意用户
+	oauth2Options := []kithttp.ServerOption{
+		kithttp.ServerBefore(verifier.HttpTokenContext(tokenVerifier)),
+		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorEncoder(encodeError),
+		zipkinSever,
+	}
+	r.Methods("GET").Path("/user/profile").Handler(kithttp.NewServer(
+		endpoints.ProfileEndpoint,
+		decodeProfileRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+	r.Methods("POST").Path("/user/profile/update").Handler(kithttp.NewServer(
+		endpoints.UpdateProfileEndpoint,
+		decodeUpdateProfileRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+	r.Methods("POST").Path("/user/profile/password").Handler(kithttp.NewServer(
+		endpoints.ChangeProfilePasswordEndpoint,
+		decodeChangeProfilePasswordRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+	r.Methods("POST").Path("/user/manage/create").Handler(kithttp.NewServer(
+		endpoints.ManageCreateUserEndpoint,
+		decodeCreateUserRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+	r.Methods("POST").Path("/user/manage/admin/create").Handler(kithttp.NewServer(
+		endpoints.ManageCreateAdminUserEndpoint,
+		decodeCreateAdminUserRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+	r.Methods("GET").Path("/user/manage/get").Handler(kithttp.NewServer(
+		endpoints.ManageGetUserEndpoint,
+		decodeUserIdRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+	r.Methods("POST").Path("/user/manage/disable").Handler(kithttp.NewServer(
+		endpoints.ManageDisableUserEndpoint,
+		decodeDisableUserRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+	r.Methods("POST").Path("/user/manage/delete").Handler(kithttp.NewServer(
+		endpoints.ManageDeleteUserEndpoint,
+		decodeUserIdRequest,
+		encodeUserResponse,
+		oauth2Options...,
+	))
+
 	// =================================健康检查============================================================
 	r.Path("/metrics").Handler(promhttp.Handler())
 
@@ -109,10 +179,87 @@ func decodeCreateAdminUserRequest(_ context.Context, r *http.Request) (interface
 	return createUserRequest, nil
 }
 
+func decodeProfileRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return endpts.UserIdRequest{UserId: verifier.UserIdFromContext(ctx)}, nil
+}
+
+func decodeUpdateProfileRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var updateUserRequest endpts.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&updateUserRequest); err != nil {
+		return nil, ErrBadRequest
+	}
+	updateUserRequest.UserId = verifier.UserIdFromContext(ctx)
+	return updateUserRequest, nil
+}
+
+func decodeChangeProfilePasswordRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var changePasswordRequest endpts.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&changePasswordRequest); err != nil {
+		return nil, ErrBadRequest
+	}
+	changePasswordRequest.UserId = verifier.UserIdFromContext(ctx)
+	return changePasswordRequest, nil
+}
+
+func decodeUserIdRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userId, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	return endpts.UserIdRequest{UserId: userId}, nil
+}
+
+// disabled默认为true，disabled=false时重新启用
+func decodeDisableUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userId, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		return nil, ErrBadRequest
+	}
+	disabled := true
+	if value := r.URL.Query().Get("disabled"); value != "" {
+		if disabled, err = strconv.ParseBool(value); err != nil {
+			return nil, ErrBadRequest
+		}
+	}
+	return endpts.DisableUserRequest{UserId: userId, Disabled: disabled}, nil
+}
+
+func decodeRegisterRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var registerRequest endpts.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&registerRequest); err != nil {
+		return nil, ErrBadRequest
+	}
+	registerRequest.Ip = common.ClientIp(r)
+	return registerRequest, nil
+}
+
+func decodeResendVerifyCodeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var resendRequest endpts.ResendVerifyCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&resendRequest); err != nil {
+		return nil, ErrBadRequest
+	}
+	resendRequest.Ip = common.ClientIp(r)
+	return resendRequest, nil
+}
+
+func decodeVerifyAccountRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var verifyRequest endpts.VerifyAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyRequest); err != nil {
+		return nil, ErrBadRequest
+	}
+	return verifyRequest, nil
+}
+
 // encode errors from bussiness-logic
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	switch err {
+	case verifier.ErrUnauthorized:
+		w.WriteHeader(http.StatusUnauthorized)
+	case verifier.ErrNotPermit:
+		w.WriteHeader(http.StatusForbidden)
+	case ErrBadRequest:
+		w.WriteHeader(http.StatusBadRequest)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -56,7 +56,6 @@ func DecodeGRPCCreateUserRequest(ctx context.Context, r interface{}) (interface{
 	return endpoint.CreateUserRequest{
 		Username: req.Username,
 		Password: req.Password,
-		UserId:   req.UserId,
 		Age:      int(req.Age),
 	}, nil
 }
@@ -65,12 +64,135 @@ func EncodeGRPCCreateUserResponse(ctx context.Context, r interface{}) (interface
 	if resp.Error != nil {
 		return &pb.CreateUserResponse{
 			Result: resp.Result,
-			Err:    "error",
+			Err:    resp.Error.Error(),
 		}, nil
 	}
 
 	return &pb.CreateUserResponse{
 		Result: resp.Result,
+		UserId: resp.UserId,
 		Err:    "",
 	}, nil
 }
+
+// =============================================Authorities编、解码=======================================================
+
+func DecodeGRPCAuthoritiesRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.AuthoritiesRequest)
+	return endpoint.AuthoritiesRequest{
+		UserId: req.UserId,
+		IdType: int(req.IdType),
+	}, nil
+}
+func EncodeGRPCAuthoritiesResponse(ctx context.Context, r interface{}) (interface{}, error) {
+	resp := r.(endpoint.AuthoritiesResponse)
+	if resp.Error != nil {
+		return &pb.AuthoritiesResponse{
+			Err: resp.Error.Error(),
+		}, nil
+	}
+
+	return &pb.AuthoritiesResponse{
+		Authorities: resp.Authorities,
+		Err:         "",
+	}, nil
+}
+
+// =============================================账号管理编、解码=======================================================
+
+func DecodeGRPCUserIdRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.UserIdRequest)
+	return endpoint.UserIdRequest{
+		UserId: req.UserId,
+	}, nil
+}
+func DecodeGRPCUpdateUserRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.UpdateUserRequest)
+	return endpoint.UpdateUserRequest{
+		UserId:   req.UserId,
+		Username: req.Username,
+		Age:      int(req.Age),
+	}, nil
+}
+func DecodeGRPCChangePasswordRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.ChangePasswordRequest)
+	return endpoint.ChangePasswordRequest{
+		UserId:      req.UserId,
+		OldPassword: req.OldPassword,
+		NewPassword: req.NewPassword,
+	}, nil
+}
+func DecodeGRPCDisableUserRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.DisableUserRequest)
+	return endpoint.DisableUserRequest{
+		UserId:   req.UserId,
+		Disabled: req.Disabled,
+	}, nil
+}
+func EncodeGRPCGetUserResponse(ctx context.Context, r interface{}) (interface{}, error) {
+	resp := r.(endpoint.GetUserResponse)
+	return &pb.GetUserResponse{
+		UserId:   resp.UserId,
+		Username: resp.Username,
+		Age:      int32(resp.Age),
+		IdType:   int32(resp.IdType),
+		Status:   int32(resp.Status),
+		Err:      resp.Error,
+	}, nil
+}
+func EncodeGRPCUserOperationResponse(ctx context.Context, r interface{}) (interface{}, error) {
+	resp := r.(endpoint.UserOperationResponse)
+	return &pb.UserOperationResponse{
+		Result: resp.Result,
+		Err:    resp.Error,
+	}, nil
+}
+
+// =============================================两步验证编、解码=======================================================
+
+func DecodeGRPCMfaRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.MfaRequest)
+	return endpoint.MfaRequest{
+		UserId: req.UserId,
+		IdType: int(req.IdType),
+	}, nil
+}
+func DecodeGRPCMfaEnrollRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.MfaEnrollRequest)
+	return endpoint.MfaEnrollRequest{
+		UserId:      req.UserId,
+		IdType:      int(req.IdType),
+		AccountName: req.AccountName,
+		Issuer:      req.Issuer,
+	}, nil
+}
+func DecodeGRPCMfaCodeRequest(ctx context.Context, r interface{}) (interface{}, error) {
+	req := r.(*pb.MfaCodeRequest)
+	return endpoint.MfaCodeRequest{
+		UserId: req.UserId,
+		IdType: int(req.IdType),
+		Code:   req.Code,
+	}, nil
+}
+func EncodeGRPCMfaStatusResponse(ctx context.Context, r interface{}) (interface{}, error) {
+	resp := r.(endpoint.MfaStatusResponse)
+	return &pb.MfaStatusResponse{
+		Enabled: resp.Enabled,
+		Err:     resp.Error,
+	}, nil
+}
+func EncodeGRPCMfaEnrollResponse(ctx context.Context, r interface{}) (interface{}, error) {
+	resp := r.(endpoint.MfaEnrollResponse)
+	return &pb.MfaEnrollResponse{
+		Secret: resp.Secret,
+		Uri:    resp.Uri,
+		Err:    resp.Error,
+	}, nil
+}
+func EncodeGRPCMfaActivateResponse(ctx context.Context, r interface{}) (interface{}, error) {
+	resp := r.(endpoint.MfaActivateResponse)
+	return &pb.MfaActivateResponse{
+		RecoveryCodes: resp.RecoveryCodes,
+		Err:           resp.Error,
+	}, nil
+}